@@ -1,7 +1,6 @@
 package red
 
 import (
-	"container/list"
 	"errors"
 	"fmt"
 	"regexp"
@@ -11,6 +10,7 @@ import (
 
 // identifiers, used e.g. in addressPart
 const (
+	identByteOffset    string = "&" // followed by a number: the line containing that byte offset
 	identComma         string = ","
 	identDec           string = "-"
 	identDot           string = "."
@@ -18,6 +18,7 @@ const (
 	identInc           string = "+"
 	identMark          string = "'"
 	identNotSpecified  string = "XXX" // if an address is not specified ...
+	identPercent       string = "%"   // (only as an address range) the whole buffer, equivalent to ','
 	identRegexBackward string = "?"
 	identRegexForward  string = "/"
 	identSemicolon     string = ";"
@@ -33,11 +34,12 @@ const (
 )
 
 /*
-addressPart is the parsed version of one capture group in the address-RE.
+addressPart is one part of an address, as parsed by the commandParser (e.g. a line number, a mark or a regex).
 */
 type addressPart struct {
-	addrIdent string // see constant strings ident*
-	info      string // set for e.g. mark, regex, signednum
+	addrIdent  string // see constant strings ident*
+	info       string // set for e.g. mark, regex, signednum
+	ignoreCase bool   // regex only: match case-insensitively (suffix 'I')
 }
 
 /*
@@ -50,10 +52,14 @@ type Address struct {
 	internal []addressPart // stores the address as parsed
 }
 
-// AddressError records an address error.
+/*
+AddressError records an address error.
+ errors.Is reports whether it is of the given kind, e.g. ErrAddressOutOfRange.
+*/
 type AddressError struct {
-	Msg string
-	Err error
+	Msg  string
+	Err  error
+	Kind error // the kind of error, e.g. ErrAddressOutOfRange or ErrInvalidDestination
 }
 
 func (e *AddressError) Error() string {
@@ -66,39 +72,29 @@ func (e *AddressError) Error() string {
 
 func (e *AddressError) Unwrap() error { return e.Err }
 
+func (e *AddressError) Is(target error) bool { return e.Kind != nil && target == e.Kind }
+
+var (
+	ErrNoMatch            error = errors.New("no matching line found")
+	ErrNoSuchMark         error = errors.New("unknown mark")
+	ErrAddressOutOfRange  error = errors.New("invalid line")
+	ErrInvalidDestination error = errors.New("invalid destination")
+)
+
 func errorInvalidLine(str string, err error) error {
-	return &AddressError{Msg: fmt.Sprintf("invalid line: %s", str), Err: err}
+	return &AddressError{Msg: fmt.Sprintf("%s: %s", ErrAddressOutOfRange, str), Err: err, Kind: ErrAddressOutOfRange}
 }
 
 // errorInvalidDestination is used by commands which take a 'destination'
 func errorInvalidDestination(str string, err error) error {
-	return &AddressError{Msg: fmt.Sprintf("invalid destination: %s", str), Err: err}
+	return &AddressError{Msg: fmt.Sprintf("%s: %s", ErrInvalidDestination, str), Err: err, Kind: ErrInvalidDestination}
 }
-func errorUnrecognisedAddress(str string, err error) error {
-	return &AddressError{Msg: fmt.Sprintf("unrecognised address: %s", str), Err: err}
-}
-
-/*
-Regex for the parts of an address.
- 1. special:	. $
- 2: mark:		' followed by a lowercase letter
- 3: reFor:		/regex/
- 4: reBack:		?regex?
- 5. signednbr:	+-<n>
- 6. inc:		+
- 7. dec:		-
-
-These can be repeated any number of times.
-Note: the check for a signed number must come before the check for +/-.
-*/
-var addressRE = regexp.MustCompile(`(?P<dot>\.)|(?P<dollar>\$)|(?P<mark>'[a-z])|(?P<reFor>\/[^/]*\/)|` +
-	`(?P<reBack>\?[^\?]*\?)|(?P<signednbr>[+-]?\d+)|(?P<inc>\+)|(?P<dec>-)`)
 
 /*
 isNotSpecified returns true if this address was not specified.
 */
 func (a Address) isNotSpecified() bool {
-	return a.internal[0].addrIdent == identNotSpecified
+	return len(a.internal) == 0 || a.internal[0].addrIdent == identNotSpecified
 }
 
 /*
@@ -108,6 +104,18 @@ func (a Address) isSpecified() bool {
 	return !a.isNotSpecified()
 }
 
+/*
+ Returns true if this address contains a regular expression search, e.g. '/re/' or '?re?+1'.
+*/
+func (a Address) containsRegex() bool {
+	for _, part := range a.internal {
+		if part.addrIdent == identRegexForward || part.addrIdent == identRegexBackward {
+			return true
+		}
+	}
+	return false
+}
+
 /*
 newUnspecifiedAddress creates a new Address object with a special AddressPart to indiacte 'not specified'.
 */
@@ -127,87 +135,15 @@ func newAbsoluteAddress(lineNbr int) Address {
 }
 
 /*
- Creates a new Address from an input string.
-/*
- Creates a new Address from an input string.
+ Creates a new Address from an input string (see commandParser).
 */
 func newAddress(addrStr string) (Address, error) {
-	addrStr = strings.TrimSpace(addrStr)
-	if len(addrStr) == 0 {
-		return newUnspecifiedAddress(), nil
+	p := commandParser{input: addrStr}
+	address, err := p.parseAddress()
+	if err == nil {
+		err = p.expectEnd()
 	}
-
-	// stores the parsed address parts
-	address := Address{}
-
-	/*
-	 Iterate over the input string by using regexp.FindStringIndex.
-	 This is to be able to pick up input errors, such as a non-terminated regex, by detecting if any non-blank chars were skipped over.
-	*/
-	index := 0 // the index of the input string slice where the current RE matched
-	keepGoing := true
-	for keepGoing {
-		loc := addressRE.FindStringIndex(addrStr[index:])
-		if loc == nil {
-			// this is ok if have reached end of input; otherwise check the intervening chars
-			if index != len(addrStr) {
-				err := checkSkippedChars(index, len(addrStr), addrStr)
-				if err != nil {
-					return address, err
-				}
-			}
-			keepGoing = false
-			continue
-		}
-		startOfMatch := index + loc[0]
-		if loc[0] != 0 {
-			// char(s) were skipped during the previous call of FindStringIndex -- either spaces or error
-			err := checkSkippedChars(index, startOfMatch, addrStr)
-			if err != nil {
-				return address, err
-			}
-		}
-
-		// have now matched the RE at startOfMatch:index+loc[1]
-
-		//fmt.Printf("%02d-%02d >>%s<<\n", startOfMatch, index+loc[1], addrStr[startOfMatch:index+loc[1]])
-
-		// re-execute RE find to get named capture groups
-		matches := findNamedMatches(addressRE, addrStr[startOfMatch:index+loc[1]], false)
-
-		var addrPart addressPart
-		switch {
-		case len(matches["dot"]) != 0:
-			addrPart = addressPart{addrIdent: identDot}
-		case len(matches["dollar"]) != 0:
-			addrPart = addressPart{addrIdent: identDollar}
-		case len(matches["mark"]) != 0:
-			addrPart = addressPart{addrIdent: identMark, info: matches["mark"][1:]}
-		case len(matches["reFor"]) != 0:
-			addrPart = addressPart{addrIdent: identRegexForward, info: matches["reFor"][1 : len(matches["reFor"])-1]}
-		case len(matches["reBack"]) != 0:
-			addrPart = addressPart{addrIdent: identRegexBackward, info: matches["reBack"][1 : len(matches["reBack"])-1]}
-		case len(matches["inc"]) != 0:
-			addrPart = addressPart{addrIdent: identInc}
-		case len(matches["dec"]) != 0:
-			addrPart = addressPart{addrIdent: identDec}
-		case len(matches["signednbr"]) != 0:
-			// check the number is valid (should be ok, since the RE matched, but still...)
-			_, err := strconv.Atoi(matches["signednbr"])
-			if err != nil {
-				return address, errorUnrecognisedAddress(matches["signednbr"], err)
-			}
-			addrPart = addressPart{addrIdent: identSignedNbr, info: matches["signednbr"]}
-		default:
-			return address, errors.New("apparently no RE match second time around ... should not happen")
-		}
-
-		address.internal = append(address.internal, addrPart)
-
-		index += loc[1]
-	}
-
-	return address, nil
+	return address, err
 }
 
 /**
@@ -227,10 +163,11 @@ func (addr Address) addressPartsAsString() string {
 
 /*
  calculateActuaLineNumber calculates and returns the actual line number specified by the address,
- depending on the current linenbr and the list of lines. (The list of marks can also be required.)
+ depending on the current linenbr and the buffer and marks of the state.
  Returns error errInvalidLine if the resulting line number is out-of-bounds (<0, > max).
 */
-func (addr Address) calculateActualLineNumber(currentLineNbr int, buffer *list.List, marks map[string]int) (int, error) {
+func (addr Address) calculateActualLineNumber(currentLineNbr int, state *State) (int, error) {
+	buffer, marks := state.Buffer, state.marks
 	var lineNbr int = currentLineNbr
 	if addr.isNotSpecified() {
 		return currentLineNbr, nil
@@ -256,21 +193,32 @@ func (addr Address) calculateActualLineNumber(currentLineNbr int, buffer *list.L
 				lineNbr = markLineNbr
 				parsingAddressOffset = true
 			} else {
-				return -1, fmt.Errorf("unknown mark: '%s'", addrPart.info)
+				return -1, fmt.Errorf("%w: '%s'", ErrNoSuchMark, addrPart.info)
+			}
+		case identRegexForward, identRegexBackward:
+			re, err := addrPart.searchRegex(state)
+			if err != nil {
+				return -1, err
+			}
+			matchLine := matchLineForward
+			if addrPart.addrIdent == identRegexBackward {
+				matchLine = matchLineBackward
 			}
-		case identRegexForward:
-			matchingLineNbr, err := matchLineForward(lineNbr, addrPart.info, buffer)
+			matchingLineNbr, err := matchLine(lineNbr, re, buffer)
 			if err != nil {
-				return -1, fmt.Errorf("did not find line matching regex")
+				return -1, fmt.Errorf("did not find line matching regex: %w", err)
 			}
+			state.lastSearchRE = re
 			lineNbr = matchingLineNbr
 			parsingAddressOffset = true
-		case identRegexBackward:
-			matchingLineNbr, err := matchLineBackward(lineNbr, addrPart.info, buffer)
+		case identByteOffset:
+			offset, err := strconv.ParseInt(addrPart.info, 10, 64)
 			if err != nil {
-				return -1, fmt.Errorf("did not find line matching regex")
+				return -1, fmt.Errorf("error parsing byte offset in address part '%v': %w", addrPart, err)
+			}
+			if lineNbr, err = state.lineAtByteOffset(offset); err != nil {
+				return -1, err
 			}
-			lineNbr = matchingLineNbr
 			parsingAddressOffset = true
 		case identSignedNbr:
 			parsedLineNbr, err := strconv.Atoi(addrPart.info)
@@ -306,81 +254,61 @@ func (addr Address) calculateActualLineNumber(currentLineNbr int, buffer *list.L
 }
 
 /*
-Returns the line number of the next line after 'startLine' which matches the given regex.
-Search will wrap around.
+ Returns the regex of a regex address part.
+ An empty regex (i.e. // or ??) refers to the regex of the previous search.
 */
-func matchLineForward(startLine int, reStr string, buffer *list.List) (int, error) {
-	re := regexp.MustCompile(reStr)
-
-	// move to line 'startLine'
-	e := _findLine(startLine, buffer)
-	// should not happen
-	if e == nil {
-		return -1, fmt.Errorf("matchLineForward: move to line '%d' failed", startLine)
-	}
-
-	found := false
-	currentLineNbr := startLine
-
-	// starting at the next line, iterate to end of file matching regex
-	for e = e.Next(); e != nil && !found; e = e.Next() {
-		currentLineNbr++
-		if re.MatchString(e.Value.(Line).Line) {
-			found = true
+func (p addressPart) searchRegex(state *State) (*regexp.Regexp, error) {
+	if p.info == "" {
+		if state.lastSearchRE == nil {
+			return nil, ErrNoPreviousRegex
 		}
+		return state.lastSearchRE, nil
 	}
+	return state.compileRegex(p.info, p.ignoreCase)
+}
 
-	if found {
-		return currentLineNbr, nil
+/*
+Returns the line number of the next line after 'startLine' which matches the given regex.
+Search will wrap around.
+*/
+func matchLineForward(startLine int, re *regexp.Regexp, buffer Buffer) (int, error) {
+	// check line 'startLine'
+	if _, err := buffer.Get(startLine); err != nil {
+		return -1, err
 	}
 
-	// now iterate from start of file to 'startLine' matching regex
-	for currentLineNbr, e = 0, buffer.Front(); (currentLineNbr != startLine) && !found; e = e.Next() {
-		currentLineNbr++
-		if re.MatchString(e.Value.(Line).Line) {
-			found = true
+	// starting at the next line, iterate to end of file matching regex,
+	// then from start of file to 'startLine'
+	for i := 1; i <= buffer.Len(); i++ {
+		lineNbr := (startLine+i-1)%buffer.Len() + 1
+		line, _ := buffer.Get(lineNbr)
+		if matchesLine(re, line) {
+			return lineNbr, nil
 		}
 	}
-
-	if found {
-		return currentLineNbr, nil
-	} else {
-		return -1, fmt.Errorf("mo matching line found")
-	}
+	return -1, ErrNoMatch
 }
 
 /*
 Returns the line number of the first line before 'startLine' which matches the given regex.
 Search will wrap around.
 */
-func matchLineBackward(startLine int, reStr string, buffer *list.List) (int, error) {
-	re := regexp.MustCompile(reStr)
-
-	// move to line 'startLine'
-	e := _findLine(startLine, buffer)
-	// should not happen
-	if e == nil {
-		return -1, fmt.Errorf("matchLineForward: move to line '%d' failed", startLine)
-	}
-
-	currentLineNbr := startLine
-
-	// starting at the previous line, iterate to start of file matching regex
-	for e = e.Prev(); e != nil; e = e.Prev() {
-		currentLineNbr--
-		if re.MatchString(e.Value.(Line).Line) {
-			return currentLineNbr, nil
-		}
+func matchLineBackward(startLine int, re *regexp.Regexp, buffer Buffer) (int, error) {
+	// check line 'startLine'
+	if _, err := buffer.Get(startLine); err != nil {
+		return -1, err
 	}
 
-	// now iterate from end of file back to 'startLine' matching regex
-	for currentLineNbr, e = buffer.Len(), buffer.Back(); currentLineNbr != startLine; e, currentLineNbr = e.Prev(), currentLineNbr-1 {
-		if re.MatchString(e.Value.(Line).Line) {
-			return currentLineNbr, nil
+	// starting at the previous line, iterate to start of file matching regex,
+	// then from end of file back to 'startLine'
+	for i := 1; i <= buffer.Len(); i++ {
+		lineNbr := (startLine-i-1+buffer.Len())%buffer.Len() + 1
+		line, _ := buffer.Get(lineNbr)
+		if matchesLine(re, line) {
+			return lineNbr, nil
 		}
 	}
-
-	return -1, fmt.Errorf("mo matching line found")
+	return -1, ErrNoMatch
 }
 
 /*
@@ -394,36 +322,6 @@ func syntaxError(errorText string) error {
 	return errors.New("syntax error: " + errorText)
 }
 
-/*
-checkSkippedChars checks if there were any non-blank chars between 'start' and 'end'. If so, returns an error.
-*/
-func checkSkippedChars(start, end int, str string) error {
-	trimmed := strings.TrimSpace(str[start:end])
-	if len(trimmed) != 0 {
-		locnString, errorDesc := analyzeParseError(start, end, trimmed)
-		return syntaxError(fmt.Sprintf("%s at posn %s: >>%s<<", errorDesc, locnString, str[start:end]))
-	}
-	return nil
-}
-
-func analyzeParseError(start, end int, str string) (string, string) {
-	var locnString, errorDesc string
-	if start+1 == end {
-		locnString = strconv.Itoa(start)
-	} else {
-		locnString = fmt.Sprintf("%d-%d", start, end)
-	}
-	switch str[0:1] {
-	case identMark:
-		errorDesc = "incorrect mark"
-	case identRegexForward, identRegexBackward:
-		errorDesc = "non-terminated regex"
-	default:
-		errorDesc = "unrecognised"
-	}
-	return locnString, errorDesc
-}
-
 /*
 String generates a pretty form of an Address.
 */
@@ -446,11 +344,16 @@ func (p addressPart) String() string {
 	case identMark:
 		return fmt.Sprintf("%s%s", identMark, p.info)
 	case identRegexBackward, identRegexForward:
+		if p.ignoreCase {
+			return fmt.Sprintf("%s%s%s%s", p.addrIdent, p.info, p.addrIdent, suffixIgnoreCase)
+		}
 		return fmt.Sprintf("%s%s%s", p.addrIdent, p.info, p.addrIdent)
 	case identInc, identDec, identDollar, identDot:
 		return p.addrIdent
 	case identSignedNbr:
 		return p.info
+	case identByteOffset:
+		return p.addrIdent + p.info
 	default:
 		return fmt.Sprintf("not recognised: '%s'", p.addrIdent)
 
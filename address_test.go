@@ -2,6 +2,8 @@ package red
 
 import (
 	"fmt"
+	"io"
+	"regexp"
 	"testing"
 )
 
@@ -18,6 +20,8 @@ func TestRawParseAddress(t *testing.T) {
 		// regex
 		{"/.*/", "/.*/"},
 		{"?.*?", "?.*?"},
+		{"/a/I", "/a/I"},
+		{"?a?I+", "?a?I,+"},
 		// inc, dec
 		{"+", "+"},
 		{"++", "+,+"},
@@ -134,6 +138,8 @@ func TestCalculateActualLineNumber(t *testing.T) {
 		// regex
 		{1, "/3/", 3},
 		{5, "+?3?", 3},
+		{1, "/[a-z]/I", 4},
+		{6, "?[a-z]?I", 4},
 	}
 
 	for _, test := range data {
@@ -142,10 +148,11 @@ func TestCalculateActualLineNumber(t *testing.T) {
 			if err != nil {
 				t.Errorf("error: %s", err)
 			} else {
-				marks := map[string]int{
+				state := resetState([]string{"1", "2", "3", "4X", "5", "6", "7", "8"})
+				state.marks = map[string]int{
 					"a": 2,
 				}
-				lineNbr, err := addr.calculateActualLineNumber(test.startLine, createListOfLines([]string{"1", "2", "3", "4", "5", "6", "7", "8"}), marks)
+				lineNbr, err := addr.calculateActualLineNumber(test.startLine, state)
 				if err != nil {
 					t.Errorf("error: %s", err)
 				} else {
@@ -185,7 +192,7 @@ func TestInvalidCalculateActualLineNumber(t *testing.T) {
 			if err != nil {
 				t.Errorf("error: %s", err)
 			} else {
-				lineNbr, err := addr.calculateActualLineNumber(test.startLine, createListOfLines([]string{"1", "2", "3", "4", "5", "6", "7", "8"}), make(map[string]int))
+				lineNbr, err := addr.calculateActualLineNumber(test.startLine, resetState([]string{"1", "2", "3", "4", "5", "6", "7", "8"}))
 				if err != nil {
 					// ok
 				} else {
@@ -219,11 +226,11 @@ func TestMatchLineForwardOrBackward(t *testing.T) {
 		t.Run(fmt.Sprintf("%2d >>%s<<", i, test.regex), func(t *testing.T) {
 			var lineNbr int
 			var err error
-			buf := createListOfLines([]string{"1", "2", "3", "4", "5", "6", "7", "8"})
+			buf := createBuffer([]string{"1", "2", "3", "4", "5", "6", "7", "8"})
 			if test.forward {
-				lineNbr, err = matchLineForward(test.startLine, test.regex, buf)
+				lineNbr, err = matchLineForward(test.startLine, regexp.MustCompile(test.regex), buf)
 			} else {
-				lineNbr, err = matchLineBackward(test.startLine, test.regex, buf)
+				lineNbr, err = matchLineBackward(test.startLine, regexp.MustCompile(test.regex), buf)
 			}
 			if err != nil {
 				t.Errorf("error: %s", err)
@@ -234,6 +241,46 @@ func TestMatchLineForwardOrBackward(t *testing.T) {
 	}
 }
 
+func TestRegexAddressRepeatsPreviousSearch(t *testing.T) {
+	steps := []struct {
+		cmdLine         string
+		expectedLineNbr int
+	}{
+		{"/x$/", 3},
+		{"//", 5},
+		{"//", 3}, // wraps around
+		{"??", 5},
+		{"?^a?", 4},
+		{"??", 3},
+		{"g/b/", 2},
+		{"1", 1},
+		{"//", 2}, // the regex of the 'g' command
+	}
+	state := resetState([]string{"a", "b", "ax", "a", "x"})
+	state.lineNbr = 1
+	state.Stdout = io.Discard
+	for _, step := range steps {
+		if err := processCommandLine(t, state, step.cmdLine); err != nil {
+			t.Fatalf("command '%s': error: %s", step.cmdLine, err)
+		}
+		assertInt(t, "wrong state.lineNbr for "+step.cmdLine, state.lineNbr, step.expectedLineNbr)
+	}
+	assertString(t, "wrong last search regex", state.lastSearchRE.String(), "b")
+}
+
+func TestRegexAddressErrors(t *testing.T) {
+	for _, cmdLine := range []string{"//", "??", "/[/", "/z/"} {
+		state := resetState([]string{"a", "b"})
+		state.lineNbr = 1
+		if err := processCommandLine(t, state, cmdLine); err == nil {
+			t.Fatalf("command '%s': expected error", cmdLine)
+		}
+		if cmdLine == "/z/" && state.lastSearchRE != nil {
+			t.Fatalf("last search regex should not be set by a failed search")
+		}
+	}
+}
+
 /**
 invalid address strings
 */
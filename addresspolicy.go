@@ -0,0 +1,113 @@
+package red
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrAddressMayNotBeSpecified error = errors.New("an address may not be specified")
+
+/*
+addressPolicy describes which addresses are valid for a command.
+
+The policy is checked by ProcessCommand after the addresses have been resolved,
+and again by each command itself (so that commands called directly are checked as well),
+so that a command is only ever executed with valid addresses.
+Commands not present in 'addressPolicies' get the default (zero) policy:
+ an address or range may be given, and the start line must not be 0.
+*/
+type addressPolicy struct {
+	noAddress        bool // no address may be given
+	noRange          bool // at most one address may be given
+	zeroAllowed      bool // the address '0' (zero) is valid
+	defaultsToBuffer bool // if no address is given, the command operates on the whole buffer
+}
+
+var addressPolicies = map[string]addressPolicy{
+	commandAppend:                   {zeroAllowed: true},
+	commandAlias:                    {noAddress: true},
+	commandUnalias:                  {noAddress: true},
+	commandRunAlias:                 {noAddress: true},
+	commandCount:                    {defaultsToBuffer: true},
+	commandEdit:                     {noAddress: true},
+	commandEditUnconditionally:      {noAddress: true},
+	commandFilename:                 {noAddress: true},
+	commandNextFile:                 {noAddress: true},
+	commandOpenBuffer:               {noAddress: true},
+	commandListBuffers:              {noAddress: true},
+	commandSwitchBuffer:             {noAddress: true},
+	commandDOS:                      {noAddress: true},
+	commandUnix:                     {noAddress: true},
+	commandPreviousFile:             {noAddress: true},
+	commandGlobal:                   {defaultsToBuffer: true},
+	commandGlobalInteractive:        {defaultsToBuffer: true},
+	commandGrep:                     {defaultsToBuffer: true},
+	commandHelp:                     {noAddress: true},
+	commandHelpLong:                 {noAddress: true},
+	commandHistory:                  {noAddress: true},
+	commandVerboseErrors:            {noAddress: true},
+	commandInsert:                   {zeroAllowed: true},
+	commandMarks:                    {noAddress: true},
+	commandDeleteMarks:              {noAddress: true},
+	commandDiff:                     {noAddress: true},
+	commandPrompt:                   {noAddress: true},
+	commandIgnoreCase:               {noAddress: true},
+	commandQuit:                     {noAddress: true},
+	commandQuitUnconditionally:      {noAddress: true},
+	commandRead:                     {noRange: true, zeroAllowed: true},
+	commandRevert:                   {noAddress: true},
+	commandReverse:                  {defaultsToBuffer: true},
+	commandSet:                      {noAddress: true},
+	commandSort:                     {defaultsToBuffer: true},
+	commandUniq:                     {defaultsToBuffer: true},
+	commandUndo:                     {noAddress: true},
+	commandRedo:                     {noAddress: true},
+	commandInverseGlobal:            {defaultsToBuffer: true},
+	commandInverseGlobalInteractive: {defaultsToBuffer: true},
+	commandWrite:                    {defaultsToBuffer: true},
+	commandWriteAppend:              {defaultsToBuffer: true},
+	commandWriteQuit:                {defaultsToBuffer: true},
+	commandWriteAppendQuit:          {defaultsToBuffer: true},
+	commandPut:                      {noRange: true},
+	commandPutBefore:                {noRange: true, zeroAllowed: true},
+	commandScroll:                   {noRange: true, zeroAllowed: true},
+	commandPrintContext:             {defaultsToBuffer: true}, // only when searching for a regex
+	commandComment:                  {zeroAllowed: true},
+	commandTemplate:                 {zeroAllowed: true},
+	commandLinenumber:               {zeroAllowed: true},
+	commandShell:                    {defaultsToBuffer: true}, // an address is only used for filtering lines
+	commandExtension:                {defaultsToBuffer: true},
+	commandNoCommand:                {zeroAllowed: true},
+}
+
+/*
+ Checks the resolved addresses of the command against the command's address policy.
+ The address range must have been resolved beforehand.
+*/
+func (cmd Command) validateAddress(state *State) error {
+	if !cmd.addressIsResolved {
+		return errAddressHasNotBeenResolved
+	}
+	policy := addressPolicies[cmd.cmd]
+	addressSpecified := cmd.addrRange.IsSpecified()
+	if policy.noAddress && addressSpecified {
+		return fmt.Errorf("%s: %w", cmd.cmd, ErrAddressMayNotBeSpecified)
+	}
+	if policy.noRange && cmd.addrRange.end.isSpecified() {
+		return fmt.Errorf("%s: %w", cmd.cmd, ErrRangeMayNotBeSpecified)
+	}
+	if policy.noAddress || (policy.defaultsToBuffer && !addressSpecified) {
+		return nil
+	}
+	if cmd.resolved.start == 0 && !policy.zeroAllowed {
+		if state.Buffer.Len() == 0 {
+			return fmt.Errorf("%s: %w", cmd.cmd, errorInvalidLine("buffer is empty", nil))
+		}
+		return fmt.Errorf("%s: %w", cmd.cmd, errorInvalidLine("start line is 0", nil))
+	}
+	if cmd.resolved.end == 0 {
+		// only possible if the address '0' is allowed
+		return nil
+	}
+	return checkLineRange(maxIntOf(1, cmd.resolved.start), cmd.resolved.end, state.Buffer)
+}
@@ -0,0 +1,105 @@
+package red
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestValidateAddress(t *testing.T) {
+	data := []struct {
+		buffer    []string
+		addrRange string
+		cmdIdent  string
+		expectErr bool
+	}{
+		{[]string{"1", "2", "3"}, "1,2", commandPrint, false},
+		{[]string{"1", "2", "3"}, "0", commandPrint, true},
+		{[]string{"1", "2", "3"}, "0,2", commandDelete, true},
+		{[]string{"1", "2", "3"}, "0", commandAppend, false},
+		{[]string{"1", "2", "3"}, "0", commandPutBefore, false},
+		{[]string{"1", "2", "3"}, "0", commandPut, true},
+		{[]string{"1", "2", "3"}, "1,2", commandPut, true},
+		{[]string{"1", "2", "3"}, "1,2", commandMark, false},
+		{[]string{"1", "2", "3"}, "0", commandMark, true},
+		{[]string{"1", "2", "3"}, "2", commandMark, false},
+		{[]string{"1", "2", "3"}, "$", commandMark, false},
+		{[]string{"1", "2", "3"}, "1,2", commandRead, true},
+		{[]string{"1", "2", "3"}, "1,2", commandScroll, true},
+		{[]string{"1", "2", "3"}, "1", commandQuit, true},
+		{[]string{"1", "2", "3"}, "", commandQuit, false},
+		{[]string{"1", "2", "3"}, "1,$", commandUndo, true},
+		{[]string{}, "", commandPrint, true},
+		{[]string{}, "", commandDelete, true},
+		{[]string{}, "", commandYank, true},
+		{[]string{}, "", commandAppend, false},
+		{[]string{}, "", commandWrite, false},
+		{[]string{}, "", commandCount, false},
+		{[]string{}, "0", commandWrite, true},
+	}
+
+	for i, test := range data {
+		t.Run(fmt.Sprintf("test %d: >>%s%s<<", i, test.addrRange, test.cmdIdent), func(t *testing.T) {
+			state := resetState(test.buffer)
+			cmd, err := createCommandAndResolveAddressRange(state, newValidRange(test.addrRange), test.cmdIdent, "")
+			if err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			err = cmd.validateAddress(state)
+			if test.expectErr && err == nil {
+				t.Fatalf("expected error")
+			} else if !test.expectErr && err != nil {
+				t.Fatalf("error: %s", err)
+			}
+		})
+	}
+}
+
+func TestProcessCommandUsesCurrentLineByDefault(t *testing.T) {
+	state := resetState([]string{"1", "2", "3"})
+	state.lineNbr = 2
+	cmd, err := ParseCommand(commandDelete, false)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if _, err = cmd.ProcessCommand(state, nil, false); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertBufferContents(t, state.Buffer, "1\n3\n")
+}
+
+func TestCommandsValidateAddressWhenCalledDirectly(t *testing.T) {
+	data := []struct {
+		addrRange string
+		cmdIdent  string
+		fn        func(cmd Command, state *State) error
+	}{
+		{"0", commandDelete, func(cmd Command, state *State) error { return cmd.Delete(state, true) }},
+		{"0", commandYank, func(cmd Command, state *State) error { return cmd.Yank(state) }},
+		{"0", commandMark, func(cmd Command, state *State) error { return cmd.Mark(state) }},
+		{"0", commandPut, func(cmd Command, state *State) error { return cmd.Put(state) }},
+		{"1,2", commandRead, func(cmd Command, state *State) error { return cmd.Read(state) }},
+	}
+	for i, test := range data {
+		t.Run(fmt.Sprintf("test %d: >>%s%s<<", i, test.addrRange, test.cmdIdent), func(t *testing.T) {
+			state := resetState([]string{"1", "2", "3"})
+			cmd, err := createCommandAndResolveAddressRange(state, newValidRange(test.addrRange), test.cmdIdent, "x")
+			if err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			if err = test.fn(cmd, state); err == nil {
+				t.Fatalf("expected error")
+			}
+			assertBufferContents(t, state.Buffer, "1\n2\n3\n")
+		})
+	}
+}
+
+func TestTransferValidatesAddress(t *testing.T) {
+	state := resetState([]string{"1", "2", "3"})
+	cmd := Command{addrRange: newValidRange("1"), cmd: commandTransfer, restOfCmd: "$"}
+	if err := cmd.Transfer(state); !errors.Is(err, errAddressHasNotBeenResolved) {
+		t.Fatalf("expected errAddressHasNotBeenResolved, got %v", err)
+	}
+	assertBufferContents(t, state.Buffer, "1\n2\n3\n")
+}
@@ -1,36 +1,22 @@
 package red
 
 import (
-	"container/list"
 	"errors"
 	"fmt"
-	"regexp"
-	"strings"
-	//	"strconv"
 )
 
-/*
-Names of the capture groups. Must correspond to the regex.
-*/
 const (
-	firstAddressCaptureGroup  string = "address1"
-	secondAddressCaptureGroup string = "address2"
-	separatorCaptureGroup     string = "separator"
-
 	separatorComma     string = ","
 	separatorSemicolon string = ";"
 )
 
 var (
-	errBadRange               error = errors.New("address range start > end")
+	ErrBadRange               error = errors.New("address range start > end")
 	errInvalidStartOfRange    error = errors.New("invalid start of range")
 	errInvalidEndOfRange      error = errors.New("invalid end of range")
 	ErrRangeMayNotBeSpecified error = errors.New("a range may not be specified")
-	errUnrecognisedRange      error = errors.New("unrecognised address range")
 )
 
-var addressRangeRE = regexp.MustCompile(`^(?P<address1>[^,;]*)` + `(?P<separator>[,;]?)` + `(?P<address2>[^,;]*)$`)
-
 /*
 An AddressRange stores the start and end addresses of a range.
 */
@@ -48,18 +34,22 @@ func (r AddressRange) String() string {
   as given by calculateStartAndEndLineNumbers. It is an error if start > end.
  Otherwise, returns the current line number as start and end.
 */
-func (ra AddressRange) getAddressRange(currentLineNbr int, buffer *list.List, marks map[string]int) (startLine int, endLine int, err error) {
+func (ra AddressRange) getAddressRange(state *State) (startLine int, endLine int, err error) {
 	if !ra.IsSpecified() {
-		return currentLineNbr, currentLineNbr, nil
+		return state.lineNbr, state.lineNbr, nil
 	}
-	return ra.calculateStartAndEndLineNumbers(currentLineNbr, buffer, marks)
+	return ra.calculateStartAndEndLineNumbers(state.lineNbr, state)
 }
 
 /*
  Calculates the start and end line numbers from the given address range.
  It is an error if start > end.
+
+ In a semicolon-delimited range, the second address is calculated relative to the first,
+ i.e. '.' and any regex search in the second address start at the first address.
+ (state.lineNbr is not changed, so that a range can be resolved more than once with the same result.)
 */
-func (ra *AddressRange) calculateStartAndEndLineNumbers(currentLineNbr int, buffer *list.List, marks map[string]int) (startLine int, endLine int, err error) {
+func (ra *AddressRange) calculateStartAndEndLineNumbers(currentLineNbr int, state *State) (startLine int, endLine int, err error) {
 	// special case 1: first address empty -> {1,addr} or {.;addr}
 	if ra.start.isNotSpecified() {
 		switch ra.separator {
@@ -69,7 +59,7 @@ func (ra *AddressRange) calculateStartAndEndLineNumbers(currentLineNbr int, buff
 			startLine = currentLineNbr
 		}
 	} else {
-		if startLine, err = ra.start.calculateActualLineNumber(currentLineNbr, buffer, marks); err != nil {
+		if startLine, err = ra.start.calculateActualLineNumber(currentLineNbr, state); err != nil {
 			return -1, -1, fmt.Errorf("%s: %w", errInvalidStartOfRange, err)
 		}
 	}
@@ -82,14 +72,14 @@ func (ra *AddressRange) calculateStartAndEndLineNumbers(currentLineNbr int, buff
 	if ra.end.isNotSpecified() {
 		endLine = startLine
 	} else {
-		if endLine, err = ra.end.calculateActualLineNumber(currentLineNbr, buffer, marks); err != nil {
+		if endLine, err = ra.end.calculateActualLineNumber(currentLineNbr, state); err != nil {
 			return -1, -1, fmt.Errorf("%s: %w", errInvalidEndOfRange, err)
 		}
 	}
 
 	// start must be before end ('special' values excluded)
 	if startLine >= 0 && endLine >= 0 && startLine > endLine {
-		return -1, -1, errBadRange
+		return -1, -1, ErrBadRange
 	}
 
 	return startLine, endLine, nil
@@ -102,6 +92,13 @@ func (ra AddressRange) IsSpecified() bool {
 	return !(ra.start.isNotSpecified() && ra.end.isNotSpecified())
 }
 
+/*
+ Returns true if either address of the range contains a regular expression search.
+*/
+func (ra AddressRange) containsRegex() bool {
+	return ra.start.containsRegex() || ra.end.containsRegex()
+}
+
 /*
 newRange creates an AddressRange from the given string.
 
@@ -115,96 +112,20 @@ The value of the first address in a range cannot exceed the value of the second.
 
   Special cases:
     empty string        {notSpecified, notSpecified}
-    .                   {currentLine, currentLine}
-    $                   {endOfFile, endOfFile}
+    n (one address)     {n, notSpecified}, i.e. the range n,n
     ,                   {startOfFile, endOfFile}
-    n                   {n, n}
+    %                   {startOfFile, endOfFile}
+    ;                   {currentLine, endOfFile}
 
-  Otherwise, a range in format A1[,;]A2 is expected.
- *
+  Otherwise, a range in format A1[,;]A2 is expected (see commandParser).
 */
 func newRange(rangeStr string) (AddressRange, error) {
-
-	var addrRange AddressRange
-
-	// this case does not seem to be caught by the following switch, therefore handle it specially
-	if len(strings.TrimSpace(rangeStr)) == 0 {
-		startAddr, err := newAddress(rangeStr)
-		if err != nil {
-			return addrRange, err
-		}
-		return AddressRange{startAddr, startAddr, identComma}, nil
-	}
-	// a few special cases to start with
-	switch rangeStr {
-	case identDot:
-	case identDollar:
-		startAddr, err := newAddress(rangeStr)
-		if err != nil {
-			return addrRange, err
-		}
-		return AddressRange{startAddr, startAddr, identComma}, nil
-	case identComma: // ==(1,$)
-		startAddr, err := newAddress("1")
-		if err != nil {
-			return addrRange, err
-		}
-		endAddr, err := newAddress(identDollar)
-		if err != nil {
-			return addrRange, err
-		}
-		return AddressRange{startAddr, endAddr, identComma}, nil
-	case identSemicolon: // ==(.,$)
-		startAddr, err := newAddress(identDot)
-		if err != nil {
-			return addrRange, err
-		}
-		endAddr, err := newAddress(identDollar)
-		if err != nil {
-			return addrRange, err
-		}
-		return AddressRange{startAddr, endAddr, identComma}, nil
-	}
-
-	matches := findNamedMatches(addressRangeRE, rangeStr, false)
-	if matches == nil {
-		return addrRange, errUnrecognisedRange
+	p := commandParser{input: rangeStr}
+	addrRange, err := p.parseRange()
+	if err == nil {
+		err = p.expectEnd()
 	}
-
-	start, err := newAddress(matches[firstAddressCaptureGroup])
-	if err != nil {
-		return addrRange, fmt.Errorf("cannot parse address 1: %s", err.Error())
-	}
-	end, err := newAddress(matches[secondAddressCaptureGroup])
-	if err != nil {
-		return addrRange, fmt.Errorf("cannot parse address 2: %s", err.Error())
-	}
-	separator := matches[separatorCaptureGroup]
-
-	/* TODO
-
-	// special cases: first address empty -> {1,addr} or {.;addr}
-	// TODO check if 2nd addr is present
-	if start.isNotSpecified() {
-		switch separator {
-		case separatorComma:
-			if start, err = newAddress("1"); err != nil {
-				return addrRange, err
-			}
-		case separatorSemicolon:
-			if start, err = newAddress(identDot); err != nil {
-				return addrRange, err
-			}
-		}
-	}
-
-	// first address given, second empty -> {<given address>, <given address>}
-	if end.isNotSpecified() {
-		end = start
-	}
-	*/
-
-	return AddressRange{start, end, separator}, nil
+	return addrRange, err
 }
 
 /*
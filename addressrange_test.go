@@ -1,6 +1,7 @@
 package red
 
 import (
+	"bytes"
 	"fmt"
 	"testing"
 )
@@ -24,12 +25,12 @@ func TestRangeErrors(t *testing.T) {
 			if err != nil {
 				t.Errorf("error: %s", err)
 			} else {
-				lines := createListOfLines([]string{"1", "2", "3", "4 123", "5", "6 456regex", "7", "8"})
-				marks := map[string]int{
+				state := resetState([]string{"1", "2", "3", "4 123", "5", "6 456regex", "7", "8"})
+				state.marks = map[string]int{
 					"a": 1,
 					"b": 3,
 				}
-				start, end, err := r.calculateStartAndEndLineNumbers(1, lines, marks)
+				start, end, err := r.calculateStartAndEndLineNumbers(1, state)
 				if err != nil {
 					// ok
 				} else {
@@ -53,6 +54,11 @@ func TestCreateAddressRange(t *testing.T) {
 		{"/regex/,+2", 5, 6, 7},      // sep=,
 		{"?first line?,+2", 5, 1, 7}, // sep=,
 		{"?first line?;+2", 5, 1, 3},
+		{"/regex/;.", 1, 6, 6},
+		{"/^[0-9]/;/^[0-9]/", 3, 4, 5},
+		{"/^[0-9]/,/^[0-9]/", 3, 4, 4},
+		{"/^[0-9]/;//", 3, 4, 5}, // '//' repeats the search of the first address, starting at the first address
+		{"/^[0-9]/;?4?", 3, 4, 6},
 
 		{"+,5", 2, 3, 5},
 		{"-,+", 2, 1, 3},
@@ -70,6 +76,7 @@ func TestCreateAddressRange(t *testing.T) {
 		{",7", 2, 1, 7}, // If only the second address is given, the resulting address pair is '1,addr'
 		{";8", 2, 2, 8}, // If only the second address is given, the resulting address pair is '.;addr'
 		{",", 3, 1, 8},  // (1,$)
+		{"%", 3, 1, 8},  // (1,$)
 		{";", 3, 3, 8},  // (.,$)
 		{"4,$", 2, 4, 8},
 		{"$,$", 4, 8, 8},
@@ -90,7 +97,7 @@ func TestCreateAddressRange(t *testing.T) {
 				t.Errorf("error: %s", err)
 			} else {
 				start, end, err := r.calculateStartAndEndLineNumbers(test.startLine,
-					createListOfLines([]string{"1 first line", "2", "3", "4 123", "5", "6 456regex", "7", "8"}), make(map[string]int))
+					resetState([]string{"1 first line", "2", "3", "4 123", "5", "6 456regex", "7", "8"}))
 				if err != nil {
 					t.Errorf("error: %s", err)
 				}
@@ -110,6 +117,96 @@ func TestCreateAddressRange(t *testing.T) {
 
 }
 
+func TestParseAddressRange(t *testing.T) {
+	data := []struct {
+		rangeStr                   string
+		expectedAddr1, expectedSep string
+		expectedAddr2              string
+		expectedError              string
+	}{
+		{"1,2", "1", ",", "2", ""},
+		{"/a,b/;?c;d?", "/a,b/", ";", "?c;d?", ""},
+		{"/a?b/,?c/d?", "/a?b/", ",", "?c/d?", ""},
+		{"'a", "'a", "", "", ""},
+		{"$", "$", "", "", ""},
+		{";", ".", ",", "$", ""},
+		{"%", "1", ",", "$", ""},
+		{"/a", "", "", "", "unterminated regular expression '/a' at column 1"},
+		{"1,2,3", "", "", "", "unexpected ',' at column 4"},
+		{"1;/x/;", "", "", "", "unexpected ';' at column 6"},
+		{"'A", "", "", "", "invalid mark ''A' at column 1"},
+		{"1,%", "", "", "", "unexpected '%' at column 3"},
+	}
+	addressString := func(addr Address) string {
+		if addr.isNotSpecified() {
+			return ""
+		}
+		return addr.addressPartsAsString()
+	}
+	for _, test := range data {
+		t.Run(fmt.Sprintf(">>%s<<", test.rangeStr), func(t *testing.T) {
+			addrRange, err := newRange(test.rangeStr)
+			if test.expectedError != "" {
+				if err == nil {
+					t.Fatalf("expected error")
+				}
+				assertString(t, "wrong error", err.Error(), test.expectedError)
+				return
+			}
+			if err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertString(t, "addr1", addressString(addrRange.start), test.expectedAddr1)
+			assertString(t, "separator", addrRange.separator, test.expectedSep)
+			assertString(t, "addr2", addressString(addrRange.end), test.expectedAddr2)
+		})
+	}
+}
+
+func TestSeparatorInRegexAddress(t *testing.T) {
+	state := resetState([]string{"x", "a,b", "y", "a,b", "z"})
+	state.lineNbr = 1
+	if err := processCommandLine(t, state, "/a,b/;//d"); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertBufferContents(t, state.Buffer, "x\nz\n")
+	assertInt(t, "wrong state.lineNbr!", state.lineNbr, 2)
+}
+
+func TestWholeBufferRange(t *testing.T) {
+	data := []struct {
+		cmdLine          string
+		expectedOutput   string
+		expectedContents string
+		expectedLineNbr  int
+	}{
+		{"%p", "a1\nb2\na3\n", "a1\nb2\na3\n", 3},
+		{" % n", "   1\t a1\n   2\t b2\n   3\t a3\n", "a1\nb2\na3\n", 3},
+		{"%s/a/x/", "2 lines changed\n", "x1\nb2\nx3\n", 3},
+		{"%s/[0-9]/!/gp", "a!\n3 lines changed\n", "a!\nb!\na!\n", 3},
+		{"%j", "", "a1b2a3\n", 1},
+		{"%d p", "", "", 0},
+		{"%y", "", "a1\nb2\na3\n", 1},
+	}
+	for i, test := range data {
+		t.Run(fmt.Sprintf("test %d: >>%s<<", i, test.cmdLine), func(t *testing.T) {
+			state := resetState([]string{"a1", "b2", "a3"})
+			state.lineNbr = 1
+			var output bytes.Buffer
+			state.Stdout = &output
+			if err := processCommandLine(t, state, test.cmdLine); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertString(t, "wrong output", output.String(), test.expectedOutput)
+			assertBufferContents(t, state.Buffer, test.expectedContents)
+			assertInt(t, "wrong state.lineNbr!", state.lineNbr, test.expectedLineNbr)
+		})
+	}
+	if _, err := ParseCommand("1%p", false); err == nil {
+		t.Fatalf("expected error for '1%%p'")
+	}
+}
+
 func TestCreateAddressRangeMarks(t *testing.T) {
 	data := []struct {
 		addrRange                  string
@@ -133,13 +230,13 @@ func TestCreateAddressRangeMarks(t *testing.T) {
 			if err != nil {
 				t.Errorf("error: %s", err)
 			} else {
-				lines := createListOfLines([]string{"first line", "second", "third", "fourth", "fifth", "sixth"})
-				marks := map[string]int{
+				state := resetState([]string{"first line", "second", "third", "fourth", "fifth", "sixth"})
+				state.marks = map[string]int{
 					"a": 2,
 					"b": 3,
 					"c": 6,
 				}
-				start, end, err := r.calculateStartAndEndLineNumbers(test.startLine, lines, marks)
+				start, end, err := r.calculateStartAndEndLineNumbers(test.startLine, state)
 				if err != nil {
 					t.Errorf("error: %s", err)
 				}
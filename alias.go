@@ -0,0 +1,217 @@
+package red
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrUnknownAlias error = errors.New("unknown alias")
+	ErrAliasCycle   error = errors.New("alias refers to itself")
+	ErrInvalidAlias error = errors.New("invalid alias")
+)
+
+// separates the commands of an alias, e.g. 'wq! = w | Q'. '\|' stands for a '|' within a command.
+const aliasSeparator string = "|"
+
+/*
+ Splits the definition of an alias into its commands, see aliasSeparator.
+*/
+func splitAliasCommands(definition string) []string {
+	var commands []string
+	var sb strings.Builder
+	for i := 0; i < len(definition); i++ {
+		switch {
+		case strings.HasPrefix(definition[i:], `\`+aliasSeparator):
+			sb.WriteString(aliasSeparator)
+			i += len(aliasSeparator)
+		case strings.HasPrefix(definition[i:], aliasSeparator):
+			commands = append(commands, strings.TrimSpace(sb.String()))
+			sb.Reset()
+			i += len(aliasSeparator) - 1
+		default:
+			sb.WriteByte(definition[i])
+		}
+	}
+	return append(commands, strings.TrimSpace(sb.String()))
+}
+
+/*
+ Formats the commands of an alias so that they can be read by splitAliasCommands.
+*/
+func formatAliasCommands(commands []string) string {
+	escaped := make([]string, len(commands))
+	for i, command := range commands {
+		escaped[i] = strings.ReplaceAll(command, aliasSeparator, `\`+aliasSeparator)
+	}
+	return strings.Join(escaped, " "+aliasSeparator+" ")
+}
+
+/*
+DefineAlias defines (or replaces) an alias, i.e. a name for one or more command lines.
+
+ The definition has the form 'name = commands', e.g. 'dd = .d' or 'wq! = w | Q',
+ where the commands are separated by '|' (see aliasSeparator).
+ The commands may themselves use aliases, but an alias must not refer to itself, also indirectly.
+*/
+func (state *State) DefineAlias(definition string) error {
+	name, value, err := parseSetting(definition)
+	if err != nil {
+		return fmt.Errorf("%w: expected 'name = commands'", ErrInvalidAlias)
+	}
+	if name == "" || strings.ContainsAny(name, " \t") || name == commandAlias || name == commandUnalias {
+		return fmt.Errorf("%w: name '%s'", ErrInvalidAlias, name)
+	}
+	commands := splitAliasCommands(value)
+	for _, command := range commands {
+		if command == "" {
+			return fmt.Errorf("%w: '%s': empty command", ErrInvalidAlias, name)
+		}
+	}
+	previous, existed := state.aliases[name]
+	if state.aliases == nil {
+		state.aliases = make(map[string][]string)
+	}
+	state.aliases[name] = commands
+	if _, err := state.expandAlias(name, nil); err != nil {
+		if existed {
+			state.aliases[name] = previous
+		} else {
+			delete(state.aliases, name)
+		}
+		return err
+	}
+	return nil
+}
+
+/*
+ Returns the command lines to be executed for the given command line:
+ if the whole command line (ignoring surrounding whitespace) is the name of an alias, the commands of the alias,
+ each of which is expanded in turn; otherwise the command line itself.
+ 'expanding' holds the names of the aliases currently being expanded, to detect an alias referring to itself.
+*/
+func (state *State) expandAlias(cmdLine string, expanding []string) ([]string, error) {
+	name := strings.TrimSpace(cmdLine)
+	commands, ok := state.aliases[name]
+	if !ok {
+		return []string{cmdLine}, nil
+	}
+	for _, n := range expanding {
+		if n == name {
+			return nil, fmt.Errorf("%w: %s -> %s", ErrAliasCycle, strings.Join(expanding, " -> "), name)
+		}
+	}
+	expanding = append(expanding[:len(expanding):len(expanding)], name)
+	var expanded []string
+	for _, command := range commands {
+		lines, err := state.expandAlias(command, expanding)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, lines...)
+	}
+	return expanded, nil
+}
+
+/*
+ParseCommand parses the command line as ParseCommand does, having first expanded any alias (see DefineAlias).
+
+ An alias is used if the whole command line is its name. The command returned then executes
+ the commands of the alias in turn, stopping at the first error; they are undone together by a single 'u'.
+*/
+func (state *State) ParseCommand(cmdLine string) (Command, error) {
+	lines, err := state.expandAlias(cmdLine, nil)
+	if err != nil {
+		return Command{}, err
+	}
+	if len(lines) == 1 && lines[0] == cmdLine {
+		return ParseCommand(cmdLine, state.Debug)
+	}
+	// check all the commands before the first is executed
+	for _, line := range lines {
+		if _, err := ParseCommand(line, state.Debug); err != nil {
+			return Command{}, fmt.Errorf("alias '%s': %w", strings.TrimSpace(cmdLine), err)
+		}
+	}
+	unspecified := newUnspecifiedAddress()
+	return Command{addrRange: AddressRange{unspecified, unspecified, separatorComma}, cmd: commandRunAlias, restOfCmd: strings.Join(lines, "\n")}, nil
+}
+
+/*
+ Executes the commands of an alias, as expanded by State.ParseCommand (one command per line of restOfCmd).
+ Returns true if one of the commands quit the editor.
+*/
+func (cmd Command) runAlias(state *State, inGlobalCommand bool) (quit bool, err error) {
+	for _, line := range strings.Split(cmd.restOfCmd, "\n") {
+		aliasCmd, err := ParseCommand(line, state.Debug)
+		if err != nil {
+			return quit, err
+		}
+		cmdQuit, err := aliasCmd.ProcessCommand(state, nil, inGlobalCommand)
+		quit = quit || cmdQuit
+		if err != nil || quit {
+			return quit, err
+		}
+	}
+	return quit, nil
+}
+
+/*
+Alias shows or defines the command aliases.
+
+ alias                   prints all aliases
+ alias name              prints the commands of the alias
+ alias name = commands   defines the alias (see DefineAlias), e.g. 'alias wq! = w | Q'
+
+ Aliases can also be defined in the configuration file (see LoadConfig).
+*/
+func (cmd Command) Alias(state *State) error {
+	if err := cmd.validateAddress(state); err != nil {
+		return err
+	}
+	rest := strings.TrimSpace(cmd.restOfCmd)
+	switch {
+	case rest == "":
+		names := make([]string, 0, len(state.aliases))
+		for name := range state.aliases {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if !state.pageLine() {
+				break
+			}
+			fmt.Fprintf(state.Stdout, "%s = %s\n", name, formatAliasCommands(state.aliases[name]))
+		}
+	case strings.Contains(rest, "="):
+		if err := state.DefineAlias(rest); err != nil {
+			return fmt.Errorf("%s: %w", cmd.cmd, err)
+		}
+	default:
+		commands, ok := state.aliases[rest]
+		if !ok {
+			return fmt.Errorf("%s: %w: '%s'", cmd.cmd, ErrUnknownAlias, rest)
+		}
+		fmt.Fprintf(state.Stdout, "%s = %s\n", rest, formatAliasCommands(commands))
+	}
+	return nil
+}
+
+/*
+Unalias removes an alias.
+
+ unalias name
+*/
+func (cmd Command) Unalias(state *State) error {
+	if err := cmd.validateAddress(state); err != nil {
+		return err
+	}
+	name := strings.TrimSpace(cmd.restOfCmd)
+	if _, ok := state.aliases[name]; !ok {
+		return fmt.Errorf("%s: %w: '%s'", cmd.cmd, ErrUnknownAlias, name)
+	}
+	delete(state.aliases, name)
+	return nil
+}
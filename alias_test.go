@@ -0,0 +1,132 @@
+package red
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+/*
+ Processes the command line as entered at the prompt, i.e. expanding aliases.
+*/
+func processAliasedCommandLine(t *testing.T, state *State, cmdLine string) (bool, error) {
+	t.Helper()
+	cmd, err := state.ParseCommand(cmdLine)
+	if err != nil {
+		return false, err
+	}
+	return cmd.ProcessCommand(state, nil, false)
+}
+
+func TestSplitAliasCommands(t *testing.T) {
+	data := []struct {
+		definition string
+		expected   []string
+	}{
+		{".d", []string{".d"}},
+		{"w | Q", []string{"w", "Q"}},
+		{`s/a\|b/x/|p`, []string{"s/a|b/x/", "p"}},
+	}
+	for _, test := range data {
+		commands := splitAliasCommands(test.definition)
+		assertString(t, "wrong commands", strings.Join(commands, ","), strings.Join(test.expected, ","))
+		// formatting the commands gives the same commands again
+		assertString(t, "wrong formatted commands", strings.Join(splitAliasCommands(formatAliasCommands(commands)), ","), strings.Join(test.expected, ","))
+	}
+}
+
+func TestAlias(t *testing.T) {
+	state := resetState([]string{"a", "b", "c", "d"})
+	state.lineNbr = 1
+	for _, cmdLine := range []string{"alias dd = .d", "alias two = dd | dd", "alias yy=.y"} {
+		if _, err := processAliasedCommandLine(t, state, cmdLine); err != nil {
+			t.Fatalf("command '%s': error: %s", cmdLine, err)
+		}
+	}
+	if _, err := processAliasedCommandLine(t, state, " two "); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertBufferContents(t, state.Buffer, "c\nd\n")
+	// the commands of the alias are undone together
+	if _, err := processAliasedCommandLine(t, state, "u"); err != nil {
+		t.Fatalf("undo: error: %s", err)
+	}
+	assertBufferContents(t, state.Buffer, "a\nb\nc\nd\n")
+	// an alias is only used for the whole command line
+	if _, err := processAliasedCommandLine(t, state, "2,3dd"); err == nil {
+		t.Fatalf("expected error for '2,3dd'")
+	}
+
+	var output bytes.Buffer
+	state.Stdout = &output
+	for _, cmdLine := range []string{"alias", "alias dd", "unalias yy", "alias"} {
+		if _, err := processAliasedCommandLine(t, state, cmdLine); err != nil {
+			t.Fatalf("command '%s': error: %s", cmdLine, err)
+		}
+	}
+	assertString(t, "wrong output", output.String(),
+		"dd = .d\ntwo = dd | dd\nyy = .y\n"+"dd = .d\n"+"dd = .d\ntwo = dd | dd\n")
+}
+
+func TestAliasQuits(t *testing.T) {
+	state := resetState([]string{"a"})
+	state.changedSinceLastWrite = true
+	if err := state.DefineAlias("quit! = Q"); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	quit, err := processAliasedCommandLine(t, state, "quit!")
+	if err != nil || !quit {
+		t.Fatalf("expected quit, got quit=%t, %v", quit, err)
+	}
+}
+
+func TestAliasErrors(t *testing.T) {
+	data := []struct {
+		definitions []string
+		expected    error
+	}{
+		{[]string{"loop = loop"}, ErrAliasCycle},
+		{[]string{"a1 = p", "a2 = a1 | p", "a1 = a2"}, ErrAliasCycle},
+		{[]string{"x y = p"}, ErrInvalidAlias},
+		{[]string{"alias = p"}, ErrInvalidAlias},
+		{[]string{"empty = p |"}, ErrInvalidAlias},
+		{[]string{"noequals"}, ErrInvalidAlias},
+	}
+	for _, test := range data {
+		t.Run(strings.Join(test.definitions, ";"), func(t *testing.T) {
+			state := resetState(nil)
+			var err error
+			for _, definition := range test.definitions {
+				if err = state.DefineAlias(definition); err != nil {
+					break
+				}
+			}
+			if !errors.Is(err, test.expected) {
+				t.Fatalf("expected error %v, got %v", test.expected, err)
+			}
+		})
+	}
+	// a rejected definition leaves the previous definition in place
+	state := resetState(nil)
+	for _, definition := range []string{"a1 = p", "a2 = a1"} {
+		if err := state.DefineAlias(definition); err != nil {
+			t.Fatalf("error: %s", err)
+		}
+	}
+	if err := state.DefineAlias("a1 = a2"); !errors.Is(err, ErrAliasCycle) {
+		t.Fatalf("expected ErrAliasCycle, got %v", err)
+	}
+	assertString(t, "wrong alias", strings.Join(state.aliases["a1"], ","), "p")
+
+	if _, err := processAliasedCommandLine(t, state, "unalias nosuchalias"); !errors.Is(err, ErrUnknownAlias) {
+		t.Fatalf("expected ErrUnknownAlias, got %v", err)
+	}
+	// the commands are checked before any is executed
+	if err := state.DefineAlias("bad = p | )"); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if _, err := processAliasedCommandLine(t, state, "bad"); !errors.Is(err, ErrUnrecognisedCommand) {
+		t.Fatalf("expected ErrUnrecognisedCommand, got %v", err)
+	}
+}
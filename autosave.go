@@ -0,0 +1,129 @@
+package red
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// suffix of the recovery file written by autosave
+const recoveryFileSuffix = ".red.swp"
+
+// the name used for the recovery file of a buffer without a filename
+const unnamedBuffer = "unnamed"
+
+/*
+RecoveryFilename returns the name of the recovery file for the given file,
+i.e. '.<name>.red.swp' in the same directory as the file.
+*/
+func RecoveryFilename(filename string) string {
+	if filename == "" {
+		filename = unnamedBuffer
+	}
+	dir, name := filepath.Split(filename)
+	return filepath.Join(dir, "."+name+recoveryFileSuffix)
+}
+
+/*
+StartAutosave writes a snapshot of the buffer to the recovery file (see RecoveryFilename) every 'interval',
+if the buffer contains unsaved changes.
+
+ The recovery file is removed again once the buffer has been written, and when autosaving is stopped.
+ Returns a function which stops autosaving.
+*/
+func StartAutosave(state *State, interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				state.autosave()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(done)
+		state.commandMutex.Lock()
+		defer state.commandMutex.Unlock()
+		state.removeRecoveryFile()
+	}
+}
+
+/*
+ Returns the name of the recovery file for the buffer (see RecoveryFilename).
+ The recovery file of a buffer without a filename is kept in the directory for temporary files (see ApplyEnvironment).
+*/
+func (state *State) bufferRecoveryFilename() string {
+	if state.defaultFilename == "" {
+		return RecoveryFilename(filepath.Join(state.tempDir(), unnamedBuffer))
+	}
+	return RecoveryFilename(state.defaultFilename)
+}
+
+/*
+ Writes the buffer to the recovery file if it contains unsaved changes,
+ or removes the recovery file if the changes have been written in the meantime.
+*/
+func (state *State) autosave() {
+	state.commandMutex.Lock()
+	defer state.commandMutex.Unlock()
+	if !state.changedSinceLastWrite {
+		state.removeRecoveryFile()
+		return
+	}
+	filename := state.bufferRecoveryFilename()
+	if filename != state.recoveryFilename {
+		// the default filename has changed
+		state.removeRecoveryFile()
+	}
+	if _, err := WriteFile(filename, state.Buffer, 1, state.Buffer.Len()); err != nil {
+		fmt.Fprintf(state.Stderr, "autosave: %s\n", err)
+		return
+	}
+	state.recoveryFilename = filename
+}
+
+/*
+ Removes the recovery file written by the last autosave, if any.
+*/
+func (state *State) removeRecoveryFile() {
+	if state.recoveryFilename != "" {
+		os.Remove(state.recoveryFilename)
+		state.recoveryFilename = ""
+	}
+}
+
+/*
+OfferRecovery checks whether a recovery file exists for the default filename, e.g. after a crash,
+and if so asks the user whether it should be restored.
+
+ If the answer is 'y', the contents of the recovery file replace the buffer,
+ which then counts as containing unsaved changes.
+*/
+func (state *State) OfferRecovery() error {
+	filename := state.bufferRecoveryFilename()
+	if _, err := os.Stat(filename); err != nil {
+		return nil
+	}
+	fmt.Fprintf(state.Stdout, "recovery file %s found, restore it? (y/n) ", filename)
+	answer, err := state.InputReader().ReadString('\n')
+	if err != nil || strings.TrimSpace(answer) != "y" {
+		return nil
+	}
+	nbrBytesRead, listOfLines, err := ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	state.message(messageCount, "%dL, %dC", listOfLines.Len(), nbrBytesRead)
+	terminateLastLine(listOfLines)
+	state.replaceBuffer(newBufferOf(listOfLines), filename)
+	state.changedSinceLastWrite = true
+	state.recoveryFilename = filename
+	return moveToLine(state.Buffer.Len(), state)
+}
@@ -0,0 +1,119 @@
+package red
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecoveryFilename(t *testing.T) {
+	data := []struct {
+		filename string
+		expected string
+	}{
+		{"file.txt", ".file.txt.red.swp"},
+		{filepath.Join("dir", "file.txt"), filepath.Join("dir", ".file.txt.red.swp")},
+		{"", ".unnamed.red.swp"},
+	}
+	for _, test := range data {
+		assertString(t, "wrong recovery filename for "+test.filename, RecoveryFilename(test.filename), test.expected)
+	}
+}
+
+func TestAutosave(t *testing.T) {
+	dir, err := os.MkdirTemp("", "red-autosave")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	state := resetState([]string{"1", "2"})
+	state.defaultFilename = filepath.Join(dir, "file.txt")
+	recoveryFilename := RecoveryFilename(state.defaultFilename)
+
+	// nothing to save
+	state.autosave()
+	if _, err := os.Stat(recoveryFilename); err == nil {
+		t.Fatalf("recovery file should not have been written")
+	}
+
+	state.changedSinceLastWrite = true
+	state.autosave()
+	contents, err := os.ReadFile(recoveryFilename)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertString(t, "wrong recovery file contents", string(contents), "1\n2\n")
+
+	// the buffer has been written
+	state.changedSinceLastWrite = false
+	state.autosave()
+	if _, err := os.Stat(recoveryFilename); err == nil {
+		t.Fatalf("recovery file should have been removed")
+	}
+}
+
+func TestStartAutosave(t *testing.T) {
+	dir, err := os.MkdirTemp("", "red-autosave")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	state := resetState([]string{"1", "2"})
+	state.defaultFilename = filepath.Join(dir, "file.txt")
+	state.changedSinceLastWrite = true
+	recoveryFilename := RecoveryFilename(state.defaultFilename)
+
+	stop := StartAutosave(state, time.Millisecond)
+	for i := 0; i < 100; i++ {
+		if _, err = os.Stat(recoveryFilename); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		stop()
+		t.Fatalf("recovery file was not written")
+	}
+	stop()
+	if _, err := os.Stat(recoveryFilename); err == nil {
+		t.Fatalf("recovery file should have been removed")
+	}
+}
+
+func TestOfferRecovery(t *testing.T) {
+	dir, err := os.MkdirTemp("", "red-autosave")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "file.txt")
+	if err := os.WriteFile(RecoveryFilename(filename), []byte("a\nb\nc\n"), 0666); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+
+	for _, answer := range []string{"n", "y"} {
+		state := resetState([]string{"1", "2"})
+		state.defaultFilename = filename
+		state.Input = bufio.NewReader(strings.NewReader(answer + "\n"))
+		var output bytes.Buffer
+		state.Stdout = &output
+		if err := state.OfferRecovery(); err != nil {
+			t.Fatalf("error: %s", err)
+		}
+		if answer == "n" {
+			assertBufferContents(t, state.Buffer, "1\n2\n")
+		} else {
+			assertBufferContents(t, state.Buffer, "a\nb\nc\n")
+			assertInt(t, "wrong state.lineNbr!", state.lineNbr, 3)
+			if !state.changedSinceLastWrite {
+				t.Fatalf("expected changedSinceLastWrite")
+			}
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package red
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var ErrOverlappingEdits error = errors.New("overlapping edits")
+
+/*
+Tx collects the changes of a batch of edits, see Editor.Batch.
+
+ All line numbers refer to the buffer as it was when the batch was started,
+ i.e. the edits can be staged in any order without taking account of the lines inserted or deleted by other edits.
+ The lines to be inserted are given without trailing newlines (as returned by Editor.Lines).
+*/
+type Tx struct {
+	bufferLen int
+	edits     []stagedEdit
+}
+
+/*
+ A change staged in a Tx: the lines 'start' to 'end' are replaced by 'lines'.
+ An insertion after line n has start = n+1 and end = n.
+*/
+type stagedEdit struct {
+	start, end int
+	lines      []string
+}
+
+/*
+Insert stages the insertion of the lines after the given line (0: at the start of the buffer).
+ Lines inserted after the same line appear in the order in which they were staged.
+*/
+func (tx *Tx) Insert(afterLineNbr int, lines ...string) error {
+	if afterLineNbr < 0 || afterLineNbr > tx.bufferLen {
+		return errorInvalidLine(fmt.Sprintf("%d, max line: %d", afterLineNbr, tx.bufferLen), nil)
+	}
+	return tx.stage(afterLineNbr+1, afterLineNbr, lines)
+}
+
+/*
+Delete stages the deletion of the lines startLineNbr to endLineNbr (inclusive).
+*/
+func (tx *Tx) Delete(startLineNbr, endLineNbr int) error {
+	return tx.Replace(startLineNbr, endLineNbr)
+}
+
+/*
+Replace stages the replacement of the lines startLineNbr to endLineNbr (inclusive) by the given lines.
+*/
+func (tx *Tx) Replace(startLineNbr, endLineNbr int, lines ...string) error {
+	if startLineNbr < 1 || startLineNbr > endLineNbr || endLineNbr > tx.bufferLen {
+		return errorInvalidLine(fmt.Sprintf("%d,%d, max line: %d", startLineNbr, endLineNbr, tx.bufferLen), nil)
+	}
+	return tx.stage(startLineNbr, endLineNbr, lines)
+}
+
+func (tx *Tx) stage(start, end int, lines []string) error {
+	for _, line := range lines {
+		if strings.Contains(line, "\n") {
+			return fmt.Errorf("%w: line contains a newline: %q", ErrInvalidArgument, line)
+		}
+	}
+	tx.edits = append(tx.edits, stagedEdit{start: start, end: end, lines: lines})
+	return nil
+}
+
+/*
+ Sorts the edits by their position in the buffer, and checks that they do not overlap.
+ An insertion before a line comes before a change of that line.
+*/
+func (tx *Tx) sortEdits() error {
+	sort.SliceStable(tx.edits, func(i, j int) bool {
+		a, b := tx.edits[i], tx.edits[j]
+		if a.start != b.start {
+			return a.start < b.start
+		}
+		return a.end < b.end
+	})
+	for i := 1; i < len(tx.edits); i++ {
+		previous, edit := tx.edits[i-1], tx.edits[i]
+		if previous.end >= edit.start {
+			return fmt.Errorf("%w: lines %d,%d and %d,%d", ErrOverlappingEdits, previous.start, previous.end, edit.start, edit.end)
+		}
+	}
+	return nil
+}
+
+/*
+Batch makes a number of changes to the buffer in one step.
+
+ The function 'fn' stages the changes with the Tx given to it. If it returns an error, nothing is changed.
+ Otherwise the changes are applied together: they are undone by a single 'u',
+ and the buffer is marked as changed once. The changes must not overlap.
+ If applying the changes fails, the buffer is restored.
+
+ The current line is set to the last line inserted by the last change in the buffer,
+ or, if that change only deleted lines, to the line after the deleted lines (or the last line).
+*/
+func (e *Editor) Batch(fn func(tx *Tx) error) error {
+	state := e.state
+	tx := &Tx{bufferLen: state.Buffer.Len()}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.sortEdits(); err != nil {
+		return err
+	}
+	if len(tx.edits) == 0 {
+		return nil
+	}
+	state.beginUndoTransaction()
+	if err := tx.apply(state); err != nil {
+		// restore the buffer, without recording the changes made whilst doing so
+		failed := state.currentUndo
+		state.beginUndoTransaction()
+		if undoErr := failed.apply(state); undoErr != nil {
+			err = fmt.Errorf("%w (the buffer could not be restored: %s)", err, undoErr)
+		}
+		state.currentUndo = nil
+		return err
+	}
+	state.endUndoTransaction()
+	state.changedSinceLastWrite = true
+	return nil
+}
+
+/*
+ Applies the sorted edits, starting with the last, so that the line numbers of the other edits remain valid.
+*/
+func (tx *Tx) apply(state *State) error {
+	// where the last edit ends up, once the edits before it have been applied
+	last := tx.edits[len(tx.edits)-1]
+	shift := 0
+	for _, edit := range tx.edits[:len(tx.edits)-1] {
+		shift += len(edit.lines) - (edit.end - edit.start + 1)
+	}
+	for i := len(tx.edits) - 1; i >= 0; i-- {
+		edit := tx.edits[i]
+		if edit.end >= edit.start {
+			deleted, err := deleteLines(edit.start, edit.end, state)
+			if err != nil {
+				return err
+			}
+			state.addUndo(edit.start-1, edit.start-1, commandAppend, deleted)
+		}
+		if len(edit.lines) > 0 {
+			newLines := list.New()
+			for _, line := range edit.lines {
+				newLines.PushBack(Line{line + "\n"})
+			}
+			if err := appendLines(edit.start-1, state, newLines); err != nil {
+				return err
+			}
+			state.addUndo(edit.start, edit.start+newLines.Len()-1, commandDelete, nil)
+		}
+	}
+	lineNbr := last.start + shift + len(last.lines) - 1
+	if len(last.lines) == 0 {
+		lineNbr = minIntOf(last.start+shift, state.Buffer.Len())
+	}
+	return moveToLine(lineNbr, state)
+}
@@ -0,0 +1,146 @@
+package red
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func createBatchEditor(t *testing.T) *Editor {
+	t.Helper()
+	editor := NewEditor()
+	if _, err := editor.Execute("a\n1\n2\n3\n4\n5\n."); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	editor.State().changedSinceLastWrite = false
+	editor.State().undo.Init()
+	return editor
+}
+
+func assertEditorLines(t *testing.T, editor *Editor, expected string) {
+	t.Helper()
+	lines, err := editor.Lines(1, editor.Len())
+	if err != nil {
+		lines = nil
+	}
+	assertString(t, "wrong lines", strings.Join(lines, ","), expected)
+}
+
+func TestBatch(t *testing.T) {
+	data := []struct {
+		name            string
+		stage           func(tx *Tx) error
+		expected        string
+		expectedLineNbr int
+	}{
+		{"insert", func(tx *Tx) error { return tx.Insert(2, "a", "b") }, "1,2,a,b,3,4,5", 4},
+		{"insert at start", func(tx *Tx) error { return tx.Insert(0, "a") }, "a,1,2,3,4,5", 1},
+		{"delete", func(tx *Tx) error { return tx.Delete(2, 3) }, "1,4,5", 2},
+		{"delete last lines", func(tx *Tx) error { return tx.Delete(4, 5) }, "1,2,3", 3},
+		{"replace", func(tx *Tx) error { return tx.Replace(3, 3, "x", "y") }, "1,2,x,y,4,5", 4},
+		{"line numbers refer to the original buffer", func(tx *Tx) error {
+			if err := tx.Replace(5, 5, "e"); err != nil {
+				return err
+			}
+			if err := tx.Delete(1, 2); err != nil {
+				return err
+			}
+			return tx.Insert(3, "x", "y", "z")
+		}, "3,x,y,z,4,e", 6},
+		{"inserts at the same position keep their order", func(tx *Tx) error {
+			if err := tx.Replace(2, 2, "b"); err != nil {
+				return err
+			}
+			if err := tx.Insert(1, "x"); err != nil {
+				return err
+			}
+			if err := tx.Insert(1, "y"); err != nil {
+				return err
+			}
+			return tx.Insert(2, "z")
+		}, "1,x,y,b,z,3,4,5", 5},
+	}
+	for _, test := range data {
+		t.Run(test.name, func(t *testing.T) {
+			editor := createBatchEditor(t)
+			if err := editor.Batch(test.stage); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertEditorLines(t, editor, test.expected)
+			assertInt(t, "wrong line nbr", editor.State().lineNbr, test.expectedLineNbr)
+			if !editor.Dirty() {
+				t.Fatalf("expected editor to be dirty")
+			}
+			// the whole batch is undone at once, and can be redone
+			assertInt(t, "wrong nbr of undo entries", editor.State().undo.Len(), 1)
+			if _, err := editor.Execute("u"); err != nil {
+				t.Fatalf("undo: error: %s", err)
+			}
+			assertEditorLines(t, editor, "1,2,3,4,5")
+			if _, err := editor.Execute("U"); err != nil {
+				t.Fatalf("redo: error: %s", err)
+			}
+			assertEditorLines(t, editor, test.expected)
+		})
+	}
+}
+
+func TestBatchErrors(t *testing.T) {
+	errStop := errors.New("stop")
+	data := []struct {
+		name     string
+		stage    func(tx *Tx) error
+		expected error
+	}{
+		{"error from function", func(tx *Tx) error {
+			if err := tx.Delete(1, 1); err != nil {
+				return err
+			}
+			return errStop
+		}, errStop},
+		{"overlapping edits", func(tx *Tx) error {
+			if err := tx.Delete(1, 3); err != nil {
+				return err
+			}
+			return tx.Replace(3, 4, "x")
+		}, ErrOverlappingEdits},
+		{"insert within a changed range", func(tx *Tx) error {
+			if err := tx.Insert(2, "x"); err != nil {
+				return err
+			}
+			return tx.Delete(2, 3)
+		}, ErrOverlappingEdits},
+		{"invalid line", func(tx *Tx) error { return tx.Delete(5, 6) }, ErrAddressOutOfRange},
+		{"newline in a line", func(tx *Tx) error { return tx.Insert(1, "a\nb") }, ErrInvalidArgument},
+	}
+	for _, test := range data {
+		t.Run(test.name, func(t *testing.T) {
+			editor := createBatchEditor(t)
+			if err := editor.Batch(test.stage); !errors.Is(err, test.expected) {
+				t.Fatalf("expected error %v, got %v", test.expected, err)
+			}
+			assertEditorLines(t, editor, "1,2,3,4,5")
+			assertInt(t, "wrong nbr of undo entries", editor.State().undo.Len(), 0)
+			if editor.Dirty() {
+				t.Fatalf("expected editor not to be dirty")
+			}
+		})
+	}
+}
+
+func TestBatchMarks(t *testing.T) {
+	editor := createBatchEditor(t)
+	if _, err := editor.Execute("4ka"); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	err := editor.Batch(func(tx *Tx) error {
+		if err := tx.Delete(1, 2); err != nil {
+			return err
+		}
+		return tx.Insert(5, "x")
+	})
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertInt(t, "wrong mark", editor.State().marks["a"], 2)
+}
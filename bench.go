@@ -0,0 +1,138 @@
+package red
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"time"
+)
+
+var errNotAllowedInBench error = errors.New("command cannot be used when benchmarking")
+
+/*
+BenchStats stores the timing and allocation statistics of one command of a benchmarked script.
+*/
+type BenchStats struct {
+	Command       string        // the command as entered
+	Runs          int           // number of times the command was executed
+	Errors        int           // number of executions which returned an error
+	Total         time.Duration // total execution time
+	Min, Max      time.Duration // fastest and slowest execution
+	Allocs, Bytes uint64        // total number of allocations and bytes allocated
+}
+
+/*
+Avg returns the average execution time.
+*/
+func (s BenchStats) Avg() time.Duration {
+	if s.Runs == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Runs)
+}
+
+func (s BenchStats) String() string {
+	if s.Runs == 0 {
+		return fmt.Sprintf("%-20s runs=0", s.Command)
+	}
+	return fmt.Sprintf("%-20s runs=%d errors=%d min=%v avg=%v max=%v allocs/op=%d bytes/op=%d", s.Command, s.Runs, s.Errors,
+		s.Min, s.Avg(), s.Max, s.Allocs/uint64(s.Runs), s.Bytes/uint64(s.Runs))
+}
+
+/*
+Bench replays the given commands 'nbrRuns' times, each time on a throwaway copy of the state,
+and returns timing and allocation statistics for each command.
+
+ The given state is not changed. Any output of the commands is discarded.
+ Commands which require input, access files, run shell commands, or quit the editor are not allowed.
+ Errors returned by the commands (e.g. a substitution which does not match) are counted, but do not stop the benchmark.
+*/
+func Bench(state *State, commands []string, nbrRuns int) ([]BenchStats, error) {
+	if nbrRuns < 1 {
+		return nil, fmt.Errorf("bench: invalid number of runs: %d", nbrRuns)
+	}
+	parsedCommands := make([]Command, len(commands))
+	for i, cmdStr := range commands {
+		cmd, err := ParseCommand(cmdStr, false)
+		if err != nil {
+			return nil, fmt.Errorf("bench: command %d ('%s'): %w", i+1, cmdStr, err)
+		}
+		switch cmd.cmd {
+		case commandAppend, commandInsert, commandChange,
+			commandGlobalInteractive, commandInverseGlobalInteractive,
+			commandEdit, commandEditUnconditionally, commandNextFile, commandPreviousFile, commandOpenBuffer, commandRead, commandDiff, commandRevert,
+			commandWrite, commandWriteAppend, commandWriteQuit, commandWriteAppendQuit, commandShell, commandExtension,
+			commandQuit, commandQuitUnconditionally:
+			return nil, fmt.Errorf("bench: command %d ('%s'): %w", i+1, cmdStr, errNotAllowedInBench)
+		}
+		parsedCommands[i] = cmd
+	}
+
+	stats := make([]BenchStats, len(commands))
+	for i, cmdStr := range commands {
+		stats[i].Command = cmdStr
+	}
+	var before, after runtime.MemStats
+	for run := 0; run < nbrRuns; run++ {
+		copyOfState, err := state.clone()
+		if err != nil {
+			return nil, fmt.Errorf("bench: %w", err)
+		}
+		copyOfState.Stdout = io.Discard
+		for i, cmd := range parsedCommands {
+			runtime.ReadMemStats(&before)
+			start := time.Now()
+			_, err := cmd.ProcessCommand(copyOfState, nil, false)
+			elapsed := time.Since(start)
+			runtime.ReadMemStats(&after)
+
+			s := &stats[i]
+			if err != nil {
+				s.Errors++
+			}
+			if s.Runs == 0 || elapsed < s.Min {
+				s.Min = elapsed
+			}
+			if elapsed > s.Max {
+				s.Max = elapsed
+			}
+			s.Runs++
+			s.Total += elapsed
+			s.Allocs += after.Mallocs - before.Mallocs
+			s.Bytes += after.TotalAlloc - before.TotalAlloc
+		}
+	}
+	return stats, nil
+}
+
+/*
+ Returns a copy of the state, with its own copy of the buffer, cut buffer, registers and marks.
+ The undo and redo lists of the copy are empty.
+*/
+func (state *State) clone() (*State, error) {
+	newState := *state
+	lines := list.New()
+	if state.Buffer.Len() != 0 {
+		if err := state.Buffer.Iterate(1, state.Buffer.Len(), func(lineNbr int, line *Line) { lines.PushBack(*line) }); err != nil {
+			return nil, err
+		}
+	}
+	newState.Buffer = newBufferOf(lines)
+	newState.CutBuffer = list.New()
+	newState.CutBuffer.PushBackList(state.CutBuffer)
+	newState.registers = make(map[string]*list.List, len(state.registers))
+	for name, lines := range state.registers {
+		newState.registers[name] = list.New()
+		newState.registers[name].PushBackList(lines)
+	}
+	newState.marks = make(map[string]int, len(state.marks))
+	for name, lineNbr := range state.marks {
+		newState.marks[name] = lineNbr
+	}
+	newState.undo = list.New()
+	newState.redo = list.New()
+	newState.currentUndo = nil
+	return &newState, nil
+}
@@ -0,0 +1,72 @@
+package red
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBench(t *testing.T) {
+	state := resetState([]string{"a", "b", "c", "d"})
+	state.lineNbr = 2
+	commands := []string{"1,2j", "$m0", "y", "2,3s/x/y/"}
+	stats, err := Bench(state, commands, 3)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertInt(t, "wrong number of stats", len(stats), len(commands))
+	for i, s := range stats {
+		assertString(t, "wrong command", s.Command, commands[i])
+		assertInt(t, "wrong number of runs", s.Runs, 3)
+		if s.Min > s.Max || s.Total < s.Max {
+			t.Fatalf("inconsistent timings for '%s': %+v", s.Command, s)
+		}
+	}
+	// the substitution never matches
+	assertInt(t, "wrong number of errors", stats[3].Errors, 3)
+	assertInt(t, "wrong number of errors", stats[0].Errors, 0)
+
+	// the original state is unchanged
+	assertBufferContents(t, state.Buffer, "a\nb\nc\nd\n")
+	assertInt(t, "wrong state.lineNbr!", state.lineNbr, 2)
+	assertInt(t, "wrong cut buffer len", state.CutBuffer.Len(), 0)
+	assertInt(t, "wrong undo len", state.undo.Len(), 0)
+}
+
+func TestBenchDiscardsOutput(t *testing.T) {
+	state := resetState([]string{"a", "b"})
+	var output bytes.Buffer
+	state.Stdout = &output
+	if _, err := Bench(state, []string{",p", "="}, 2); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertString(t, "unexpected output", output.String(), "")
+}
+
+func TestBenchInvalid(t *testing.T) {
+	state := resetState([]string{"a", "b"})
+	for _, commands := range [][]string{{"1d", "a"}, {"w file"}, {"q"}, {"G/a/"}, {"V/a/"}, {"1,2,3,4p"}} {
+		if _, err := Bench(state, commands, 1); err == nil {
+			t.Fatalf("expected error for %v", commands)
+		}
+	}
+	if _, err := Bench(state, []string{"p"}, 0); err == nil {
+		t.Fatalf("expected error for 0 runs")
+	}
+}
+
+func TestClone(t *testing.T) {
+	state := resetState([]string{"a", "b", "c"})
+	state.lineNbr = 3
+	state.addMark("x", 2)
+	newState, err := state.clone()
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if _, err := newState.Buffer.DeleteRange(1, 1); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	newState.addMark("x", 1)
+	assertBufferContents(t, state.Buffer, "a\nb\nc\n")
+	assertInt(t, "wrong mark", state.marks["x"], 2)
+	assertInt(t, "wrong current line of copy", newState.lineNbr, 3)
+}
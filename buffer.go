@@ -0,0 +1,169 @@
+package red
+
+import (
+	"container/list"
+	"fmt"
+)
+
+/*
+Buffer stores the lines being edited. Lines are numbered from 1 to Len().
+
+ Lines are passed in and out as lists of Line (the same as e.g. the cut buffer).
+ It is an error to access a line outside the buffer.
+*/
+type Buffer interface {
+	// Len returns the number of lines in the buffer.
+	Len() int
+	// Get returns the given line. The line must not be changed (use Set instead).
+	Get(lineNbr int) (*Line, error)
+	// Set replaces the given line.
+	Set(lineNbr int, line Line) error
+	// InsertAfter inserts the lines after the given line. Line 0 inserts at the start of the buffer.
+	InsertAfter(lineNbr int, lines *list.List) error
+	// DeleteRange deletes the given lines from the buffer and returns them.
+	DeleteRange(startLineNbr, endLineNbr int) (*list.List, error)
+	// Iterate calls fn for each of the given lines in turn.
+	Iterate(startLineNbr, endLineNbr int, fn func(lineNbr int, line *Line)) error
+}
+
+/*
+NewBuffer creates an empty buffer.
+*/
+func NewBuffer() Buffer {
+	return &sliceBuffer{}
+}
+
+/*
+ Creates a buffer containing the given lines.
+*/
+func newBufferOf(lines *list.List) Buffer {
+	buffer := NewBuffer()
+	_ = buffer.InsertAfter(0, lines) // cannot fail for an empty buffer
+	return buffer
+}
+
+/*
+sliceBuffer stores the lines in a slice, giving constant-time access to any line.
+
+ Each line is stored as a pointer. Set always stores a new pointer, therefore the
+ identity of a line (as used by 'g') changes whenever the line is changed.
+*/
+type sliceBuffer struct {
+	lines []*Line
+	// lengths[i] is the total length of the lines 1 to i+1; only the first nbrLengths entries are valid (see cumulativeLength)
+	lengths    []int64
+	nbrLengths int
+}
+
+/*
+ Implemented by buffers which keep the cumulative lengths of their lines,
+ so that the position of a line in the file can be found without reading all the lines before it.
+*/
+type lengthIndexer interface {
+	// cumulativeLength returns the total length in bytes of the lines 1 to lineNbr (0 for line 0).
+	cumulativeLength(lineNbr int) (int64, error)
+}
+
+func (b *sliceBuffer) Len() int {
+	return len(b.lines)
+}
+
+func (b *sliceBuffer) Get(lineNbr int) (*Line, error) {
+	if lineNbr < 1 || lineNbr > len(b.lines) {
+		return nil, errorInvalidLine(fmt.Sprintf("%d, max line: %d", lineNbr, len(b.lines)), nil)
+	}
+	return b.lines[lineNbr-1], nil
+}
+
+func (b *sliceBuffer) Set(lineNbr int, line Line) error {
+	if lineNbr < 1 || lineNbr > len(b.lines) {
+		return errorInvalidLine(fmt.Sprintf("%d, max line: %d", lineNbr, len(b.lines)), nil)
+	}
+	b.lines[lineNbr-1] = &line
+	b.invalidateLengths(lineNbr)
+	return nil
+}
+
+func (b *sliceBuffer) InsertAfter(lineNbr int, lines *list.List) error {
+	if lineNbr < 0 || lineNbr > len(b.lines) {
+		return errorInvalidLine(fmt.Sprintf("%d, max line: %d", lineNbr, len(b.lines)), nil)
+	}
+	nbrLines := lines.Len()
+	if nbrLines == 0 {
+		return nil
+	}
+	newLines := make([]*Line, 0, nbrLines)
+	for el := lines.Front(); el != nil; el = el.Next() {
+		line := el.Value.(Line)
+		newLines = append(newLines, &line)
+	}
+	oldLen := len(b.lines)
+	// make room, then move the following lines up
+	b.lines = append(b.lines, newLines...)
+	copy(b.lines[lineNbr+nbrLines:], b.lines[lineNbr:oldLen])
+	copy(b.lines[lineNbr:], newLines)
+	b.invalidateLengths(lineNbr + 1)
+	return nil
+}
+
+func (b *sliceBuffer) DeleteRange(startLineNbr, endLineNbr int) (*list.List, error) {
+	if err := checkLineRange(startLineNbr, endLineNbr, b); err != nil {
+		return nil, err
+	}
+	deleted := list.New()
+	for _, line := range b.lines[startLineNbr-1 : endLineNbr] {
+		deleted.PushBack(*line)
+	}
+	oldLen := len(b.lines)
+	b.lines = append(b.lines[:startLineNbr-1], b.lines[endLineNbr:]...)
+	// release the lines no longer referenced
+	tail := b.lines[len(b.lines):oldLen]
+	for i := range tail {
+		tail[i] = nil
+	}
+	b.invalidateLengths(startLineNbr)
+	return deleted, nil
+}
+
+func (b *sliceBuffer) Iterate(startLineNbr, endLineNbr int, fn func(lineNbr int, line *Line)) error {
+	if err := checkLineRange(startLineNbr, endLineNbr, b); err != nil {
+		return err
+	}
+	for lineNbr := startLineNbr; lineNbr <= endLineNbr; lineNbr++ {
+		fn(lineNbr, b.lines[lineNbr-1])
+	}
+	return nil
+}
+
+/*
+ The cumulative lengths are calculated as required, and are invalidated from the first line changed.
+ Changes near the end of the buffer (e.g. appending text) therefore only cost the recalculation of the lines after the change.
+*/
+func (b *sliceBuffer) cumulativeLength(lineNbr int) (int64, error) {
+	if lineNbr < 0 || lineNbr > len(b.lines) {
+		return 0, errorInvalidLine(fmt.Sprintf("%d, max line: %d", lineNbr, len(b.lines)), nil)
+	}
+	if lineNbr == 0 {
+		return 0, nil
+	}
+	if len(b.lengths) < len(b.lines) {
+		b.lengths = append(b.lengths, make([]int64, len(b.lines)-len(b.lengths))...)
+	}
+	for ; b.nbrLengths < lineNbr; b.nbrLengths++ {
+		var previous int64
+		if b.nbrLengths > 0 {
+			previous = b.lengths[b.nbrLengths-1]
+		}
+		b.lengths[b.nbrLengths] = previous + int64(len(b.lines[b.nbrLengths].Line))
+	}
+	return b.lengths[lineNbr-1], nil
+}
+
+/*
+ Invalidates the cumulative lengths of the given line and the lines after it.
+*/
+func (b *sliceBuffer) invalidateLengths(lineNbr int) {
+	if b.nbrLengths >= lineNbr {
+		b.nbrLengths = lineNbr - 1
+	}
+}
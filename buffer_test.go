@@ -0,0 +1,240 @@
+package red
+
+import (
+	"container/list"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestBufferInsertAfter(t *testing.T) {
+	data := []struct {
+		lineNbr  int
+		expected string
+	}{
+		{0, "x\ny\n1\n2\n3\n"},
+		{1, "1\nx\ny\n2\n3\n"},
+		{3, "1\n2\n3\nx\ny\n"},
+	}
+	for _, test := range data {
+		t.Run(fmt.Sprintf("after %d", test.lineNbr), func(t *testing.T) {
+			buffer := createBuffer([]string{"1", "2", "3"})
+			if err := buffer.InsertAfter(test.lineNbr, createListOfLines([]string{"x", "y"})); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertBufferContents(t, buffer, test.expected)
+		})
+	}
+}
+
+func TestBufferInsertAfterEmptyList(t *testing.T) {
+	buffer := createBuffer([]string{"1", "2"})
+	if err := buffer.InsertAfter(1, list.New()); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertBufferContents(t, buffer, "1\n2\n")
+}
+
+func TestBufferDeleteRange(t *testing.T) {
+	data := []struct {
+		start, end              int
+		expected, expectedLines string
+	}{
+		{1, 1, "2\n3\n4\n", "1\n"},
+		{2, 3, "1\n4\n", "2\n3\n"},
+		{1, 4, "", "1\n2\n3\n4\n"},
+	}
+	for _, test := range data {
+		t.Run(fmt.Sprintf("%d,%d", test.start, test.end), func(t *testing.T) {
+			buffer := createBuffer([]string{"1", "2", "3", "4"})
+			deleted, err := buffer.DeleteRange(test.start, test.end)
+			if err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertBufferContents(t, buffer, test.expected)
+			assertListContents(t, deleted, test.expectedLines)
+		})
+	}
+}
+
+func TestBufferSet(t *testing.T) {
+	buffer := createBuffer([]string{"1", "2", "3"})
+	before, _ := buffer.Get(2)
+	if err := buffer.Set(2, Line{"x\n"}); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	after, _ := buffer.Get(2)
+	if before == after {
+		t.Fatalf("expected a new line to be stored")
+	}
+	assertBufferContents(t, buffer, "1\nx\n3\n")
+}
+
+func TestBufferIterate(t *testing.T) {
+	buffer := createBuffer([]string{"1", "2", "3", "4"})
+	var contents string
+	if err := buffer.Iterate(2, 3, func(lineNbr int, line *Line) { contents += fmt.Sprintf("%d:%s", lineNbr, line.Line) }); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertString(t, "wrong lines", contents, "2:2\n3:3\n")
+}
+
+func TestBufferInvalidLines(t *testing.T) {
+	buffer := createBuffer([]string{"1", "2", "3"})
+	if _, err := buffer.Get(0); err == nil {
+		t.Fatalf("expected error for Get(0)")
+	}
+	if _, err := buffer.Get(4); err == nil {
+		t.Fatalf("expected error for Get(4)")
+	}
+	if err := buffer.Set(4, Line{"x\n"}); err == nil {
+		t.Fatalf("expected error for Set(4)")
+	}
+	if err := buffer.InsertAfter(4, createListOfLines([]string{"x"})); err == nil {
+		t.Fatalf("expected error for InsertAfter(4)")
+	}
+	if _, err := buffer.DeleteRange(2, 4); err == nil {
+		t.Fatalf("expected error for DeleteRange(2,4)")
+	}
+	if err := buffer.Iterate(0, 2, func(lineNbr int, line *Line) {}); err == nil {
+		t.Fatalf("expected error for Iterate(0,2)")
+	}
+	assertBufferContents(t, buffer, "1\n2\n3\n")
+}
+
+const benchmarkBufferSize = 1000000
+
+/*
+Creates a state with a buffer of 1M lines, every 10th line contains 'match'.
+*/
+func createBenchmarkState() *State {
+	lines := list.New()
+	for i := 1; i <= benchmarkBufferSize; i++ {
+		if i%10 == 0 {
+			lines.PushBack(Line{fmt.Sprintf("line %d: a line which will match\n", i)})
+		} else {
+			lines.PushBack(Line{fmt.Sprintf("line %d: the quick brown fox\n", i)})
+		}
+	}
+	state := NewState()
+	state.Buffer = newBufferOf(lines)
+	state.lineNbr = state.Buffer.Len()
+	return state
+}
+
+/*
+Runs the given command once per iteration. The undo list is reset (outside of the timing) after each run.
+*/
+func benchmarkCommand(b *testing.B, cmdLine string) {
+	state := createBenchmarkState()
+	cmd, err := ParseCommand(cmdLine, false)
+	if err != nil {
+		b.Fatalf("error: %s", err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := cmd.ProcessCommand(state, nil, false); err != nil {
+			b.Fatalf("error: %s", err)
+		}
+		b.StopTimer()
+		state.undo = list.New()
+		b.StartTimer()
+	}
+}
+
+func BenchmarkPrint(b *testing.B) {
+	state := createBenchmarkState()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := _printRange(io.Discard, 1, state.Buffer.Len(), state, false, false); err != nil {
+			b.Fatalf("error: %s", err)
+		}
+	}
+}
+
+func BenchmarkPrintLastLines(b *testing.B) {
+	state := createBenchmarkState()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := _printRange(io.Discard, state.Buffer.Len()-10, state.Buffer.Len(), state, false, false); err != nil {
+			b.Fatalf("error: %s", err)
+		}
+	}
+}
+
+func BenchmarkSubstitute(b *testing.B) {
+	benchmarkCommand(b, "1,$s/match/match/")
+}
+
+func BenchmarkSubstituteLastLines(b *testing.B) {
+	benchmarkCommand(b, "$-10,$s/match/match/")
+}
+
+func BenchmarkGlobal(b *testing.B) {
+	benchmarkCommand(b, "g/match/s/a/a/")
+}
+
+/*
+Moves through the buffer from the middle, one command per iteration, starting again at the middle at the end of the buffer.
+Since lines are accessed by their index, the cost does not depend on the position in the buffer.
+*/
+func benchmarkNavigation(b *testing.B, cmdLine string) {
+	state := createBenchmarkState()
+	state.Stdout = io.Discard
+	cmd, err := ParseCommand(cmdLine, false)
+	if err != nil {
+		b.Fatalf("error: %s", err)
+	}
+	middle := state.Buffer.Len() / 2
+	state.lineNbr = middle
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if state.lineNbr > state.Buffer.Len()-state.WindowSize-1 {
+			state.lineNbr = middle
+		}
+		if _, err := cmd.ProcessCommand(state, nil, false); err != nil {
+			b.Fatalf("error: %s", err)
+		}
+	}
+}
+
+func BenchmarkNextLine(b *testing.B) {
+	benchmarkNavigation(b, "+1p")
+}
+
+func BenchmarkScroll(b *testing.B) {
+	benchmarkNavigation(b, "z")
+}
+
+func TestBufferCumulativeLength(t *testing.T) {
+	buffer := createBuffer([]string{"a", "bb", "ccc"}).(*sliceBuffer)
+	assertLengths := func(expected ...int64) {
+		t.Helper()
+		for lineNbr, length := range expected {
+			actual, err := buffer.cumulativeLength(lineNbr)
+			if err != nil {
+				t.Fatalf("line %d: error: %s", lineNbr, err)
+			}
+			if actual != length {
+				t.Fatalf("line %d: expected length %d, got %d", lineNbr, length, actual)
+			}
+		}
+	}
+	assertLengths(0, 2, 5, 9)
+	// each change invalidates the lengths from the line changed
+	if err := buffer.Set(2, Line{"b\n"}); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertLengths(0, 2, 4, 8)
+	if err := buffer.InsertAfter(1, createListOfLines([]string{"xxxx"})); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertLengths(0, 2, 7, 9, 13)
+	if _, err := buffer.DeleteRange(1, 2); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertLengths(0, 2, 6)
+	if _, err := buffer.cumulativeLength(3); err == nil {
+		t.Fatalf("expected error for line beyond the buffer")
+	}
+}
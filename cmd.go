@@ -6,7 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"os"
+	"io/fs"
 	"regexp"
 	"strconv"
 	"strings"
@@ -15,17 +15,35 @@ import (
 // ---- constants for the available commands
 const (
 	commandAppend                   string = "a"
+	commandAppendText               string = "A"
+	commandAlias                    string = "alias"
 	commandChange                   string = "c"
+	commandCount                    string = "C"
 	commandDelete                   string = "d"
+	commandDeleteMarks              string = "delmarks"
+	commandDiff                     string = "diff"
+	commandDOS                      string = "dos"
 	commandEdit                     string = "e"
 	commandEditUnconditionally      string = "E"
 	commandFilename                 string = "f"
+	commandNextFile                 string = "fn"
+	commandPreviousFile             string = "fp"
+	commandReflow                   string = "F"
 	commandGlobal                   string = "g"
 	commandGlobalInteractive        string = "G"
-	commandHelp                     string = "h" // a startling departure from the ed range of commands ...
+	commandGrep                     string = "grep"
+	commandHelp                     string = "h"
+	commandHelpLong                 string = "help" // a startling departure from the ed range of commands ...
+	commandHistory                  string = "history"
+	commandVerboseErrors            string = "H"
 	commandInsert                   string = "i"
+	commandInsertText               string = "I"
 	commandJoin                     string = "j"
 	commandMark                     string = "k"
+	commandMarks                    string = "marks"
+	commandListBuffers              string = "ls"
+	commandOpenBuffer               string = "new"
+	commandNumberLines              string = "N"
 	commandList                     string = "l" // print suffix
 	commandMove                     string = "m"
 	commandNumber                   string = "n" // print suffix
@@ -34,53 +52,77 @@ const (
 	commandQuit                     string = "q"
 	commandQuitUnconditionally      string = "Q"
 	commandRead                     string = "r"
+	commandRevert                   string = "revert"
+	commandReverse                  string = "reverse"
 	commandSubstitute               string = "s"
+	commandSet                      string = "set"
+	commandSwitchBuffer             string = "switch"
+	commandSort                     string = "sort"
 	commandTransfer                 string = "t"
+	commandRetab                    string = "T"
 	commandUndo                     string = "u"
+	commandUnix                     string = "unix"
+	commandUniq                     string = "uniq"
+	commandUnalias                  string = "unalias"
+	commandRedo                     string = "U"
 	commandInverseGlobal            string = "v"
 	commandInverseGlobalInteractive string = "V"
 	commandWrite                    string = "w"
 	commandWriteAppend              string = "W"
+	commandWriteQuit                string = "wq"
+	commandWriteAppendQuit          string = "Wq"
 	commandPut                      string = "x"
+	commandPutBefore                string = "X"
 	commandYank                     string = "y"
 	commandScroll                   string = "z"
+	commandPrintContext             string = "Z"
 	commandComment                  string = "#"
+	commandTemplate                 string = "@"
 	commandLinenumber               string = "="
-
-	internalCommandUndoMove  string = ")" // an internal command to undo the 'move' command (which requires two steps)
-	internalCommandUndoSubst string = "(" // an internal command to undo the 'subst' command (which is 1..n 'change' commands)
-	commandNoCommand         string = ""  // returned when an empty line was entered
+	commandShell                    string = "!"
+	commandIgnoreCase               string = "~"
+	commandShiftRight               string = ">"
+	commandShiftLeft                string = "<"
+	commandExtension                string = "|"
+
+	commandNoCommand string = ""        // returned when an empty line was entered
+	commandRunAlias  string = "(alias)" // executes the commands of an alias, see State.ParseCommand -- cannot be entered
 )
 
-const unsavedChanges string = "buffer has unsaved changes"
+const currentLineMarker string = "> " // marks the current line when printing, see state.HighlightDot
 
-var (
-	errInvalidWindowSize         error = errors.New("invalid window size")
-	errBadMarkname               error = errors.New("a name of a mark must be one char: a-z")
-	errMissingFilename           error = errors.New("filename missing and no default set")
-	errNotAllowedInGlobalCommand error = errors.New("command cannot be used within 'g'/'v'")
-	errNothingToUndo             error = errors.New("nothing to undo")
-	errUnrecognisedCommand       error = errors.New("unrecognised command")
-	errAddressHasNotBeenResolved error = errors.New("address has not been resolved")
-)
+const listLineLength int = 72 // the 'l' command folds lines longer than this
+
+// characters which are written as escape sequences by the 'l' command
+var listEscapes = map[byte]string{'\\': `\\`, '$': `\$`, '\a': `\a`, '\b': `\b`, '\f': `\f`, '\r': `\r`, '\t': `\t`, '\v': `\v`}
 
+// suffixes for the 'j' command
 const (
-	_simplifiedAddressRE = `([+-]?\d+|[\.\$\+-]|'[a-z]|\/[^\/]*\/|\?[^\?]*\?|\s*)+`
-	_commandRE           = `[acdeEfgGhijklmnpPqQrstuvVwWxyz#=]`
+	joinWithSpace        string = "+" // join with a space
+	joinWithoutSeparator string = "-" // join without a separator
 )
 
 var (
-	singleLetterRE = regexp.MustCompile(`^([a-z])$`)
-	// This RE matches user input of the form addr1 sep addr2 cmd (everything is optional, whitespace allowed anywhere)
-	// The group 'addrRange' will contain addr1 sep addr2.
-	// The group 'cmd' will contain everything else (note: a command is optional)
-	// In case of syntax errors (e.g. nonterminated regex, mark followed by number), the 'cmd' group will contain the string starting at the error
-	commandLineRE = regexp.MustCompile(
-		"^(?P<addrRange>" + _simplifiedAddressRE +
-			"[,;]?" + _simplifiedAddressRE +
-			")(?P<cmd>" + _commandRE + "?)(?P<rest>.*)$")
+	ErrInvalidWindowSize         error = errors.New("invalid window size")
+	ErrBadMarkName               error = errors.New("a name of a mark must be one char: a-z")
+	ErrMissingFilename           error = errors.New("filename missing and no default set")
+	ErrNotAllowedInGlobalCommand error = errors.New("command cannot be used within 'g'/'v'")
+	ErrNothingToUndo             error = errors.New("nothing to undo")
+	ErrNothingToRedo             error = errors.New("nothing to redo")
+	ErrUnrecognisedCommand       error = errors.New("unrecognised command")
+	ErrUnsavedChanges            error = errors.New("buffer has unsaved changes")
+	ErrInvalidArgument           error = errors.New("invalid argument")
+	errAddressHasNotBeenResolved error = errors.New("address has not been resolved")
 )
 
+var singleLetterRE = regexp.MustCompile(`^([a-z])$`)
+
+// commands consisting of more than one character. The first character is always a command in its own right, see parseMultiCharCommand
+var multiCharCommands = []string{commandHelpLong, commandHistory, commandNextFile, commandPreviousFile, commandDOS, commandUnix, commandSet,
+	commandWriteQuit, commandWriteAppendQuit, commandMarks, commandDeleteMarks, commandDiff,
+	commandRevert, commandReverse, commandSort, commandUniq, commandGrep, commandOpenBuffer, commandListBuffers, commandSwitchBuffer,
+	commandAlias, commandUnalias}
+
 type resolvedAddress struct {
 	start, end int
 }
@@ -95,10 +137,35 @@ type Command struct {
 	resolved          resolvedAddress // resolved addresses
 	cmd               string          // command identifier
 	restOfCmd         string          // rest of command, if present
+	printSuffix       string          // print suffixes ('p', 'n', 'l') given after the command, if any
+}
+
+// commands which accept print suffixes, e.g. '3d p'. ('s' handles its suffixes itself)
+var printSuffixCommands = map[string]bool{
+	commandAppend: true, commandChange: true, commandDelete: true, commandInsert: true, commandJoin: true,
+	commandList: true, commandMove: true, commandNumber: true, commandPrint: true,
+	commandPut: true, commandPutBefore: true, commandTransfer: true, commandUndo: true, commandRedo: true,
+	commandShiftRight: true, commandShiftLeft: true,
 }
 
+/*
+ Splits any print suffixes off the end of the rest of the command.
+ A character preceded by a quote is not a suffix, since it is the name of a mark (e.g. 'm'p') or of a register (e.g. 'x "p').
+*/
+func splitPrintSuffix(restOfCmd string) (string, string) {
+	end := len(restOfCmd)
+	for end > 0 && strings.ContainsAny(restOfCmd[end-1:end], commandList+commandNumber+commandPrint) &&
+		!(end > 1 && (restOfCmd[end-2] == '\'' || restOfCmd[end-2] == registerPrefix[0])) {
+		end--
+	}
+	return strings.TrimSpace(restOfCmd[:end]), restOfCmd[end:]
+}
+
+/*
+ Resolves the address range of the command. If no address has been specified, the current line is used.
+*/
 func (cmd *Command) resolveAddress(state *State) error {
-	start, end, err := cmd.addrRange.calculateStartAndEndLineNumbers(state.lineNbr, state.Buffer, state.marks)
+	start, end, err := cmd.addrRange.getAddressRange(state)
 	if err != nil {
 		return err
 	}
@@ -116,13 +183,14 @@ func (cmd *Command) createNewResolvedCommand(newCmdIdent, newRestOfCmd string) (
 	if !cmd.addressIsResolved {
 		return newCmd, errAddressHasNotBeenResolved
 	}
-	newCmd = Command{addressIsResolved: true, resolved: resolvedAddress{start: cmd.resolved.start, end: cmd.resolved.end},
+	newCmd = Command{addrRange: cmd.addrRange, addressIsResolved: true, resolved: resolvedAddress{start: cmd.resolved.start, end: cmd.resolved.end},
 		cmd: newCmdIdent, restOfCmd: newRestOfCmd}
 	return newCmd, nil
 }
 
 /*
 ParseCommand parses the given string and creates a Command object.
+ A syntax error is reported as a SyntaxError, giving the column of the error.
 */
 func ParseCommand(str string, debug bool) (cmd Command, err error) {
 	if debug {
@@ -132,55 +200,47 @@ func ParseCommand(str string, debug bool) (cmd Command, err error) {
 		// newline alone == +1p
 		str = "+1p"
 	}
-	matches := findNamedMatches(commandLineRE, str, true)
-	/*
-		if matches == nil {
-			// add on implicit "p" and try again
-			matches = commandLineRE.FindStringSubmatch(str + "p")
-		}
-	*/
-	// the RE really always matches. In case of a syntax error, 'addrRange' and 'cmd' will be empty and 'rest' will be filled
-	if matches != nil {
-		addrString := strings.TrimSpace(matches["addrRange"])
-		cmdString := strings.TrimSpace(matches["cmd"])
-		restOfCmd := strings.TrimSpace(matches["rest"])
-		if debug {
-			fmt.Printf("parsed addrString: '%s', cmd: '%s', rest: %s\n", addrString, cmdString, restOfCmd)
-		}
+	line, err := parseCommandLine(str)
+	if err != nil {
+		return Command{}, err
+	}
+	if debug {
+		fmt.Printf("parsed addrString: '%s', cmd: '%s', rest: %s\n", line.addrString, line.cmd, line.rest)
+	}
+	cmdString, restOfCmd := line.cmd, strings.TrimSpace(line.rest)
+	if cmdString == "" {
+		// an address on its own prints the addressed line
+		cmdString = commandPrint
+	} else if longCmd, rest, ok := parseMultiCharCommand(cmdString, line.rest); ok {
+		cmdString, restOfCmd = longCmd, strings.TrimSpace(rest)
+	}
+	cmd = Command{parsedAddrString: line.addrString, addrRange: line.addrRange, cmd: cmdString, restOfCmd: restOfCmd}
+	if printSuffixCommands[cmdString] {
+		cmd.restOfCmd, cmd.printSuffix = splitPrintSuffix(restOfCmd)
+	}
+	if debug {
+		fmt.Printf("parsed cmd: '%v'\n", cmd)
+	}
+	return cmd, nil
+}
 
-		if len(cmdString) == 0 && len(restOfCmd) != 0 && (restOfCmd[0:1] == "/" || restOfCmd[0:1] == "?") {
-			return Command{}, fmt.Errorf("could not parse command (non-terminated regex?)")
+/*
+ Checks whether the single-character command and the (untrimmed) rest of the command form one of the multiCharCommands,
+ e.g. 'h' and "elp s" form the command 'help' with the rest "s".
+ The multi-character command must be followed by whitespace, '!', or nothing.
+*/
+func parseMultiCharCommand(cmd, rest string) (multiCharCmd, restOfCmd string, ok bool) {
+	for _, multiCharCmd := range multiCharCommands {
+		if !strings.HasPrefix(multiCharCmd, cmd) || !strings.HasPrefix(rest, multiCharCmd[len(cmd):]) {
+			continue
 		}
-		addrRange, err := newRange(addrString)
-		if err != nil {
-			return Command{}, fmt.Errorf("could not parse address range: %w", err)
-		} else {
-			// if cmdString is empty, then use implicit "p"
-			if len(cmdString) == 0 {
-				// in this case, make sure restOfCmd is also empty
-				if len(restOfCmd) != 0 {
-					return Command{}, fmt.Errorf("general parse error")
-				}
-				cmdString = "p"
-			} else {
-				// check command
-				var cmdMatch bool
-				if cmdMatch, err = regexp.MatchString(_commandRE, cmdString); err != nil {
-					return Command{}, fmt.Errorf("RE error parsing command: '%s', error: %w", cmdString, err)
-				}
-				if !cmdMatch {
-					return Command{}, fmt.Errorf("could not parse command: '%s'", cmdString)
-				}
-			}
-			cmd := Command{parsedAddrString: addrString, addrRange: addrRange, cmd: cmdString, restOfCmd: restOfCmd}
-			if debug {
-				fmt.Printf("parsed cmd: '%v'\n", cmd)
-			}
-			return cmd, nil
+		rest = rest[len(multiCharCmd)-len(cmd):]
+		if rest == "" || strings.TrimSpace(rest[:1]) == "" || rest[:1] == "!" {
+			return multiCharCmd, rest, true
 		}
-	} else {
-		return Command{}, errUnrecognisedCommand
+		return "", "", false
 	}
+	return "", "", false
 }
 
 /*
@@ -193,14 +253,14 @@ inserts text in the buffer before the addressed line.
    insert: it is equivalent to address '1'.
 
  The current address is set to the address of the last line entered or,
- if there were none, to the addressed line.
+ if there were none (in which case the buffer is unchanged), to the addressed line.
 
  If the parameter "inputLines" is specified, this input will be used.
  Otherwise the user must input the required lines, terminated by ".".
 */
 func (cmd Command) AppendInsert(state *State, inputLines *list.List) error {
-	if !cmd.addressIsResolved {
-		return errAddressHasNotBeenResolved
+	if err := cmd.validateAddress(state); err != nil {
+		return err
 	}
 
 	var newLines *list.List
@@ -210,12 +270,13 @@ func (cmd Command) AppendInsert(state *State, inputLines *list.List) error {
 		newLines = inputLines
 		nbrLinesEntered = inputLines.Len()
 	} else {
-		if newLines, nbrLinesEntered, err = readInputLines(); err != nil {
+		if newLines, nbrLinesEntered, err = readInputLines(state.InputReader()); err != nil {
 			return err
 		}
 	}
+	// nothing entered: the buffer is unchanged
 	if nbrLinesEntered == 0 {
-		return nil
+		return moveToLine(cmd.resolved.start, state)
 	}
 
 	state.changedSinceLastWrite = true
@@ -224,11 +285,10 @@ func (cmd Command) AppendInsert(state *State, inputLines *list.List) error {
 	// or insert with line 0 or 1
 
 	if (cmd.cmd == commandAppend && cmd.resolved.start == 0) || (cmd.cmd == commandInsert && cmd.resolved.start <= 1) {
-		state.Buffer.PushFrontList(newLines)
-		moveToLine(nbrLinesEntered, state)
-		if !state.processingUndo {
-			state.addUndo(1, nbrLinesEntered, commandDelete, newLines, cmd)
+		if err = appendLines(0, state, newLines); err != nil {
+			return err
 		}
+		state.addUndo(1, nbrLinesEntered, commandDelete, newLines)
 	} else {
 		var startAddrForUndo, endAddrForUndo int
 		lineNbr := cmd.resolved.start
@@ -241,9 +301,11 @@ func (cmd Command) AppendInsert(state *State, inputLines *list.List) error {
 			startAddrForUndo = lineNbr + 1
 			endAddrForUndo = lineNbr + nbrLinesEntered
 		}
-		appendLines(lineNbr, state, newLines)
+		if err = appendLines(lineNbr, state, newLines); err != nil {
+			return err
+		}
 
-		state.addUndo(startAddrForUndo, endAddrForUndo, commandDelete, newLines, cmd)
+		state.addUndo(startAddrForUndo, endAddrForUndo, commandDelete, newLines)
 	}
 
 	return nil
@@ -254,18 +316,23 @@ Change changes lines in the buffer.
 
  The addressed lines are deleted from the buffer, and text is inserted in their place.
 
+ If no lines are entered, the addressed lines are deleted (as for 'd').
+
  The current address is set to the address of the last line entered or, if there were none,
  to the new address of the line after the last line deleted;
  if the lines deleted were originally at the end of the buffer,
  the current address is set to the address of the new last line;
  if no lines remain in the buffer, the current address is set to zero.
+
+ As for 'd', the deleted lines can be stored in a register instead of the cut buffer (e.g. 'c "a').
 */
 func (cmd Command) Change(state *State, inputLines *list.List) error {
-	if !cmd.addressIsResolved {
-		return errAddressHasNotBeenResolved
+	if err := cmd.validateAddress(state); err != nil {
+		return err
 	}
-	if cmd.resolved.start == 0 {
-		return fmt.Errorf("change: %w", errorInvalidLine("start line is 0", nil))
+	// check the register before reading any input
+	if _, _, err := parseRegisterName(cmd.restOfCmd); err != nil {
+		return fmt.Errorf("change: %w", err)
 	}
 
 	var (
@@ -277,20 +344,20 @@ func (cmd Command) Change(state *State, inputLines *list.List) error {
 		newLines = inputLines
 		nbrLinesEntered = inputLines.Len()
 	} else {
-		// get the input, abort if empty
-		if newLines, nbrLinesEntered, err = readInputLines(); err != nil {
+		if newLines, nbrLinesEntered, err = readInputLines(state.InputReader()); err != nil {
 			return err
 		}
 	}
-	if nbrLinesEntered == 0 {
-		return nil
-	}
 
 	// delete the lines
 	deleteCmd, err := cmd.createNewResolvedCommand(commandDelete, cmd.restOfCmd)
 	if err != nil {
 		return err
 	}
+	// if nothing was entered, the change is a delete (with the undo of a delete)
+	if nbrLinesEntered == 0 {
+		return deleteCmd.Delete(state, true)
+	}
 	if err = deleteCmd.Delete(state, false); err != nil {
 		return err
 	}
@@ -308,12 +375,16 @@ func (cmd Command) Change(state *State, inputLines *list.List) error {
 	state.changedSinceLastWrite = true
 
 	if atEOF {
-		appendLines(startLineNbr, state, newLines)
+		if err := appendLines(startLineNbr, state, newLines); err != nil {
+			return err
+		}
 		// "change" is its own inverse
-		state.addUndo(startLineNbr+1, startLineNbr+newLines.Len(), commandChange, state.CutBuffer, cmd)
+		state.addUndo(startLineNbr+1, startLineNbr+newLines.Len(), commandChange, state.CutBuffer)
 	} else {
-		appendLines(startLineNbr-1, state, newLines)
-		state.addUndo(startLineNbr, startLineNbr+newLines.Len()-1, commandChange, state.CutBuffer, cmd)
+		if err := appendLines(startLineNbr-1, state, newLines); err != nil {
+			return err
+		}
+		state.addUndo(startLineNbr, startLineNbr+newLines.Len()-1, commandChange, state.CutBuffer)
 	}
 
 	return nil
@@ -335,53 +406,48 @@ Delete deletes the addressed lines from the buffer.
    the current address is set to the address of the new last line;
  if no lines remain in the buffer, the current address is set to zero.
 
- Deleted lines are stored in the state.CutBuffer.
+ Deleted lines are stored in the state.CutBuffer, or in a register if one is given (e.g. 'd "a').
+ If the name of the register is in upper case (e.g. 'd "A'), the lines are appended to the register.
 
  If addUndo is true, an undo command will be stored in state.undo.
- (This will be affected by the value of state.processingUndo)
 */
 func (cmd Command) Delete(state *State, addUndo bool) error {
-	if !cmd.addressIsResolved {
-		return errAddressHasNotBeenResolved
+	if err := cmd.validateAddress(state); err != nil {
+		return err
 	}
-	if cmd.resolved.start == 0 {
-		return fmt.Errorf("delete: %w", errorInvalidLine("start line is 0", nil))
+	registerName, appendTo, err := parseRegisterName(cmd.restOfCmd)
+	if err != nil {
+		return fmt.Errorf("delete: %w", err)
+	}
+	// the marks of the deleted lines are removed by deleteLines, and are restored by an undo
+	deletedMarks := state.marksInRange(cmd.resolved.start, cmd.resolved.end)
+	tempBuffer, err := deleteLines(cmd.resolved.start, cmd.resolved.end, state)
+	if err != nil {
+		return fmt.Errorf("delete: %w", err)
 	}
-
-	tempBuffer := deleteLines(cmd.resolved.start, cmd.resolved.end, state)
-
 	if tempBuffer.Len() == 0 {
 		return nil
 	}
 
-	state.CutBuffer = tempBuffer
+	state.setRegister(registerName, tempBuffer, appendTo)
 	state.changedSinceLastWrite = true
 	bufferLen := state.Buffer.Len()
 
-	state.updateMarks(commandDelete, cmd.resolved.start, cmd.resolved.end, -1)
-
-	// inverse of delete m..n  ist insert at m
+	// inverse of delete m..n is append at m-1 (which also works if the last lines have been deleted)
 	if addUndo {
-		// special case: we've deleted the last line
-		if cmd.resolved.start > bufferLen {
-			// undo of $d is $-1,a
-			state.addUndo(endOfFile, endOfFile, commandAppend, tempBuffer, cmd)
-		} else {
-			state.addUndo(cmd.resolved.start, cmd.resolved.start, commandInsert, tempBuffer, cmd)
-		}
+		state.addUndoWithMarks(cmd.resolved.start-1, cmd.resolved.start-1, commandAppend, tempBuffer, deletedMarks)
 	}
 
-	// set up line nbr and dotline
+	// set up line nbr
 
 	newLineNbr := cmd.resolved.start
 	if bufferLen == 0 {
-		state.dotline = nil
 		state.lineNbr = 0
 	} else {
 		if newLineNbr > bufferLen {
 			newLineNbr = bufferLen
 		}
-		moveToLine(newLineNbr, state)
+		return moveToLine(newLineNbr, state)
 	}
 	return nil
 }
@@ -389,31 +455,88 @@ func (cmd Command) Delete(state *State, addUndo bool) error {
 /*
 Edit reads in a file, and sets the default filename.
   If file is not specified, then the default filename is used.
+  If file is '!command', the output of the shell command is read instead. The default filename is unchanged.
   Any lines in the buffer are deleted before the new file is read.
   The current address is set to the address of the last line in the buffer.
-  Resets undo buffer.
+  Resets undo and redo buffers.
 */
 func (cmd Command) Edit(state *State) error {
-	filename, err := getFilename(strings.TrimSpace(cmd.restOfCmd), state, true)
+	filename := strings.TrimSpace(cmd.restOfCmd)
+	largeBuffer, nbrBytesRead, mixed, err := state.openLargeFileForEdit(filename)
 	if err != nil {
 		return err
 	}
-	nbrBytesRead, listOfLines, err := ReadFile(filename)
-	if err != nil {
-		return err
+	var buffer Buffer
+	var dos, noFinalNewline bool
+	var enc fileEncoding
+	if largeBuffer != nil {
+		buffer, dos, noFinalNewline = largeBuffer, largeBuffer.dos, largeBuffer.noFinalNewline
+	} else {
+		var listOfLines *list.List
+		if nbrBytesRead, listOfLines, enc, err = readFileOrShellCommand(filename, state, true); err != nil {
+			return err
+		}
+		dos, mixed = stripDOSLineEndings(listOfLines)
+		noFinalNewline = terminateLastLine(listOfLines)
+		buffer = newBufferOf(listOfLines)
+	}
+	if !state.Silent {
+		state.message(messageCount, "%dL, %dC", buffer.Len(), nbrBytesRead)
+	}
+	if mixed && !state.Silent {
+		state.message(messageInfo, "mixed line endings, will be written with %s line endings", lineEndingName(dos))
+	}
+	state.dosLineEndings = dos
+	state.fileEncoding = enc
+	state.noFinalNewline = noFinalNewline
+	if filename == "" {
+		filename = state.defaultFilename
 	}
-	fmt.Printf("%dL, %dC\n", listOfLines.Len(), nbrBytesRead)
-	state.Buffer = listOfLines
+	state.replaceBuffer(buffer, filename)
 	state.changedSinceLastWrite = false
 	state.undo = list.New()
-	moveToLine(state.Buffer.Len(), state)
-	return nil
+	state.redo = list.New()
+	return moveToLine(state.Buffer.Len(), state)
+}
+
+/*
+Revert reloads the default file, discarding all changes to the buffer.
+
+ revert
+
+ Unlike 'E', no filename can be given, i.e. the buffer is always replaced by the file it was read from.
+ As for 'e', the undo and redo lists are cleared and the marks are removed.
+ The current address is unchanged, unless the file now has fewer lines, in which case it is set to the last line.
+*/
+func (cmd Command) Revert(state *State) error {
+	if err := cmd.validateAddress(state); err != nil {
+		return err
+	}
+	if strings.TrimSpace(cmd.restOfCmd) != "" {
+		return fmt.Errorf("%s: %w: no filename may be given", cmd.cmd, ErrInvalidArgument)
+	}
+	if state.defaultFilename == "" {
+		return fmt.Errorf("%s: %w", cmd.cmd, ErrMissingFilename)
+	}
+	currentLine := state.lineNbr
+	if err := (Command{cmd: commandEditUnconditionally}).Edit(state); err != nil {
+		return err
+	}
+	return moveToLine(minIntOf(currentLine, state.Buffer.Len()), state)
 }
 
 /*
 Join joins the addressed lines, replacing them by a single line containing their joined text.
 
- If only one address is given, this command does nothing.
+ (.,.)j[+|-|/separator/][p|n|l]
+
+ By default the lines are joined using state.JoinSeparator, which is empty (as in ed) unless configured.
+   +            joins the lines with a space
+   -            joins the lines without a separator
+   /separator/  joins the lines with the given separator (any character can be used as the delimiter)
+
+ If only one address is given, this command does nothing,
+ unless state.JoinNext is set, in which case the addressed line is joined with the following line.
 
  If lines are joined, the current address is set to the address of the joined line.
  Else, the current address is unchanged.
@@ -423,20 +546,39 @@ Join joins the addressed lines, replacing them by a single line containing their
 func (cmd Command) Join(state *State) error {
 	var err error
 
-	if !cmd.addressIsResolved {
-		return errAddressHasNotBeenResolved
+	if err := cmd.validateAddress(state); err != nil {
+		return err
 	}
-	var sb strings.Builder
-	joinFn := func(lineNbr int, el *list.Element, state *State) {
-		line := el.Value.(Line).Line
-		// replace the newline with a space
-		sb.WriteString(strings.Replace(line, "\n", " ", 1))
+	separator := state.JoinSeparator
+	switch arg := strings.TrimSpace(cmd.restOfCmd); arg {
+	case "":
+		// use default
+	case joinWithSpace:
+		separator = " "
+	case joinWithoutSeparator:
+		separator = ""
+	default:
+		if separator, err = parseDelimitedArg(arg); err != nil {
+			return fmt.Errorf("join: %w", err)
+		}
+	}
+	if cmd.resolved.start == cmd.resolved.end {
+		if !state.JoinNext || cmd.resolved.end >= state.Buffer.Len() {
+			return nil
+		}
+		cmd.resolved.end++
+	}
+
+	var lines []string
+	joinFn := func(lineNbr int, line *Line, state *State) {
+		lines = append(lines, strings.TrimSuffix(line.Line, "\n"))
 	}
-	iterateLines(cmd.resolved.start, cmd.resolved.end, state, joinFn)
-	// the last line has had an extra space added; remove this and add newline again
-	joinedLines := sb.String()[0:sb.Len()-1] + "\n"
+	if err = iterateLines(cmd.resolved.start, cmd.resolved.end, state, joinFn); err != nil {
+		return fmt.Errorf("join: %w", err)
+	}
+	joinedLines := strings.Join(lines, separator) + "\n"
 
-	changeCommand, err := cmd.createNewResolvedCommand(commandChange, cmd.restOfCmd)
+	changeCommand, err := cmd.createNewResolvedCommand(commandChange, "")
 	if err != nil {
 		return err
 	}
@@ -449,13 +591,29 @@ func (cmd Command) Join(state *State) error {
 /*
 Linenumber prints the line number of the addressed line.
 
+ (.)=
+ (.)=b   also prints the byte offset at which the line starts in the file, and the length of the line in bytes and runes,
+         in the format: line=<n> offset=<n> bytes=<n> runes=<n>
+
+ The byte offset includes the line endings of the preceding lines, as they are written by 'w'.
+ The length of the line does not include its line ending.
+
  The current address is unchanged.
 */
 func (cmd Command) Linenumber(state *State) error {
-	if !cmd.addressIsResolved {
-		return errAddressHasNotBeenResolved
+	if err := cmd.validateAddress(state); err != nil {
+		return err
+	}
+	switch arg := strings.TrimSpace(cmd.restOfCmd); arg {
+	case "":
+		fmt.Fprintln(state.Stdout, cmd.resolved.start)
+	case linenumberOffsets:
+		if err := printLineOffsets(state, cmd.resolved.start); err != nil {
+			return fmt.Errorf("%s: %w", cmd.cmd, err)
+		}
+	default:
+		return fmt.Errorf("%s: %w: '%s'", cmd.cmd, ErrInvalidArgument, arg)
 	}
-	fmt.Println(cmd.resolved.start)
 	return nil
 }
 
@@ -463,23 +621,20 @@ func (cmd Command) Linenumber(state *State) error {
 Mark marks the given line.
 
 Name of the mark must be one char (a..z)
- It is an error if an address range is specified.
+ If an address range is specified, the last line of the range is marked.
 
  The current address is unchanged.
 */
 func (cmd Command) Mark(state *State) error {
-	if !cmd.addressIsResolved {
-		return errAddressHasNotBeenResolved
+	if err := cmd.validateAddress(state); err != nil {
+		return err
 	}
 	matches := singleLetterRE.FindStringSubmatch(strings.TrimSpace(cmd.restOfCmd))
 	if matches == nil {
-		return errBadMarkname
+		return ErrBadMarkName
 	}
 	markName := matches[1]
-	if cmd.addrRange.end.isSpecified() {
-		return ErrRangeMayNotBeSpecified
-	}
-	state.addMark(markName, cmd.resolved.start)
+	state.addMark(markName, cmd.resolved.end)
 	return nil
 }
 
@@ -494,12 +649,12 @@ Move moves lines in the buffer.
 
  The current address is set to the new address of the last line moved.
 
- Undo is handled by storing the special command 'internalCommandUndoMove'.
+ The undo is a delete of the moved lines, followed by an append at their original position.
 */
 func (cmd Command) Move(state *State) error {
 	// default is current line (for both start/end, and dest)
-	if !cmd.addressIsResolved {
-		return errAddressHasNotBeenResolved
+	if err := cmd.validateAddress(state); err != nil {
+		return err
 	}
 	var destLineNbr int
 	var err error
@@ -512,14 +667,11 @@ func (cmd Command) Move(state *State) error {
 		if destLine, err = newAddress(destStr); err != nil {
 			return errorInvalidDestination(destStr, err)
 		}
-		if destLineNbr, err = destLine.calculateActualLineNumber(state.lineNbr, state.Buffer, state.marks); err != nil {
+		if destLineNbr, err = destLine.calculateActualLineNumber(state.lineNbr, state); err != nil {
 			return errorInvalidDestination(destStr, err)
 		}
 	}
 	startLineNbr := cmd.resolved.start
-	if startLineNbr == 0 {
-		return errorInvalidLine("start line=0", nil)
-	}
 	if destLineNbr > state.Buffer.Len() {
 		return errorInvalidDestination(fmt.Sprintf("dest line: %d > last line: %d", destLineNbr, state.Buffer.Len()), nil)
 	}
@@ -529,20 +681,25 @@ func (cmd Command) Move(state *State) error {
 	}
 
 	// delete the lines
-	tempBuffer := deleteLines(startLineNbr, cmd.resolved.end, state)
+	tempBuffer, err := deleteLines(startLineNbr, cmd.resolved.end, state)
+	if err != nil {
+		return fmt.Errorf("move: %w", err)
+	}
 	if tempBuffer.Len() == 0 {
 		return nil
 	}
 
-	state.updateMarks(commandMove, startLineNbr, cmd.resolved.end, destLineNbr)
-
 	// adjust destination line number if it has been affected by the delete
 	if destLineNbr >= startLineNbr {
 		destLineNbr -= (cmd.resolved.end - startLineNbr + 1)
 	}
 
-	appendLines(destLineNbr, state, tempBuffer)
-	state.addUndo(destLineNbr+1, destLineNbr+tempBuffer.Len(), internalCommandUndoMove, tempBuffer, cmd)
+	if err = appendLines(destLineNbr, state, tempBuffer); err != nil {
+		return err
+	}
+	// stored in reverse order, since the undo commands are processed last first
+	state.addUndo(startLineNbr-1, startLineNbr-1, commandAppend, tempBuffer)
+	state.addUndo(destLineNbr+1, destLineNbr+tempBuffer.Len(), commandDelete, nil)
 	state.changedSinceLastWrite = true
 	return nil
 }
@@ -551,36 +708,58 @@ func (cmd Command) Move(state *State) error {
 Print prints the addressed lines.
 
  For command "n": Precedes each line by its line number and a <tab>.
+ For command "l": Prints the lines unambiguously: the end of each line is marked with '$',
+   backslashes, '$' and the characters \a \b \f \r \t \v are printed as escape sequences,
+   other non-printable characters (and bytes > 126) are printed as octal escapes (e.g. \033),
+   and lines longer than 72 characters are folded, the point of folding being marked with a backslash.
+   If the file did not end with a newline, the last line is not marked with '$'.
 
  The current address is set to the address of the last line printed.
 */
 func (cmd Command) Print(state *State) error {
-	if !cmd.addressIsResolved {
-		return errAddressHasNotBeenResolved
+	if err := cmd.validateAddress(state); err != nil {
+		return err
 	}
 	// no address specified defaults to .
 	// TODO don't think this can occur anymore
 	if !cmd.addrRange.IsSpecified() {
 		cmd.addrRange = newValidRange(identDot)
 	}
-	return _printRange(os.Stdout, cmd.resolved.start, cmd.resolved.end, state, cmd.cmd == commandNumber)
+	printLineNumbers := cmd.cmd == commandNumber || strings.Contains(cmd.printSuffix, commandNumber)
+	listLines := cmd.cmd == commandList || strings.Contains(cmd.printSuffix, commandList)
+	// the lines found by a search are printed with the matches highlighted
+	var highlight *regexp.Regexp
+	if cmd.addrRange.containsRegex() {
+		highlight = state.lastSearchRE
+	}
+	return _printRangeHighlighted(state.Stdout, cmd.resolved.start, cmd.resolved.end, state, printLineNumbers, listLines, highlight)
 }
 
 /*
 Put copies (puts) the contents of the cut buffer to after the addressed line.
 If no address was specified, defaults to ".".
  The current address is set to the address of the last line copied.
+
+ The command 'X' puts the contents of the cut buffer before the addressed line.
+ For this command the address '0' (zero) is valid and is equivalent to address '1'.
+
+ If a register is given (e.g. 'x "a'), the contents of the register are put instead of the cut buffer.
+ If a buffer of the session is given (e.g. 'x #2', see 'ls'), the lines of that buffer are put.
 */
 func (cmd Command) Put(state *State) error {
-	if !cmd.addressIsResolved {
-		return errAddressHasNotBeenResolved
+	if err := cmd.validateAddress(state); err != nil {
+		return err
 	}
-	if cmd.resolved.start == 0 {
-		return fmt.Errorf("put: %w", errorInvalidLine("start line is 0", nil))
+	lines, _, isBuffer, err := state.bufferLines(strings.TrimSpace(cmd.restOfCmd))
+	if err != nil {
+		return fmt.Errorf("put: %w", err)
 	}
-	// range not allowed
-	if cmd.resolved.start != cmd.resolved.end {
-		return fmt.Errorf("put: %w", ErrRangeMayNotBeSpecified)
+	if !isBuffer {
+		registerName, _, err := parseRegisterName(cmd.restOfCmd)
+		if err != nil {
+			return fmt.Errorf("put: %w", err)
+		}
+		lines = state.register(registerName)
 	}
 
 	startLineNbr := cmd.resolved.start
@@ -588,12 +767,18 @@ func (cmd Command) Put(state *State) error {
 	if cmd.addrRange.start.isNotSpecified() {
 		startLineNbr = state.lineNbr
 	}
+	// a put before line <n> is the same as a put after line <n-1>
+	if cmd.cmd == commandPutBefore && startLineNbr > 0 {
+		startLineNbr--
+	}
 
-	nbrLines := state.CutBuffer.Len()
+	nbrLines := lines.Len()
 	if nbrLines > 0 {
-		appendLines(startLineNbr, state, state.CutBuffer)
+		if err := appendLines(startLineNbr, state, lines); err != nil {
+			return fmt.Errorf("put: %w", err)
+		}
 		state.changedSinceLastWrite = true
-		state.addUndo(startLineNbr+1, startLineNbr+nbrLines, commandDelete, nil, cmd)
+		state.addUndo(startLineNbr+1, startLineNbr+nbrLines, commandDelete, nil)
 	}
 	return nil
 }
@@ -604,24 +789,18 @@ Read reads file and appends it after the addressed line.
  If file is not specified, then the default filename is used.
  If there is no default filename prior to the command, then the default filename is set to file.
  Otherwise, the default filename is unchanged.
+ If file is '!command', the output of the shell command is read instead.
+ If file is '#n', the lines of buffer n of the session (see 'ls') are read instead.
 
  The address '0' (zero) is valid for this command; it reads the file at the beginning of the buffer.
 
  The current address is set to the address of the last line read or, if there were none, to the addressed line.
 */
 func (cmd Command) Read(state *State) error {
-	if !cmd.addressIsResolved {
-		return errAddressHasNotBeenResolved
-	}
-	// range not allowed
-	if cmd.addrRange.end.isSpecified() {
-		return fmt.Errorf("read: %w", ErrRangeMayNotBeSpecified)
-	}
-
-	filename, err := getFilename(strings.TrimSpace(cmd.restOfCmd), state, false)
-	if err != nil {
+	if err := cmd.validateAddress(state); err != nil {
 		return err
 	}
+
 	var startLineNbr int
 	// default is append at eof
 	if cmd.addrRange.start.isNotSpecified() {
@@ -629,20 +808,31 @@ func (cmd Command) Read(state *State) error {
 	} else {
 		startLineNbr = cmd.resolved.start
 	}
-	nbrBytesRead, listOfLines, err := ReadFile(filename)
+	filename := strings.TrimSpace(cmd.restOfCmd)
+	listOfLines, nbrBytesRead, isBuffer, err := state.bufferLines(filename)
 	if err != nil {
-		return err
+		return fmt.Errorf("read: %w", err)
+	}
+	if !isBuffer {
+		if nbrBytesRead, listOfLines, _, err = readFileOrShellCommand(filename, state, false); err != nil {
+			return err
+		}
 	}
-	fmt.Printf("%dL, %dC\n", listOfLines.Len(), nbrBytesRead)
+	if !state.Silent {
+		state.message(messageCount, "%dL, %dC", listOfLines.Len(), nbrBytesRead)
+	}
+	stripDOSLineEndings(listOfLines)
+	terminateLastLine(listOfLines)
 	nbrLinesRead := listOfLines.Len()
 	if nbrLinesRead > 0 {
-		appendLines(startLineNbr, state, listOfLines)
+		if err = appendLines(startLineNbr, state, listOfLines); err != nil {
+			return fmt.Errorf("read: %w", err)
+		}
 		state.changedSinceLastWrite = true
-		state.addUndo(startLineNbr+1, startLineNbr+listOfLines.Len(), commandDelete, nil, cmd)
-	} else {
-		moveToLine(startLineNbr, state)
+		state.addUndo(startLineNbr+1, startLineNbr+listOfLines.Len(), commandDelete, nil)
+		return nil
 	}
-	return nil
+	return moveToLine(startLineNbr, state)
 }
 
 /*
@@ -650,18 +840,29 @@ Scroll scrolls n lines at a time starting at addressed line, and sets window siz
  The current address is set to the address of the last line printed.
 
  If n is not specified, then the current window size is used.
+ 'z=n' sets the window size to n without scrolling; 'z=' prints the current window size.
 
  Window size defaults to screen size minus two lines, or to 22 if screen size can't be determined.
 */
 func (cmd Command) Scroll(state *State) error {
-	return cmd._scroll(state, os.Stdout)
+	return cmd._scroll(state, state.Stdout)
 }
 func (cmd Command) _scroll(state *State, writer io.Writer) error {
-	if !cmd.addressIsResolved {
-		return errAddressHasNotBeenResolved
+	if err := cmd.validateAddress(state); err != nil {
+		return err
 	}
-	if !cmd.addrRange.end.isNotSpecified() {
-		return fmt.Errorf("scroll: cannot specify an address range")
+	// check for 'z=<n>'
+	if arg := strings.TrimSpace(cmd.restOfCmd); strings.HasPrefix(arg, "=") {
+		if arg == "=" {
+			fmt.Fprintln(writer, state.WindowSize)
+			return nil
+		}
+		newWindowSize, err := strconv.Atoi(strings.TrimSpace(arg[1:]))
+		if err != nil || newWindowSize < 1 {
+			return ErrInvalidWindowSize
+		}
+		state.WindowSize = newWindowSize
+		return nil
 	}
 	var startLineNbr, endLineNbr int
 	if cmd.addrRange.start.isNotSpecified() {
@@ -674,7 +875,7 @@ func (cmd Command) _scroll(state *State, writer io.Writer) error {
 		// parse to number if possible
 		newWindowSize, err := strconv.Atoi(strings.TrimSpace(cmd.restOfCmd))
 		if err != nil || newWindowSize < 1 {
-			return errInvalidWindowSize
+			return ErrInvalidWindowSize
 		}
 		state.WindowSize = newWindowSize
 	}
@@ -686,7 +887,7 @@ func (cmd Command) _scroll(state *State, writer io.Writer) error {
 	startLineNbr = minIntOf(startLineNbr, state.Buffer.Len())
 	endLineNbr = minIntOf(endLineNbr, state.Buffer.Len())
 
-	return _printRange(writer, startLineNbr, endLineNbr, state, true)
+	return _printRange(writer, startLineNbr, endLineNbr, state, true, false)
 }
 
 /*
@@ -697,7 +898,10 @@ Transfer copies (i.e. transfers) the addressed lines to after the right-hand des
  The current address is set to the address of the last line copied.
 */
 func (cmd Command) Transfer(state *State) error {
-	startLineNbr, endLineNbr, err := cmd.addrRange.getAddressRange(state.lineNbr, state.Buffer, state.marks)
+	if err := cmd.validateAddress(state); err != nil {
+		return err
+	}
+	startLineNbr, endLineNbr, err := cmd.addrRange.getAddressRange(state)
 	if err != nil {
 		return err
 	}
@@ -710,82 +914,119 @@ func (cmd Command) Transfer(state *State) error {
 		if destLine, err = newAddress(destStr); err != nil {
 			return errorInvalidDestination(fmt.Sprintf("transfer: error parsing destination address: %s", destStr), err)
 		}
-		if destLineNbr, err = destLine.calculateActualLineNumber(state.lineNbr, state.Buffer, state.marks); err != nil {
-			return err
+		if destLineNbr, err = destLine.calculateActualLineNumber(state.lineNbr, state); err != nil {
+			return errorInvalidDestination(destStr, err)
 		}
 	}
 	if destLineNbr > state.Buffer.Len() {
 		return errorInvalidDestination(fmt.Sprintf("transfer: destLine: %d > max line: %d", destLineNbr, state.Buffer.Len()), nil)
 	}
-	tempBuffer := copyLines(startLineNbr, endLineNbr, state)
-	appendLines(destLineNbr, state, tempBuffer)
+	tempBuffer, err := copyLines(startLineNbr, endLineNbr, state)
+	if err != nil {
+		return fmt.Errorf("transfer: %w", err)
+	}
+	if err = appendLines(destLineNbr, state, tempBuffer); err != nil {
+		return fmt.Errorf("transfer: %w", err)
+	}
 	state.changedSinceLastWrite = true
 
 	// the undo is a delete command from destLineNbr + 1
-	state.addUndo(destLineNbr+1, destLineNbr+tempBuffer.Len(), commandDelete, nil, cmd)
+	state.addUndo(destLineNbr+1, destLineNbr+tempBuffer.Len(), commandDelete, nil)
 	return nil
 }
 
 /*
-Undo undoes the previous command.
+Undo undoes the previous command, i.e. all changes made by the command.
+ Repeated 'u' commands undo the commands before that, one at a time.
+
+ If state.UndoToggle is set (GNU-compatible mode), only the last command can be undone
+ and an undo can itself be undone.
+
+ The current address is set to what it was before the undone command. The cut buffer is unchanged.
 */
 func (cmd Command) Undo(state *State) error {
-
 	if state.undo.Len() == 0 {
-		return errNothingToUndo
+		return ErrNothingToUndo
 	}
+	transaction := state.undo.Remove(state.undo.Front()).(*undoTransaction)
 
-	undoEl := state.undo.Front()
-	state.undo.Remove(undoEl)
-	undo := undoEl.Value.(Undo)
-
-	if state.Debug {
-		fmt.Println(undo.cmd)
+	// the changes made whilst undoing are collected in the current transaction
+	if state.currentUndo == nil {
+		state.beginUndoTransaction()
+		defer state.endUndoTransaction()
 	}
-	// set global flag to indicate we're undoing
-	state.processingUndo = true
-	var err error
-	// cater for the 'special' undo commands
-	switch undo.cmd.cmd {
-	case internalCommandUndoMove:
-		err = handleUndoMove(undo, state)
-	case internalCommandUndoSubst:
-		err = handleUndoSubst(undo, state)
-	default:
-		_, err = undo.cmd.ProcessCommand(state, undo.text, false)
+	err := transaction.apply(state)
+	if !state.UndoToggle {
+		// the undo itself cannot be undone, but is stored for 'redo'
+		state.moveCurrentUndoToRedo(transaction.cutBuffer)
 	}
-	state.processingUndo = false
 	return err
 }
 
 /*
-Write handles the commands "w", "wq", and "W".
+Redo reapplies the changes undone by the previous 'u' command.
+ After repeated 'u' commands, repeated 'U' commands reapply the undone commands one at a time.
+ Any new change to the buffer clears the list of commands which can be redone.
+
+ The current address is set to what it was before the 'u' command.
+ The cut buffer is set to its contents after the original command, e.g. the deleted lines after redoing a 'd'.
+*/
+func (cmd Command) Redo(state *State) error {
+	if state.redo.Len() == 0 {
+		return ErrNothingToRedo
+	}
+	transaction := state.redo.Remove(state.redo.Front()).(*undoTransaction)
+
+	// the changes made whilst redoing are collected in the current transaction, and can be undone again
+	if state.currentUndo == nil {
+		state.beginUndoTransaction()
+		defer state.endUndoTransaction()
+	}
+	state.currentUndo.keepRedo = true
+	if err := transaction.apply(state); err != nil {
+		return err
+	}
+	// the cut buffer is set as it was after the original command
+	if transaction.cutBuffer != nil {
+		state.CutBuffer = transaction.cutBuffer
+	}
+	return nil
+}
+
+/*
+Write handles the commands "w", "wq", "W" and "Wq".
 
  Writes (or appends in case of W) the addressed lines to file.
- Any previous contents of file is lost without warning.
+ If no address is specified, the whole buffer is written.
+ For 'w', any previous contents of file is lost without warning,
+ unless backups have been switched on (see state.BackupSuffix), in which case the file is first renamed.
+ For 'W', the file is created if it does not exist.
 
  If there is no default filename, then the default filename is set to file, otherwise it is unchanged.
  If no filename is specified, then the default filename is used.
+ If file is '!command', the addressed lines are written to the standard input of the shell command instead.
+ In this case the default filename is unchanged, and the buffer is not considered to be saved.
+
+ If the file read by 'e' did not end with a newline, the last line of the buffer is written without one.
+ If it had DOS line endings, these are used (see SetLineEndings).
+ The file is written in the encoding of the file read by 'e' (see state.Encoding).
 
  The current address is unchanged.
+ After a 'w' the buffer is considered unchanged; this is not the case after a 'W'.
 
- In case of 'wq': a quit is performed immediately afterwards. (This is handled by the caller.)
+ In case of 'wq' and 'Wq': a quit is performed immediately afterwards, if the write was successful. (This is handled by the caller.)
 */
 func (cmd Command) Write(state *State) error {
 	// save current address
 	currentLine := state.lineNbr
 
-	if !cmd.addressIsResolved {
-		return errAddressHasNotBeenResolved
-	}
-
-	// handle command sequence 'wq'
-	filename := strings.TrimPrefix(cmd.restOfCmd, commandQuit)
-	filename, err := getFilename(strings.TrimSpace(filename), state, true)
-	if err != nil {
+	if err := cmd.validateAddress(state); err != nil {
 		return err
 	}
 
+	appending := cmd.cmd == commandWriteAppend || cmd.cmd == commandWriteAppendQuit
+	filename := strings.TrimSpace(cmd.restOfCmd)
+
 	var startLineNbr, endLineNbr int
 	if !cmd.addrRange.IsSpecified() {
 		startLineNbr = 1
@@ -793,19 +1034,74 @@ func (cmd Command) Write(state *State) error {
 	} else {
 		startLineNbr, endLineNbr = cmd.resolved.start, cmd.resolved.end
 	}
-	// disallow 0
-	if startLineNbr == 0 {
-		return fmt.Errorf("write: %w", errorInvalidLine("start line is 0", nil))
+	if err := state.checkRestrictedFilename(filename); err != nil {
+		return err
+	}
+	if isShellCommand(filename) {
+		// the buffer is not considered saved
+		nbrBytesWritten, err := state.writeToShellCommand(filename[len(commandShell):], startLineNbr, endLineNbr)
+		if err != nil {
+			return err
+		}
+		if !state.Silent {
+			state.message(messageCount, "%dC", nbrBytesWritten)
+		}
+		return moveToLine(currentLine, state)
 	}
-	moveToLine(startLineNbr, state)
-	nbrBytesWritten, err := WriteFile(filename, state.dotline, startLineNbr, endLineNbr)
+	filename, err := getFilename(filename, state, true)
 	if err != nil {
 		return err
 	}
-	fmt.Printf("%dC\n", nbrBytesWritten)
-	state.changedSinceLastWrite = false
-	moveToLine(currentLine, state)
-	return nil
+	// a file which did not end with a newline is written without one
+	var buffer Buffer = state.Buffer
+	if state.noFinalNewline {
+		buffer = noFinalNewlineBuffer{buffer}
+	}
+	if state.dosLineEndings {
+		buffer = dosLineEndingBuffer{buffer}
+	}
+	if !state.fileEncoding.isPlainUTF8() {
+		enc := state.fileEncoding
+		// appending to a file: the file already starts with a byte order mark, if required
+		enc.bom = enc.bom && !appending
+		buffer = encodingBuffer{buffer, enc}
+	}
+	writeFn := writeFile
+	var original fs.FileInfo // the file before it was renamed to the backup
+	if appending {
+		writeFn = appendFile
+	} else if state.BackupSuffix != "" || state.BackupDir != "" {
+		// the file is renamed, i.e. a large file is still readable
+		if _, original, err = backupFile(state.FileSystem, filename, state.BackupSuffix, state.BackupDir); err != nil {
+			return fmt.Errorf("backup: %w", err)
+		}
+	} else if largeBuffer, ok := state.Buffer.(*largeFileBuffer); ok {
+		if err = largeBuffer.checkOverwrite(state.FileSystem, filename, state.WriteInPlace); err != nil {
+			return err
+		}
+	}
+	fsys := state.FileSystem
+	if state.WriteInPlace {
+		fsys = inPlaceFileSystem{fsys}
+	}
+	nbrBytesWritten, err := writeFn(fsys, filename, buffer, startLineNbr, endLineNbr)
+	if err != nil {
+		return err
+	}
+	// the new file gets the mode and owner of the file which was renamed
+	if err = keepFileMode(state.FileSystem, filename, original); err != nil {
+		return err
+	}
+	if !state.Silent {
+		state.message(messageCount, "%dC", nbrBytesWritten)
+	}
+	if !appending {
+		state.changedSinceLastWrite = false
+	}
+	for _, l := range state.listeners {
+		l.OnWrite(filename, startLineNbr, endLineNbr)
+	}
+	return moveToLine(currentLine, state)
 }
 
 /*
@@ -813,19 +1109,26 @@ CmdYank copies (yanks) the addressed lines to the cut buffer.
 
  The cut buffer is overwritten by subsequent 'c', 'd', 'j', 's', or 'y' commands.
  The current address is unchanged.
+
+ If a register is given (e.g. 'y "a'), the lines are copied to the register instead of the cut buffer.
+ If the name of the register is in upper case (e.g. 'y "A'), the lines are appended to the register.
 */
 func (cmd Command) Yank(state *State) error {
-	if !cmd.addressIsResolved {
-		return errAddressHasNotBeenResolved
+	if err := cmd.validateAddress(state); err != nil {
+		return err
 	}
-	if cmd.resolved.start == 0 {
-		return fmt.Errorf("yank: %w", errorInvalidLine("start line is 0", nil))
+	registerName, appendTo, err := parseRegisterName(cmd.restOfCmd)
+	if err != nil {
+		return fmt.Errorf("yank: %w", err)
 	}
 	currentAddress := state.lineNbr // save for later
 
-	state.CutBuffer = copyLines(cmd.resolved.start, cmd.resolved.end, state)
-	moveToLine(currentAddress, state)
-	return nil
+	yankedLines, err := copyLines(cmd.resolved.start, cmd.resolved.end, state)
+	if err != nil {
+		return fmt.Errorf("yank: %w", err)
+	}
+	state.setRegister(registerName, yankedLines, appendTo)
+	return moveToLine(currentAddress, state)
 }
 
 // ----------------------------------------------------------------------------
@@ -835,130 +1138,123 @@ func (cmd Command) Yank(state *State) error {
 // ----------------------------------------------------------------------------
 
 /*
- Implements the undo for the command 'move'.
+ Appends the lines in the list 'newLines' to the current buffer, after line #lineNbr.
+ Line 0 appends before the first line. The marks are adjusted accordingly.
 
- This consists of two operations, unlike all the others
-  - first delete the moved lines
-  - then re-insert
+ Afterwards, the state's current line will be set to the last of the new lines just appended.
 */
-func handleUndoMove(undoCmd Undo, state *State) error {
-	// first the delete...
-	undoStartLine, err := undoCmd.cmd.addrRange.start.calculateActualLineNumber(state.lineNbr, state.Buffer, state.marks)
-	if err != nil {
-		return err
+func appendLines(lineNbr int, state *State, newLines *list.List) error {
+	// return if newLines is empty
+	if newLines.Len() == 0 {
+		return nil
 	}
-	undoEndLine, err := undoCmd.cmd.addrRange.start.calculateActualLineNumber(state.lineNbr, state.Buffer, state.marks)
-	if err != nil {
+	if err := state.Buffer.InsertAfter(lineNbr, newLines); err != nil {
 		return err
 	}
-	_ = deleteLines(undoStartLine, undoEndLine, state)
-
-	// ...then the append. The line to append at is stored in the original command
-	originalStartLine, err := undoCmd.originalCmd.addrRange.start.calculateActualLineNumber(state.lineNbr, state.Buffer, state.marks)
-	if err != nil {
-		return err
-	}
-	appendLines(originalStartLine-1, state, undoCmd.text)
-
-	return nil
+	state.linesInserted(lineNbr, newLines.Len())
+	return moveToLine(lineNbr+newLines.Len(), state)
 }
 
 /*
- Implements the undo for the command 'subst'.
- This is a list of 1..n undo commands (each of which is a 'change' command).
+ Copies the required lines into a new list.
 */
-func handleUndoSubst(toplevelUndoCmd Undo, state *State) error {
-	// undo.text == a list of 'change' undo-commands, NOT a list of changed lines
-	for el := toplevelUndoCmd.text.Front(); el != nil; el = el.Next() {
-		undoCmd := el.Value.(Undo)
-		if undoCmd.cmd.cmd != commandChange {
-			panic(fmt.Sprintf("expected 'change' command, got '%s'\n", undoCmd.cmd.cmd))
-		}
-		undoCmd.cmd.Change(state, undoCmd.text)
+func copyLines(startLineNbr, endLineNbr int, state *State) (*list.List, error) {
+	tempBuffer := list.New()
+	copyFunc := func(lineNbr int, line *Line, state *State) {
+		tempBuffer.PushBack(*line)
 	}
-	return nil
+	err := iterateLines(startLineNbr, endLineNbr, state, copyFunc)
+	return tempBuffer, err
 }
 
 /*
- Appends the lines in the list 'newLines' to the current buffer, after line #lineNbr.
+ Replaces each of the required lines with the result of applying 'fn' to its text.
+ Lines which are not altered by 'fn' are left untouched.
 
- Afterwards, the state's current line will be set to the last of the new lines just appended.
-
- Special cases:
-   - appending at the last line
-	- appending at "line 0" i.e. before the first line
+ Returns:
+  - number of lines changed
+  - a list of undo objects to undo these changes
 */
-func appendLines(lineNbr int, state *State, newLines *list.List) {
-	// return if newLines is empty
-	if newLines.Len() == 0 {
-		return
-	}
-	if lineNbr == state.Buffer.Len() {
-		// append at end
-		state.Buffer.PushBackList(newLines)
-		moveToLine(state.Buffer.Len(), state)
-	} else if lineNbr == 0 {
-		// append at start
-		state.Buffer.PushFrontList(newLines)
-		moveToLine(newLines.Len(), state)
-	} else {
-		moveToLine(lineNbr, state)
-		nbrLinesEntered := 0
-		mark := state.dotline
-		for e := newLines.Front(); e != nil; e = e.Next() {
-			mark = state.Buffer.InsertAfter(e.Value, mark)
-			nbrLinesEntered++
+func changeLines(startLineNbr, endLineNbr int, state *State, fn func(lineNbr int, line string) string) (int, *list.List, error) {
+	nbrLinesChanged := 0
+	undoList := list.New()
+	changeFunc := func(lineNbr int, line *Line, state *State) {
+		changedLine := fn(lineNbr, line.Line)
+		if changedLine == line.Line {
+			return
 		}
-		moveToLine(lineNbr+nbrLinesEntered, state)
-	}
+		nbrLinesChanged++
+		// the undo is a 'change' of this one line back to its original text
+		undoCommand := Command{addrRange: AddressRange{newAbsoluteAddress(lineNbr), newAbsoluteAddress(lineNbr), separatorComma},
+			addressIsResolved: true, resolved: resolvedAddress{start: lineNbr, end: lineNbr}, cmd: commandChange}
+		originalText := list.New()
+		originalText.PushBack(*line)
+		undoList.PushBack(Undo{cmd: undoCommand, text: originalText})
+		_ = state.Buffer.Set(lineNbr, Line{changedLine}) // the line number is valid
+		state.lineChanged(lineNbr)
+	}
+	err := iterateLines(startLineNbr, endLineNbr, state, changeFunc)
+	return nbrLinesChanged, undoList, err
 }
 
 /*
- Copies the required lines into a new list.
+ Deletes the required lines from the state.buffer and returns them as a new list.
+ The marks are adjusted accordingly.
+ The current line is not changed, and must be set by the caller.
 */
-func copyLines(startLineNbr, endLineNbr int, state *State) *list.List {
-	tempBuffer := list.New()
-	copyFunc := func(lineNbr int, el *list.Element, state *State) {
-		tempBuffer.PushBack(el.Value)
+func deleteLines(startLineNbr, endLineNbr int, state *State) (newList *list.List, err error) {
+	if newList, err = state.Buffer.DeleteRange(startLineNbr, endLineNbr); err != nil {
+		return nil, err
 	}
-	iterateLines(startLineNbr, endLineNbr, state, copyFunc)
-	return tempBuffer
+	state.linesDeleted(startLineNbr, endLineNbr)
+	return newList, nil
 }
 
 /*
- Deletes the required lines from the state.buffer and returns them as a new list.
+A LineProcessorFn is a function which operates on a line.
+The line must not be changed (use state.Buffer.Set instead).
 */
-func deleteLines(startLineNbr, endLineNbr int, state *State) (newList *list.List) {
-	tempBuffer := list.New()
-	deleteFunc := func(lineNbr int, el *list.Element, state *State) {
-		state.Buffer.Remove(el)
-		tempBuffer.PushBack(el.Value)
-	}
-	iterateLines(startLineNbr, endLineNbr, state, deleteFunc)
-	return tempBuffer
-}
+type LineProcessorFn func(lineNbr int, line *Line, state *State)
 
 /*
-A LineProcessorFn is a function which operates on a line
+ Iterate over the required lines and apply the given function.
+ The current line is set to the first line.
+ It is an error if the line numbers are out of range.
 */
-type LineProcessorFn func(lineNbr int, el *list.Element, state *State)
+func iterateLines(startLineNbr, endLineNbr int, state *State, fn LineProcessorFn) error {
+	if err := checkLineRange(startLineNbr, endLineNbr, state.Buffer); err != nil {
+		return err
+	}
+	if err := moveToLine(startLineNbr, state); err != nil {
+		return err
+	}
+	return state.Buffer.Iterate(startLineNbr, endLineNbr, func(lineNbr int, line *Line) {
+		fn(lineNbr, line, state)
+	})
+}
 
 /*
- Iterate over the required lines and apply the given function.
+ Checks that the given line numbers denote a valid range of lines in the buffer, i.e. 1 <= start <= end <= $.
 */
-func iterateLines(startLineNbr, endLineNbr int, state *State, fn LineProcessorFn) {
-	moveToLine(startLineNbr, state)
-	el := state.dotline
-	for lineNbr := startLineNbr; lineNbr <= endLineNbr; lineNbr++ {
-		elementCopy := el
-		el = el.Next()
-		fn(lineNbr, elementCopy, state)
+func checkLineRange(startLineNbr, endLineNbr int, buffer Buffer) error {
+	if startLineNbr < 1 {
+		return errorInvalidLine(fmt.Sprintf("start line: %d", startLineNbr), nil)
+	}
+	if endLineNbr > buffer.Len() {
+		return errorInvalidLine(fmt.Sprintf("end line: %d, max line: %d", endLineNbr, buffer.Len()), nil)
 	}
+	if startLineNbr > endLineNbr {
+		return fmt.Errorf("%w: start line: %d, end line: %d", ErrBadRange, startLineNbr, endLineNbr)
+	}
+	return nil
 }
 
-func readInputLines() (newLines *list.List, nbrLinesEntered int, err error) {
+/*
+ Reads lines from the reader until a line containing only "." is entered.
+ A line containing only "\." is entered as ".", see unescapeInputLine.
+*/
+func readInputLines(reader *bufio.Reader) (newLines *list.List, nbrLinesEntered int, err error) {
 	newLines = list.New()
-	reader := bufio.NewReader(os.Stdin)
 	nbrLinesEntered = 0
 	for quit := false; !quit; {
 		var inputStr string
@@ -970,12 +1266,90 @@ func readInputLines() (newLines *list.List, nbrLinesEntered int, err error) {
 			quit = true
 		} else {
 			nbrLinesEntered++
-			newLines.PushBack(Line{inputStr})
+			newLines.PushBack(Line{unescapeInputLine(inputStr)})
 		}
 	}
 	return
 }
 
+/*
+ A line of input mode containing only a fullstop would end the input. In order to enter such a line,
+ the fullstop can be preceded by a backslash, which is removed: "\." is entered as ".".
+ Generally, one backslash is removed from a line consisting of backslashes followed by a fullstop, e.g. "\\." is entered as "\.".
+*/
+func unescapeInputLine(line string) string {
+	text := strings.TrimSuffix(line, "\n")
+	if strings.HasPrefix(text, `\`) && strings.TrimLeft(text, `\`) == "." {
+		return line[1:]
+	}
+	return line
+}
+
+/*
+ReadCommandLine reads a command from the reader, removing the trailing LF.
+The command-list of a 'g' or 'v' command, and the replacement of an 's' command (in order to split a line),
+can span several lines: a line terminated by a backslash is continued on the next line.
+*/
+func ReadCommandLine(reader *bufio.Reader) (string, error) {
+	cmdStr, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	cmdStr = strings.TrimSuffix(cmdStr, "\n")
+	if line, err := parseCommandLine(cmdStr); err == nil {
+		switch line.cmd {
+		case commandGlobal, commandInverseGlobal, commandSubstitute:
+			return readContinuationLines(reader, cmdStr)
+		}
+	}
+	return cmdStr, nil
+}
+
+/*
+ Reads a (possibly multi-line) command-list, e.g. for the 'G' command, removing the trailing LF.
+*/
+func readCommandList(reader *bufio.Reader) (string, error) {
+	firstLine, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return readContinuationLines(reader, strings.TrimSuffix(firstLine, "\n"))
+}
+
+/*
+ As long as the given string is terminated by a backslash, the next line is read and appended (separated by a newline).
+*/
+func readContinuationLines(reader *bufio.Reader, str string) (string, error) {
+	for strings.HasSuffix(str, `\`) {
+		nextLine, err := reader.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		str += "\n" + strings.TrimSuffix(nextLine, "\n")
+	}
+	return str, nil
+}
+
+/*
+ Reads the given file or, if the name starts with '!', the output of the shell command.
+ The filename is determined as described for getFilename; a shell command never changes the default filename.
+ The contents of a file are converted from its encoding (see readEncodedFile), which is also returned.
+*/
+func readFileOrShellCommand(potentialFilename string, state *State, setDefault bool) (nbrBytesRead int, listOfLines *list.List, enc fileEncoding, err error) {
+	if err = state.checkRestrictedFilename(potentialFilename); err != nil {
+		return 0, nil, enc, err
+	}
+	if isShellCommand(potentialFilename) {
+		nbrBytesRead, listOfLines, err = state.readFromShellCommand(potentialFilename[len(commandShell):])
+		return nbrBytesRead, listOfLines, enc, err
+	}
+	filename, err := getFilename(potentialFilename, state, setDefault)
+	if err != nil {
+		return 0, nil, enc, err
+	}
+	return readEncodedFile(state.FileSystem, filename, state.Encoding)
+}
+
 /*
  If potentialFilename is set, returns this. If setDefault is TRUE, the state.defaultFilename will
  be set to this filename.
@@ -990,18 +1364,26 @@ func getFilename(potentialFilename string, state *State, setDefault bool) (filen
 		if state.defaultFilename != "" {
 			filename = state.defaultFilename
 		} else {
-			return "", errMissingFilename
+			return "", ErrMissingFilename
 		}
 	} else {
 		filename = potentialFilename
-		if setDefault {
+		// in restricted mode, the default filename cannot be changed once set
+		if setDefault && !(state.Restricted && state.defaultFilename != "") {
 			state.defaultFilename = potentialFilename
 		}
 	}
 	return filename, nil
 }
 
-func _printRange(writer io.Writer, startLine, endLine int, state *State, printLineNumbers bool) error {
+func _printRange(writer io.Writer, startLine, endLine int, state *State, printLineNumbers, listLines bool) error {
+	return _printRangeHighlighted(writer, startLine, endLine, state, printLineNumbers, listLines, nil)
+}
+
+/*
+ As _printRange, but the matches of the regex 'highlight' (if set) are highlighted when colouring is on.
+*/
+func _printRangeHighlighted(writer io.Writer, startLine, endLine int, state *State, printLineNumbers, listLines bool, highlight *regexp.Regexp) error {
 	// disallow 0p
 	if startLine == 0 {
 		return fmt.Errorf("print: %w", errorInvalidLine("start line is 0", nil))
@@ -1009,29 +1391,57 @@ func _printRange(writer io.Writer, startLine, endLine int, state *State, printLi
 	if endLine == 0 {
 		endLine = 1
 	}
-	if startLine > endLine {
-		panic(fmt.Sprintf("start line: %d, end line %d", startLine, endLine))
+	if err := checkLineRange(startLine, endLine, state.Buffer); err != nil {
+		return fmt.Errorf("print: %w", err)
 	}
-	moveToLine(startLine, state)
-
-	el := state.dotline
-	prevEl := el
-	for lineNbr := startLine; lineNbr <= endLine; lineNbr++ {
-		_printLine(writer, lineNbr, el.Value.(Line).Line, printLineNumbers)
-		prevEl = el // store el, to be able to set dotline i/c we hit the end of the list
-		el = el.Next()
+	currentLineNbr := state.lineNbr // for state.HighlightDot
+	renderer := state.lineRenderer(writer, highlight)
+	var interrupted error
+	err := state.Buffer.Iterate(startLine, endLine, func(lineNbr int, line *Line) {
+		if interrupted != nil {
+			return
+		}
+		if interrupted = state.checkInterrupt(); interrupted != nil {
+			return
+		}
+		if !state.pageLine() {
+			return
+		}
+		if state.HighlightDot {
+			_printGutter(writer, lineNbr == currentLineNbr)
+		}
+		text := line.Line
+		if listLines && state.noFinalNewline && lineNbr == state.Buffer.Len() {
+			// shown without the '$', since the line will be written without a newline
+			text = strings.TrimSuffix(text, "\n")
+		}
+		renderer.printLine(writer, lineNbr, text, printLineNumbers, listLines, nil)
+	})
+	if err == nil {
+		err = interrupted
+	}
+	if err != nil {
+		return fmt.Errorf("print: %w", err)
 	}
-	// set dotline
-	if el != nil {
-		state.dotline = el
+	// the current line is the last line printed
+	return moveToLine(endLine, state)
+}
+
+/*
+ Prints a marker in front of the current line, or the equivalent number of spaces otherwise.
+*/
+func _printGutter(writer io.Writer, isCurrentLine bool) {
+	if isCurrentLine {
+		fmt.Fprint(writer, currentLineMarker)
 	} else {
-		state.dotline = prevEl
+		fmt.Fprint(writer, strings.Repeat(" ", len(currentLineMarker)))
 	}
-	state.lineNbr = endLine
-	return nil
 }
 
-func _printLine(writer io.Writer, lineNbr int, str string, printLineNumbers bool) {
+func _printLine(writer io.Writer, lineNbr int, str string, printLineNumbers, listLine bool) {
+	if listLine {
+		str = _listLine(str)
+	}
 	if printLineNumbers {
 		fmt.Fprintf(writer, "%4d%c %s", lineNbr, '\t', str)
 	} else {
@@ -1039,28 +1449,48 @@ func _printLine(writer io.Writer, lineNbr int, str string, printLineNumbers bool
 	}
 }
 
-/**
- * Returns element in the buffer corresponding to the given line number.
- */
-func _findLine(requiredLine int, buffer *list.List) *list.Element {
-	// TODO? always starts at the top of the file ...
-	lineNbr, e := 1, buffer.Front()
-	for ; e != nil && lineNbr != requiredLine; e, lineNbr = e.Next(), lineNbr+1 {
+/*
+ Converts the line to the unambiguous form of the 'l' command (see Print).
+*/
+func _listLine(str string) string {
+	terminated := strings.HasSuffix(str, "\n")
+	str = strings.TrimSuffix(str, "\n")
+	var sb strings.Builder
+	column := 0
+	for i := 0; i < len(str); i++ {
+		token, isEscape := listEscapes[str[i]]
+		if !isEscape {
+			if str[i] < ' ' || str[i] > '~' {
+				token = fmt.Sprintf("\\%03o", str[i])
+			} else {
+				token = str[i : i+1]
+			}
+		}
+		// fold the line, leaving space for the backslash
+		if column+len(token) > listLineLength-1 {
+			sb.WriteString("\\\n")
+			column = 0
+		}
+		sb.WriteString(token)
+		column += len(token)
 	}
-	// double check
-	if requiredLine != lineNbr {
-		panic(fmt.Sprintf("bad line number: got %d, wanted %d", lineNbr, requiredLine))
+	if terminated {
+		sb.WriteString("$")
 	}
-	return e
+	sb.WriteString("\n")
+	return sb.String()
 }
 
 /**
- * moves to the given line number and updates the state (dotline, lineNbr).
+ * moves to the given line number and updates the state (lineNbr).
+ * Line 0 is allowed, and means "before the first line".
  */
-func moveToLine(requiredLine int, state *State) {
-	e := _findLine(requiredLine, state.Buffer)
-	state.dotline = e
+func moveToLine(requiredLine int, state *State) error {
+	if requiredLine < 0 || requiredLine > state.Buffer.Len() {
+		return errorInvalidLine(fmt.Sprintf("%d, max line: %d", requiredLine, state.Buffer.Len()), nil)
+	}
 	state.lineNbr = requiredLine
+	return nil
 }
 
 /*
@@ -1079,110 +1509,218 @@ func (cmd Command) ProcessCommand(state *State, enteredText *list.List, inGlobal
 		case commandEdit, commandEditUnconditionally,
 			commandGlobal, commandGlobalInteractive,
 			commandInverseGlobal, commandInverseGlobalInteractive,
-			commandHelp,
-			commandQuit, commandQuitUnconditionally,
-			commandUndo, commandWrite, commandWriteAppend:
-			return false, errNotAllowedInGlobalCommand
+			commandDiff, commandHelp, commandHelpLong, commandHistory, commandMarks, commandNextFile, commandPreviousFile,
+			commandOpenBuffer, commandListBuffers, commandSwitchBuffer, commandAlias, commandUnalias,
+			commandRevert, commandSet, commandQuit, commandQuitUnconditionally,
+			commandUndo, commandRedo, commandWrite, commandWriteAppend, commandWriteQuit, commandWriteAppendQuit:
+			return false, ErrNotAllowedInGlobalCommand
 		default:
 			//ok
 		}
 	}
-	// check for commands which cannot take ranges
-	switch cmd.cmd {
-	case commandEdit, commandEditUnconditionally,
-		commandFilename, commandHelp, commandPrompt,
-		commandQuit, commandQuitUnconditionally,
-		commandUndo:
-		if cmd.addrRange.IsSpecified() {
-			err = ErrRangeMayNotBeSpecified
-		}
-	default:
-		//ok
-	}
-
+	// a 'q' or 'e' refused because of unsaved changes proceeds if it is repeated immediately
+	warnedCommand := state.warnedCommand
+	state.warnedCommand = ""
 	// first, resolve addresses
 	if !cmd.addressIsResolved {
 		if err = cmd.resolveAddress(state); err != nil {
 			return false, err
 		}
 	}
+	// and make sure they're valid for this command
+	if err = cmd.validateAddress(state); err != nil {
+		return false, err
+	}
+	// a top-level command starts an undo transaction, which collects the undo commands of all changes made.
+	// Commands executed by another command (e.g. by 'g' or 'u') belong to the transaction of that command.
+	topLevel := state.currentUndo == nil
+	if topLevel {
+		// prevents an autosave whilst the buffer is being changed
+		state.commandMutex.Lock()
+		defer state.commandMutex.Unlock()
+		state.beginUndoTransaction()
+		// an interrupt before the command was started (e.g. whilst waiting for input) is ignored
+		state.clearInterrupt()
+		state.resetPager()
+	}
 
 	switch cmd.cmd {
 	case commandAppend, commandInsert:
 		err = cmd.AppendInsert(state, enteredText)
+	case commandAppendText, commandInsertText:
+		err = cmd.AppendInsertText(state)
+	case commandAlias:
+		err = cmd.Alias(state)
+	case commandUnalias:
+		err = cmd.Unalias(state)
+	case commandRunAlias:
+		quit, err = cmd.runAlias(state, inGlobalCommand)
 	case commandChange:
 		err = cmd.Change(state, enteredText)
+	case commandCount:
+		err = cmd.Count(state)
 	case commandDelete:
 		err = cmd.Delete(state, true)
+	case commandDiff:
+		err = cmd.Diff(state)
 	case commandEdit:
-		if state.changedSinceLastWrite {
-			fmt.Println(unsavedChanges)
-		} else {
+		if err = state.checkUnsavedChanges(cmd.cmd, warnedCommand); err == nil {
 			err = cmd.Edit(state)
 		}
 	case commandEditUnconditionally:
 		err = cmd.Edit(state)
 	case commandFilename:
-		state.defaultFilename = strings.TrimSpace(cmd.restOfCmd)
-	case commandGlobal:
+		err = state.setDefaultFilename(strings.TrimSpace(cmd.restOfCmd))
+	case commandNextFile, commandPreviousFile:
+		err = cmd.NextFile(state)
+	case commandDOS, commandUnix:
+		err = cmd.SetLineEndings(state)
+	case commandReflow:
+		err = cmd.Reflow(state)
+	case commandGlobal, commandGlobalInteractive, commandInverseGlobal, commandInverseGlobalInteractive:
 		err = cmd.CmdGlobal(state)
-	case commandGlobalInteractive:
-		fmt.Println("not yet implemented")
+	case commandGrep:
+		err = cmd.Grep(state)
 	case commandHelp:
+		err = cmd.ExplainLastError(state)
+	case commandHelpLong:
 		err = cmd.Help(state)
-	case commandInverseGlobal:
-		fmt.Println("not yet implemented")
-	case commandInverseGlobalInteractive:
-		fmt.Println("not yet implemented")
+	case commandHistory:
+		err = cmd.PrintHistory(state)
+	case commandVerboseErrors:
+		err = cmd.ToggleVerboseErrors(state)
 	case commandJoin:
 		err = cmd.Join(state)
 	case commandMark:
 		err = cmd.Mark(state)
-	case commandList:
-		fmt.Println("not yet implemented")
+	case commandMarks:
+		err = cmd.ListMarks(state)
+	case commandDeleteMarks:
+		err = cmd.DeleteMarks(state)
 	case commandMove:
 		err = cmd.Move(state)
-	case commandNumber, commandPrint:
+	case commandOpenBuffer:
+		err = cmd.OpenBuffer(state)
+	case commandListBuffers:
+		err = cmd.ListBuffers(state)
+	case commandSwitchBuffer:
+		err = cmd.SwitchBuffer(state)
+	case commandList, commandNumber, commandPrint:
 		err = cmd.Print(state)
+	case commandNumberLines:
+		err = cmd.NumberLines(state)
 	case commandPrompt:
 		state.ShowPrompt = !state.ShowPrompt
 	case commandQuit, commandQuitUnconditionally:
-		if cmd.cmd == commandQuit && state.changedSinceLastWrite {
-			fmt.Println(unsavedChanges)
-		} else {
+		if cmd.cmd == commandQuitUnconditionally {
+			quit = true
+		} else if err = state.checkUnsavedChanges(cmd.cmd, warnedCommand); err == nil {
 			quit = true
 		}
 	case commandRead:
 		err = cmd.Read(state)
+	case commandRevert:
+		err = cmd.Revert(state)
+	case commandReverse:
+		err = cmd.Reverse(state)
 	case commandSubstitute:
 		err = cmd.CmdSubstitute(state)
+	case commandSet:
+		err = cmd.Set(state)
+	case commandSort:
+		err = cmd.Sort(state)
 	case commandTransfer:
 		err = cmd.Transfer(state)
+	case commandRetab:
+		err = cmd.Retab(state)
 	case commandUndo:
 		err = cmd.Undo(state)
-	case commandWrite:
+	case commandRedo:
+		err = cmd.Redo(state)
+	case commandUniq:
+		err = cmd.Uniq(state)
+	case commandWrite, commandWriteAppend, commandWriteQuit, commandWriteAppendQuit:
 		err = cmd.Write(state)
-		quit = (cmd.cmd == commandWrite && strings.HasPrefix(cmd.restOfCmd, commandQuit))
-	case commandWriteAppend:
-		fmt.Println("not yet implemented")
-	case commandPut:
+		quit = err == nil && (cmd.cmd == commandWriteQuit || cmd.cmd == commandWriteAppendQuit)
+	case commandPut, commandPutBefore:
 		err = cmd.Put(state)
 	case commandYank:
 		err = cmd.Yank(state)
 	case commandScroll:
 		err = cmd.Scroll(state)
+	case commandPrintContext:
+		err = cmd.PrintContext(state)
 	case commandComment:
 		err = cmd.Comment(state)
+	case commandTemplate:
+		err = cmd.Template(state)
 	case commandLinenumber:
 		err = cmd.Linenumber(state)
+	case commandShell:
+		err = cmd.ShellEscape(state)
+	case commandIgnoreCase:
+		state.IgnoreCase = !state.IgnoreCase
+	case commandShiftRight, commandShiftLeft:
+		err = cmd.Shift(state)
+	case commandExtension:
+		err = cmd.Extension(state)
 	case commandNoCommand:
 		// nothing entered -- ignore
 	default:
-		fmt.Println("ERROR got command not in switch!?: ", cmd.cmd)
+		fmt.Fprintln(state.Stdout, "ERROR got command not in switch!?: ", cmd.cmd)
+	}
+	// print suffixes of the print commands themselves have already been handled
+	if err == nil && cmd.printSuffix != "" && !isPrintCommand(cmd) {
+		err = printCurrentLine(state, cmd.printSuffix)
+	}
+	if topLevel {
+		state.endUndoTransaction()
+		if state.CheckState && err == nil {
+			err = CheckInvariants(state)
+		}
 	}
 	return quit, err
 }
 
+/*
+ Returns ErrUnsavedChanges if the buffer has unsaved changes, unless the command has just been refused for this reason
+ (i.e. 'warnedCommand' is the same command). As in POSIX ed, the command then proceeds if it is repeated immediately.
+ For 'q', the unsaved changes of all buffers of the session count.
+*/
+func (state *State) checkUnsavedChanges(cmdIdent, warnedCommand string) error {
+	if !state.hasUnsavedChanges(cmdIdent == commandQuit) || cmdIdent == warnedCommand {
+		return nil
+	}
+	state.warnedCommand = cmdIdent
+	return ErrUnsavedChanges
+}
+
+func isPrintCommand(cmd Command) bool {
+	return cmd.cmd == commandPrint || cmd.cmd == commandNumber || cmd.cmd == commandList
+}
+
+/*
+ Prints the current line according to the given print suffixes ('p', 'n', and/or 'l').
+ Nothing is printed if the buffer is empty.
+*/
+func printCurrentLine(state *State, suffixes string) error {
+	if state.lineNbr == 0 {
+		return nil
+	}
+	return _printRange(state.Stdout, state.lineNbr, state.lineNbr, state,
+		strings.Contains(suffixes, commandNumber), strings.Contains(suffixes, commandList))
+}
+
+func maxIntOf(vars ...int) int {
+	max := vars[0]
+	for _, i := range vars {
+		if max < i {
+			max = i
+		}
+	}
+	return max
+}
+
 func minIntOf(vars ...int) int {
 	min := vars[0]
 	for _, i := range vars {
@@ -7,9 +7,11 @@ import (
 	"io"
 	"os"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/rjo67/red"
+	"github.com/rjo67/red/terminal"
 )
 
 /*
@@ -22,44 +24,280 @@ NAME is the progam name
 */
 const NAME = "Rich's ed"
 
+// exit statuses of the program
+const (
+	exitOK    = 0 // no errors
+	exitError = 1 // a command failed, or the editor could not be started
+)
+
 func main() {
 	state := red.NewState()
 
 	flag.BoolVar(&state.Debug, "d", false, "debug mode")
+	flag.BoolVar(&state.CheckState, "check", false, "check the consistency of the editor state after each command (debugging aid)")
 	flag.BoolVar(&state.ShowMemory, "m", false, "show memory usage")
+	flag.BoolVar(&state.Silent, "s", false, "script mode: suppresses the banner, the prompt, memory usage and the byte counts of e, r and w")
+	flag.BoolVar(&state.Deterministic, "deterministic", false, "suppress nondeterministic output (banner, memory usage, current time)")
 	flag.StringVar(&state.Prompt, "p", "", "Specifies a command prompt (default ':')")
+	flag.IntVar(&state.TabStop, "t", 8, "Specifies the width of a tab stop")
+	flag.IntVar(&state.TextWidth, "width", 72, "Specifies the maximum line length for reformatting")
+	flag.StringVar(&state.JoinSeparator, "joinsep", "", "Specifies the default separator for the join command (default: none)")
+	flag.BoolVar(&state.JoinNext, "J", false, "join command with one address joins with the next line")
+	flag.BoolVar(&state.HighlightDot, "hl", false, "mark the current line when printing")
+	flag.StringVar(&state.Color, "color", "auto", "colour line numbers and matches: auto (only when printing to a terminal), always or never")
+	flag.StringVar(&state.Messages, "messages", "stdout", "where byte counts, 'lines changed' and errors are written: stdout, stderr or tagged (on stdout, prefixed by '@@')")
+	flag.BoolVar(&state.IgnoreCase, "i", false, "regular expressions match case-insensitively")
+	flag.BoolVar(&state.VerboseErrors, "v", false, "print error messages instead of just '?' (see command 'H')")
+	flag.BoolVar(&state.UndoToggle, "undotoggle", false, "GNU-compatible undo: only the last command can be undone, and 'u' undoes a previous 'u'")
+	flag.StringVar(&state.BackupSuffix, "backup", "", "before 'w' overwrites a file, renames it by appending the given suffix, e.g. '~'")
+	flag.StringVar(&state.BackupDir, "backupdir", "", "the directory in which to store backups (see -backup)")
+	flag.BoolVar(&state.WriteInPlace, "inplace", false, "'w' overwrites an existing file in place (keeping hard links and the inode) instead of replacing it")
+	flag.BoolVar(&state.Restricted, "r", false, "restricted mode: no shell commands, and only the files given on the command line can be edited")
+	flag.StringVar(&state.Encoding, "encoding", "", "the encoding of files without a byte order mark: utf-8 (default), latin1, utf-16le or utf-16be")
+	flag.BoolVar(&state.LargeFiles, "large", false, "large-file mode: the lines of a file are read from disk only when they are accessed")
+	flag.IntVar(&state.WindowSize, "w", 0, "Specifies the window size for the scroll command (default: screen size minus two lines, or 22)")
+	benchRuns := flag.Int("bench", 0, "replays the commands in the script file (see -script) n times and reports timing statistics")
+	benchScript := flag.String("script", "", "the script file for -bench")
+	templatesFile := flag.String("templates", "", "the file containing template definitions (default: ~/.red_templates, if present)")
+	tutor := flag.Bool("tutor", false, "starts the interactive tutorial")
+	scriptFile := flag.String("f", "", "reads the commands (and any text for input mode) from the given file instead of from stdin")
+	flag.DurationVar(&state.AutosaveInterval, "autosave", 0, "writes unsaved changes to a recovery file at the given interval, e.g. 60s (default: no autosave)")
+	rcFile := flag.String("rc", "", "the configuration file containing settings and startup commands (default: ~/.redrc, if present)")
+	noRC := flag.Bool("norc", false, "does not read the configuration file")
+	noLineEditing := flag.Bool("noedit", false, "disables line editing (cursor keys etc.) when reading from a terminal")
+	noPager := flag.Bool("nopager", false, "disables pausing after each screenful of output from p, n and l")
+	historyFile := flag.String("history", red.DefaultHistoryFile(), "the file in which the command history is kept when line editing (\"\": none)")
+	serve := flag.Bool("serve", false, "server mode for editor frontends: reads commands as JSON requests from stdin and writes JSON responses to stdout")
 	flag.Parse()
 
 	stop := false
-	var startfile string
-	if flag.NArg() > 1 {
-		fmt.Printf("unexpected arguments. See usage")
+	exitStatus := exitOK
+	state.ShowPrompt = true
+	startupCommands, err := resolveConfig(state, flag.CommandLine, os.Getenv, *rcFile, !*noRC)
+	if err != nil {
+		fmt.Fprintf(state.Stderr, "error reading configuration: %s\n", err.Error())
+		stop = true
+		exitStatus = exitError
+	}
+	if err := red.CheckEncoding(state.Encoding); err != nil {
+		fmt.Fprintf(state.Stderr, "error: %s\n", err.Error())
 		stop = true
-	} else if flag.NArg() == 1 {
+		exitStatus = exitError
+	}
+	if err := red.CheckColor(state.Color); err != nil {
+		fmt.Fprintf(state.Stderr, "error: %s\n", err.Error())
+		stop = true
+		exitStatus = exitError
+	}
+	if err := red.CheckMessages(state.Messages); err != nil {
+		fmt.Fprintf(state.Stderr, "error: %s\n", err.Error())
+		stop = true
+		exitStatus = exitError
+	}
+	serveOutput := state.Stdout
+	if *serve {
+		// stdout only carries the responses; any other output (e.g. byte counts) goes to stderr
+		state.Stdout = state.Stderr
+	}
+	var startfile string
+	if flag.NArg() > 0 {
+		// further files can be edited with the commands 'fn' and 'fp'
 		startfile = flag.Arg(0)
+		state.SetFileList(flag.Args())
 	}
 	if !stop {
 		if state.Prompt == "" {
 			state.Prompt = ":" // default prompt
 		}
-		state.ShowPrompt = true
+		state.ShowPrompt = state.ShowPrompt && !state.Silent
+		state.ShowMemory = state.ShowMemory && !state.Silent
 
-		state.WindowSize = 15 // see https://stackoverflow.com/a/48610796 for a better way...
+		if state.WindowSize < 1 {
+			state.WindowSize = red.TerminalWindowSize()
+			// the window size follows the terminal size, unless set explicitly
+			defer red.HandleWindowResize(state)()
+		}
 
-		fmt.Printf("*** %s (v%s)\n", NAME, VERSION)
+		if !state.Deterministic && !state.Silent && !*serve {
+			fmt.Fprintf(state.Stdout, "*** %s (v%s)\n", NAME, VERSION)
+		}
+	}
+	if !stop {
+		if err := red.LoadTemplatesFile(state, *templatesFile); err != nil {
+			fmt.Fprintf(state.Stderr, "error reading templates: %s\n", err.Error())
+			stop = true
+			exitStatus = exitError
+		}
+	}
+	saveHistory := func() {}
+	if !stop && !*serve && *scriptFile == "" && !*noLineEditing && !state.Silent && terminal.IsTerminal(os.Stdin.Fd()) {
+		// commands and input-mode text can be edited before being entered
+		lineEditor := terminal.NewLineEditor(os.Stdin, state.Stdout)
+		lineEditor.History = state.History
+		// Tab completes the filenames of the commands e, E, r, w, W, wq, Wq and f
+		lineEditor.Completer = terminal.FilenameCompleter{FS: state.FileSystem, Commands: []string{"e", "E", "r", "w", "W", "wq", "Wq", "f", "diff"}}
+		if !*noPager && terminal.IsTerminal(os.Stdout.Fd()) {
+			// a screenful, leaving one line for the '--More--' prompt
+			state.PageSize = red.TerminalWindowSize() + 1
+			state.MorePrompt = lineEditor.More
+		}
+		state.Stdin = lineEditor
+		if *historyFile != "" {
+			if err := state.History.LoadHistoryFile(*historyFile); err != nil {
+				fmt.Fprintf(state.Stderr, "error reading history: %s\n", err.Error())
+			}
+			saveHistory = func() {
+				if err := state.History.SaveHistoryFile(*historyFile); err != nil {
+					fmt.Fprintf(state.Stderr, "error writing history: %s\n", err.Error())
+				}
+			}
+		}
+	}
+	if !stop && *scriptFile != "" {
+		f, err := openScriptFile(state, *scriptFile)
+		if err != nil {
+			fmt.Fprintf(state.Stderr, "error opening script file: %s\n", err.Error())
+			stop = true
+			exitStatus = exitError
+		} else {
+			defer f.Close()
+		}
 	}
 	if !stop {
 		// read in start file if specified
 		if startfile != "" {
 			if err := readInputFile(startfile, state); err != nil {
-				fmt.Printf("error: %s\n", err.Error())
+				fmt.Fprintf(state.Stderr, "error: %s\n", err.Error())
 				stop = true
+				exitStatus = exitError
 			}
 		}
 	}
+	if !stop && *tutor {
+		tutorloop(state.InputReader())
+		stop = true
+	}
 	if !stop {
-		mainloop(state, bufio.NewReader(os.Stdin))
+		if *benchRuns > 0 {
+			if err := runBench(state, *benchScript, *benchRuns); err != nil {
+				fmt.Fprintf(state.Stderr, "error: %s\n", err.Error())
+				exitStatus = exitError
+			}
+		} else {
+			// on SIGHUP or SIGTERM, unsaved changes are written to red.hup
+			red.HandleHangup(state, func() { os.Exit(exitError) })
+			// Ctrl-C aborts the current command instead of the program
+			red.HandleInterrupt(state)
+			stopAutosave := func() {}
+			if state.AutosaveInterval > 0 {
+				if err := state.OfferRecovery(); err != nil {
+					fmt.Fprintf(state.Stderr, "error reading recovery file: %s\n", err.Error())
+				}
+				stopAutosave = red.StartAutosave(state, state.AutosaveInterval)
+			}
+			if !runStartupCommands(state, startupCommands) {
+				exitStatus = exitError
+			}
+			if *serve {
+				if err := red.Serve(state, state.InputReader(), serveOutput); err != nil {
+					fmt.Fprintf(state.Stderr, "error: %s\n", err.Error())
+					exitStatus = exitError
+				}
+			} else if status := mainloop(state); status != exitOK {
+				exitStatus = status
+			}
+			stopAutosave()
+		}
+	}
+	saveHistory()
+	if exitStatus != exitOK {
+		os.Exit(exitStatus)
+	}
+}
+
+/*
+Replays the commands in the given script 'nbrRuns' times against the current buffer and prints the statistics.
+Any output of the commands themselves is discarded.
+*/
+func runBench(state *red.State, scriptFilename string, nbrRuns int) error {
+	if scriptFilename == "" {
+		return fmt.Errorf("no script file specified")
+	}
+	script, err := os.ReadFile(scriptFilename)
+	if err != nil {
+		return err
 	}
+	var commands []string
+	for _, line := range strings.Split(string(script), "\n") {
+		if strings.TrimSpace(line) != "" {
+			commands = append(commands, line)
+		}
+	}
+
+	stats, err := red.Bench(state, commands, nbrRuns)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range stats {
+		if state.Deterministic {
+			// timings and allocations differ from run to run
+			fmt.Fprintf(state.Stdout, "%-20s runs=%d errors=%d\n", s.Command, s.Runs, s.Errors)
+		} else {
+			fmt.Fprintln(state.Stdout, s)
+		}
+	}
+	return nil
+}
+
+/*
+Sets up 'state' to read the commands, and any text for input mode, from the given file.
+The file must be closed by the caller.
+*/
+func openScriptFile(state *red.State, filename string) (*os.File, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	state.Stdin = f
+	return f, nil
+}
+
+/*
+Sets up the editor from the environment (see red.ApplyEnvironment) and the configuration file (if 'readRC'),
+in that order, and returns the startup commands of the configuration file.
+The flags which have been given explicitly on the command line override both.
+*/
+func resolveConfig(state *red.State, flags *flag.FlagSet, getenv func(string) string, rcFile string, readRC bool) (startupCommands []string, err error) {
+	explicitFlags := map[string]string{}
+	flags.Visit(func(f *flag.Flag) { explicitFlags[f.Name] = f.Value.String() })
+	err = red.ApplyEnvironment(state, getenv)
+	if err == nil && readRC {
+		startupCommands, err = red.LoadConfigFile(state, rcFile)
+	}
+	for name, value := range explicitFlags {
+		flags.Set(name, value)
+	}
+	return startupCommands, err
+}
+
+/*
+Executes the startup commands of the configuration file. Errors are reported as for commands entered by the user.
+Returns false if a command failed.
+*/
+func runStartupCommands(state *red.State, commands []string) (ok bool) {
+	ok = true
+	for _, cmdStr := range commands {
+		cmd, err := state.ParseCommand(cmdStr)
+		if err == nil {
+			_, err = cmd.ProcessCommand(state, nil, false)
+		}
+		if err != nil {
+			state.ReportError(err)
+			ok = false
+		}
+	}
+	return ok
 }
 
 /*
@@ -80,45 +318,106 @@ func readInputFile(filename string, state *red.State) error {
 	return nil
 }
 
-func mainloop(state *red.State, reader *bufio.Reader) {
+/*
+Reads commands from state.Stdin and processes them until 'q' or EOF.
+
+ Errors are reported via state.ReportError and processing continues.
+ Returns exitError if any command failed (e.g. for scripts piped into the editor), otherwise exitOK.
+*/
+func mainloop(state *red.State) (exitStatus int) {
+	// commands which read further input (e.g. 'a' or 'G') use the same reader
+	reader := state.InputReader()
+	out := state.Stdout
+	exitStatus = exitOK
 	quit := false
 	for !quit {
-		if state.ShowMemory {
-			fmt.Printf("%s ", GetMemUsage())
+		var prompt strings.Builder
+		if state.ShowMemory && !state.Deterministic {
+			fmt.Fprintf(&prompt, "%s ", GetMemUsage())
 		}
 		if state.ShowPrompt {
-			fmt.Print(state.Prompt, " ")
+			fmt.Fprint(&prompt, state.Prompt, " ")
 		}
-		cmdStr, err := reader.ReadString('\n')
+		if lineEditor, ok := state.Stdin.(*terminal.LineEditor); ok {
+			// the line editor redraws the prompt whilst the line is edited
+			lineEditor.SetPrompt(prompt.String())
+		} else {
+			fmt.Fprint(out, prompt.String())
+		}
+		cmdStr, err := red.ReadCommandLine(reader)
 		if err != nil {
 			// EOF might happen if reading commands from input file
 			if err == io.EOF {
 				quit = true
 			} else {
-				fmt.Printf("error: %s", err)
+				state.ReportError(err)
+				exitStatus = exitError
 			}
 		} else {
-			cmd, err := red.ParseCommand(cmdStr[0:len(cmdStr)-1], state.Debug) // remove LF
+			state.History.Add(cmdStr)
+			cmd, err := state.ParseCommand(cmdStr)
 			if err != nil {
-				fmt.Printf("? %s\n", err)
+				state.ReportError(err)
+				exitStatus = exitError
 			} else {
 				if state.Debug {
-					fmt.Println(cmd)
+					fmt.Fprintln(out, cmd)
 				}
 
 				var err error
 				quit, err = cmd.ProcessCommand(state, nil, false)
 
-				// each command call can return an error, which will be displayed here
+				// each command call can return an error, which will be reported here
 				if err != nil {
-					fmt.Printf("error: %s\n", err)
+					state.ReportError(err)
+					exitStatus = exitError
 				}
 				if state.Debug {
-					fmt.Printf("state: %+v, buffer len: %d, cut buffer len %d\n", state, state.Buffer.Len(), state.CutBuffer.Len())
+					if state.Deterministic {
+						// the state contains pointers, which differ from run to run
+						fmt.Fprintf(out, "buffer len: %d, cut buffer len %d\n", state.Buffer.Len(), state.CutBuffer.Len())
+					} else {
+						fmt.Fprintf(out, "state: %+v, buffer len: %d, cut buffer len %d\n", state, state.Buffer.Len(), state.CutBuffer.Len())
+					}
 				}
 			}
 		}
 	}
+	return exitStatus
+}
+
+/*
+Runs the interactive tutorial, which uses its own practice buffer.
+*/
+func tutorloop(reader *bufio.Reader) {
+	tutor, state := red.NewTutor()
+	state.ShowPrompt = true
+	out := state.Stdout
+	fmt.Fprintln(out, "Enter 'q' to leave the tutorial at any time.")
+	fmt.Fprintln(out, tutor.Lesson())
+	for !tutor.Done() {
+		fmt.Fprint(out, state.Prompt, " ")
+		cmdStr, err := reader.ReadString('\n')
+		if err != nil {
+			if err != io.EOF {
+				fmt.Fprintf(out, "error: %s", err)
+			}
+			return
+		}
+		completed, quit, err := tutor.Execute(state, strings.TrimSuffix(cmdStr, "\n"))
+		switch {
+		case quit:
+			return
+		case err != nil:
+			fmt.Fprintf(out, "error: %s\n", err)
+			fmt.Fprintln(out, tutor.Hint())
+		case completed:
+			fmt.Fprintln(out, "Well done!")
+			fmt.Fprintln(out, tutor.Lesson())
+		default:
+			fmt.Fprintln(out, tutor.Hint())
+		}
+	}
 }
 
 // GetMemUsage returns a formatted string of current memory stats
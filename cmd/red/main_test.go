@@ -3,9 +3,11 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"flag"
 	"fmt"
 	"io"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/rjo67/red"
@@ -43,16 +45,15 @@ func TestMainLoop(t *testing.T) {
 				t.Fatalf("error reading input file: %s", err)
 			}
 
-			// open commands file
-			f, err := os.Open(commandsFilename)
+			// open commands file (as if specified with -f)
+			f, err := openScriptFile(state, commandsFilename)
 			if err != nil {
 				t.Fatalf("error opening commands file: %s", err)
 			}
 			defer f.Close()
-			reader := bufio.NewReader(f)
 
 			// GO
-			mainloop(state, reader)
+			mainloop(state)
 
 			// compare
 			err = fileCompare(outputFilename, expectedOutputFilename)
@@ -63,6 +64,156 @@ func TestMainLoop(t *testing.T) {
 	}
 }
 
+/*
+Tests which execute the given ED commands against an input file in deterministic mode
+and compare everything written by the editor with the expected transcript.
+*/
+func TestTranscript(t *testing.T) {
+
+	data := []struct {
+		inputFilename string
+		name          string
+	}{
+		{"test1.txt", "transcript1.txt"},
+	}
+
+	for _, test := range data {
+		t.Run(fmt.Sprintf("processing file %s", test.name), func(t *testing.T) {
+			expectedTranscriptFilename := "testfiles/transcript-" + test.name
+			commandsFilename := "testfiles/commands-" + test.name
+			inputFilename := "testfiles/" + test.inputFilename
+
+			state := red.NewState()
+			state.Deterministic = true
+			state.ShowMemory = true // must not show up in the transcript
+			state.ShowPrompt = true
+
+			f, err := os.Open(commandsFilename)
+			if err != nil {
+				t.Fatalf("error opening commands file: %s", err)
+			}
+			defer f.Close()
+
+			// capture everything written by the commands and the main loop
+			var transcript bytes.Buffer
+			state.Stdout = &transcript
+			if err := readInputFile(inputFilename, state); err != nil {
+				t.Fatalf("error reading input file: %s", err)
+			}
+			state.Stdin = f
+			mainloop(state)
+
+			expected, err := os.ReadFile(expectedTranscriptFilename)
+			if err != nil {
+				t.Fatalf("error reading transcript file: %s", err)
+			}
+			if transcript.String() != string(expected) {
+				t.Errorf("transcript did not match '%s'.\ngot:\n%s\nexpected:\n%s", expectedTranscriptFilename, transcript.String(), expected)
+			}
+		})
+	}
+}
+
+func TestMainLoopExitStatus(t *testing.T) {
+	data := []struct {
+		commands           string
+		expectedExitStatus int
+		expectedOutput     string
+	}{
+		{"a\nline\n.\n1p\n", exitOK, "line\n"},
+		{"1p\n", exitError, "?\n"},
+		{"a\nline\n.\n9p\nh\n1p\n", exitError, "?\ninvalid start of range: invalid line: 9, max line: 1\nline\n"},
+		{"u\nH\n", exitError, "?\nnothing to undo\n"},
+	}
+	for i, test := range data {
+		t.Run(fmt.Sprintf("test %d", i), func(t *testing.T) {
+			state := red.NewState()
+			var output bytes.Buffer
+			state.Stdout = &output
+			state.Stdin = strings.NewReader(test.commands)
+			exitStatus := mainloop(state)
+			if exitStatus != test.expectedExitStatus {
+				t.Fatalf("wrong exit status, got %d, expected %d", exitStatus, test.expectedExitStatus)
+			}
+			if output.String() != test.expectedOutput {
+				t.Fatalf("wrong output, got:\n%s\nexpected:\n%s", output.String(), test.expectedOutput)
+			}
+		})
+	}
+}
+
+func TestResolveConfig(t *testing.T) {
+	rcFile, err := os.CreateTemp("", "red-rc")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.Remove(rcFile.Name())
+	fmt.Fprintln(rcFile, "windowsize = 10\ntabstop = 4\n:H")
+	rcFile.Close()
+	env := map[string]string{"ED_PROMPT": "env>", "ED_WINDOWSIZE": "20"}
+
+	data := []struct {
+		args           []string
+		readRC         bool
+		expectedPrompt string
+		expectedWindow int
+		expectedTabs   int
+	}{
+		{nil, false, "env>", 20, 8},
+		{nil, true, "env>", 10, 4},                                 // the configuration file overrides the environment
+		{[]string{"-p", "flag>", "-t", "2"}, true, "flag>", 10, 2}, // flags override both
+	}
+	for i, test := range data {
+		t.Run(fmt.Sprintf("test %d", i), func(t *testing.T) {
+			state := red.NewState()
+			flags := flag.NewFlagSet("red", flag.ContinueOnError)
+			flags.StringVar(&state.Prompt, "p", "", "")
+			flags.IntVar(&state.TabStop, "t", 8, "")
+			if err := flags.Parse(test.args); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			commands, err := resolveConfig(state, flags, func(name string) string { return env[name] }, rcFile.Name(), test.readRC)
+			if err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			if state.Prompt != test.expectedPrompt || state.WindowSize != test.expectedWindow || state.TabStop != test.expectedTabs {
+				t.Fatalf("wrong config: prompt %q, window size %d, tab stop %d", state.Prompt, state.WindowSize, state.TabStop)
+			}
+			if test.readRC && (len(commands) != 1 || commands[0] != "H") {
+				t.Fatalf("wrong startup commands: %v", commands)
+			}
+		})
+	}
+}
+
+func TestScriptFileWithInputMode(t *testing.T) {
+	f, err := os.CreateTemp("", "red-script")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("a\nfirst\nsecond\n.\n1c\nchanged\n.\n,p\n")
+	f.Close()
+
+	state := red.NewState()
+	var output bytes.Buffer
+	state.Stdout = &output
+	script, err := openScriptFile(state, f.Name())
+	if err != nil {
+		t.Fatalf("error opening script file: %s", err)
+	}
+	defer script.Close()
+	if exitStatus := mainloop(state); exitStatus != exitOK {
+		t.Fatalf("wrong exit status %d, output: %s", exitStatus, output.String())
+	}
+	if output.String() != "changed\nsecond\n" {
+		t.Fatalf("wrong output, got:\n%s", output.String())
+	}
+	if _, err := openScriptFile(state, f.Name()+".does-not-exist"); err == nil {
+		t.Fatalf("expected error for missing script file")
+	}
+}
+
 func fileCompare(filename1, filename2 string) error {
 	f1, err := os.Open(filename1)
 	if err != nil {
@@ -3,7 +3,12 @@ package red
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -41,6 +46,74 @@ func TestAppend(t *testing.T) {
 
 }
 
+func TestAppendChangeReadInput(t *testing.T) {
+	data := []struct {
+		cmd              string
+		expectedContents string
+	}{
+		{"2a", "1\n2\nx\ny\n3\n"},
+		{"2i", "1\nx\ny\n2\n3\n"},
+		{"2c", "1\nx\ny\n3\n"},
+	}
+	for i, test := range data {
+		t.Run(fmt.Sprintf("test %d: >>%s<<", i, test.cmd), func(t *testing.T) {
+			state := resetState([]string{"1", "2", "3"})
+			state.Stdin = strings.NewReader("x\ny\n.\n")
+			cmd, err := ParseCommand(test.cmd, false)
+			if err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			if _, err = cmd.ProcessCommand(state, nil, false); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertBufferContents(t, state.Buffer, test.expectedContents)
+		})
+	}
+}
+
+func TestReadInputLinesEscapedFullstop(t *testing.T) {
+	input := "a\n\\.\n\\\\.\n.b\n\\.b\n.\nnot read\n"
+	lines, nbrLines, err := readInputLines(bufio.NewReader(strings.NewReader(input)))
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertInt(t, "wrong number of lines", nbrLines, 5)
+	assertListContents(t, lines, "a\n.\n\\.\n.b\n\\.b\n")
+}
+
+func TestAppendChangeEmptyInput(t *testing.T) {
+	data := []struct {
+		cmdLine          string
+		expectedContents string
+		expectedLineNbr  int
+	}{
+		{"2a", "1\n2\n3\n4\n", 2},
+		{"0a", "1\n2\n3\n4\n", 0},
+		{"3i", "1\n2\n3\n4\n", 3},
+		{"2c", "1\n3\n4\n", 2},
+		{"2,3c", "1\n4\n", 2},
+		{"3,4c", "1\n2\n", 2},
+		{"1,$c", "", 0},
+	}
+	for i, test := range data {
+		t.Run(fmt.Sprintf("test %d: >>%s<<", i, test.cmdLine), func(t *testing.T) {
+			state := resetState([]string{"1", "2", "3", "4"})
+			state.lineNbr = 1
+			state.Stdin = strings.NewReader(".\n")
+			if err := processCommandLine(t, state, test.cmdLine); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertBufferContents(t, state.Buffer, test.expectedContents)
+			assertInt(t, "wrong state.lineNbr", state.lineNbr, test.expectedLineNbr)
+			// a change without input can be undone
+			if err := processCommandLine(t, state, "u"); err != nil && !errors.Is(err, ErrNothingToUndo) {
+				t.Fatalf("undo: error: %s", err)
+			}
+			assertBufferContents(t, state.Buffer, "1\n2\n3\n4\n")
+		})
+	}
+}
+
 func TestChange(t *testing.T) {
 	data := []struct {
 		addrRange        string
@@ -109,7 +182,7 @@ func TestJoin(t *testing.T) {
 		t.Fatalf("error: %s", err)
 	}
 	assertInt(t, "wrong state.lineNbr!", state.lineNbr, 2)
-	assertBufferContents(t, state.Buffer, "1\n2 3\n4\n5\n")
+	assertBufferContents(t, state.Buffer, "1\n23\n4\n5\n")
 
 	// ---------- test2: NB here "2j" is a no-op, but in vim 2j is the same as 2,+1j
 	state = resetState([]string{"1", "2", "3", "4", "5"})
@@ -123,6 +196,42 @@ func TestJoin(t *testing.T) {
 	assertBufferContents(t, state.Buffer, "1\n2\n3\n4\n5\n")
 }
 
+func TestJoinOptions(t *testing.T) {
+	data := []struct {
+		addrRange        string
+		suffix           string
+		joinNext         bool
+		expectedContents string
+		expectedLineNbr  int
+	}{
+		{"2,3", "-", false, "1\n23\n4\n5\n", 2},
+		{"2,3", "+", false, "1\n2 3\n4\n5\n", 2},
+		{"2,4", "/, /", false, "1\n2, 3, 4\n5\n", 2},
+		{"2,4", "||", false, "1\n234\n5\n", 2},
+		{"2", "", true, "1\n23\n4\n5\n", 2},
+		{"5", "", true, "1\n2\n3\n4\n5\n", 1}, // no next line: no-op
+		{"2", "", false, "1\n2\n3\n4\n5\n", 1},
+	}
+
+	for i, test := range data {
+		t.Run(fmt.Sprintf("test %d: >>%sj%s<<", i, test.addrRange, test.suffix), func(t *testing.T) {
+			var err error
+			var cmd Command
+			state := resetState([]string{"1", "2", "3", "4", "5"})
+			state.lineNbr = 1
+			state.JoinNext = test.joinNext
+			if cmd, err = createCommandAndResolveAddressRange(state, newValidRange(test.addrRange), commandJoin, test.suffix); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			if err = cmd.Join(state); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertInt(t, "wrong state.lineNbr!", state.lineNbr, test.expectedLineNbr)
+			assertBufferContents(t, state.Buffer, test.expectedContents)
+		})
+	}
+}
+
 func TestMove(t *testing.T) {
 	data := []struct {
 		addrRange        string
@@ -172,6 +281,13 @@ func TestParseValidCommands(t *testing.T) {
 		{"'a,5y", "'a,5", "y", ""},
 		{"/234/,9m4", "/234/,9", "m", "4"},
 		{"?234?,'b  y", "?234?,'b", "y", ""},
+		{"1,$N/%03d: /", "1,$", "N", "/%03d: /"},
+		{"wq", "", "wq", ""},
+		{"1,2wq out.txt", "1,2", "wq", "out.txt"},
+		{"Wq out.txt", "", "Wq", "out.txt"},
+		{"w q.txt", "", "w", "q.txt"},
+		{"wq.txt", "", "w", "q.txt"},
+		{"w q", "", "w", "q"},
 	}
 	for i, test := range data {
 		t.Run(fmt.Sprintf("test %d: >>%s<<", i, test.input), func(t *testing.T) {
@@ -199,6 +315,119 @@ func TestParseInvalidCommands(t *testing.T) {
 	}
 }
 
+func TestParseCommandErrors(t *testing.T) {
+	data := []struct {
+		input         string
+		expectedError string
+	}{
+		{"1,2,3p", "unexpected ',' at column 4"},
+		{"/x/;/y/;p", "unexpected ';' at column 8"},
+		{"'qbe,2p", "unrecognised command 'b' at column 3"},
+		{"1,2 b", "unrecognised command 'b' at column 5"},
+		{"1,2äp", "unrecognised command 'ä' at column 4"},
+		{"?234,'b  y", "unterminated regular expression '?234,'b  y' at column 1"},
+		{"'1p", "invalid mark ''1' at column 1"},
+		{"99999999999999999999p", "invalid number '99999999999999999999' at column 1"},
+	}
+	for _, test := range data {
+		_, err := ParseCommand(test.input, false)
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Fatalf("command '%s': expected syntax error, got %v", test.input, err)
+		}
+		assertString(t, "wrong error for "+test.input, err.Error(), test.expectedError)
+	}
+}
+
+func TestCommandErrors(t *testing.T) {
+	data := []struct {
+		cmdLine       string
+		changed       bool // whether the buffer has unsaved changes
+		expectedError error
+	}{
+		{"5p", false, ErrAddressOutOfRange},
+		{"3,1p", false, ErrBadRange},
+		{"'ap", false, ErrNoSuchMark},
+		{"/xyz/p", false, ErrNoMatch},
+		{"1m5", false, ErrInvalidDestination},
+		{"1kA", false, ErrBadMarkName},
+		{"u", false, ErrNothingToUndo},
+		{"q", true, ErrUnsavedChanges},
+		{"e", true, ErrUnsavedChanges},
+		{"1P", false, ErrAddressMayNotBeSpecified},
+		{"F x", false, ErrInvalidArgument},
+		{"set x=1", false, ErrUnknownSetting},
+		{"1,2b", false, ErrUnrecognisedCommand},
+	}
+	for _, test := range data {
+		state := resetState([]string{"a", "b", "c"})
+		state.lineNbr = 1
+		state.changedSinceLastWrite = test.changed
+		cmd, err := ParseCommand(test.cmdLine, false)
+		if err == nil {
+			_, err = cmd.ProcessCommand(state, nil, false)
+		}
+		if !errors.Is(err, test.expectedError) {
+			t.Fatalf("command '%s': expected error '%s', got %v", test.cmdLine, test.expectedError, err)
+		}
+	}
+}
+
+func TestRepeatedCommandWithUnsavedChanges(t *testing.T) {
+	dir, err := os.MkdirTemp("", "red-unsaved")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	data := []struct {
+		cmdLines     []string
+		expectedQuit bool
+	}{
+		{[]string{"q"}, false},
+		{[]string{"q", "q"}, true},
+		{[]string{"q", "p", "q"}, false}, // another command resets the warning
+		{[]string{"q", "e", "q"}, false},
+		{[]string{"q", "Q"}, true},
+		{[]string{"w", "q"}, true},
+	}
+	for _, test := range data {
+		state := resetState([]string{"a"})
+		state.lineNbr = 1
+		state.Stdout = io.Discard
+		state.defaultFilename = filepath.Join(dir, "written")
+		state.changedSinceLastWrite = true
+		var quit bool
+		for i, cmdLine := range test.cmdLines {
+			cmd, err := ParseCommand(cmdLine, false)
+			if err != nil {
+				t.Fatalf("command '%s': error: %s", cmdLine, err)
+			}
+			quit, err = cmd.ProcessCommand(state, nil, false)
+			if i == len(test.cmdLines)-1 && !test.expectedQuit && !errors.Is(err, ErrUnsavedChanges) {
+				t.Fatalf("%v: expected error '%s', got %v", test.cmdLines, ErrUnsavedChanges, err)
+			}
+		}
+		if quit != test.expectedQuit {
+			t.Fatalf("%v: expected quit=%t", test.cmdLines, test.expectedQuit)
+		}
+	}
+	// a repeated 'e' edits the file
+	state := resetState([]string{"a"})
+	state.Stdout = io.Discard
+	state.changedSinceLastWrite = true
+	filename := filepath.Join(dir, "file")
+	if err := os.WriteFile(filename, []byte("b\n"), 0644); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if err := processCommandLine(t, state, "e "+filename); !errors.Is(err, ErrUnsavedChanges) {
+		t.Fatalf("expected error '%s', got %v", ErrUnsavedChanges, err)
+	}
+	if err := processCommandLine(t, state, "e "+filename); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertBufferContents(t, state.Buffer, "b\n")
+}
+
 func createAndCheckCommand(t *testing.T, cmdString, expAddr, expCmd, expRestOfCmd string) {
 	var cmd Command
 	var err error
@@ -221,7 +450,7 @@ func TestPrintRange(t *testing.T) {
 	// to capture the output
 	var buff bytes.Buffer // implements io.Writer
 
-	if err := _printRange(&buff, cmd.resolved.start, cmd.resolved.end, state, false); err != nil {
+	if err := _printRange(&buff, cmd.resolved.start, cmd.resolved.end, state, false, false); err != nil {
 		t.Fatalf("error %s", err)
 	}
 	if buff.String() != "2\n3\n" {
@@ -232,7 +461,7 @@ func TestPrintRange(t *testing.T) {
 	if cmd, err = createCommandAndResolveAddressRange(state, newValidRange("1, 4"), commandPrint, ""); err != nil {
 		t.Fatalf("error %s", err)
 	}
-	if err = _printRange(&buff, cmd.resolved.start, cmd.resolved.end, state, false); err != nil {
+	if err = _printRange(&buff, cmd.resolved.start, cmd.resolved.end, state, false, false); err != nil {
 		t.Fatalf("error %s", err)
 	}
 	if buff.String() != "1\n2\n3\n4\n" {
@@ -243,7 +472,7 @@ func TestPrintRange(t *testing.T) {
 	if cmd, err = createCommandAndResolveAddressRange(state, newValidRange("3,3"), commandPrint, ""); err != nil {
 		t.Fatalf("error %s", err)
 	}
-	if err = _printRange(&buff, cmd.resolved.start, cmd.resolved.end, state, false); err != nil {
+	if err = _printRange(&buff, cmd.resolved.start, cmd.resolved.end, state, false, false); err != nil {
 		t.Fatalf("error %s", err)
 	}
 	if buff.String() != "3\n" {
@@ -258,7 +487,7 @@ func TestPrintRange(t *testing.T) {
 	if err = cmd.resolveAddress(state); err != nil {
 		t.Fatalf("error %s", err)
 	}
-	if err = _printRange(&buff, cmd.resolved.start, cmd.resolved.end, state, false); err != nil {
+	if err = _printRange(&buff, cmd.resolved.start, cmd.resolved.end, state, false, false); err != nil {
 		t.Fatalf("error %s", err)
 	}
 	if buff.String() != "4\n" {
@@ -266,6 +495,75 @@ func TestPrintRange(t *testing.T) {
 	}
 }
 
+func TestPrintRangeHighlightDot(t *testing.T) {
+	state := resetState([]string{"1", "2", "3", "4", "5"})
+	state.HighlightDot = true
+	state.lineNbr = 3
+
+	var buff bytes.Buffer
+	if err := _printRange(&buff, 2, 4, state, false, false); err != nil {
+		t.Fatalf("error %s", err)
+	}
+	assertString(t, "2,4p", buff.String(), "  2\n> 3\n  4\n")
+
+	// the current line is now 4
+	buff.Reset()
+	if err := _printRange(&buff, 3, 5, state, true, false); err != nil {
+		t.Fatalf("error %s", err)
+	}
+	assertString(t, "3,5n", buff.String(), "     3\t 3\n>    4\t 4\n     5\t 5\n")
+}
+
+func TestPrintRangeInvalid(t *testing.T) {
+	state := resetState([]string{"1", "2", "3"})
+	data := []struct{ start, end int }{{3, 2}, {0, 2}, {2, 4}}
+	for _, test := range data {
+		var buff bytes.Buffer
+		if err := _printRange(&buff, test.start, test.end, state, false, false); err == nil {
+			t.Fatalf("expected error for range %d,%d", test.start, test.end)
+		}
+		assertString(t, "no output expected", buff.String(), "")
+	}
+}
+
+func TestListLine(t *testing.T) {
+	long := strings.Repeat("0123456789", 8)
+	data := []struct {
+		line     string
+		expected string
+	}{
+		{"plain text\n", "plain text$\n"},
+		{"\ttab\\back\n", "\\ttab\\\\back$\n"},
+		{"bell\a bs\b ff\f cr\r vt\v\n", "bell\\a bs\\b ff\\f cr\\r vt\\v$\n"},
+		{"esc\x1b nul\x00 del\x7f\n", "esc\\033 nul\\000 del\\177$\n"},
+		{"ä\n", "\\303\\244$\n"},
+		{"$ is escaped\n", "\\$ is escaped$\n"},
+		{"\n", "$\n"},
+		{long + "\n", long[:71] + "\\\n" + long[71:] + "$\n"},
+		// an escape sequence is not split
+		{long[:70] + "\t\n", long[:70] + "\\\n\\t$\n"},
+	}
+	for i, test := range data {
+		assertString(t, fmt.Sprintf("test %d", i), _listLine(test.line), test.expected)
+	}
+}
+
+func TestPrintRangeList(t *testing.T) {
+	state := resetState([]string{"a\tb", "c"})
+	var buff bytes.Buffer
+	if err := _printRange(&buff, 1, 2, state, false, true); err != nil {
+		t.Fatalf("error %s", err)
+	}
+	assertString(t, "1,2l", buff.String(), "a\\tb$\nc$\n")
+	assertInt(t, "wrong state.lineNbr!", state.lineNbr, 2)
+
+	buff.Reset()
+	if err := _printRange(&buff, 1, 1, state, true, true); err != nil {
+		t.Fatalf("error %s", err)
+	}
+	assertString(t, "1ln", buff.String(), "   1\t a\\tb$\n")
+}
+
 func TestScroll(t *testing.T) {
 	var err error
 	var cmd Command
@@ -305,6 +603,33 @@ func TestScroll(t *testing.T) {
 	assertInt(t, "bad scroll size", state.WindowSize, 3)
 }
 
+func TestScrollSetWindowSize(t *testing.T) {
+	state := resetState([]string{"1", "2", "3", "4", "5"})
+	state.WindowSize = 2
+	state.lineNbr = 1
+	var buff bytes.Buffer
+	for _, arg := range []string{"=4", "="} {
+		cmd, err := createCommandAndResolveAddressRange(state, newValidRange(""), commandScroll, arg)
+		if err != nil {
+			t.Fatalf("error %s", err)
+		}
+		if err := cmd._scroll(state, &buff); err != nil {
+			t.Fatalf("error %s", err)
+		}
+	}
+	assertInt(t, "bad scroll size", state.WindowSize, 4)
+	assertInt(t, "current line changed", state.lineNbr, 1)
+	assertString(t, "z= output", buff.String(), "4\n")
+
+	cmd, err := createCommandAndResolveAddressRange(state, newValidRange(""), commandScroll, "=0")
+	if err != nil {
+		t.Fatalf("error %s", err)
+	}
+	if err := cmd._scroll(state, &buff); err != ErrInvalidWindowSize {
+		t.Fatalf("expected ErrInvalidWindowSize, got %v", err)
+	}
+}
+
 func TestPut(t *testing.T) {
 	data := []struct {
 		addrRange        string
@@ -347,6 +672,67 @@ func TestPut(t *testing.T) {
 	}
 }
 
+func TestPutBefore(t *testing.T) {
+	data := []struct {
+		addrRange        string
+		expectedContents string
+		expectedLineNbr  int
+		expectedMark     int
+	}{
+		{"1", "some\nnew\n1\n2\n3\n", 2, 5},
+		{"0", "some\nnew\n1\n2\n3\n", 2, 5},
+		{"3", "1\n2\nsome\nnew\n3\n", 4, 5},
+		{"", "1\nsome\nnew\n2\n3\n", 3, 5}, // default is "."
+	}
+
+	for i, test := range data {
+		t.Run(fmt.Sprintf("test %d: >>%s<<", i, test.addrRange), func(t *testing.T) {
+			state := resetState([]string{"1", "2", "3"})
+			state.lineNbr = 2
+			state.addMark("a", 3)
+			state.CutBuffer = createListOfLines([]string{"some", "new"})
+			cmd, err := createCommandAndResolveAddressRange(state, newValidRange(test.addrRange), commandPutBefore, "")
+			if err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			if err = cmd.Put(state); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertInt(t, "wrong state.lineNbr!", state.lineNbr, test.expectedLineNbr)
+			assertBufferContents(t, state.Buffer, test.expectedContents)
+			assertInt(t, "mark 'a' not pointing at correct line.", state.marks["a"], test.expectedMark)
+
+			// and undo
+			if err = cmd.Undo(state); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertBufferContents(t, state.Buffer, "1\n2\n3\n")
+		})
+	}
+}
+
+func TestPutMarksAndUndo(t *testing.T) {
+	for _, cmdIdent := range []string{commandPut, commandPutBefore} {
+		t.Run(cmdIdent, func(t *testing.T) {
+			state := resetState([]string{"1", "2", "3", "4"})
+			state.addMark("a", 1) // above the insertion point
+			state.addMark("b", 3) // below the insertion point
+			state.CutBuffer = createListOfLines([]string{"some", "new"})
+			if err := processCommandLine(t, state, "2"+cmdIdent); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertInt(t, "mark 'a' after put", state.marks["a"], 1)
+			assertInt(t, "mark 'b' after put", state.marks["b"], 5)
+			if err := processCommandLine(t, state, commandUndo); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertBufferContents(t, state.Buffer, "1\n2\n3\n4\n")
+			assertInt(t, "mark 'a' after undo", state.marks["a"], 1)
+			assertInt(t, "mark 'b' after undo", state.marks["b"], 3)
+		})
+	}
+}
+
 func TestTransfer(t *testing.T) {
 	data := []struct {
 		addrRange        string
@@ -405,7 +791,7 @@ func TestYank(t *testing.T) {
 				t.Fatalf("error: %s", err)
 			}
 			assertInt(t, "wrong state.lineNbr!", state.lineNbr, test.expectedLineNbr)
-			assertBufferContents(t, state.CutBuffer, test.expectedContentsOfCutBuffer)
+			assertListContents(t, state.CutBuffer, test.expectedContentsOfCutBuffer)
 		})
 	}
 }
@@ -415,10 +801,203 @@ func TestMoveToLine(t *testing.T) {
 	state := resetState(data)
 
 	for i, expected := range data {
-		moveToLine(i+1, state)
+		if err := moveToLine(i+1, state); err != nil {
+			t.Fatalf("error: %s", err)
+		}
 		assertInt(t, "wrong state.lineNbr!", i+1, state.lineNbr)
-		if state.dotline.Value.(Line).Line != expected+"\n" {
-			t.Fatalf("bad data element %d, expected '%s' but got '%s'", i, expected, state.dotline.Value.(Line).Line)
+		line, err := state.Buffer.Get(state.lineNbr)
+		if err != nil {
+			t.Fatalf("error: %s", err)
+		}
+		if line.Line != expected+"\n" {
+			t.Fatalf("bad data element %d, expected '%s' but got '%s'", i, expected, line.Line)
+		}
+	}
+}
+
+func TestMoveToLineOutOfRange(t *testing.T) {
+	state := resetState([]string{"1", "2", "3"})
+	state.lineNbr = 2
+	for _, lineNbr := range []int{-1, 4} {
+		if err := moveToLine(lineNbr, state); err == nil {
+			t.Fatalf("expected error for line %d", lineNbr)
+		}
+		assertInt(t, "wrong state.lineNbr!", state.lineNbr, 2)
+	}
+	if err := moveToLine(0, state); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertInt(t, "wrong state.lineNbr!", state.lineNbr, 0)
+}
+
+func TestWriteAppend(t *testing.T) {
+	const filename string = "writeappend.txt"
+	os.Remove(filename)
+	defer os.Remove(filename)
+
+	state := resetState([]string{"1", "2", "3"})
+	state.lineNbr = 2
+	state.defaultFilename = filename
+	for _, addrRange := range []string{"2,3", ""} {
+		cmd, err := createCommandAndResolveAddressRange(state, newValidRange(addrRange), commandWriteAppend, "")
+		if err != nil {
+			t.Fatalf("error: %s", err)
+		}
+		if err = cmd.Write(state); err != nil {
+			t.Fatalf("error: %s", err)
+		}
+	}
+	assertInt(t, "wrong state.lineNbr!", state.lineNbr, 2)
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	// without an address, the whole buffer is appended
+	assertString(t, "file contents", string(contents), "2\n3\n1\n2\n3\n")
+}
+
+func TestWriteQuit(t *testing.T) {
+	dir, err := os.MkdirTemp("", "red-writequit")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	data := []struct {
+		cmdLine      string
+		filename     string // the file written
+		expectedQuit bool
+	}{
+		{"w q.txt", "q.txt", false},
+		{"w q", "q", false},
+		{"wq quit.txt", "quit.txt", true},
+		{"Wq quit.txt", "quit.txt", true},
+	}
+	for _, test := range data {
+		state := resetState([]string{"1", "2"})
+		state.Stdout = io.Discard
+		cmdLine := strings.Replace(test.cmdLine, " ", " "+dir+string(os.PathSeparator), 1)
+		cmd, err := ParseCommand(cmdLine, false)
+		if err != nil {
+			t.Fatalf("command '%s': error: %s", test.cmdLine, err)
+		}
+		quit, err := cmd.ProcessCommand(state, nil, false)
+		if err != nil {
+			t.Fatalf("command '%s': error: %s", test.cmdLine, err)
+		}
+		if quit != test.expectedQuit {
+			t.Fatalf("command '%s': expected quit=%t", test.cmdLine, test.expectedQuit)
+		}
+		if _, err := os.Stat(filepath.Join(dir, test.filename)); err != nil {
+			t.Fatalf("command '%s': file not written: %s", test.cmdLine, err)
+		}
+	}
+	// no quit if the write fails
+	state := resetState([]string{"1"})
+	cmd, _ := ParseCommand("wq "+filepath.Join(dir, "nodir", "file"), false)
+	if quit, err := cmd.ProcessCommand(state, nil, false); err == nil || quit {
+		t.Fatalf("expected error and no quit, got quit=%t, err=%v", quit, err)
+	}
+}
+
+func TestReadCommandLine(t *testing.T) {
+	data := []struct {
+		input    string
+		expected string
+	}{
+		{"p\n", "p"},
+		// only g and v command-lists and s replacements may be continued
+		{"p\\\np\n", "p\\"},
+		{"s/a/b\\\nc/\n", "s/a/b\\\nc/"},
+		{"g/x/s/a/b/\\\np\n", "g/x/s/a/b/\\\np"},
+		{"1,3v/x/d\\\n\n", "1,3v/x/d\\\n"},
+	}
+	for i, test := range data {
+		t.Run(fmt.Sprintf("test %d", i), func(t *testing.T) {
+			cmdStr, err := ReadCommandLine(bufio.NewReader(strings.NewReader(test.input)))
+			if err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertString(t, "wrong command line", cmdStr, test.expected)
+		})
+	}
+}
+
+func TestPrintSuffixes(t *testing.T) {
+	data := []struct {
+		cmdLine          string
+		expectedContents string
+		expectedOutput   string
+	}{
+		{"2d p", "1\n3\n4\n", "3\n"},
+		{"2dn", "1\n3\n4\n", "   2\t 3\n"},
+		{"$d l", "1\n2\n3\n", "3$\n"},
+		{"1m$p", "2\n3\n4\n1\n", "1\n"},
+		{"1,2t0n", "1\n2\n1\n2\n3\n4\n", "   2\t 2\n"},
+		{"2,3j p", "1\n23\n4\n", "23\n"},
+		{"2,3jp", "1\n23\n4\n", "23\n"},
+		{"2,3j+n", "1\n2 3\n4\n", "   2\t 2 3\n"},
+		{"2,3j/-/p", "1\n2-3\n4\n", "2-3\n"},
+		{"1,3s/[0-9]/x/p", "x\nx\nx\n4\n", "x\n"},
+		{"2pn", "1\n2\n3\n4\n", "   2\t 2\n"},
+		{"2k p", "1\n2\n3\n4\n", ""}, // not a suffix: 'p' is the name of the mark
+	}
+	for i, test := range data {
+		t.Run(fmt.Sprintf("test %d: >>%s<<", i, test.cmdLine), func(t *testing.T) {
+			state := resetState([]string{"1", "2", "3", "4"})
+			var output bytes.Buffer
+			state.Stdout = &output
+			cmd, err := ParseCommand(test.cmdLine, false)
+			if err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			if _, err = cmd.ProcessCommand(state, nil, false); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertBufferContents(t, state.Buffer, test.expectedContents)
+			assertString(t, "wrong output", strings.Replace(output.String(), "3 lines changed\n", "", 1), test.expectedOutput)
+		})
+	}
+}
+
+func TestSplitPrintSuffix(t *testing.T) {
+	for _, test := range []struct{ restOfCmd, expectedRest, expectedSuffix string }{
+		{"p", "", "p"},
+		{"0 pn", "0", "pn"},
+		{"'p", "'p", ""},
+		{"'pl", "'p", "l"},
+		{"/x/", "/x/", ""},
+	} {
+		rest, suffix := splitPrintSuffix(test.restOfCmd)
+		assertString(t, "wrong rest of command for "+test.restOfCmd, rest, test.expectedRest)
+		assertString(t, "wrong suffix for "+test.restOfCmd, suffix, test.expectedSuffix)
+	}
+}
+
+func TestSilentMode(t *testing.T) {
+	f, err := os.CreateTemp("", "red-silent")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("1\n2\n")
+	f.Close()
+
+	for _, silent := range []bool{false, true} {
+		state := resetState([]string{})
+		state.Silent = silent
+		var commands []string
+		state.Shell = stubShell(&commands)
+		var output bytes.Buffer
+		state.Stdout = &output
+		for _, cmdLine := range []string{"e " + f.Name(), "r " + f.Name(), "w " + f.Name(), "!ls"} {
+			if err := processCommandLine(t, state, cmdLine); err != nil {
+				t.Fatalf("command '%s': error: %s", cmdLine, err)
+			}
+		}
+		expected := "2L, 4C\n2L, 4C\n8C\nran: ls\n!\n"
+		if silent {
+			expected = "ran: ls\n"
 		}
+		assertString(t, fmt.Sprintf("wrong output (silent=%t)", silent), output.String(), expected)
 	}
 }
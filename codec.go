@@ -0,0 +1,139 @@
+package red
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var errWriteNotSupported error = errors.New("writing is not supported")
+
+/*
+FileCodec converts the contents of files when they are read and written, e.g. to decompress and compress them.
+
+ A codec is used for a file which has the codec's extension or, when reading, which starts with the codec's magic bytes.
+*/
+type FileCodec struct {
+	Name      string                                    // name of the codec, for messages
+	Extension string                                    // extension of the files, e.g. ".gz"
+	Magic     []byte                                    // the first bytes of the files
+	NewReader func(r io.Reader) (io.ReadCloser, error)  // returns a reader of the converted contents
+	NewWriter func(w io.Writer) (io.WriteCloser, error) // returns a writer which converts the contents; nil if writing is not supported
+}
+
+// the registered codecs
+var fileCodecs = []*FileCodec{
+	{
+		Name:      "gzip",
+		Extension: ".gz",
+		Magic:     []byte{0x1f, 0x8b},
+		NewReader: func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+		NewWriter: func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil },
+	},
+	{
+		Name:      "bzip2",
+		Extension: ".bz2",
+		Magic:     []byte("BZh"),
+		NewReader: func(r io.Reader) (io.ReadCloser, error) { return io.NopCloser(bzip2.NewReader(r)), nil },
+	},
+}
+
+/*
+RegisterFileCodec adds a codec, which takes precedence over the codecs already registered.
+*/
+func RegisterFileCodec(codec *FileCodec) {
+	fileCodecs = append([]*FileCodec{codec}, fileCodecs...)
+}
+
+/*
+ Returns the codec for the file with the given name and first bytes, or nil if the file needs no conversion.
+*/
+func findFileCodec(filename string, header []byte) *FileCodec {
+	for _, codec := range fileCodecs {
+		if codec.Extension != "" && strings.HasSuffix(filename, codec.Extension) {
+			return codec
+		}
+	}
+	for _, codec := range fileCodecs {
+		if len(codec.Magic) != 0 && bytes.HasPrefix(header, codec.Magic) {
+			return codec
+		}
+	}
+	return nil
+}
+
+/*
+ Opens the file in the file system (or the remote file, see RemoteFiles) for reading, converting its contents if a codec is required (see FileCodec).
+ The returned function closes the file.
+*/
+func openFile(fsys FileSystem, filename string) (reader *bufio.Reader, closeFn func(), err error) {
+	var file io.ReadCloser
+	if files, ok := findRemoteFiles(filename); ok {
+		file, err = files.Open(filename)
+	} else {
+		file, err = fsys.Open(filename)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	reader = bufio.NewReader(file)
+	header, _ := reader.Peek(maxMagicLength())
+	codec := findFileCodec(filename, header)
+	if codec == nil {
+		return reader, func() { file.Close() }, nil
+	}
+	codecReader, err := codec.NewReader(reader)
+	if err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("%s: %w", codec.Name, err)
+	}
+	return bufio.NewReader(codecReader), func() { codecReader.Close(); file.Close() }, nil
+}
+
+/*
+ Returns the codec to use when writing the file: determined by the extension or,
+ if the file already exists, by its first bytes.
+ Returns an error if the codec does not support writing.
+*/
+func fileCodecForWriting(fsys FileSystem, filename string) (*FileCodec, error) {
+	var header []byte
+	if file, err := fsys.Open(filename); err == nil {
+		header, _ = bufio.NewReader(file).Peek(maxMagicLength())
+		file.Close()
+	}
+	codec := findFileCodec(filename, header)
+	if codec != nil && codec.NewWriter == nil {
+		return nil, fmt.Errorf("%s: %w", codec.Name, errWriteNotSupported)
+	}
+	return codec, nil
+}
+
+/*
+ Writes the lines 'startLineNbr' til 'endLineNbr' of the buffer to 'w', converted by the codec (if not nil).
+*/
+func writeWithCodec(w io.Writer, codec *FileCodec, buffer Buffer, startLineNbr, endLineNbr int) (nbrBytesWritten int, err error) {
+	if codec == nil {
+		return WriteWriter(bufio.NewWriter(w), buffer, startLineNbr, endLineNbr)
+	}
+	codecWriter, err := codec.NewWriter(w)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", codec.Name, err)
+	}
+	if nbrBytesWritten, err = WriteWriter(bufio.NewWriter(codecWriter), buffer, startLineNbr, endLineNbr); err != nil {
+		return 0, err
+	}
+	return nbrBytesWritten, codecWriter.Close()
+}
+
+func maxMagicLength() int {
+	length := 0
+	for _, codec := range fileCodecs {
+		length = maxIntOf(length, len(codec.Magic))
+	}
+	return length
+}
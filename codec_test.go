@@ -0,0 +1,109 @@
+package red
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindFileCodec(t *testing.T) {
+	data := []struct {
+		filename     string
+		header       []byte
+		expectedName string
+	}{
+		{"log.gz", nil, "gzip"},
+		{"log", []byte{0x1f, 0x8b, 0x08}, "gzip"},
+		{"log.bz2", nil, "bzip2"},
+		{"log", []byte("BZh9"), "bzip2"},
+		{"log.txt", []byte("text"), ""},
+	}
+	for _, test := range data {
+		name := ""
+		if codec := findFileCodec(test.filename, test.header); codec != nil {
+			name = codec.Name
+		}
+		assertString(t, "wrong codec for "+test.filename, name, test.expectedName)
+	}
+}
+
+func TestGzipFile(t *testing.T) {
+	dir, err := os.MkdirTemp("", "red-codec")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "log.gz")
+
+	state := resetState([]string{"1", "2"})
+	state.Stdout = io.Discard
+	for _, cmdLine := range []string{"w " + filename, "W", "e", "$a"} {
+		state.Input = nil
+		state.Stdin = bytes.NewBufferString("3\n.\n")
+		if err := processCommandLine(t, state, cmdLine); err != nil {
+			t.Fatalf("command '%s': error: %s", cmdLine, err)
+		}
+	}
+	// appending adds a further gzip member, which is read as part of the file
+	assertBufferContents(t, state.Buffer, "1\n2\n1\n2\n3\n")
+
+	// the file is compressed
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer f.Close()
+	reader, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	contents, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertString(t, "wrong file contents", string(contents), "1\n2\n1\n2\n")
+}
+
+func TestReadOnlyCodec(t *testing.T) {
+	dir, err := os.MkdirTemp("", "red-codec")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	if _, err := WriteFile(filepath.Join(dir, "log.bz2"), createBuffer([]string{"1"}), 1, 1); !errors.Is(err, errWriteNotSupported) {
+		t.Fatalf("expected errWriteNotSupported, got %v", err)
+	}
+}
+
+func TestRegisterFileCodec(t *testing.T) {
+	savedCodecs := fileCodecs
+	defer func() { fileCodecs = savedCodecs }()
+	// a codec which converts the contents to upper case when reading
+	RegisterFileCodec(&FileCodec{
+		Name:      "upper",
+		Extension: ".up",
+		NewReader: func(r io.Reader) (io.ReadCloser, error) {
+			contents, err := io.ReadAll(r)
+			return io.NopCloser(bytes.NewReader(bytes.ToUpper(contents))), err
+		},
+	})
+
+	dir, err := os.MkdirTemp("", "red-codec")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "file.up")
+	if err := os.WriteFile(filename, []byte("abc\n"), 0666); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	_, listOfLines, err := ReadFile(filename)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertBufferContents(t, newBufferOf(listOfLines), "ABC\n")
+}
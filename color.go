@@ -0,0 +1,112 @@
+package red
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+var ErrInvalidColorMode error = errors.New("invalid colour mode")
+
+// the values of the option 'color' (see ProgramFlags.Color)
+const (
+	colorAuto   string = "auto"   // colour only when printing to a terminal (the default)
+	colorAlways string = "always" // colour even when the output is e.g. a pipe
+	colorNever  string = "never"
+)
+
+// the ANSI escape sequences used for colouring the output
+const (
+	colorLineNumber string = "\x1b[32m"   // green, as used by grep
+	colorMatch      string = "\x1b[1;31m" // bold red, as used by grep
+	colorReset      string = "\x1b[0m"
+)
+
+/*
+CheckColor returns an error if the given colour mode is not one of auto, always or never.
+*/
+func CheckColor(mode string) error {
+	switch mode {
+	case colorAuto, colorAlways, colorNever:
+		return nil
+	}
+	return fmt.Errorf("%w: '%s' (expected %s, %s or %s)", ErrInvalidColorMode, mode, colorAuto, colorAlways, colorNever)
+}
+
+/*
+ Returns true if the output written to 'writer' is to be coloured (see ProgramFlags.Color).
+ In the mode 'auto' (or if no mode has been set), this is only the case if the writer is a terminal.
+*/
+func (state *State) colorEnabled(writer io.Writer) bool {
+	switch state.Color {
+	case colorAlways:
+		return true
+	case colorNever:
+		return false
+	}
+	return isTerminal(writer)
+}
+
+/*
+ A lineRenderer prints lines as _printLine does, colouring the line numbers
+ and highlighting the matches of a regex if the output is to be coloured.
+*/
+type lineRenderer struct {
+	color bool           // whether to write colour escape sequences
+	re    *regexp.Regexp // if set, the matches of the regex are highlighted
+}
+
+/*
+ Returns the renderer for printing to the given writer. If 're' is set, its matches are highlighted.
+*/
+func (state *State) lineRenderer(writer io.Writer, re *regexp.Regexp) lineRenderer {
+	return lineRenderer{color: state.colorEnabled(writer), re: re}
+}
+
+/*
+ Prints the line (see _printLine). 'spans' gives the positions of text to be highlighted,
+ and if nil, the matches of the renderer's regex are highlighted.
+ Nothing is highlighted in the unambiguous form of 'l'.
+*/
+func (r lineRenderer) printLine(writer io.Writer, lineNbr int, str string, printLineNumbers, listLine bool, spans [][]int) {
+	if !r.color {
+		_printLine(writer, lineNbr, str, printLineNumbers, listLine)
+		return
+	}
+	if listLine {
+		str = _listLine(str)
+	} else {
+		if spans == nil && r.re != nil {
+			spans = r.re.FindAllStringIndex(strings.TrimSuffix(str, "\n"), -1)
+		}
+		str = highlightSpans(str, spans)
+	}
+	if printLineNumbers {
+		fmt.Fprintf(writer, "%s%4d%s%c %s", colorLineNumber, lineNbr, colorReset, '\t', str)
+	} else {
+		fmt.Fprint(writer, str)
+	}
+}
+
+/*
+ Encloses the given (sorted, non-overlapping) parts of the line in highlighting escape sequences.
+ Empty parts are ignored.
+*/
+func highlightSpans(line string, spans [][]int) string {
+	var sb strings.Builder
+	pos := 0
+	for _, span := range spans {
+		if span[0] == span[1] {
+			continue // nothing to highlight
+		}
+		sb.WriteString(line[pos:span[0]])
+		sb.WriteString(colorMatch)
+		sb.WriteString(line[span[0]:span[1]])
+		sb.WriteString(colorReset)
+		pos = span[1]
+	}
+	sb.WriteString(line[pos:])
+	return sb.String()
+}
@@ -0,0 +1,71 @@
+package red
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestHighlightSpans(t *testing.T) {
+	data := []struct {
+		re       string
+		line     string
+		expected string
+	}{
+		{"b", "abcb\n", "a\x1b[1;31mb\x1b[0mc\x1b[1;31mb\x1b[0m\n"},
+		{"x*", "ab\n", "ab\n"},
+		{"b$", "ab", "a\x1b[1;31mb\x1b[0m"},
+	}
+	for _, test := range data {
+		t.Run(test.re, func(t *testing.T) {
+			spans := regexp.MustCompile(test.re).FindAllStringIndex(strings.TrimSuffix(test.line, "\n"), -1)
+			assertString(t, "wrong highlighting", highlightSpans(test.line, spans), test.expected)
+		})
+	}
+}
+
+func TestColorOutput(t *testing.T) {
+	data := []struct {
+		color          string
+		cmdLine        string
+		expectedOutput string
+	}{
+		{"always", "2n", "\x1b[32m   2\x1b[0m\t bcd\n"},
+		{"always", "/c/", "b\x1b[1;31mc\x1b[0md\n"},
+		{"always", "/c/n", "\x1b[32m   2\x1b[0m\t b\x1b[1;31mc\x1b[0md\n"},
+		{"always", "2l", "bcd$\n"},
+		{"always", "grep /b/", "\x1b[32m   1\x1b[0m\t a\x1b[1;31mb\x1b[0mc\n\x1b[32m   2\x1b[0m\t \x1b[1;31mb\x1b[0mcd\n"},
+		{"always", "s/c/XX/gp", "ab\x1b[1;31mXX\x1b[0m\n1 lines changed\n"},
+		{"always", "1,2Z/d/0", "\x1b[32m   2\x1b[0m\t bc\x1b[1;31md\x1b[0m\n"},
+		// the output is not a terminal
+		{"auto", "/c/n", "   2\t bcd\n"},
+		{"never", "grep /b/", "   1\t abc\n   2\t bcd\n"},
+	}
+	for _, test := range data {
+		t.Run(test.color+" "+test.cmdLine, func(t *testing.T) {
+			var output bytes.Buffer
+			state := resetState([]string{"abc", "bcd"})
+			state.Stdout = &output
+			state.lineNbr = 1
+			if err := state.SetOption("color", test.color); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			if err := processCommandLine(t, state, test.cmdLine); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertString(t, "wrong output", output.String(), test.expectedOutput)
+		})
+	}
+}
+
+func TestColorSetting(t *testing.T) {
+	state := NewState()
+	if value, _ := state.Option("color"); value != colorAuto {
+		t.Fatalf("expected default %s, got %s", colorAuto, value)
+	}
+	if err := state.SetOption("color", "sometimes"); !errors.Is(err, ErrInvalidColorMode) {
+		t.Fatalf("expected ErrInvalidColorMode, got %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+package red
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// name of the configuration file in the user's home directory
+const configFilename string = ".redrc"
+
+// prefix of a startup command in the configuration file
+const configCommandPrefix string = ":"
+
+// prefix of the definition of an extension program in the configuration file
+const configExtensionPrefix string = "extension "
+
+/*
+LoadConfigFile reads the configuration file (see LoadConfig) and returns its startup commands.
+If no filename is given, the file '.redrc' in the user's home directory is read, if present.
+*/
+func LoadConfigFile(state *State, filename string) (commands []string, err error) {
+	mustExist := filename != ""
+	if !mustExist {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, nil
+		}
+		filename = home + string(os.PathSeparator) + configFilename
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		if !mustExist && errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	if commands, err = LoadConfig(state, f); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return commands, nil
+}
+
+/*
+LoadConfig reads editor settings and startup commands.
+
+ Each line either sets an option in the form 'name = value' (see SetOption), e.g. 'windowsize = 20',
+ defines an alias in the form 'alias name = commands' (see DefineAlias), e.g. 'alias dd = .d',
+ defines an extension in the form 'extension name = program' (see RegisterExtensionProgram), e.g. 'extension upper = tr a-z A-Z',
+ or, if it starts with ':', contains a command to be executed on startup, e.g. ':H'.
+ A value may be enclosed in double quotes, e.g. to set a prompt ending with a space: 'prompt = "> "'.
+ The same settings can be changed with the command 'set'.
+ Empty lines and lines starting with '#' are ignored.
+
+ The options are set immediately; the startup commands are returned.
+*/
+func LoadConfig(state *State, reader io.Reader) (commands []string, err error) {
+	scanner := bufio.NewScanner(reader)
+	for lineNbr := 1; scanner.Scan(); lineNbr++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, configCommandPrefix) {
+			commands = append(commands, line[len(configCommandPrefix):])
+			continue
+		}
+		if strings.HasPrefix(line, commandAlias+" ") {
+			if err := state.DefineAlias(line[len(commandAlias):]); err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNbr, err)
+			}
+			continue
+		}
+		if strings.HasPrefix(line, configExtensionPrefix) {
+			name, program, err := parseSetting(line[len(configExtensionPrefix):])
+			if err == nil {
+				err = state.RegisterExtensionProgram(name, program)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNbr, err)
+			}
+			continue
+		}
+		name, value, err := parseSetting(line)
+		if errors.Is(err, errMissingValue) {
+			return nil, fmt.Errorf("line %d: expected 'name = value' or ':command'", lineNbr)
+		}
+		if err == nil {
+			err = state.SetOption(name, value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNbr, err)
+		}
+	}
+	return commands, scanner.Err()
+}
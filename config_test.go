@@ -0,0 +1,93 @@
+package red
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig(t *testing.T) {
+	state := resetState([]string{})
+	config := `# my settings
+
+prompt = "red> "
+windowsize=20
+backup = ~
+ignorecase = on
+verbose = yes
+autosave = 1m
+alias wq! = w | Q
+extension upper = tr a-z A-Z
+:H
+:a
+`
+	commands, err := LoadConfig(state, strings.NewReader(config))
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertString(t, "prompt", state.Prompt, "red> ")
+	assertInt(t, "window size", state.WindowSize, 20)
+	assertString(t, "backup suffix", state.BackupSuffix, "~")
+	if !state.IgnoreCase || !state.VerboseErrors {
+		t.Fatalf("expected ignorecase and verbose to be set")
+	}
+	if state.AutosaveInterval != time.Minute {
+		t.Fatalf("expected autosave interval 1m, got %s", state.AutosaveInterval)
+	}
+	assertString(t, "startup commands", strings.Join(commands, ","), "H,a")
+	assertString(t, "alias", strings.Join(state.aliases["wq!"], ","), "w,Q")
+	assertString(t, "extension", state.extensions["upper"].program, "tr a-z A-Z")
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	data := []struct {
+		config      string
+		expectedErr error
+	}{
+		{"no equals sign", nil},
+		{"unknown = 1", ErrUnknownSetting},
+		{"windowsize = 0", ErrInvalidSetting},
+		{"windowsize = x", ErrInvalidSetting},
+		{"alias loop = loop", ErrAliasCycle},
+		{"extension 1x = true", ErrInvalidExtensionName},
+		{"ignorecase = maybe", ErrInvalidSetting},
+		{"autosave = 10", ErrInvalidSetting},
+		{"encoding = ebcdic", ErrUnknownEncoding},
+		{`prompt = "unterminated`, nil},
+	}
+	for _, test := range data {
+		_, err := LoadConfig(resetState([]string{}), strings.NewReader(test.config))
+		if err == nil {
+			t.Fatalf("expected error for '%s'", test.config)
+		}
+		if test.expectedErr != nil && !errors.Is(err, test.expectedErr) {
+			t.Fatalf("'%s': expected %v, got %v", test.config, test.expectedErr, err)
+		}
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	dir, err := os.MkdirTemp("", "red-config")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, configFilename)
+
+	state := resetState([]string{})
+	if _, err = LoadConfigFile(state, filename); err == nil {
+		t.Fatalf("expected error for missing file")
+	}
+	if err = os.WriteFile(filename, []byte("tabstop = 4\n:1p\n"), 0644); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	commands, err := LoadConfigFile(state, filename)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertInt(t, "tab stop", state.TabStop, 4)
+	assertString(t, "startup commands", strings.Join(commands, ","), "1p")
+}
@@ -0,0 +1,127 @@
+package red
+
+import (
+	"container/list"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+/*
+Count prints the number of lines, words, characters (runes) and bytes in the addressed lines.
+
+ (1,$)C
+ (1,$)C/re/   counts the matches of the regular expression 're' instead
+
+ If no address is specified, the whole buffer is counted.
+ The output has the (stable) format: lines=<n> words=<n> runes=<n> bytes=<n>
+ or, for a regex, the number of matching lines and of matches: lines=<n> matches=<n>
+ An empty regex refers to the previous regex.
+
+ Nothing is changed, and the current address is unchanged.
+*/
+func (cmd Command) Count(state *State) error {
+	return cmd._count(state, state.Stdout)
+}
+func (cmd Command) _count(state *State, writer io.Writer) error {
+	if err := cmd.validateAddress(state); err != nil {
+		return err
+	}
+	var startLineNbr, endLineNbr int
+	if !cmd.addrRange.IsSpecified() {
+		startLineNbr, endLineNbr = 1, state.Buffer.Len()
+	} else {
+		startLineNbr, endLineNbr = cmd.resolved.start, cmd.resolved.end
+	}
+	if arg := strings.TrimSpace(cmd.restOfCmd); arg != "" {
+		re, rest, err := parseGlobalCommand(arg, state)
+		if err != nil {
+			return fmt.Errorf("count: %w", err)
+		}
+		if rest != "" {
+			return fmt.Errorf("count: %w: '%s'", ErrInvalidArgument, rest)
+		}
+		var stats matchStats
+		if state.Buffer.Len() != 0 {
+			if stats, err = countMatches(startLineNbr, endLineNbr, state, re); err != nil {
+				return fmt.Errorf("count: %w", err)
+			}
+		}
+		fmt.Fprintln(writer, stats)
+		return nil
+	}
+	var stats textStats
+	if state.Buffer.Len() != 0 {
+		if startLineNbr == 0 {
+			return fmt.Errorf("count: %w", errorInvalidLine("start line is 0", nil))
+		}
+		currentLineNbr := state.lineNbr
+		lines, err := copyLines(startLineNbr, endLineNbr, state)
+		if err != nil {
+			return fmt.Errorf("count: %w", err)
+		}
+		stats = countLines(lines)
+		if err = moveToLine(currentLineNbr, state); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintln(writer, stats)
+	return nil
+}
+
+/*
+textStats stores the result of the count command.
+*/
+type textStats struct {
+	lines, words, runes, bytes int
+}
+
+func (s textStats) String() string {
+	return fmt.Sprintf("lines=%d words=%d runes=%d bytes=%d", s.lines, s.words, s.runes, s.bytes)
+}
+
+/*
+ Counts the lines, words, runes and bytes in the given list.
+*/
+func countLines(lines *list.List) textStats {
+	var stats textStats
+	for el := lines.Front(); el != nil; el = el.Next() {
+		line := el.Value.(Line).Line
+		stats.lines++
+		stats.words += len(strings.Fields(line))
+		stats.runes += utf8.RuneCountInString(line)
+		stats.bytes += len(line)
+	}
+	return stats
+}
+
+/*
+matchStats stores the result of the count command for a regex.
+*/
+type matchStats struct {
+	lines, matches int
+}
+
+func (s matchStats) String() string {
+	return fmt.Sprintf("lines=%d matches=%d", s.lines, s.matches)
+}
+
+/*
+ Counts the lines matching the regex and the number of (non-overlapping) matches,
+ without copying the lines and without changing the current line.
+*/
+func countMatches(startLineNbr, endLineNbr int, state *State, re *regexp.Regexp) (matchStats, error) {
+	var stats matchStats
+	if startLineNbr == 0 {
+		return stats, errorInvalidLine("start line is 0", nil)
+	}
+	err := state.Buffer.Iterate(startLineNbr, endLineNbr, func(lineNbr int, line *Line) {
+		if nbrMatches := len(re.FindAllStringIndex(strings.TrimSuffix(line.Line, "\n"), -1)); nbrMatches > 0 {
+			stats.lines++
+			stats.matches += nbrMatches
+		}
+	})
+	return stats, err
+}
@@ -0,0 +1,78 @@
+package red
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"testing"
+)
+
+func TestCount(t *testing.T) {
+	data := []struct {
+		addrRange      string
+		buffer         []string
+		expectedOutput string
+	}{
+		{"", []string{"one two", "", "three  four\tfive"}, "lines=3 words=5 runes=26 bytes=26\n"},
+		{"1,2", []string{"one two", "", "three  four\tfive"}, "lines=2 words=2 runes=9 bytes=9\n"},
+		{"1", []string{"grüße"}, "lines=1 words=1 runes=6 bytes=8\n"},
+		{"", []string{}, "lines=0 words=0 runes=0 bytes=0\n"},
+	}
+
+	for i, test := range data {
+		t.Run(fmt.Sprintf("test %d: >>%s%s<<", i, test.addrRange, commandCount), func(t *testing.T) {
+			var err error
+			var cmd Command
+			state := resetState(test.buffer)
+			state.lineNbr = state.Buffer.Len()
+			if cmd, err = createCommandAndResolveAddressRange(state, newValidRange(test.addrRange), commandCount, ""); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			var buff bytes.Buffer
+			if err = cmd._count(state, &buff); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertString(t, "wrong output", buff.String(), test.expectedOutput)
+			assertInt(t, "wrong state.lineNbr!", state.lineNbr, state.Buffer.Len())
+		})
+	}
+}
+
+func TestCountMatches(t *testing.T) {
+	data := []struct {
+		cmdLine        string
+		expectedOutput string
+	}{
+		{"C/a/", "lines=2 matches=4\n"},
+		{"2,$C /a/", "lines=1 matches=1\n"},
+		{"C/x*/", "lines=3 matches=11\n"}, // empty matches are counted as well
+		{"C/^$/", "lines=0 matches=0\n"},
+		{"C//", "lines=2 matches=2\n"}, // the previous regex
+	}
+	for _, test := range data {
+		t.Run(test.cmdLine, func(t *testing.T) {
+			var output bytes.Buffer
+			state := resetState([]string{"aaa", "bcd", "ab"})
+			state.Stdout = &output
+			state.lineNbr = 2
+			state.lastSearchRE = regexp.MustCompile("b")
+			if err := processCommandLine(t, state, test.cmdLine); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertString(t, "wrong output", output.String(), test.expectedOutput)
+			assertInt(t, "wrong line nbr", state.lineNbr, 2)
+		})
+	}
+}
+
+func TestCountMatchesErrors(t *testing.T) {
+	state := resetState([]string{"a"})
+	if err := processCommandLine(t, state, "C/a/x"); !errors.Is(err, ErrInvalidArgument) {
+		t.Fatalf("expected ErrInvalidArgument, got %v", err)
+	}
+	state = resetState([]string{"a"})
+	if err := processCommandLine(t, state, "C//"); !errors.Is(err, ErrNoPreviousRegex) {
+		t.Fatalf("expected ErrNoPreviousRegex, got %v", err)
+	}
+}
@@ -0,0 +1,238 @@
+package red
+
+import (
+	"fmt"
+	"strings"
+)
+
+// the number of unchanged lines shown before and after each change by 'diff'
+const diffContextLines int = 3
+
+/*
+ An operation of an edit script, which turns one list of lines into another.
+*/
+type diffOp struct {
+	kind byte // ' ': the line is in both lists, '-': the line is deleted, '+': the line is inserted
+	line string
+}
+
+const (
+	diffEqual  byte = ' '
+	diffDelete byte = '-'
+	diffInsert byte = '+'
+)
+
+/*
+Diff shows the differences between a file and the buffer, i.e. what a 'w' would change.
+
+ diff [file]
+
+ The file defaults to the default filename; 'diff !command' compares the buffer with the output of the shell command.
+ The differences are shown as a unified diff (as by 'diff -u'), with the file as the old and the buffer as the new version.
+ Nothing is printed if there are no differences.
+
+ The line endings of the file are ignored, i.e. only the text of the lines is compared.
+ The current address is unchanged.
+*/
+func (cmd Command) Diff(state *State) error {
+	if err := cmd.validateAddress(state); err != nil {
+		return err
+	}
+	filename := strings.TrimSpace(cmd.restOfCmd)
+	_, listOfLines, _, err := readFileOrShellCommand(filename, state, false)
+	if err != nil {
+		return fmt.Errorf("%s: %w", cmd.cmd, err)
+	}
+	if filename == "" {
+		filename = state.defaultFilename
+	}
+	stripDOSLineEndings(listOfLines)
+	terminateLastLine(listOfLines)
+	oldLines := make([]string, 0, listOfLines.Len())
+	for el := listOfLines.Front(); el != nil; el = el.Next() {
+		oldLines = append(oldLines, el.Value.(Line).Line)
+	}
+	newLines := make([]string, 0, state.Buffer.Len())
+	if state.Buffer.Len() > 0 {
+		err = state.Buffer.Iterate(1, state.Buffer.Len(), func(lineNbr int, line *Line) { newLines = append(newLines, line.Line) })
+		if err != nil {
+			return fmt.Errorf("%s: %w", cmd.cmd, err)
+		}
+	}
+	for _, line := range unifiedDiff(filename, "(buffer)", diffLines(oldLines, newLines)) {
+		if !state.pageLine() {
+			break
+		}
+		fmt.Fprint(state.Stdout, line)
+	}
+	return nil
+}
+
+/*
+ Returns an edit script which turns the lines 'a' into the lines 'b', using the algorithm of Myers
+ ("An O(ND) Difference Algorithm and Its Variations", 1986).
+
+ Lines common to the start or the end of both lists are handled first,
+ so that the cost of the algorithm depends on the part of the lists which has been changed.
+*/
+func diffLines(a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{diffEqual, line})
+	}
+	ops = append(ops, myersDiff(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{diffEqual, line})
+	}
+	return ops
+}
+
+/*
+ Returns the shortest edit script for the lines 'a' and 'b'.
+
+ For each number of differences d, v[k] stores how far along 'a' the furthest path with d differences
+ reaches on the diagonal k = x - y. The values for each d are kept in 'trace', so that the path can be followed back.
+*/
+func myersDiff(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	maxD := n + m
+	offset := maxD + 1
+	v := make([]int, 2*maxD+3)
+	var trace [][]int // trace[d][k+d]: the values of v after step d
+	for d := 0; d <= maxD; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1] // down, i.e. an insertion
+			} else {
+				x = v[offset+k-1] + 1 // right, i.e. a deletion
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrackDiff(a, b, trace, d)
+			}
+		}
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+	}
+	return nil // not reached
+}
+
+/*
+ Follows the path with 'd' differences back from the end of both lists, and returns its edit script.
+*/
+func backtrackDiff(a, b []string, trace [][]int, d int) []diffOp {
+	ops := make([]diffOp, 0, len(a)+len(b))
+	x, y := len(a), len(b)
+	for ; d > 0; d-- {
+		previous := trace[d-1] // covers the diagonals -(d-1) to d-1
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && previous[k-1+d-1] < previous[k+1+d-1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := previous[prevK+d-1]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			ops = append(ops, diffOp{diffEqual, a[x-1]})
+			x--
+			y--
+		}
+		if x == prevX {
+			ops = append(ops, diffOp{diffInsert, b[y-1]})
+			y--
+		} else {
+			ops = append(ops, diffOp{diffDelete, a[x-1]})
+			x--
+		}
+	}
+	for ; x > 0; x-- {
+		ops = append(ops, diffOp{diffEqual, a[x-1]})
+	}
+	// the ops have been collected from the end
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+/*
+ Formats the edit script as a unified diff, with diffContextLines lines of context around each change.
+ Returns the lines of the diff (each terminated by a newline), or none if there are no changes.
+*/
+func unifiedDiff(oldName, newName string, ops []diffOp) []string {
+	var diff []string
+	// the number of lines of the old and the new version before ops[pos]
+	pos, oldLineNbr, newLineNbr := 0, 0, 0
+	advance := func(to int) {
+		for ; pos < to; pos++ {
+			if ops[pos].kind != diffInsert {
+				oldLineNbr++
+			}
+			if ops[pos].kind != diffDelete {
+				newLineNbr++
+			}
+		}
+	}
+	for start := 0; start < len(ops); {
+		// find the next change
+		for start < len(ops) && ops[start].kind == diffEqual {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+		// a hunk ends when there are more than twice the number of context lines without a change
+		end := start
+		for i := start; i < len(ops); i++ {
+			if ops[i].kind != diffEqual {
+				end = i + 1
+			} else if i-end >= 2*diffContextLines {
+				break
+			}
+		}
+		hunkStart := maxIntOf(start-diffContextLines, 0)
+		hunkEnd := minIntOf(end+diffContextLines, len(ops))
+		if diff == nil {
+			diff = append(diff, fmt.Sprintf("--- %s\n", oldName), fmt.Sprintf("+++ %s\n", newName))
+		}
+		advance(hunkStart)
+		oldStart, newStart := oldLineNbr, newLineNbr
+		advance(hunkEnd)
+		diff = append(diff, fmt.Sprintf("@@ -%s +%s @@\n", diffRange(oldStart, oldLineNbr-oldStart), diffRange(newStart, newLineNbr-newStart)))
+		for _, op := range ops[hunkStart:hunkEnd] {
+			diff = append(diff, string(op.kind)+op.line)
+		}
+		start = hunkEnd
+	}
+	return diff
+}
+
+/*
+ Formats the range of a hunk: the first line (from 1) and the number of lines, which is omitted if it is 1.
+ An empty range is given by the line before it.
+*/
+func diffRange(start, length int) string {
+	switch length {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	default:
+		return fmt.Sprintf("%d,%d", start+1, length)
+	}
+}
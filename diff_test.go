@@ -0,0 +1,122 @@
+package red
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	data := []struct {
+		a, b             string
+		expectedNbrEdits int
+	}{
+		{"", "", 0},
+		{"abc", "abc", 0},
+		{"", "abc", 3},
+		{"abc", "", 3},
+		{"abcabba", "cbabac", 5}, // the example of Myers' paper
+		{"abcdef", "abxdey", 4},
+		{"xabc", "abcx", 2},
+	}
+	for _, test := range data {
+		t.Run(test.a+"/"+test.b, func(t *testing.T) {
+			a, b := strings.Split(test.a, ""), strings.Split(test.b, "")
+			ops := diffLines(a, b)
+			// the edit script must turn 'a' into 'b'
+			var oldLines, newLines []string
+			nbrEdits := 0
+			for _, op := range ops {
+				if op.kind != diffInsert {
+					oldLines = append(oldLines, op.line)
+				}
+				if op.kind != diffDelete {
+					newLines = append(newLines, op.line)
+				}
+				if op.kind != diffEqual {
+					nbrEdits++
+				}
+			}
+			assertString(t, "wrong old lines", strings.Join(oldLines, ""), test.a)
+			assertString(t, "wrong new lines", strings.Join(newLines, ""), test.b)
+			assertInt(t, "wrong nbr of edits", nbrEdits, test.expectedNbrEdits)
+		})
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	var oldLines, newLines []string
+	for i := 1; i <= 20; i++ {
+		line := strings.Repeat("x", i) + "\n"
+		oldLines = append(oldLines, line)
+		switch i {
+		case 1:
+			// deleted
+		case 12:
+			newLines = append(newLines, "changed\n")
+		default:
+			newLines = append(newLines, line)
+		}
+	}
+	newLines = append(newLines, "appended\n")
+	diff := strings.Join(unifiedDiff("old", "new", diffLines(oldLines, newLines)), "")
+	expected := `--- old
++++ new
+@@ -1,4 +1,3 @@
+-x
+ xx
+ xxx
+ xxxx
+@@ -9,7 +8,7 @@
+ xxxxxxxxx
+ xxxxxxxxxx
+ xxxxxxxxxxx
+-xxxxxxxxxxxx
++changed
+ xxxxxxxxxxxxx
+ xxxxxxxxxxxxxx
+ xxxxxxxxxxxxxxx
+@@ -18,3 +17,4 @@
+ xxxxxxxxxxxxxxxxxx
+ xxxxxxxxxxxxxxxxxxx
+ xxxxxxxxxxxxxxxxxxxx
++appended
+`
+	assertString(t, "wrong diff", diff, expected)
+	if diff := unifiedDiff("old", "new", diffLines(oldLines, oldLines)); diff != nil {
+		t.Fatalf("expected no diff, got %v", diff)
+	}
+}
+
+func TestDiffCommand(t *testing.T) {
+	dir, err := os.MkdirTemp("", "red-diff")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "file.txt")
+	// the line endings of the file are ignored
+	if err := os.WriteFile(filename, []byte("a\r\nb\r\nc"), 0666); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	var out bytes.Buffer
+	state := NewState()
+	state.Stdout = &out
+	state.Silent = true
+	for _, cmdLine := range []string{"e " + filename, "diff", "2s/b/x/"} {
+		if err := processCommandLine(t, state, cmdLine); err != nil {
+			t.Fatalf("command '%s': error: %s", cmdLine, err)
+		}
+	}
+	// no differences before the change
+	assertString(t, "wrong output", strings.TrimPrefix(out.String(), "1 lines changed\n"), "")
+	out.Reset()
+	if err := processCommandLine(t, state, "diff"); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	expected := "--- " + filename + "\n+++ (buffer)\n@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n"
+	assertString(t, "wrong output", out.String(), expected)
+	assertInt(t, "wrong line nbr", state.lineNbr, 2)
+}
@@ -0,0 +1,122 @@
+package red
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+)
+
+/*
+Editor is a high-level interface to the editor, for programs which embed red
+instead of driving the command loop in cmd/red.
+
+ An Editor executes command lines as entered by a user, and gives access to the lines of the buffer.
+ The underlying State is available via State(), e.g. to set options.
+*/
+type Editor struct {
+	state *State
+}
+
+/*
+Result is the result of executing a command line.
+*/
+type Result struct {
+	Output  string // everything written by the command
+	LineNbr int    // the current line after the command
+	Quit    bool   // whether the command was a quit command
+}
+
+/*
+NewEditor creates an editor with an empty buffer.
+*/
+func NewEditor() *Editor {
+	return &Editor{state: NewState()}
+}
+
+/*
+State returns the state of the editor.
+*/
+func (e *Editor) State() *State {
+	return e.state
+}
+
+/*
+Execute processes the given command line.
+
+ The command line may consist of several lines: a 'g' or 'v' command-list can be continued
+ as described for ReadCommandLine, and the lines after the command are used as the input
+ for commands such as 'a', 'c' or 'i' (terminated as usual by a line containing only ".").
+
+ The output of the command is returned in the result and not written to state.Stdout.
+ An error is also stored in state.LastError (see command 'h').
+*/
+func (e *Editor) Execute(cmdLine string) (Result, error) {
+	state := e.state
+	savedStdout, savedInput := state.Stdout, state.Input
+	defer func() { state.Stdout, state.Input = savedStdout, savedInput }()
+
+	var output bytes.Buffer
+	state.Stdout = &output
+	state.Input = bufio.NewReader(strings.NewReader(strings.TrimSuffix(cmdLine, "\n") + "\n"))
+
+	cmdStr, err := ReadCommandLine(state.Input)
+	if err != nil {
+		state.LastError = err
+		return Result{LineNbr: state.lineNbr}, err
+	}
+	cmd, err := state.ParseCommand(cmdStr)
+	if err != nil {
+		state.LastError = err
+		return Result{LineNbr: state.lineNbr}, err
+	}
+	quit, err := cmd.ProcessCommand(state, nil, false)
+	if err != nil {
+		state.LastError = err
+	}
+	return Result{Output: output.String(), LineNbr: state.lineNbr, Quit: quit}, err
+}
+
+/*
+LoadFile replaces the contents of the buffer with the given file, discarding any unsaved changes.
+The filename becomes the default filename.
+*/
+func (e *Editor) LoadFile(filename string) error {
+	cmd, err := ParseCommand(commandEditUnconditionally+" "+filename, e.state.Debug)
+	if err != nil {
+		return err
+	}
+	savedStdout := e.state.Stdout
+	defer func() { e.state.Stdout = savedStdout }()
+	e.state.Stdout = io.Discard
+	_, err = cmd.ProcessCommand(e.state, nil, false)
+	return err
+}
+
+/*
+Lines returns the lines startLineNbr to endLineNbr (inclusive) of the buffer, without their trailing newlines.
+*/
+func (e *Editor) Lines(startLineNbr, endLineNbr int) ([]string, error) {
+	if err := checkLineRange(startLineNbr, endLineNbr, e.state.Buffer); err != nil {
+		return nil, err
+	}
+	lines := make([]string, 0, endLineNbr-startLineNbr+1)
+	err := e.state.Buffer.Iterate(startLineNbr, endLineNbr, func(lineNbr int, line *Line) {
+		lines = append(lines, strings.TrimSuffix(line.Line, "\n"))
+	})
+	return lines, err
+}
+
+/*
+Len returns the number of lines in the buffer.
+*/
+func (e *Editor) Len() int {
+	return e.state.Buffer.Len()
+}
+
+/*
+Dirty returns true if the buffer has been changed since it was last read or written.
+*/
+func (e *Editor) Dirty() bool {
+	return e.state.changedSinceLastWrite
+}
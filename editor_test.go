@@ -0,0 +1,81 @@
+package red
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestEditorExecute(t *testing.T) {
+	editor := NewEditor()
+	steps := []struct {
+		cmdLine         string
+		expectedOutput  string
+		expectedLineNbr int
+	}{
+		{"a\nfirst\nsecond\nthird\n.", "", 3},
+		{"1,2p", "first\nsecond\n", 2},
+		{"g/[nr]d/p\\\n-1", "second\nfirst\nthird\nsecond\n", 2},
+		{"c\nchanged\n.", "", 2},
+		{"$n", "   3\t third\n", 3},
+	}
+	for _, step := range steps {
+		result, err := editor.Execute(step.cmdLine)
+		if err != nil {
+			t.Fatalf("command '%s': error: %s", step.cmdLine, err)
+		}
+		assertString(t, "wrong output for "+step.cmdLine, result.Output, step.expectedOutput)
+		assertInt(t, "wrong line nbr for "+step.cmdLine, result.LineNbr, step.expectedLineNbr)
+	}
+	lines, err := editor.Lines(1, editor.Len())
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertString(t, "wrong lines", strings.Join(lines, ","), "first,changed,third")
+	if !editor.Dirty() {
+		t.Fatalf("expected editor to be dirty")
+	}
+	if result, err := editor.Execute("Q"); err != nil || !result.Quit {
+		t.Fatalf("expected quit, got %v, err: %v", result, err)
+	}
+}
+
+func TestEditorErrors(t *testing.T) {
+	editor := NewEditor()
+	if _, err := editor.Execute("a\nno terminating dot"); err == nil {
+		t.Fatalf("expected error for unterminated input")
+	}
+	if _, err := editor.Execute("1p"); err == nil {
+		t.Fatalf("expected error for empty buffer")
+	}
+	if _, err := editor.Lines(1, 1); err == nil {
+		t.Fatalf("expected error for empty buffer")
+	}
+}
+
+func TestEditorLoadFile(t *testing.T) {
+	f, err := os.CreateTemp("", "red-editor")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("1\n2\n3\n")
+	f.Close()
+
+	editor := NewEditor()
+	if _, err := editor.Execute("a\nunsaved\n."); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if err := editor.LoadFile(f.Name()); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if editor.Dirty() {
+		t.Fatalf("expected editor not to be dirty")
+	}
+	lines, err := editor.Lines(2, 3)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertString(t, "wrong lines", strings.Join(lines, ","), "2,3")
+	assertString(t, "wrong default filename", editor.State().defaultFilename, f.Name())
+}
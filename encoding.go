@@ -0,0 +1,203 @@
+package red
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+// the supported encodings
+const (
+	encodingUTF8    = "utf-8"
+	encodingLatin1  = "latin1"
+	encodingUTF16LE = "utf-16le"
+	encodingUTF16BE = "utf-16be"
+)
+
+var (
+	ErrUnknownEncoding     error = errors.New("unknown encoding (use utf-8, latin1, utf-16le or utf-16be)")
+	ErrInvalidEncoding     error = errors.New("file is not valid")
+	ErrCharacterNotEncoded error = errors.New("character cannot be encoded")
+)
+
+// alternative names of the supported encodings
+var encodingNames = map[string]string{
+	"": encodingUTF8, "utf8": encodingUTF8, encodingUTF8: encodingUTF8,
+	encodingLatin1: encodingLatin1, "latin-1": encodingLatin1, "iso-8859-1": encodingLatin1,
+	encodingUTF16LE: encodingUTF16LE, "utf16le": encodingUTF16LE,
+	encodingUTF16BE: encodingUTF16BE, "utf16be": encodingUTF16BE,
+}
+
+// the byte order marks, which identify the encoding of a file
+var byteOrderMarks = []struct {
+	bom      []byte
+	encoding string
+}{
+	{[]byte{0xef, 0xbb, 0xbf}, encodingUTF8},
+	{[]byte{0xff, 0xfe}, encodingUTF16LE},
+	{[]byte{0xfe, 0xff}, encodingUTF16BE},
+}
+
+/*
+ The encoding of a file, and whether the file starts with a byte order mark.
+ The zero value denotes UTF-8 without a byte order mark.
+*/
+type fileEncoding struct {
+	name string
+	bom  bool
+}
+
+/*
+ Returns true if the file is in UTF-8 without a byte order mark, i.e. needs no conversion.
+*/
+func (enc fileEncoding) isPlainUTF8() bool {
+	return (enc.name == "" || enc.name == encodingUTF8) && !enc.bom
+}
+
+/*
+CheckEncoding returns an error if the given encoding is not supported.
+Supported are UTF-8, Latin-1 (ISO 8859-1), and UTF-16 (little- or big-endian).
+*/
+func CheckEncoding(name string) error {
+	_, err := normaliseEncoding(name)
+	return err
+}
+
+func normaliseEncoding(name string) (string, error) {
+	if normalised, ok := encodingNames[strings.ToLower(name)]; ok {
+		return normalised, nil
+	}
+	return "", fmt.Errorf("%w: '%s'", ErrUnknownEncoding, name)
+}
+
+/*
+ Reads the file (using a codec if required, see FileCodec), converting its contents to UTF-8.
+ A file starting with a byte order mark is read in the corresponding encoding,
+ otherwise in the encoding 'defaultEncoding'.
+
+ Returns the number of bytes read from the file, the lines, and the encoding of the file.
+*/
+func readEncodedFile(fsys FileSystem, filename, defaultEncoding string) (nbrBytesRead int, listOfLines *list.List, enc fileEncoding, err error) {
+	if enc.name, err = normaliseEncoding(defaultEncoding); err != nil {
+		return 0, nil, enc, err
+	}
+	reader, closeFn, err := openFile(fsys, filename)
+	if err != nil {
+		return 0, nil, enc, err
+	}
+	defer closeFn()
+
+	nbrBytesBOM := 0
+	for _, bom := range byteOrderMarks {
+		if prefix, _ := reader.Peek(len(bom.bom)); bytes.Equal(prefix, bom.bom) {
+			enc = fileEncoding{name: bom.encoding, bom: true}
+			nbrBytesBOM, _ = reader.Discard(len(bom.bom))
+			break
+		}
+	}
+	if enc.name == encodingUTF8 {
+		nbrBytesRead, listOfLines, err = ReadReader(reader)
+		return nbrBytesBOM + nbrBytesRead, listOfLines, enc, err
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return 0, nil, enc, err
+	}
+	decoded, err := decode(data, enc.name)
+	if err != nil {
+		return 0, nil, enc, fmt.Errorf("%s: %w", enc.name, err)
+	}
+	_, listOfLines, err = ReadReader(bufio.NewReader(strings.NewReader(decoded)))
+	return nbrBytesBOM + len(data), listOfLines, enc, err
+}
+
+/*
+ Converts the data in the given encoding to UTF-8.
+*/
+func decode(data []byte, encoding string) (string, error) {
+	switch encoding {
+	case encodingLatin1:
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return string(runes), nil
+	case encodingUTF16LE, encodingUTF16BE:
+		if len(data)%2 != 0 {
+			return "", ErrInvalidEncoding
+		}
+		units := make([]uint16, len(data)/2)
+		for i := range units {
+			if encoding == encodingUTF16LE {
+				units[i] = uint16(data[2*i]) | uint16(data[2*i+1])<<8
+			} else {
+				units[i] = uint16(data[2*i])<<8 | uint16(data[2*i+1])
+			}
+		}
+		return string(utf16.Decode(units)), nil
+	default:
+		return string(data), nil
+	}
+}
+
+/*
+ Converts the UTF-8 text to the given encoding.
+*/
+func encode(text, encoding string) (string, error) {
+	var sb strings.Builder
+	switch encoding {
+	case encodingLatin1:
+		for _, r := range text {
+			if r > 0xff {
+				return "", fmt.Errorf("%w in %s: '%c'", ErrCharacterNotEncoded, encoding, r)
+			}
+			sb.WriteByte(byte(r))
+		}
+	case encodingUTF16LE, encodingUTF16BE:
+		for _, unit := range utf16.Encode([]rune(text)) {
+			if encoding == encodingUTF16LE {
+				sb.WriteByte(byte(unit))
+				sb.WriteByte(byte(unit >> 8))
+			} else {
+				sb.WriteByte(byte(unit >> 8))
+				sb.WriteByte(byte(unit))
+			}
+		}
+	default:
+		return text, nil
+	}
+	return sb.String(), nil
+}
+
+/*
+ A buffer whose lines are returned in the given encoding, used to write a file in its original encoding
+ (see state.fileEncoding). If required, the byte order mark is prepended to the first line.
+*/
+type encodingBuffer struct {
+	Buffer
+	enc fileEncoding
+}
+
+func (b encodingBuffer) Get(lineNbr int) (*Line, error) {
+	line, err := b.Buffer.Get(lineNbr)
+	if err != nil {
+		return line, err
+	}
+	text, err := encode(line.Line, b.enc.name)
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %w", lineNbr, err)
+	}
+	if b.enc.bom && lineNbr == 1 {
+		for _, bom := range byteOrderMarks {
+			if bom.encoding == b.enc.name {
+				text = string(bom.bom) + text
+			}
+		}
+	}
+	return &Line{text}, nil
+}
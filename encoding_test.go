@@ -0,0 +1,95 @@
+package red
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	data := []struct {
+		encoding string
+		text     string
+		encoded  string
+	}{
+		{encodingUTF8, "grüß\n", "grüß\n"},
+		{encodingLatin1, "grüß\n", "gr\xfc\xdf\n"},
+		{encodingUTF16LE, "a€\n", "a\x00\xac\x20\n\x00"},
+		{encodingUTF16BE, "a€\n", "\x00a\x20\xac\x00\n"},
+		{encodingUTF16LE, "😀", "\x3d\xd8\x00\xde"}, // surrogate pair
+	}
+	for _, test := range data {
+		encoded, err := encode(test.text, test.encoding)
+		if err != nil {
+			t.Fatalf("%s: error: %s", test.encoding, err)
+		}
+		assertString(t, "wrong encoding in "+test.encoding, encoded, test.encoded)
+		decoded, err := decode([]byte(encoded), test.encoding)
+		if err != nil {
+			t.Fatalf("%s: error: %s", test.encoding, err)
+		}
+		assertString(t, "wrong decoding in "+test.encoding, decoded, test.text)
+	}
+	if _, err := encode("€", encodingLatin1); !errors.Is(err, ErrCharacterNotEncoded) {
+		t.Fatalf("expected ErrCharacterNotEncoded, got %v", err)
+	}
+	if _, err := decode([]byte("abc"), encodingUTF16BE); !errors.Is(err, ErrInvalidEncoding) {
+		t.Fatalf("expected ErrInvalidEncoding, got %v", err)
+	}
+}
+
+func TestCheckEncoding(t *testing.T) {
+	for _, name := range []string{"", "UTF-8", "latin1", "ISO-8859-1", "utf16le", "UTF-16BE"} {
+		if err := CheckEncoding(name); err != nil {
+			t.Fatalf("%s: error: %s", name, err)
+		}
+	}
+	if err := CheckEncoding("ebcdic"); !errors.Is(err, ErrUnknownEncoding) {
+		t.Fatalf("expected ErrUnknownEncoding, got %v", err)
+	}
+}
+
+func TestEncodingIsPreserved(t *testing.T) {
+	dir, err := os.MkdirTemp("", "red-encoding")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := []struct {
+		defaultEncoding  string
+		contents         string
+		expectedBuffer   string
+		expectedContents string // after changing the first line to "x"
+	}{
+		{"", "\xef\xbb\xbfa\nb\n", "a\nb\n", "\xef\xbb\xbfx\nb\n"},
+		{"latin1", "\xe4\nb\n", "ä\nb\n", "x\nb\n"},
+		{"", "\xff\xfe\xe4\x00\n\x00b\x00\n\x00", "ä\nb\n", "\xff\xfex\x00\n\x00b\x00\n\x00"},
+		{"", "\xfe\xff\x00\xe4\x00\n", "ä\n", "\xfe\xff\x00x\x00\n"},
+		{"utf-16be", "\x00\xe4\x00\n", "ä\n", "\x00x\x00\n"},
+	}
+	for i, test := range data {
+		filename := filepath.Join(dir, "file.txt")
+		if err := os.WriteFile(filename, []byte(test.contents), 0666); err != nil {
+			t.Fatalf("error: %s", err)
+		}
+		state := NewState()
+		state.Stdout = io.Discard
+		state.Encoding = test.defaultEncoding
+		for _, cmdLine := range []string{"e " + filename, "1s/.*/x/", "w"} {
+			if err := processCommandLine(t, state, cmdLine); err != nil {
+				t.Fatalf("test %d: command '%s': error: %s", i, cmdLine, err)
+			}
+			if cmdLine[0] == 'e' {
+				assertBufferContents(t, state.Buffer, test.expectedBuffer)
+			}
+		}
+		contents, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatalf("error: %s", err)
+		}
+		assertString(t, "wrong file contents", string(contents), test.expectedContents)
+	}
+}
@@ -0,0 +1,52 @@
+package red
+
+import (
+	"fmt"
+	"os"
+)
+
+// the environment variables read by ApplyEnvironment
+const (
+	envShell      string = "SHELL"
+	envTempDir    string = "TMPDIR"
+	envPrompt     string = "ED_PROMPT"
+	envWindowSize string = "ED_WINDOWSIZE"
+)
+
+/*
+ApplyEnvironment sets up the editor from the environment variables, as returned by 'getenv' (usually os.Getenv):
+
+ SHELL          the shell which runs shell commands, e.g. for '!' (default: /bin/sh)
+ TMPDIR         the directory for temporary files, e.g. the recovery file of a buffer without a filename
+ ED_PROMPT      the prompt (see setting 'prompt')
+ ED_WINDOWSIZE  the window size for the scroll command 'z' (see setting 'windowsize')
+
+ Variables which are not set (or empty) are ignored.
+ The environment only provides defaults: it should be applied before the configuration file and the command-line flags.
+*/
+func ApplyEnvironment(state *State, getenv func(string) string) error {
+	if shell := getenv(envShell); shell != "" {
+		state.Shell = NewShellExecutor(shell)
+	}
+	if dir := getenv(envTempDir); dir != "" {
+		state.TempDir = dir
+	}
+	for _, env := range []struct{ name, setting string }{{envPrompt, "prompt"}, {envWindowSize, "windowsize"}} {
+		if value := getenv(env.name); value != "" {
+			if err := state.SetOption(env.setting, value); err != nil {
+				return fmt.Errorf("environment variable %s: %w", env.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+/*
+ Returns the directory for temporary files.
+*/
+func (state *State) tempDir() string {
+	if state.TempDir != "" {
+		return state.TempDir
+	}
+	return os.TempDir()
+}
@@ -0,0 +1,56 @@
+package red
+
+import (
+	"bytes"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+/*
+ Returns a function which looks up the environment variables in 'env'.
+*/
+func testEnvironment(env map[string]string) func(string) string {
+	return func(name string) string { return env[name] }
+}
+
+func TestApplyEnvironment(t *testing.T) {
+	state := NewState()
+	err := ApplyEnvironment(state, testEnvironment(map[string]string{envPrompt: "> ", envWindowSize: "30", envTempDir: "/var/tmp"}))
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertString(t, "wrong prompt", state.Prompt, "> ")
+	assertInt(t, "wrong window size", state.WindowSize, 30)
+	assertString(t, "wrong temp dir", state.TempDir, "/var/tmp")
+	assertString(t, "wrong recovery filename", state.bufferRecoveryFilename(), filepath.Join("/var/tmp", ".unnamed.red.swp"))
+
+	// unset variables are ignored
+	state = NewState()
+	if err := ApplyEnvironment(state, testEnvironment(nil)); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertString(t, "wrong prompt", state.Prompt, ":")
+	assertInt(t, "wrong window size", state.WindowSize, 0)
+
+	if err := ApplyEnvironment(NewState(), testEnvironment(map[string]string{envWindowSize: "x"})); err == nil {
+		t.Fatalf("expected error for invalid window size")
+	}
+}
+
+func TestApplyEnvironmentShell(t *testing.T) {
+	echo, err := exec.LookPath("echo")
+	if err != nil {
+		t.Skip("no echo")
+	}
+	// the shell is called as 'shell -c command'
+	state := NewState()
+	if err := ApplyEnvironment(state, testEnvironment(map[string]string{envShell: echo})); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	var stdout bytes.Buffer
+	if err := state.Shell("date", nil, &stdout, &stdout); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertString(t, "wrong output", stdout.String(), "-c date\n")
+}
@@ -0,0 +1,179 @@
+package red
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrUnknownExtension     error = errors.New("unknown extension")
+	ErrInvalidExtensionName error = errors.New("invalid extension name (expected a letter followed by letters, digits, '_' or '-')")
+)
+
+var extensionNameRE = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*$`)
+
+/*
+ExtensionFunc implements an extension, i.e. a command run with '|name' (see RegisterExtension).
+
+ It is given the addressed lines (without their line endings) and the arguments following the name of the extension,
+ and returns the lines which replace them. If it returns an error, the buffer is unchanged.
+*/
+type ExtensionFunc func(lines []string, args string) ([]string, error)
+
+/*
+ A registered extension: a Go function, or an external program run via the shell.
+*/
+type extension struct {
+	fn      ExtensionFunc
+	program string // the command line of an external program, empty for a Go function
+}
+
+/*
+RegisterExtension makes the function available as the extension 'name', replacing any extension of the same name.
+*/
+func (state *State) RegisterExtension(name string, fn ExtensionFunc) error {
+	return state.registerExtension(name, extension{fn: fn})
+}
+
+/*
+RegisterExtensionProgram makes an external program available as the extension 'name',
+replacing any extension of the same name.
+
+ The command is run via the shell (see State.Shell), with the arguments of the extension appended.
+ It reads the addressed lines from its standard input, and its output replaces them.
+ As for '!', the program cannot be run in restricted mode.
+ Extension programs can also be defined in the configuration file (see LoadConfig).
+*/
+func (state *State) RegisterExtensionProgram(name, command string) error {
+	if strings.TrimSpace(command) == "" {
+		return fmt.Errorf("%w: extension '%s': missing command", ErrInvalidArgument, name)
+	}
+	run := func(lines []string, args string) ([]string, error) {
+		if state.Restricted {
+			return nil, ErrRestricted
+		}
+		var input, output bytes.Buffer
+		for _, line := range lines {
+			input.WriteString(line + "\n")
+		}
+		commandLine := command
+		if args != "" {
+			commandLine += " " + args
+		}
+		if err := state.Shell(commandLine, &input, &output, state.Stderr); err != nil {
+			return nil, err
+		}
+		_, listOfLines, err := ReadReader(bufio.NewReader(&output))
+		if err != nil {
+			return nil, err
+		}
+		newLines := make([]string, 0, listOfLines.Len())
+		for el := listOfLines.Front(); el != nil; el = el.Next() {
+			newLines = append(newLines, strings.TrimSuffix(el.Value.(Line).Line, "\n"))
+		}
+		return newLines, nil
+	}
+	return state.registerExtension(name, extension{fn: run, program: command})
+}
+
+func (state *State) registerExtension(name string, ext extension) error {
+	if !extensionNameRE.MatchString(name) {
+		return fmt.Errorf("%w: '%s'", ErrInvalidExtensionName, name)
+	}
+	if state.extensions == nil {
+		state.extensions = make(map[string]extension)
+	}
+	state.extensions[name] = ext
+	return nil
+}
+
+/*
+Extension runs an extension on the addressed lines, replacing them by the lines it returns.
+
+ (1,$)|name [args]
+
+ The extension is a Go function (see RegisterExtension) or an external program (see RegisterExtensionProgram).
+ If no address is given, the whole buffer is processed. Without a name, the extensions are listed.
+
+ As for a filter ('!'), the lines are replaced as by 'c', i.e. the replaced lines are stored in the cut buffer,
+ and the current address is set to the last line returned. If the lines are unchanged, nothing is replaced
+ and the current address is set to the last addressed line.
+*/
+func (cmd Command) Extension(state *State) error {
+	if err := cmd.validateAddress(state); err != nil {
+		return err
+	}
+	rest := strings.TrimSpace(cmd.restOfCmd)
+	if rest == "" {
+		state.listExtensions()
+		return nil
+	}
+	name, args := rest, ""
+	if pos := strings.IndexAny(rest, " \t"); pos >= 0 {
+		name, args = rest[:pos], strings.TrimSpace(rest[pos:])
+	}
+	ext, ok := state.extensions[name]
+	if !ok {
+		return fmt.Errorf("%s: %w: '%s'", cmd.cmd, ErrUnknownExtension, name)
+	}
+	if state.Buffer.Len() == 0 {
+		return nil
+	}
+	startLineNbr, endLineNbr := cmd.resolved.start, cmd.resolved.end
+	if !cmd.addrRange.IsSpecified() {
+		startLineNbr, endLineNbr = 1, state.Buffer.Len()
+	}
+	lines := make([]string, 0, endLineNbr-startLineNbr+1)
+	err := state.Buffer.Iterate(startLineNbr, endLineNbr, func(_ int, line *Line) {
+		lines = append(lines, strings.TrimSuffix(line.Line, "\n"))
+	})
+	if err != nil {
+		return fmt.Errorf("%s%s: %w", cmd.cmd, name, err)
+	}
+	// the function may change the lines given to it
+	newLines, err := ext.fn(append([]string(nil), lines...), args)
+	if err != nil {
+		return fmt.Errorf("%s%s: %w", cmd.cmd, name, err)
+	}
+	unchanged := len(newLines) == len(lines)
+	listOfLines := list.New()
+	for i, line := range newLines {
+		if strings.Contains(line, "\n") {
+			return fmt.Errorf("%s%s: %w: line contains a newline: %q", cmd.cmd, name, ErrInvalidArgument, line)
+		}
+		unchanged = unchanged && line == lines[i]
+		listOfLines.PushBack(Line{line + "\n"})
+	}
+	if unchanged {
+		return moveToLine(endLineNbr, state)
+	}
+	changeCmd := Command{addrRange: cmd.addrRange, addressIsResolved: true, resolved: resolvedAddress{start: startLineNbr, end: endLineNbr}, cmd: commandChange}
+	return changeCmd.Change(state, listOfLines)
+}
+
+/*
+ Prints the names of the registered extensions, with the command line of each external program.
+*/
+func (state *State) listExtensions() {
+	names := make([]string, 0, len(state.extensions))
+	for name := range state.extensions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !state.pageLine() {
+			break
+		}
+		if program := state.extensions[name].program; program != "" {
+			fmt.Fprintf(state.Stdout, "%s = %s\n", name, program)
+		} else {
+			fmt.Fprintf(state.Stdout, "%s (function)\n", name)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package red
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func registerUpper(t *testing.T, state *State) {
+	t.Helper()
+	err := state.RegisterExtension("upper", func(lines []string, args string) ([]string, error) {
+		for i := range lines {
+			lines[i] = strings.ToUpper(lines[i]) + args
+		}
+		return lines, nil
+	})
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+}
+
+func TestExtension(t *testing.T) {
+	data := []struct {
+		cmdLine         string
+		expected        string
+		expectedLineNbr int
+	}{
+		{"|upper", "A\nB\nC\n", 3},
+		{"2|upper", "a\nB\nc\n", 2},
+		{"1,2|upper !", "A!\nB!\nc\n", 2},
+		{"2,3|drop", "a\n", 1},
+		{"|double", "a\na\nb\nb\nc\nc\n", 6},
+	}
+	for _, test := range data {
+		t.Run(test.cmdLine, func(t *testing.T) {
+			state := resetState([]string{"a", "b", "c"})
+			registerUpper(t, state)
+			state.RegisterExtension("drop", func(lines []string, args string) ([]string, error) { return nil, nil })
+			state.RegisterExtension("double", func(lines []string, args string) ([]string, error) {
+				var doubled []string
+				for _, line := range lines {
+					doubled = append(doubled, line, line)
+				}
+				return doubled, nil
+			})
+			if err := processCommandLine(t, state, test.cmdLine); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertBufferContents(t, state.Buffer, test.expected)
+			assertInt(t, "wrong line nbr", state.lineNbr, test.expectedLineNbr)
+			if err := processCommandLine(t, state, "u"); err != nil {
+				t.Fatalf("undo: error: %s", err)
+			}
+			assertBufferContents(t, state.Buffer, "a\nb\nc\n")
+		})
+	}
+}
+
+func TestExtensionProgram(t *testing.T) {
+	var commands []string
+	var input bytes.Buffer
+	state := resetState([]string{"a", "b", "c"})
+	state.Shell = stubPipe(&commands, &input, "x\ny")
+	if err := state.RegisterExtensionProgram("prog", "myprog -v"); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if err := processCommandLine(t, state, "2,3|prog 1 2"); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertString(t, "wrong command", strings.Join(commands, ","), "myprog -v 1 2")
+	assertString(t, "wrong input", input.String(), "b\nc\n")
+	assertBufferContents(t, state.Buffer, "a\nx\ny\n")
+
+	state.Restricted = true
+	if err := processCommandLine(t, state, "|prog"); !errors.Is(err, ErrRestricted) {
+		t.Fatalf("expected ErrRestricted, got %v", err)
+	}
+}
+
+func TestExtensionList(t *testing.T) {
+	var output bytes.Buffer
+	state := resetState(nil)
+	state.Stdout = &output
+	registerUpper(t, state)
+	if err := state.RegisterExtensionProgram("sorted", "sort -u"); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if err := processCommandLine(t, state, "|"); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertString(t, "wrong output", output.String(), "sorted = sort -u\nupper (function)\n")
+}
+
+func TestExtensionErrors(t *testing.T) {
+	errFailed := errors.New("failed")
+	state := resetState([]string{"a", "b"})
+	state.lineNbr = 1
+	state.RegisterExtension("fails", func(lines []string, args string) ([]string, error) { return nil, errFailed })
+	state.RegisterExtension("newline", func(lines []string, args string) ([]string, error) { return []string{"x\ny"}, nil })
+	data := []struct {
+		cmdLine  string
+		expected error
+	}{
+		{"|nosuchextension", ErrUnknownExtension},
+		{"|fails", errFailed},
+		{"|newline", ErrInvalidArgument},
+	}
+	for _, test := range data {
+		if err := processCommandLine(t, state, test.cmdLine); !errors.Is(err, test.expected) {
+			t.Fatalf("command '%s': expected error %v, got %v", test.cmdLine, test.expected, err)
+		}
+		assertBufferContents(t, state.Buffer, "a\nb\n")
+	}
+	for _, name := range []string{"", "1st", "a b"} {
+		if err := state.RegisterExtension(name, nil); !errors.Is(err, ErrInvalidExtensionName) {
+			t.Fatalf("name '%s': expected ErrInvalidExtensionName, got %v", name, err)
+		}
+	}
+}
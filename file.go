@@ -3,10 +3,12 @@ package red
 import (
 	"bufio"
 	"container/list"
-
-	//"fmt"
+	"errors"
+	"fmt"
 	"io"
-	"os"
+	"io/fs"
+	"path/filepath"
+	"strings"
 )
 
 /*
@@ -18,16 +20,14 @@ ReadFile reads the entire file identified by 'filename'.
  The file is closed when this function returns.
 */
 func ReadFile(filename string) (nbrBytesRead int, listOfLines *list.List, err error) {
-	file, err := os.Open(filename)
+	reader, closeFn, err := openFile(OSFileSystem, filename)
 
 	if err != nil {
 		return
 	}
 
-	defer file.Close()
+	defer closeFn()
 
-	// Start reading from the file with a reader
-	reader := bufio.NewReader(file)
 	return ReadReader(reader)
 }
 
@@ -68,45 +68,175 @@ func ReadReader(reader *bufio.Reader) (nbrBytesRead int, listOfLines *list.List,
 }
 
 /*
-WriteFile writes the list contents to a file identified by 'filename'.
- Starts at element 'startElement' of the list, which is identified as line# 'startLineNbr'.
- Will then iterate through til 'endLineNbr'.
+ Appends a newline to the last line of the list if it does not end with one, as is the case
+ if a file does not end with a newline.
+ Returns true if a newline was appended.
+*/
+func terminateLastLine(listOfLines *list.List) bool {
+	last := listOfLines.Back()
+	if last == nil {
+		return false
+	}
+	line := last.Value.(Line)
+	if strings.HasSuffix(line.Line, "\n") {
+		return false
+	}
+	last.Value = Line{line.Line + "\n"}
+	return true
+}
 
- An existing file will be truncated.
+/*
+ A buffer whose last line is returned without its trailing newline,
+ used to write a file which originally did not end with a newline (see state.noFinalNewline).
+*/
+type noFinalNewlineBuffer struct {
+	Buffer
+}
 
- The number of bytes written is returned.
+func (b noFinalNewlineBuffer) Get(lineNbr int) (*Line, error) {
+	line, err := b.Buffer.Get(lineNbr)
+	if err != nil || lineNbr != b.Len() {
+		return line, err
+	}
+	return &Line{strings.TrimSuffix(line.Line, "\n")}, nil
+}
 
- The file is closed when this function returns.
+/*
+WriteFile writes the buffer contents to a file identified by 'filename'.
+ Writes the lines 'startLineNbr' til 'endLineNbr' of the buffer.
+
+ The file is written via OSFileSystem, i.e. an existing file is replaced atomically.
+ A file which requires a codec (e.g. a '.gz' file, see FileCodec) is written using the codec.
+ A URL such as ssh://host/file is written via the RemoteFiles registered for its scheme.
+
+ The number of bytes written (before conversion by a codec) is returned.
 */
-func WriteFile(filename string, startElement *list.Element, startLineNbr, endLineNbr int) (nbrBytesWritten int, err error) {
-	file, err := os.Create(filename)
+func WriteFile(filename string, buffer Buffer, startLineNbr, endLineNbr int) (nbrBytesWritten int, err error) {
+	return writeFile(OSFileSystem, filename, buffer, startLineNbr, endLineNbr)
+}
 
+/*
+ Writes the lines 'startLineNbr' til 'endLineNbr' of the buffer to the file in the given file system, see WriteFile.
+*/
+func writeFile(fsys FileSystem, filename string, buffer Buffer, startLineNbr, endLineNbr int) (nbrBytesWritten int, err error) {
+	if files, ok := findRemoteFiles(filename); ok {
+		return writeRemoteFile(files, filename, buffer, startLineNbr, endLineNbr)
+	}
+	codec, err := fileCodecForWriting(fsys, filename)
 	if err != nil {
-		return
+		return 0, err
+	}
+	err = fsys.WriteFile(filename, func(w io.Writer) (err error) {
+		nbrBytesWritten, err = writeWithCodec(w, codec, buffer, startLineNbr, endLineNbr)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return nbrBytesWritten, nil
+}
+
+/*
+BackupFile renames an existing file, so that its contents are not lost if the file is subsequently overwritten
+and the write fails halfway.
+ The backup is named 'filename' followed by 'suffix' and, if 'dir' is not empty, is placed in that directory.
+ An existing backup is replaced.
+
+ Returns the name of the backup, or "" if the file does not exist.
+*/
+func BackupFile(filename, suffix, dir string) (backupFilename string, err error) {
+	backupFilename, _, err = backupFile(OSFileSystem, filename, suffix, dir)
+	return backupFilename, err
+}
+
+/*
+ Renames the file in the given file system, see BackupFile.
+ Also returns the file info of the file as it was before being renamed (nil if it does not exist),
+ so that the new file can be given the same mode (see keepFileMode).
+*/
+func backupFile(fsys FileSystem, filename, suffix, dir string) (backupFilename string, original fs.FileInfo, err error) {
+	if original, err = fs.Stat(fsys, filename); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", nil, nil
+		}
+		return "", nil, err
+	}
+	backupFilename = filename + suffix
+	if dir != "" {
+		backupFilename = filepath.Join(dir, filepath.Base(backupFilename))
 	}
+	if err = fsys.Rename(filename, backupFilename); err != nil {
+		return "", nil, err
+	}
+	return backupFilename, original, nil
+}
+
+/*
+ Gives the file the mode and (where possible) the owner of the original file, e.g. after the original was renamed by backupFile.
+ Nothing is done if the file system does not support this (see modeKeeper).
+*/
+func keepFileMode(fsys FileSystem, filename string, original fs.FileInfo) error {
+	if keeper, ok := fsys.(modeKeeper); ok && original != nil {
+		return keeper.keepMode(filename, original)
+	}
+	return nil
+}
+
+/*
+AppendFile appends the buffer contents to a file identified by 'filename'.
+ Writes the lines 'startLineNbr' til 'endLineNbr' of the buffer.
+
+ The file will be created if it does not exist.
+ A file which requires a codec is appended to using the codec, e.g. as a further gzip member.
+
+ The number of bytes written is returned.
 
-	defer file.Close()
+ The file is closed when this function returns.
+*/
+func AppendFile(filename string, buffer Buffer, startLineNbr, endLineNbr int) (nbrBytesWritten int, err error) {
+	return appendFile(OSFileSystem, filename, buffer, startLineNbr, endLineNbr)
+}
 
-	w := bufio.NewWriter(file)
-	return WriteWriter(w, startElement, startLineNbr, endLineNbr)
+/*
+ Appends the lines 'startLineNbr' til 'endLineNbr' of the buffer to the file in the given file system, see AppendFile.
+*/
+func appendFile(fsys FileSystem, filename string, buffer Buffer, startLineNbr, endLineNbr int) (nbrBytesWritten int, err error) {
+	if _, ok := findRemoteFiles(filename); ok {
+		return 0, fmt.Errorf("%s: %w", filename, ErrAppendNotSupported)
+	}
+	codec, err := fileCodecForWriting(fsys, filename)
+	if err != nil {
+		return 0, err
+	}
+	err = fsys.AppendFile(filename, func(w io.Writer) (err error) {
+		nbrBytesWritten, err = writeWithCodec(w, codec, buffer, startLineNbr, endLineNbr)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return nbrBytesWritten, nil
 }
 
 /*
-WriteWriter writes the given list to the 'writer'.
+WriteWriter writes the lines 'startLineNbr' til 'endLineNbr' of the buffer to the 'writer'.
  The number of bytes written is returned.
 */
-func WriteWriter(w *bufio.Writer, startElement *list.Element, startLineNbr, endLineNbr int) (nbrBytesWritten int, err error) {
-	el := startElement
+func WriteWriter(w *bufio.Writer, buffer Buffer, startLineNbr, endLineNbr int) (nbrBytesWritten int, err error) {
 	for lineNbr := startLineNbr; lineNbr <= endLineNbr; lineNbr++ {
-		line := el.Value.(Line)
+		line, err := buffer.Get(lineNbr)
+		if err != nil {
+			return 0, err
+		}
 		nbrBytes, err := w.WriteString(line.Line)
 		if err != nil {
 			return 0, err
 		}
 		nbrBytesWritten += nbrBytes
-		el = el.Next()
 	}
 
-	w.Flush()
-	return nbrBytesWritten, err
+	if err := w.Flush(); err != nil {
+		return 0, err
+	}
+	return nbrBytesWritten, nil
 }
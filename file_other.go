@@ -0,0 +1,19 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd
+
+package red
+
+import "os"
+
+/*
+ The number of links to a file cannot be queried on this platform.
+*/
+func hasHardLinks(info os.FileInfo) bool {
+	return false
+}
+
+/*
+ The owner of a file cannot be changed on this platform.
+*/
+func copyOwner(filename string, original os.FileInfo) {
+}
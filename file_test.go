@@ -6,7 +6,10 @@ import (
 
 	//   "fmt"
 	"container/list"
+	"errors"
+	"io"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -55,6 +58,32 @@ func TestStringWriter(t *testing.T) {
 	createWriterAndDoTest(t, listOfLines)
 }
 
+func TestAppendFile(t *testing.T) {
+	const filename string = "appendfile.txt"
+	os.Remove(filename)
+	defer os.Remove(filename)
+
+	buffer := createBuffer([]string{"first line", "second line"})
+	// file is created if it doesn't exist
+	if _, err := AppendFile(filename, buffer, 1, 1); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	nbrBytesWritten, err := AppendFile(filename, buffer, 1, 2)
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if nbrBytesWritten != 23 {
+		t.Fatalf("Bad nbrBytesWritten, expected %d but got %d", 23, nbrBytesWritten)
+	}
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if string(contents) != "first line\nfirst line\nsecond line\n" {
+		t.Fatalf("Bad content, got %s", string(contents))
+	}
+}
+
 /* --------------------  helper routines ---------------- */
 
 func doReadTestWithFile(t *testing.T, data testdata, filename string) {
@@ -124,7 +153,7 @@ func createWriterAndDoTest(t *testing.T, listOfLines *list.List) {
 }
 
 func doWriteTest(t *testing.T, myList *list.List, writer *bufio.Writer) (nbrBytesWritten int) {
-	nbrBytesWritten, err := WriteWriter(writer, myList.Front(), 1, myList.Len())
+	nbrBytesWritten, err := WriteWriter(writer, newBufferOf(myList), 1, myList.Len())
 	if err != nil {
 		t.Fatalf("Got error %v", err)
 	}
@@ -173,3 +202,301 @@ func createFileWithLongLine(fn string) (err error) {
 
 	return
 }
+
+func TestBackupFile(t *testing.T) {
+	dir, err := os.MkdirTemp("", "red-backup")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	backupDir := filepath.Join(dir, "backups")
+	if err := os.Mkdir(backupDir, 0777); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	filename := filepath.Join(dir, "file.txt")
+
+	// file does not exist
+	if backupFilename, err := BackupFile(filename, "~", ""); err != nil || backupFilename != "" {
+		t.Fatalf("expected no backup, got '%s', err: %v", backupFilename, err)
+	}
+
+	data := []struct {
+		suffix           string
+		dir              string
+		expectedFilename string
+	}{
+		{"~", "", filepath.Join(dir, "file.txt~")},
+		{".bak", backupDir, filepath.Join(backupDir, "file.txt.bak")},
+		{"", backupDir, filepath.Join(backupDir, "file.txt")},
+	}
+	for _, test := range data {
+		if err := os.WriteFile(filename, []byte("original\n"), 0666); err != nil {
+			t.Fatalf("error: %s", err)
+		}
+		backupFilename, err := BackupFile(filename, test.suffix, test.dir)
+		if err != nil {
+			t.Fatalf("error: %s", err)
+		}
+		assertString(t, "wrong backup filename", backupFilename, test.expectedFilename)
+		contents, err := os.ReadFile(backupFilename)
+		if err != nil {
+			t.Fatalf("error: %s", err)
+		}
+		assertString(t, "wrong backup contents", string(contents), "original\n")
+		if _, err := os.Stat(filename); err == nil {
+			t.Fatalf("file should have been renamed")
+		}
+	}
+}
+
+func TestWriteWithBackup(t *testing.T) {
+	dir, err := os.MkdirTemp("", "red-backup")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "file.txt")
+	if err := os.WriteFile(filename, []byte("original\n"), 0666); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+
+	state := resetState([]string{"1", "2"})
+	state.Stdout = io.Discard
+	state.BackupSuffix = "~"
+	if err := processCommandLine(t, state, "w "+filename); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	for name, expected := range map[string]string{filename: "1\n2\n", filename + "~": "original\n"} {
+		contents, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatalf("error: %s", err)
+		}
+		assertString(t, "wrong contents of "+name, string(contents), expected)
+	}
+}
+
+func TestWriteWithBackupKeepsMode(t *testing.T) {
+	dir, err := os.MkdirTemp("", "red-backup")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "script.sh")
+	if err := os.WriteFile(filename, []byte("original\n"), 0755); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if err := os.Chmod(filename, 0755); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+
+	state := resetState([]string{"1", "2"})
+	state.Stdout = io.Discard
+	state.BackupSuffix = "~"
+	if err := processCommandLine(t, state, "w "+filename); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	for _, name := range []string{filename, filename + "~"} {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatalf("error: %s", err)
+		}
+		if info.Mode().Perm() != 0755 {
+			t.Fatalf("%s: expected mode 0755, got %o", name, info.Mode().Perm())
+		}
+	}
+}
+
+func TestWriteFileReplacesFile(t *testing.T) {
+	dir, err := os.MkdirTemp("", "red-write")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "file.txt")
+	if err := os.WriteFile(filename, []byte("original\n"), 0640); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if err := os.Chmod(filename, 0640); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	link := filepath.Join(dir, "link.txt")
+	if err := os.Symlink(filename, link); err != nil {
+		t.Skipf("cannot create symbolic link: %s", err)
+	}
+
+	buffer := createBuffer([]string{"1", "2"})
+	if _, err := WriteFile(link, buffer, 1, 2); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertString(t, "wrong contents", string(contents), "1\n2\n")
+	info, err := os.Lstat(filename)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Fatalf("mode not kept: %s", info.Mode())
+	}
+	if info, err = os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("symbolic link was replaced (err: %v)", err)
+	}
+	// no temporary files are left behind
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertInt(t, "wrong nbr of files", len(entries), 2)
+}
+
+func TestWriteFileWithHardLinks(t *testing.T) {
+	dir, err := os.MkdirTemp("", "red-write")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "file.txt")
+	if err := os.WriteFile(filename, []byte("original\n"), 0666); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	link := filepath.Join(dir, "link.txt")
+	if err := os.Link(filename, link); err != nil {
+		t.Skipf("cannot create hard link: %s", err)
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if !hasHardLinks(info) {
+		t.Skip("hard links are not detected on this platform")
+	}
+
+	if _, err := WriteFile(filename, createBuffer([]string{"1"}), 1, 1); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	// the file has been overwritten in place, therefore the change is visible via the other link
+	contents, err := os.ReadFile(link)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertString(t, "wrong contents", string(contents), "1\n")
+}
+
+func TestWriteInPlace(t *testing.T) {
+	dir, err := os.MkdirTemp("", "red-write")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "file.txt")
+	for _, inPlace := range []bool{false, true} {
+		if err := os.WriteFile(filename, []byte("original\n"), 0666); err != nil {
+			t.Fatalf("error: %s", err)
+		}
+		before, err := os.Stat(filename)
+		if err != nil {
+			t.Fatalf("error: %s", err)
+		}
+		state := resetState([]string{"1"})
+		state.Stdout = io.Discard
+		state.WriteInPlace = inPlace
+		if err := processCommandLine(t, state, "w "+filename); err != nil {
+			t.Fatalf("error: %s", err)
+		}
+		after, err := os.Stat(filename)
+		if err != nil {
+			t.Fatalf("error: %s", err)
+		}
+		// without 'inplace', the file is replaced by a new one
+		if os.SameFile(before, after) != inPlace {
+			t.Fatalf("inplace=%t: same file: %t", inPlace, os.SameFile(before, after))
+		}
+		contents, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatalf("error: %s", err)
+		}
+		assertString(t, "wrong contents", string(contents), "1\n")
+	}
+}
+
+func TestNoFinalNewlineIsPreserved(t *testing.T) {
+	const filename string = "nolinebreak.txt"
+	const outputFilename string = "nolinebreak.out"
+	createFileThatDoesNotEndWithALineBreak(filename)
+	defer os.Remove(filename)
+	defer os.Remove(outputFilename)
+
+	state := NewState()
+	var output bytes.Buffer
+	state.Stdout = &output
+	state.Input = bufio.NewReader(strings.NewReader("second\n.\n"))
+	steps := []struct {
+		cmdLine          string
+		expectedOutput   string
+		expectedContents string // of the output file, after the command
+	}{
+		{"e " + filename, "1L, 28C\n", ""},
+		{"l", "Does not end with linebreak.\n", ""},
+		{"w " + outputFilename, "28C\n", "Does not end with linebreak."},
+		{"$a", "", ""},
+		{",l", "Does not end with linebreak.$\nsecond\n", ""},
+		{"w " + outputFilename, "35C\n", "Does not end with linebreak.\nsecond"},
+		{"0r " + filename, "1L, 28C\n", ""},
+		{"w " + outputFilename, "64C\n", "Does not end with linebreak.\nDoes not end with linebreak.\nsecond"},
+	}
+	for _, step := range steps {
+		output.Reset()
+		if err := processCommandLine(t, state, step.cmdLine); err != nil {
+			t.Fatalf("command '%s': error: %s", step.cmdLine, err)
+		}
+		assertString(t, "wrong output for "+step.cmdLine, output.String(), step.expectedOutput)
+		if step.expectedContents != "" {
+			contents, err := os.ReadFile(outputFilename)
+			if err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertString(t, "wrong file contents after "+step.cmdLine, string(contents), step.expectedContents)
+		}
+	}
+}
+
+func TestRevert(t *testing.T) {
+	dir, err := os.MkdirTemp("", "red-revert")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "file.txt")
+	if err := os.WriteFile(filename, []byte("1\n2\n3\n4\n"), 0666); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	state := NewState()
+	state.Silent = true
+	// without a default filename
+	if err := processCommandLine(t, state, "revert"); !errors.Is(err, ErrMissingFilename) {
+		t.Fatalf("expected ErrMissingFilename, got %v", err)
+	}
+	state.Stdin = strings.NewReader("x\n.\n")
+	for _, cmdLine := range []string{"e " + filename, "2,3d", "$a", "3"} {
+		if err := processCommandLine(t, state, cmdLine); err != nil {
+			t.Fatalf("command '%s': error: %s", cmdLine, err)
+		}
+	}
+	assertBufferContents(t, state.Buffer, "1\n4\nx\n")
+	if err := processCommandLine(t, state, "revert"); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertBufferContents(t, state.Buffer, "1\n2\n3\n4\n")
+	assertInt(t, "wrong line nbr", state.lineNbr, 3)
+	if state.changedSinceLastWrite {
+		t.Fatalf("expected buffer to be unchanged")
+	}
+	if err := processCommandLine(t, state, "u"); !errors.Is(err, ErrNothingToUndo) {
+		t.Fatalf("expected ErrNothingToUndo, got %v", err)
+	}
+	if err := processCommandLine(t, state, "revert other.txt"); !errors.Is(err, ErrInvalidArgument) {
+		t.Fatalf("expected ErrInvalidArgument, got %v", err)
+	}
+}
@@ -0,0 +1,27 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+// +build linux darwin freebsd netbsd openbsd
+
+package red
+
+import (
+	"os"
+	"syscall"
+)
+
+/*
+ Returns true if the file has further (hard) links, which would no longer refer to the file if it were replaced.
+*/
+func hasHardLinks(info os.FileInfo) bool {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	return ok && stat.Nlink > 1
+}
+
+/*
+ Gives the file the owner and group of the original file.
+ This is only possible e.g. for root, therefore errors are ignored.
+*/
+func copyOwner(filename string, original os.FileInfo) {
+	if stat, ok := original.Sys().(*syscall.Stat_t); ok {
+		_ = os.Chown(filename, int(stat.Uid), int(stat.Gid))
+	}
+}
@@ -0,0 +1,71 @@
+package red
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrNoNextFile     error = errors.New("no next file")
+	ErrNoPreviousFile error = errors.New("no previous file")
+)
+
+/*
+SetFileList sets the list of files to be edited, e.g. as given on the command line.
+ The first file is the current file, see NextFile for switching between the files.
+*/
+func (state *State) SetFileList(filenames []string) {
+	state.fileList = filenames
+	state.fileIndex = 0
+}
+
+/*
+NextFile edits the next ('fn') or previous ('fp') file of the file list.
+
+ fn[!]
+ fp[!]
+
+ If the buffer has unsaved changes, the file is not changed unless '!' is given.
+ The new file becomes the default filename, and the current address is set to its last line (as for 'e').
+*/
+func (cmd Command) NextFile(state *State) error {
+	if err := cmd.validateAddress(state); err != nil {
+		return err
+	}
+	force := false
+	switch rest := strings.TrimSpace(cmd.restOfCmd); rest {
+	case "":
+	case "!":
+		force = true
+	default:
+		return fmt.Errorf("%s: %w: '%s'", cmd.cmd, ErrInvalidSuffix, rest)
+	}
+
+	index := state.fileIndex + 1
+	if cmd.cmd == commandPreviousFile {
+		index = state.fileIndex - 1
+	}
+	switch {
+	case index >= len(state.fileList):
+		return ErrNoNextFile
+	case index < 0:
+		return ErrNoPreviousFile
+	}
+	if state.changedSinceLastWrite && !force {
+		return fmt.Errorf("%s: %w", cmd.cmd, ErrUnsavedChanges)
+	}
+
+	filename := state.fileList[index]
+	if !state.Silent {
+		state.message(messageInfo, "%s (%d of %d)", filename, index+1, len(state.fileList))
+	}
+	editCmd := Command{cmd: commandEditUnconditionally, restOfCmd: filename}
+	if err := editCmd.Edit(state); err != nil {
+		return err
+	}
+	// also in restricted mode, where 'e' does not change the default filename
+	state.defaultFilename = filename
+	state.fileIndex = index
+	return nil
+}
@@ -0,0 +1,84 @@
+package red
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestParseFileListCommands(t *testing.T) {
+	data := []struct {
+		cmdLine      string
+		expectedCmd  string
+		expectedRest string
+	}{
+		{"fn", commandNextFile, ""},
+		{"fp", commandPreviousFile, ""},
+		{"fn!", commandNextFile, "!"},
+		{"fn !", commandNextFile, "!"},
+		{"f n", commandFilename, "n"},
+		{"fnord", commandFilename, "nord"},
+	}
+	for _, test := range data {
+		t.Run(fmt.Sprintf(">>%s<<", test.cmdLine), func(t *testing.T) {
+			cmd, err := ParseCommand(test.cmdLine, false)
+			if err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertString(t, "wrong command", cmd.cmd, test.expectedCmd)
+			assertString(t, "wrong rest of command", cmd.restOfCmd, test.expectedRest)
+		})
+	}
+}
+
+func TestNextFile(t *testing.T) {
+	var filenames []string
+	for i := 1; i <= 3; i++ {
+		f, err := os.CreateTemp("", "red-filelist")
+		if err != nil {
+			t.Fatalf("error: %s", err)
+		}
+		defer os.Remove(f.Name())
+		fmt.Fprintf(f, "file %d\n", i)
+		f.Close()
+		filenames = append(filenames, f.Name())
+	}
+	state := resetState([]string{})
+	state.SetFileList(filenames)
+	var output bytes.Buffer
+	state.Stdout = &output
+	if err := processCommandLine(t, state, "e "+filenames[0]); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+
+	steps := []struct {
+		cmdLine          string
+		expectError      bool
+		expectedOutput   string
+		expectedContents string
+		expectedFile     int // index in filenames of the default filename
+	}{
+		{"fp", true, "", "file 1\n", 0},
+		{"fn", false, fmt.Sprintf("%s (2 of 3)\n1L, 7C\n", filenames[1]), "file 2\n", 1},
+		{"s/2/two/", false, "1 lines changed\n", "file two\n", 1},
+		{"fn", true, "", "file two\n", 1},
+		{"fn!", false, fmt.Sprintf("%s (3 of 3)\n1L, 7C\n", filenames[2]), "file 3\n", 2},
+		{"fn", true, "", "file 3\n", 2},
+		{"fp", false, fmt.Sprintf("%s (2 of 3)\n1L, 7C\n", filenames[1]), "file 2\n", 1},
+		{"1fp", true, "", "file 2\n", 1},
+		{"fp x", true, "", "file 2\n", 1},
+	}
+	for _, step := range steps {
+		output.Reset()
+		err := processCommandLine(t, state, step.cmdLine)
+		if step.expectError && err == nil {
+			t.Fatalf("command '%s': expected error", step.cmdLine)
+		} else if !step.expectError && err != nil {
+			t.Fatalf("command '%s': error: %s", step.cmdLine, err)
+		}
+		assertString(t, "wrong output for "+step.cmdLine, output.String(), step.expectedOutput)
+		assertBufferContents(t, state.Buffer, step.expectedContents)
+		assertString(t, "wrong default filename after "+step.cmdLine, state.defaultFilename, filenames[step.expectedFile])
+	}
+}
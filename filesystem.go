@@ -0,0 +1,200 @@
+package red
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+var ErrReadOnlyFileSystem error = errors.New("read-only file system")
+
+/*
+FileSystem gives access to the files read and written by the editor (see state.FileSystem).
+ The default is OSFileSystem. A library user can supply an in-memory file system, test fixtures
+ (an fs.FS such as embed.FS or fstest.MapFS, via ReadOnlyFileSystem), or a custom backend.
+
+ Files are opened for reading via fs.FS. Names are passed on unchanged, i.e. the names used
+ with a FileSystem other than OSFileSystem must be valid for that file system (see fs.ValidPath).
+ URLs of remote files (see RemoteFiles) and shell commands are not passed to the FileSystem.
+*/
+type FileSystem interface {
+	fs.FS
+	// WriteFile replaces the contents of the file (creating it if necessary) with the data written by 'write'.
+	// If 'write' returns an error, this is returned and the file should be left unchanged.
+	WriteFile(name string, write func(w io.Writer) error) error
+	// AppendFile appends the data written by 'write' to the file, creating it if necessary.
+	AppendFile(name string, write func(w io.Writer) error) error
+	// Rename renames (moves) a file, replacing 'newname' if it exists.
+	Rename(oldname, newname string) error
+}
+
+/*
+OSFileSystem is the file system of the operating system.
+ Names are paths as used by package os, i.e. may be absolute or relative to the working directory.
+
+ An existing file is replaced atomically by WriteFile: the data is written to a temporary file in the same directory,
+ which is synced to disk and then renamed. The mode (and, where possible, the owner) of the existing file are kept.
+ If the name refers to a symbolic link, the file it refers to is replaced.
+ Files which cannot be replaced in this way (e.g. devices, or files with further hard links) are truncated and overwritten.
+ This can be forced for all files with the setting 'inplace' (or the flag -inplace), e.g. to keep the inode of a file
+ which is watched by another program; the file is then not replaced atomically.
+*/
+var OSFileSystem FileSystem = osFileSystem{}
+
+type osFileSystem struct{}
+
+func (osFileSystem) Open(name string) (fs.File, error) {
+	return os.Open(name)
+}
+
+func (osFileSystem) WriteFile(name string, write func(w io.Writer) error) (err error) {
+	if target, err := filepath.EvalSymlinks(name); err == nil {
+		name = target
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		// nothing to lose
+		return writeFileInPlace(name, write)
+	}
+	if !info.Mode().IsRegular() || hasHardLinks(info) {
+		return writeFileInPlace(name, write)
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".red*")
+	if err != nil {
+		return err
+	}
+	tempFilename := file.Name()
+	defer func() {
+		if err != nil {
+			file.Close()
+			os.Remove(tempFilename)
+		}
+	}()
+	if err = write(file); err != nil {
+		return err
+	}
+	if err = file.Chmod(info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	copyOwner(tempFilename, info)
+	return os.Rename(tempFilename, name)
+}
+
+func (osFileSystem) overwriteFile(name string, write func(w io.Writer) error) error {
+	return writeFileInPlace(name, write)
+}
+
+/*
+ Truncates the file (or creates it if it does not exist), and writes the data.
+*/
+func writeFileInPlace(name string, write func(w io.Writer) error) error {
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err = write(file); err != nil {
+		return err
+	}
+	// special files such as devices cannot be synced
+	if info, err := file.Stat(); err == nil && info.Mode().IsRegular() {
+		if err = file.Sync(); err != nil {
+			return err
+		}
+	}
+	return file.Close()
+}
+
+func (osFileSystem) AppendFile(name string, write func(w io.Writer) error) error {
+	file, err := os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err = write(file); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func (osFileSystem) Rename(oldname, newname string) error {
+	return os.Rename(oldname, newname)
+}
+
+/*
+ Implemented by file systems whose files have a mode and owner, which can be transferred to another file.
+*/
+type modeKeeper interface {
+	// keepMode gives the file the mode and (where possible) the owner of 'original'
+	keepMode(name string, original fs.FileInfo) error
+}
+
+func (osFileSystem) keepMode(name string, original fs.FileInfo) error {
+	if err := os.Chmod(name, original.Mode().Perm()); err != nil {
+		return err
+	}
+	copyOwner(name, original)
+	return nil
+}
+
+/*
+ Implemented by file systems which can overwrite an existing file, rather than replacing it by a new file.
+*/
+type inPlaceWriter interface {
+	// overwriteFile truncates the file (creating it if necessary) and writes the data
+	overwriteFile(name string, write func(w io.Writer) error) error
+}
+
+/*
+ A file system whose WriteFile overwrites an existing file in place (see the setting 'inplace'),
+ if the underlying file system supports this (see inPlaceWriter).
+*/
+type inPlaceFileSystem struct {
+	FileSystem
+}
+
+func (fsys inPlaceFileSystem) WriteFile(name string, write func(w io.Writer) error) error {
+	if writer, ok := fsys.FileSystem.(inPlaceWriter); ok {
+		return writer.overwriteFile(name, write)
+	}
+	return fsys.FileSystem.WriteFile(name, write)
+}
+
+/*
+ReadOnlyFileSystem makes an fs.FS (e.g. embed.FS) usable as a FileSystem.
+ Files can be read, but all attempts to write return an error.
+*/
+func ReadOnlyFileSystem(fsys fs.FS) FileSystem {
+	return readOnlyFileSystem{fsys}
+}
+
+type readOnlyFileSystem struct {
+	fs.FS
+}
+
+func (readOnlyFileSystem) WriteFile(name string, write func(w io.Writer) error) error {
+	return fmt.Errorf("%s: %w", name, ErrReadOnlyFileSystem)
+}
+
+func (readOnlyFileSystem) AppendFile(name string, write func(w io.Writer) error) error {
+	return fmt.Errorf("%s: %w", name, ErrReadOnlyFileSystem)
+}
+
+func (readOnlyFileSystem) Rename(oldname, newname string) error {
+	return fmt.Errorf("%s: %w", oldname, ErrReadOnlyFileSystem)
+}
@@ -0,0 +1,128 @@
+package red
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+/*
+ An in-memory FileSystem.
+*/
+type memoryFileSystem struct {
+	fstest.MapFS
+}
+
+func (m memoryFileSystem) WriteFile(name string, write func(w io.Writer) error) error {
+	var data bytes.Buffer
+	if err := write(&data); err != nil {
+		return err
+	}
+	m.MapFS[name] = &fstest.MapFile{Data: data.Bytes(), Mode: 0644}
+	return nil
+}
+
+func (m memoryFileSystem) AppendFile(name string, write func(w io.Writer) error) error {
+	var data bytes.Buffer
+	if file, ok := m.MapFS[name]; ok {
+		data.Write(file.Data)
+	}
+	if err := write(&data); err != nil {
+		return err
+	}
+	m.MapFS[name] = &fstest.MapFile{Data: data.Bytes(), Mode: 0644}
+	return nil
+}
+
+func (m memoryFileSystem) Rename(oldname, newname string) error {
+	file, ok := m.MapFS[oldname]
+	if !ok {
+		return &fs.PathError{Op: "rename", Path: oldname, Err: fs.ErrNotExist}
+	}
+	m.MapFS[newname] = file
+	delete(m.MapFS, oldname)
+	return nil
+}
+
+func TestMemoryFileSystem(t *testing.T) {
+	fsys := memoryFileSystem{fstest.MapFS{
+		"dir/file.txt": {Data: []byte("1\n2\n3\n")},
+		"other.txt":    {Data: []byte("a\nb\n")},
+	}}
+	state := resetState([]string{})
+	state.FileSystem = fsys
+	state.Silent = true
+	state.BackupSuffix = "~"
+
+	steps := []struct {
+		cmdLine          string
+		expectedContents string
+	}{
+		{"e dir/file.txt", "1\n2\n3\n"},
+		{"1r other.txt", "1\na\nb\n2\n3\n"},
+		{"w", "1\na\nb\n2\n3\n"},
+		{"1,2W other.txt", "1\na\nb\n2\n3\n"},
+		{"w new.txt.gz", "1\na\nb\n2\n3\n"},
+		{"e new.txt.gz", "1\na\nb\n2\n3\n"},
+	}
+	for _, step := range steps {
+		if err := processCommandLine(t, state, step.cmdLine); err != nil {
+			t.Fatalf("command '%s': error: %s", step.cmdLine, err)
+		}
+		assertBufferContents(t, state.Buffer, step.expectedContents)
+	}
+	assertString(t, "wrong contents of file", string(fsys.MapFS["dir/file.txt"].Data), "1\na\nb\n2\n3\n")
+	assertString(t, "wrong contents of backup", string(fsys.MapFS["dir/file.txt~"].Data), "1\n2\n3\n")
+	assertString(t, "wrong contents of appended file", string(fsys.MapFS["other.txt"].Data), "a\nb\n1\na\n")
+	if data := fsys.MapFS["new.txt.gz"].Data; !bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		t.Fatalf("expected a gzip file, got %q", data)
+	}
+}
+
+func TestReadOnlyFileSystem(t *testing.T) {
+	state := resetState([]string{})
+	state.FileSystem = ReadOnlyFileSystem(fstest.MapFS{"file.txt": {Data: []byte("1\n2\n")}})
+	state.Silent = true
+	if err := processCommandLine(t, state, "e file.txt"); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertBufferContents(t, state.Buffer, "1\n2\n")
+	for _, cmdLine := range []string{"w", "W", "w other.txt"} {
+		if err := processCommandLine(t, state, cmdLine); !errors.Is(err, ErrReadOnlyFileSystem) {
+			t.Fatalf("command '%s': expected read-only error, got %v", cmdLine, err)
+		}
+	}
+	if err := processCommandLine(t, state, "e missing.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected not-exist error, got %v", err)
+	}
+}
+
+func TestOSFileSystemWriteFileError(t *testing.T) {
+	dir, err := os.MkdirTemp("", "red-fs")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "file.txt")
+	if err = os.WriteFile(filename, []byte("original\n"), 0644); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+
+	errWrite := errors.New("write failed")
+	err = OSFileSystem.WriteFile(filename, func(w io.Writer) error {
+		io.WriteString(w, "partial")
+		return errWrite
+	})
+	if !errors.Is(err, errWrite) {
+		t.Fatalf("expected write error, got %v", err)
+	}
+	data, _ := os.ReadFile(filename)
+	assertString(t, "file was changed", string(data), "original\n")
+	entries, _ := os.ReadDir(dir)
+	assertInt(t, "temporary file not removed", len(entries), 1)
+}
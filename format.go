@@ -0,0 +1,487 @@
+package red
+
+import (
+	"container/list"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// arguments for the retab command
+const (
+	retabToSpaces string = "s" // convert tabs to spaces (default)
+	retabToTabs   string = "t" // convert spaces to tabs
+	retabForce    string = "!" // also convert whitespace after the leading indentation
+)
+
+const defaultNumberLinesFormat string = "%d\t" // default format for the number lines command
+
+const indentTab string = "tab" // the value of the setting 'indent' for indenting with a tab
+
+/*
+Retab converts the leading whitespace of the addressed lines from tabs to spaces, or vice versa,
+according to state.TabStop.
+
+ (.,.)T[s|t][!]
+   s   converts tabs to spaces (the default)
+   t   converts spaces to tabs
+   !   forces conversion of whitespace in the rest of the line as well, not just the indentation
+
+ The number of lines changed is reported (unless in silent mode).
+ The current address is set to the address of the last line changed.
+ If no lines were changed, the current address is unchanged.
+
+ Each changed line is undone by a 'change' command.
+*/
+func (cmd Command) Retab(state *State) error {
+	if err := cmd.validateAddress(state); err != nil {
+		return err
+	}
+	if state.TabStop < 1 {
+		return fmt.Errorf("retab: %w: invalid tab stop: %d", ErrInvalidArgument, state.TabStop)
+	}
+	args := strings.TrimSpace(cmd.restOfCmd)
+	force := strings.HasSuffix(args, retabForce)
+	args = strings.TrimSpace(strings.TrimSuffix(args, retabForce))
+
+	var retabFn func(lineNbr int, line string) string
+	switch args {
+	case "", retabToSpaces:
+		retabFn = func(lineNbr int, line string) string { return expandTabs(line, state.TabStop, force) }
+	case retabToTabs:
+		retabFn = func(lineNbr int, line string) string { return unexpandSpaces(line, state.TabStop, force) }
+	default:
+		return fmt.Errorf("retab: %w: '%s'", ErrInvalidArgument, args)
+	}
+
+	currentLineNbr := state.lineNbr
+	nbrLinesChanged, undoList, err := changeLines(cmd.resolved.start, cmd.resolved.end, state, retabFn)
+	if err != nil {
+		return fmt.Errorf("retab: %w", err)
+	}
+	if !state.Silent {
+		state.message(messageChanged, "%d lines changed", nbrLinesChanged)
+	}
+	if nbrLinesChanged == 0 {
+		return moveToLine(currentLineNbr, state)
+	}
+	if err = moveToLine(lastChangedLine(undoList), state); err != nil {
+		return err
+	}
+	state.addUndoList(undoList)
+	state.changedSinceLastWrite = true
+	return nil
+}
+
+/*
+ Returns the line number of the last line in the given list of undo objects (as returned by changeLines).
+*/
+func lastChangedLine(undoList *list.List) int {
+	return undoList.Back().Value.(Undo).cmd.resolved.end
+}
+
+/*
+ Replaces tabs by the equivalent number of spaces.
+ Only tabs in the leading whitespace are replaced, unless 'all' is set.
+*/
+func expandTabs(line string, tabStop int, all bool) string {
+	var sb strings.Builder
+	column := 0
+	inIndent := true
+	for _, r := range line {
+		switch {
+		case r == '\t' && (inIndent || all):
+			nbrSpaces := tabStop - column%tabStop
+			sb.WriteString(strings.Repeat(" ", nbrSpaces))
+			column += nbrSpaces
+			continue
+		case r == '\t':
+			column += tabStop - column%tabStop
+		case r == ' ':
+			column++
+		default:
+			inIndent = false
+			column++
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+/*
+ Replaces runs of spaces which end at a tab stop by tabs.
+ Only the leading whitespace is processed, unless 'all' is set.
+*/
+func unexpandSpaces(line string, tabStop int, all bool) string {
+	var sb strings.Builder
+	column := 0
+	nbrPendingSpaces := 0 // spaces seen but not yet written
+	inIndent := true
+	for _, r := range line {
+		switch {
+		case r == ' ' && (inIndent || all):
+			nbrPendingSpaces++
+			column++
+			if column%tabStop == 0 {
+				if nbrPendingSpaces == 1 && !inIndent {
+					// a single space is never replaced in the middle of a line
+					sb.WriteRune(' ')
+				} else {
+					sb.WriteRune('\t')
+				}
+				nbrPendingSpaces = 0
+			}
+			continue
+		case r == '\t':
+			// any pending spaces are swallowed by the tab
+			nbrPendingSpaces = 0
+			column += tabStop - column%tabStop
+		default:
+			inIndent = false
+			column++
+		}
+		sb.WriteString(strings.Repeat(" ", nbrPendingSpaces))
+		nbrPendingSpaces = 0
+		sb.WriteRune(r)
+	}
+	sb.WriteString(strings.Repeat(" ", nbrPendingSpaces))
+	return sb.String()
+}
+
+/*
+Shift indents (command '>') or outdents (command '<') the addressed lines by state.Indent.
+
+ (.,.)>[count]
+ (.,.)<[count]
+
+ The count gives the number of times the lines are shifted. Repeating the command character has the same effect,
+ e.g. '>>' is the same as '>2'.
+ Empty lines are not indented. Outdenting removes the indentation if the line starts with it,
+ otherwise a leading tab, or as many leading spaces (up to the width of the indentation) as there are.
+
+ The current address is set to the address of the last line changed.
+ If no lines were changed, the current address is unchanged.
+
+ Each changed line is undone by a 'change' command.
+*/
+func (cmd Command) Shift(state *State) error {
+	if err := cmd.validateAddress(state); err != nil {
+		return err
+	}
+	if state.Indent == "" {
+		return fmt.Errorf("%s: %w: no indentation set", cmd.cmd, ErrInvalidArgument)
+	}
+	args := strings.TrimSpace(cmd.restOfCmd)
+	count := 1
+	for strings.HasPrefix(args, cmd.cmd) {
+		args = args[len(cmd.cmd):]
+		count++
+	}
+	if args != "" {
+		n, err := strconv.Atoi(strings.TrimSpace(args))
+		if err != nil || n < 1 || count > 1 {
+			return fmt.Errorf("%s: %w: invalid count: '%s'", cmd.cmd, ErrInvalidArgument, strings.TrimSpace(cmd.restOfCmd))
+		}
+		count = n
+	}
+
+	indentWidth := len(state.Indent)
+	if state.Indent == "\t" {
+		indentWidth = state.TabStop
+	}
+	shiftFn := func(lineNbr int, line string) string {
+		for i := 0; i < count; i++ {
+			if cmd.cmd == commandShiftRight {
+				line = indentLine(line, state.Indent)
+			} else {
+				line = outdentLine(line, state.Indent, indentWidth)
+			}
+		}
+		return line
+	}
+	currentLineNbr := state.lineNbr
+	nbrLinesChanged, undoList, err := changeLines(cmd.resolved.start, cmd.resolved.end, state, shiftFn)
+	if err != nil {
+		return fmt.Errorf("%s: %w", cmd.cmd, err)
+	}
+	if nbrLinesChanged == 0 {
+		return moveToLine(currentLineNbr, state)
+	}
+	if err = moveToLine(lastChangedLine(undoList), state); err != nil {
+		return err
+	}
+	state.addUndoList(undoList)
+	state.changedSinceLastWrite = true
+	return nil
+}
+
+/*
+ Adds the indentation to the start of the line, unless the line is empty.
+*/
+func indentLine(line, indent string) string {
+	if line == "\n" || line == "" {
+		return line
+	}
+	return indent + line
+}
+
+/*
+ Removes one level of indentation from the start of the line (see Shift).
+*/
+func outdentLine(line, indent string, indentWidth int) string {
+	switch {
+	case strings.HasPrefix(line, indent):
+		return line[len(indent):]
+	case strings.HasPrefix(line, "\t"):
+		return line[1:]
+	}
+	nbrSpaces := 0
+	for nbrSpaces < len(line) && nbrSpaces < indentWidth && line[nbrSpaces] == ' ' {
+		nbrSpaces++
+	}
+	return line[nbrSpaces:]
+}
+
+/*
+NumberLines prefixes each of the addressed lines with its line number.
+
+ (.,.)N[/format/]
+
+ The format is a printf-style format containing one integer verb, enclosed in delimiters
+ (any character can be used as the delimiter). The default format is "%d<tab>".
+
+ The current address is set to the address of the last line changed.
+
+ Each changed line is undone by a 'change' command.
+*/
+func (cmd Command) NumberLines(state *State) error {
+	if err := cmd.validateAddress(state); err != nil {
+		return err
+	}
+	format := defaultNumberLinesFormat
+	if arg := strings.TrimSpace(cmd.restOfCmd); arg != "" {
+		var err error
+		if format, err = parseDelimitedArg(arg); err != nil {
+			return fmt.Errorf("number lines: %w", err)
+		}
+	}
+	// check the format with a sample line number
+	if sample := fmt.Sprintf(format, 1); strings.Contains(sample, "%!") {
+		return fmt.Errorf("number lines: %w: invalid format: '%s'", ErrInvalidArgument, format)
+	}
+
+	numberFn := func(lineNbr int, line string) string { return fmt.Sprintf(format, lineNbr) + line }
+	nbrLinesChanged, undoList, err := changeLines(cmd.resolved.start, cmd.resolved.end, state, numberFn)
+	if err != nil {
+		return fmt.Errorf("number lines: %w", err)
+	}
+	if nbrLinesChanged == 0 {
+		return nil
+	}
+	if err = moveToLine(lastChangedLine(undoList), state); err != nil {
+		return err
+	}
+	state.addUndoList(undoList)
+	state.changedSinceLastWrite = true
+	return nil
+}
+
+/*
+AppendInsertText adds the given text to the end (command 'A') or to the start (command 'I') of each addressed line.
+
+ (.,.)A/text/
+ (.,.)I/text/
+
+ The text must be enclosed in delimiters (any character can be used as the delimiter).
+
+ The current address is set to the address of the last line changed.
+
+ Each changed line is undone by a 'change' command.
+*/
+func (cmd Command) AppendInsertText(state *State) error {
+	if err := cmd.validateAddress(state); err != nil {
+		return err
+	}
+	text, err := parseDelimitedArg(strings.TrimSpace(cmd.restOfCmd))
+	if err != nil {
+		return fmt.Errorf("%s: %w", cmd.cmd, err)
+	}
+
+	var textFn func(lineNbr int, line string) string
+	if cmd.cmd == commandInsertText {
+		textFn = func(lineNbr int, line string) string { return text + line }
+	} else {
+		textFn = func(lineNbr int, line string) string {
+			if strings.HasSuffix(line, "\n") {
+				return line[:len(line)-1] + text + "\n"
+			}
+			return line + text
+		}
+	}
+	nbrLinesChanged, undoList, err := changeLines(cmd.resolved.start, cmd.resolved.end, state, textFn)
+	if err != nil {
+		return fmt.Errorf("%s: %w", cmd.cmd, err)
+	}
+	if nbrLinesChanged == 0 {
+		return nil
+	}
+	if err = moveToLine(lastChangedLine(undoList), state); err != nil {
+		return err
+	}
+	state.addUndoList(undoList)
+	state.changedSinceLastWrite = true
+	return nil
+}
+
+/*
+ Returns the string enclosed by the delimiters (the first character of 'arg' is the delimiter).
+ This allows e.g. trailing whitespace to be specified.
+*/
+func parseDelimitedArg(arg string) (string, error) {
+	delimiter, size := utf8.DecodeRuneInString(arg)
+	if len(arg) < 2*size || !strings.HasSuffix(arg, string(delimiter)) {
+		return "", ErrMissingDelimiter
+	}
+	str := arg[size : len(arg)-size]
+	if strings.ContainsRune(str, delimiter) {
+		return "", syntaxError(fmt.Sprintf("unexpected delimiter in '%s'", arg))
+	}
+	return str, nil
+}
+
+/*
+Reflow rewraps the addressed lines so that no line is longer than the given width
+(if possible: words longer than the width are placed on a line of their own).
+
+ (.,.)F[width] [/prefix/]
+
+ If width is not specified, state.TextWidth is used.
+ Paragraphs are separated by blank lines, which are preserved.
+ The indentation of the first line of a paragraph is used for all lines of the reformatted paragraph.
+
+ If a prefix is given (enclosed in delimiters, e.g. '/# /'), it is removed from the start of each line
+ (after the indentation) before the text is rewrapped, and added to each reformatted line.
+ A line containing only the prefix (without trailing whitespace) counts as a blank line.
+
+ The current address is set to the address of the last line of the reformatted text.
+
+ Calls internally Change, which is where the undo is handled.
+*/
+func (cmd Command) Reflow(state *State) error {
+	if err := cmd.validateAddress(state); err != nil {
+		return err
+	}
+	width := state.TextWidth
+	args := strings.TrimSpace(cmd.restOfCmd)
+	widthStr := args[:len(args)-len(strings.TrimLeft(args, "0123456789"))]
+	if widthStr != "" {
+		var err error
+		if width, err = strconv.Atoi(widthStr); err != nil {
+			return fmt.Errorf("reflow: %w: invalid width: '%s'", ErrInvalidArgument, widthStr)
+		}
+	}
+	if width < 1 {
+		return fmt.Errorf("reflow: %w: invalid width: %d", ErrInvalidArgument, width)
+	}
+	var prefix string
+	if prefixArg := strings.TrimSpace(args[len(widthStr):]); prefixArg != "" {
+		var err error
+		if prefix, err = parseDelimitedArg(prefixArg); err != nil {
+			return fmt.Errorf("reflow: %w: invalid prefix: '%s' (%s)", ErrInvalidArgument, prefixArg, err)
+		}
+	}
+
+	originalLines, err := copyLines(cmd.resolved.start, cmd.resolved.end, state)
+	if err != nil {
+		return fmt.Errorf("reflow: %w", err)
+	}
+	newLines := reflowLines(originalLines, width, prefix)
+	if linesAreEqual(originalLines, newLines) {
+		return moveToLine(cmd.resolved.end, state)
+	}
+
+	changeCommand, err := cmd.createNewResolvedCommand(commandChange, "")
+	if err != nil {
+		return err
+	}
+	return changeCommand.Change(state, newLines)
+}
+
+/*
+ Rewraps the given lines to 'width', paragraph by paragraph.
+ The prefix (if any) is removed from the lines, and added to the rewrapped lines after the indentation.
+*/
+func reflowLines(lines *list.List, width int, prefix string) *list.List {
+	newLines := list.New()
+	var indent string
+	var words []string
+	flushParagraph := func() {
+		var sb strings.Builder
+		lineLength := 0
+		for _, word := range words {
+			wordLength := utf8.RuneCountInString(word)
+			if lineLength != 0 && lineLength+1+wordLength > width {
+				sb.WriteString("\n")
+				newLines.PushBack(Line{sb.String()})
+				sb.Reset()
+				lineLength = 0
+			}
+			if lineLength == 0 {
+				sb.WriteString(indent)
+				lineLength = utf8.RuneCountInString(indent)
+			} else {
+				sb.WriteString(" ")
+				lineLength++
+			}
+			sb.WriteString(word)
+			lineLength += wordLength
+		}
+		if sb.Len() != 0 {
+			sb.WriteString("\n")
+			newLines.PushBack(Line{sb.String()})
+		}
+		words = nil
+	}
+
+	for el := lines.Front(); el != nil; el = el.Next() {
+		line := el.Value.(Line).Line
+		lineIndent := line[0 : len(line)-len(strings.TrimLeft(line, " \t"))]
+		text := line[len(lineIndent):]
+		if prefix != "" {
+			if strings.HasPrefix(text, prefix) {
+				text = text[len(prefix):]
+			} else if trimmedPrefix := strings.TrimRight(prefix, " \t"); trimmedPrefix != "" && strings.HasPrefix(text, trimmedPrefix) {
+				text = text[len(trimmedPrefix):]
+			}
+		}
+		lineWords := strings.Fields(text)
+		if len(lineWords) == 0 {
+			// blank line: end of paragraph
+			flushParagraph()
+			newLines.PushBack(Line{line})
+			continue
+		}
+		if len(words) == 0 {
+			indent = lineIndent + prefix
+		}
+		words = append(words, lineWords...)
+	}
+	flushParagraph()
+	return newLines
+}
+
+/*
+ Returns true if both lists contain the same lines.
+*/
+func linesAreEqual(list1, list2 *list.List) bool {
+	if list1.Len() != list2.Len() {
+		return false
+	}
+	for el1, el2 := list1.Front(), list2.Front(); el1 != nil; el1, el2 = el1.Next(), el2.Next() {
+		if el1.Value.(Line).Line != el2.Value.(Line).Line {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,308 @@
+package red
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestRetab(t *testing.T) {
+	data := []struct {
+		addrRange        string
+		args             string
+		tabStop          int
+		expectedContents string
+		expectedLineNbr  int
+	}{
+		{"1,$", "", 4, "    a\n      b\tc\n        d\n", 3},
+		{"1,$", "s", 8, "        a\n          b\tc\n                d\n", 3},
+		{"2", "s!", 4, "\ta\n      b c\n\t\td\n", 2},
+		{"1,$", "t", 4, "\ta\n\t  b\tc\n\t\td\n", 2}, // line 2 only has its spaces converted
+		{"3", "t", 4, "\ta\n  \t  b\tc\n\t\td\n", 1}, // nothing to change, line nbr unchanged
+	}
+
+	for i, test := range data {
+		t.Run(fmt.Sprintf("test %d: >>%s%s%s<<", i, test.addrRange, commandRetab, test.args), func(t *testing.T) {
+			var err error
+			var cmd Command
+			state := resetState([]string{"\ta", "  \t  b\tc", "\t\td"})
+			state.TabStop = test.tabStop
+			state.lineNbr = 1
+			if cmd, err = createCommandAndResolveAddressRange(state, newValidRange(test.addrRange), commandRetab, test.args); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			if err = cmd.Retab(state); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertInt(t, "wrong state.lineNbr!", state.lineNbr, test.expectedLineNbr)
+			assertBufferContents(t, state.Buffer, test.expectedContents)
+		})
+	}
+}
+
+func TestRetabToTabsForced(t *testing.T) {
+	state := resetState([]string{"a   b   c d"})
+	state.TabStop = 4
+	cmd, err := createCommandAndResolveAddressRange(state, newValidRange("1"), commandRetab, "t!")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if err = cmd.Retab(state); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertBufferContents(t, state.Buffer, "a\tb\tc d\n")
+}
+
+func TestRetabUndo(t *testing.T) {
+	state := resetState([]string{"\ta", "b", "\t\tc"})
+	cmd, err := createCommandAndResolveAddressRange(state, newValidRange("1,$"), commandRetab, "")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if err = cmd.Retab(state); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertBufferContents(t, state.Buffer, "        a\nb\n                c\n")
+	if err = cmd.Undo(state); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertBufferContents(t, state.Buffer, "\ta\nb\n\t\tc\n")
+}
+
+func TestRetabReportsLinesChanged(t *testing.T) {
+	data := []struct {
+		cmdLine        string
+		silent         bool
+		expectedOutput string
+	}{
+		{"1,$T", false, "2 lines changed\n"},
+		{"2T", false, "0 lines changed\n"},
+		{"1,$T", true, ""},
+	}
+	for _, test := range data {
+		t.Run(fmt.Sprintf("%s (silent %t)", test.cmdLine, test.silent), func(t *testing.T) {
+			var output bytes.Buffer
+			state := resetState([]string{"\ta", "b", "\t\tc"})
+			state.Stdout = &output
+			state.Silent = test.silent
+			if err := processCommandLine(t, state, test.cmdLine); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertString(t, "wrong output", output.String(), test.expectedOutput)
+		})
+	}
+}
+
+func TestRetabBadArgument(t *testing.T) {
+	state := resetState([]string{"\ta"})
+	cmd, err := createCommandAndResolveAddressRange(state, newValidRange("1"), commandRetab, "x")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if err = cmd.Retab(state); err == nil {
+		t.Fatalf("expected error for bad argument")
+	}
+}
+
+func TestReflow(t *testing.T) {
+	data := []struct {
+		addrRange        string
+		width            string
+		expectedContents string
+		expectedLineNbr  int
+	}{
+		{"1,$", "", "one two three four\nfive six\n\n  seven eight nine\n  ten\n", 5},
+		{"1,$", "10", "one two\nthree four\nfive six\n\n  seven\n  eight\n  nine ten\n", 7},
+		{"1,2", "3", "one\ntwo\nthree\nfour\nfive\nsix\n\n  seven eight\nnine\nten\n", 5}, // words longer than width
+		{"5,$", "", "one two\nthree four five\nsix\n\n  seven eight nine\n  ten\n", 6},
+		{"4,5", "", "one two\nthree four five\nsix\n\n  seven eight\nnine\nten\n", 5}, // no-op
+	}
+
+	for i, test := range data {
+		t.Run(fmt.Sprintf("test %d: >>%s%s%s<<", i, test.addrRange, commandReflow, test.width), func(t *testing.T) {
+			var err error
+			var cmd Command
+			state := resetState([]string{"one two", "three four five", "six", "", "  seven eight", "nine", "ten"})
+			state.TextWidth = 20
+			if cmd, err = createCommandAndResolveAddressRange(state, newValidRange(test.addrRange), commandReflow, test.width); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			if err = cmd.Reflow(state); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertInt(t, "wrong state.lineNbr!", state.lineNbr, test.expectedLineNbr)
+			assertBufferContents(t, state.Buffer, test.expectedContents)
+		})
+	}
+}
+
+func TestReflowWithPrefix(t *testing.T) {
+	data := []struct {
+		args             string
+		expectedContents string
+	}{
+		{"/# /", "  # one two three\n  # four five\n  #\n  # six seven\nx\n"},
+		{"12 /# /", "  # one two\n  # three\n  # four\n  # five\n  #\n  # six\n  # seven\nx\n"},
+		{"|#|", "  #one two three\n  #four five\n  #\n  #six seven\nx\n"},
+	}
+	for _, test := range data {
+		t.Run(test.args, func(t *testing.T) {
+			state := resetState([]string{"  # one two", "  # three", "  #four five", "  #", "  # six", "  # seven", "x"})
+			state.TextWidth = 20
+			cmd, err := createCommandAndResolveAddressRange(state, newValidRange("1,6"), commandReflow, test.args)
+			if err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			if err = cmd.Reflow(state); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertBufferContents(t, state.Buffer, test.expectedContents)
+			assertInt(t, "nbr of undo entries", state.undo.Len(), 1)
+		})
+	}
+}
+
+func TestReflowUndo(t *testing.T) {
+	state := resetState([]string{"a b", "c", "d e f"})
+	cmd, err := createCommandAndResolveAddressRange(state, newValidRange("1,$"), commandReflow, "")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if err = cmd.Reflow(state); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertBufferContents(t, state.Buffer, "a b c d e f\n")
+	if err = cmd.Undo(state); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertBufferContents(t, state.Buffer, "a b\nc\nd e f\n")
+}
+
+func TestNumberLines(t *testing.T) {
+	data := []struct {
+		addrRange        string
+		format           string
+		expectedContents string
+		expectedLineNbr  int
+	}{
+		{"1,$", "", "1\ta\n2\tb\n3\tc\n", 3},
+		{"2,3", "/%03d: /", "a\n002: b\n003: c\n", 3},
+		{"1", "|[%d] |", "[1] a\nb\nc\n", 1},
+	}
+
+	for i, test := range data {
+		t.Run(fmt.Sprintf("test %d: >>%s%s%s<<", i, test.addrRange, commandNumberLines, test.format), func(t *testing.T) {
+			var err error
+			var cmd Command
+			state := resetState([]string{"a", "b", "c"})
+			if cmd, err = createCommandAndResolveAddressRange(state, newValidRange(test.addrRange), commandNumberLines, test.format); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			if err = cmd.NumberLines(state); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertInt(t, "wrong state.lineNbr!", state.lineNbr, test.expectedLineNbr)
+			assertBufferContents(t, state.Buffer, test.expectedContents)
+		})
+	}
+}
+
+func TestNumberLinesBadFormat(t *testing.T) {
+	for _, format := range []string{"/%d", "/%s/", "/%d/%d/"} {
+		state := resetState([]string{"a", "b", "c"})
+		cmd, err := createCommandAndResolveAddressRange(state, newValidRange("1,$"), commandNumberLines, format)
+		if err != nil {
+			t.Fatalf("error: %s", err)
+		}
+		if err = cmd.NumberLines(state); err == nil {
+			t.Fatalf("expected error for format '%s'", format)
+		}
+		assertBufferContents(t, state.Buffer, "a\nb\nc\n")
+	}
+}
+
+func TestAppendInsertText(t *testing.T) {
+	data := []struct {
+		addrRange        string
+		cmdIdent         string
+		text             string
+		expectedContents string
+		expectedLineNbr  int
+	}{
+		{"1,2", commandInsertText, "/# /", "# a\n# b\nc\n", 2},
+		{"2,$", commandAppendText, "|;|", "a\nb;\nc;\n", 3},
+		{"3", commandAppendText, "| // end|", "a\nb\nc // end\n", 3},
+	}
+
+	for i, test := range data {
+		t.Run(fmt.Sprintf("test %d: >>%s%s%s<<", i, test.addrRange, test.cmdIdent, test.text), func(t *testing.T) {
+			var err error
+			var cmd Command
+			state := resetState([]string{"a", "b", "c"})
+			if cmd, err = createCommandAndResolveAddressRange(state, newValidRange(test.addrRange), test.cmdIdent, test.text); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			if err = cmd.AppendInsertText(state); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertInt(t, "wrong state.lineNbr!", state.lineNbr, test.expectedLineNbr)
+			assertBufferContents(t, state.Buffer, test.expectedContents)
+		})
+	}
+}
+
+func TestShift(t *testing.T) {
+	data := []struct {
+		cmdLine          string
+		indent           string
+		expectedContents string
+		expectedLineNbr  int
+	}{
+		{"1,$>", "tab", "\ta\n\n\t  b\n\t\tc\n", 4},
+		{"1,2>>", "tab", "\t\ta\n\n  b\n\tc\n", 1},
+		{"3>3", "2", "a\n\n        b\n\tc\n", 3},
+		{"1,$<", "tab", "a\n\nb\nc\n", 4},
+		{"1,$<", "4", "a\n\nb\nc\n", 4},
+		{"3<", "1", "a\n\n b\n\tc\n", 3},
+		{"1,2<", "tab", "a\n\n  b\n\tc\n", 1}, // nothing to change, line nbr unchanged
+		{"3,4<<p", "tab", "a\n\nb\nc\n", 4},
+	}
+	for _, test := range data {
+		t.Run(fmt.Sprintf("%s (indent %s)", test.cmdLine, test.indent), func(t *testing.T) {
+			state := resetState([]string{"a", "", "  b", "\tc"})
+			state.Stdout = io.Discard
+			state.lineNbr = 1
+			if err := state.SetOption("indent", test.indent); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			if err := processCommandLine(t, state, test.cmdLine); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertBufferContents(t, state.Buffer, test.expectedContents)
+			assertInt(t, "wrong state.lineNbr!", state.lineNbr, test.expectedLineNbr)
+			// the shift is undone as one change
+			if test.expectedContents != "a\n\n  b\n\tc\n" {
+				if err := processCommandLine(t, state, "u"); err != nil {
+					t.Fatalf("undo: error: %s", err)
+				}
+				assertBufferContents(t, state.Buffer, "a\n\n  b\n\tc\n")
+			}
+		})
+	}
+}
+
+func TestShiftErrors(t *testing.T) {
+	state := resetState([]string{"a"})
+	state.lineNbr = 1
+	for _, cmdLine := range []string{">x", ">0", ">>2"} {
+		if err := processCommandLine(t, state, cmdLine); !errors.Is(err, ErrInvalidArgument) {
+			t.Fatalf("command '%s': expected ErrInvalidArgument, got %v", cmdLine, err)
+		}
+	}
+	if err := state.SetOption("indent", "0"); !errors.Is(err, ErrInvalidSetting) {
+		t.Fatalf("expected ErrInvalidSetting, got %v", err)
+	}
+	assertBufferContents(t, state.Buffer, "a\n")
+}
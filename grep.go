@@ -0,0 +1,72 @@
+package red
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+Grep prints the lines matching a regular expression, without changing anything.
+
+ (1,$)grep /re/
+
+ Each matching line is printed with its line number (as by 'n').
+ When colouring is on (see ProgramFlags.Color), the matching text is highlighted.
+ An empty regex refers to the previous regex. It is an error if no line matches.
+
+ Unlike 'g/re/n', the lines are neither marked nor copied, and no undo entry is created,
+ i.e. the buffer is only read once.
+ The current address is set to the address of the last matching line.
+*/
+func (cmd Command) Grep(state *State) error {
+	if err := cmd.validateAddress(state); err != nil {
+		return err
+	}
+	re, rest, err := parseGlobalCommand(strings.TrimSpace(cmd.restOfCmd), state)
+	if err != nil {
+		return fmt.Errorf("%s: %w", cmd.cmd, err)
+	}
+	if rest != "" {
+		return fmt.Errorf("%s: %w: '%s'", cmd.cmd, ErrInvalidArgument, rest)
+	}
+	startLineNbr, endLineNbr := cmd.resolved.start, cmd.resolved.end
+	if !cmd.addrRange.IsSpecified() {
+		startLineNbr, endLineNbr = 1, state.Buffer.Len()
+	}
+	if state.Buffer.Len() == 0 {
+		return fmt.Errorf("%s: %w", cmd.cmd, ErrNoMatch)
+	}
+	renderer := state.lineRenderer(state.Stdout, re)
+	currentLineNbr := state.lineNbr // for state.HighlightDot
+	lastMatch := 0
+	var interrupted error
+	err = state.Buffer.Iterate(startLineNbr, endLineNbr, func(lineNbr int, line *Line) {
+		if interrupted != nil || state.pagerStopped {
+			return
+		}
+		if interrupted = state.checkInterrupt(); interrupted != nil {
+			return
+		}
+		if !matchesLine(re, line) {
+			return
+		}
+		lastMatch = lineNbr
+		if !state.pageLine() {
+			return
+		}
+		if state.HighlightDot {
+			_printGutter(state.Stdout, lineNbr == currentLineNbr)
+		}
+		renderer.printLine(state.Stdout, lineNbr, line.Line, true, false, nil)
+	})
+	if err == nil {
+		err = interrupted
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", cmd.cmd, err)
+	}
+	if lastMatch == 0 {
+		return fmt.Errorf("%s: %w", cmd.cmd, ErrNoMatch)
+	}
+	return moveToLine(lastMatch, state)
+}
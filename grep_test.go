@@ -0,0 +1,69 @@
+package red
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestGrep(t *testing.T) {
+	data := []struct {
+		cmdLine         string
+		expectedOutput  string
+		expectedLineNbr int
+	}{
+		{"grep /a/", "   1\t abc\n   3\t cab\n", 3},
+		{"2,$grep /a/", "   3\t cab\n", 3},
+		{"grep |^b|", "   2\t bcd\n", 2},
+	}
+	for _, test := range data {
+		t.Run(test.cmdLine, func(t *testing.T) {
+			var output bytes.Buffer
+			state := resetState([]string{"abc", "bcd", "cab", "d"})
+			state.Stdout = &output
+			state.lineNbr = 4
+			if err := processCommandLine(t, state, test.cmdLine); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertString(t, "wrong output", output.String(), test.expectedOutput)
+			assertInt(t, "wrong line nbr", state.lineNbr, test.expectedLineNbr)
+			if state.changedSinceLastWrite || state.undo.Len() != 0 {
+				t.Fatalf("expected buffer to be unchanged")
+			}
+		})
+	}
+}
+
+func TestGrepPreviousRegex(t *testing.T) {
+	var output bytes.Buffer
+	state := resetState([]string{"abc", "bcd"})
+	state.Stdout = &output
+	state.lineNbr = 1
+	for _, cmdLine := range []string{"/d/", "grep //"} {
+		if err := processCommandLine(t, state, cmdLine); err != nil {
+			t.Fatalf("command '%s': error: %s", cmdLine, err)
+		}
+	}
+	assertString(t, "wrong output", output.String(), "bcd\n   2\t bcd\n")
+}
+
+func TestGrepErrors(t *testing.T) {
+	data := []struct {
+		buffer   []string
+		cmdLine  string
+		expected error
+	}{
+		{[]string{"a"}, "grep /x/", ErrNoMatch},
+		{nil, "grep /x/", ErrNoMatch},
+		{[]string{"a"}, "grep /a/p", ErrInvalidArgument},
+		{[]string{"a"}, "grep /a", ErrMissingDelimiter},
+	}
+	for _, test := range data {
+		t.Run(test.cmdLine, func(t *testing.T) {
+			state := resetState(test.buffer)
+			if err := processCommandLine(t, state, test.cmdLine); !errors.Is(err, test.expected) {
+				t.Fatalf("expected error %v, got %v", test.expected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package red
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+)
+
+/*
+HangupFilename is the name of the file to which the buffer is written if the editor is hung up.
+*/
+const HangupFilename = "red.hup"
+
+/*
+HandleHangup installs a handler for the signals SIGHUP and SIGTERM.
+
+ When one of these signals is received, any unsaved changes are written to a file (see WriteHangupFile)
+ and then 'exit' is called.
+ As with GNU ed, the buffer is written regardless of which command is currently running.
+*/
+func HandleHangup(state *State, exit func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGTERM)
+	go func() {
+		<-signals
+		filename, err := state.WriteHangupFile()
+		switch {
+		case err != nil:
+			fmt.Fprintf(state.Stderr, "could not save buffer: %s\n", err)
+		case filename != "":
+			fmt.Fprintf(state.Stderr, "buffer saved to %s\n", filename)
+		}
+		exit()
+	}()
+}
+
+/*
+WriteHangupFile writes the buffer to the file 'red.hup' in the current directory or, if that is not possible,
+in the home directory of the user or, failing that, in the directory for temporary files (see ApplyEnvironment).
+
+ The buffer is only written if it contains unsaved changes.
+ Returns the name of the file written, or "" if there was nothing to save.
+*/
+func (state *State) WriteHangupFile() (filename string, err error) {
+	if !state.changedSinceLastWrite {
+		return "", nil
+	}
+	filenames := []string{HangupFilename}
+	if home, err := os.UserHomeDir(); err == nil {
+		filenames = append(filenames, filepath.Join(home, HangupFilename))
+	}
+	filenames = append(filenames, filepath.Join(state.tempDir(), HangupFilename))
+	return state.writeHangupFile(filenames)
+}
+
+/*
+ Writes the buffer to the first of the given files which can be written.
+*/
+func (state *State) writeHangupFile(filenames []string) (filename string, err error) {
+	for _, filename = range filenames {
+		if _, err = WriteFile(filename, state.Buffer, 1, state.Buffer.Len()); err == nil {
+			return filename, nil
+		}
+	}
+	return "", err
+}
@@ -0,0 +1,39 @@
+package red
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteHangupFile(t *testing.T) {
+	dir, err := os.MkdirTemp("", "red-hup")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	state := resetState([]string{"1", "2"})
+	filenames := []string{filepath.Join(dir, "missing", HangupFilename), filepath.Join(dir, HangupFilename)}
+
+	// no unsaved changes
+	if filename, err := state.WriteHangupFile(); err != nil || filename != "" {
+		t.Fatalf("expected nothing to be saved, got '%s', err: %v", filename, err)
+	}
+
+	state.changedSinceLastWrite = true
+	filename, err := state.writeHangupFile(filenames)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertString(t, "wrong file written", filename, filenames[1])
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertString(t, "wrong file contents", string(contents), "1\n2\n")
+
+	if _, err := state.writeHangupFile(filenames[:1]); err == nil {
+		t.Fatalf("expected error")
+	}
+}
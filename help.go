@@ -8,149 +8,449 @@ import (
 /*
 Help displays a list of the available commands.
 
-In the original 'ed' the help command 'explained the last error'.
-Here, it prints the list of available commands, or if a command is included (e.g. "h a") then it prints a help for that command.
+ help
+
+ Prints the list of available commands, or if a command is included (e.g. "help a") then it prints a help for that command.
+ (As in the original 'ed', the command 'h' explains the last error, see ExplainLastError)
 */
 func (cmd Command) Help(state *State) error {
-	fmt.Println()
+	w := state.Stdout
+	fmt.Fprintln(w)
 	if subcmd := strings.TrimSpace(cmd.restOfCmd); len(subcmd) != 0 {
 		switch subcmd {
 		case "address":
-			fmt.Println("An address can contain the following elements:")
-			fmt.Println(" .    The current line in the buffer.")
-			fmt.Println(" $    The last line in the buffer.")
-			fmt.Println(" n    The nth line in the buffer.")
-			fmt.Println(" +n   The nth next line.")
-			fmt.Println(" -n   The nth previous line.")
-			fmt.Println(" +    The next line. Equivalent to '+1'.")
-			fmt.Println(" -    The previous line. Equivalent to '-1'.")
-			fmt.Println(" /re/ The next line matching the regular expression re. The search wraps around.")
-			fmt.Println(" ?re? The previous line matching the regular expression re. The search wraps around.")
-			fmt.Println(" 'x   Refers to the line marked by a 'k' (mark) command. 'x' is a lower case letter in the range a-z.")
-			fmt.Println("\nAddress ranges consist of two addresses, separated by a comma or a semicolon.")
-			fmt.Println("In the case of a semicolon, the current line is set to the first address before the second is calculated.")
-			fmt.Println("The address range can omit either the first or second address or both:")
-			fmt.Println("  only 1st address specified: the 2nd address is set to the 1st address.")
-			fmt.Println("  , addr    : the 1st address is set to line 1.")
-			fmt.Println("  ; addr    : the 1st address is set to the current line.")
-			fmt.Println("  ,         : equals '1,$', i.e. the first to last lines in the buffer.")
-			fmt.Println("  ;         : equals '.;$', i.e. the current to last lines in the buffer.")
+			fmt.Fprintln(w, "An address can contain the following elements:")
+			fmt.Fprintln(w, " .    The current line in the buffer.")
+			fmt.Fprintln(w, " $    The last line in the buffer.")
+			fmt.Fprintln(w, " n    The nth line in the buffer.")
+			fmt.Fprintln(w, " +n   The nth next line.")
+			fmt.Fprintln(w, " -n   The nth previous line.")
+			fmt.Fprintln(w, " +    The next line. Equivalent to '+1'.")
+			fmt.Fprintln(w, " -    The previous line. Equivalent to '-1'.")
+			fmt.Fprintln(w, " /re/ The next line matching the regular expression re. The search wraps around.")
+			fmt.Fprintln(w, " ?re? The previous line matching the regular expression re. The search wraps around.")
+			fmt.Fprintln(w, " //   The next line matching the regular expression of the previous search. (?? searches backwards)")
+			fmt.Fprintln(w, "\n      A regular expression followed by 'I' matches case-insensitively, e.g. /re/I.")
+			fmt.Fprintf(w, "      ('%s' followed by a delimiter is the command '%s' instead, e.g. /re/%s/# /.)\n", suffixIgnoreCase, commandInsertText, commandInsertText)
+			fmt.Fprintln(w, " 'x   Refers to the line marked by a 'k' (mark) command. 'x' is a lower case letter in the range a-z.")
+			fmt.Fprintln(w, " &n   The line containing the byte offset n (from 0) in the file as written, e.g. as reported by a compiler.")
+			fmt.Fprintf(w, "      (A comment ('%s') must therefore not start with a digit.)\n", commandComment)
+			fmt.Fprintln(w, "\nAddress ranges consist of two addresses, separated by a comma or a semicolon.")
+			fmt.Fprintln(w, "In the case of a semicolon, the current line is set to the first address before the second is calculated.")
+			fmt.Fprintln(w, "The address range can omit either the first or second address or both:")
+			fmt.Fprintln(w, "  only 1st address specified: the 2nd address is set to the 1st address.")
+			fmt.Fprintln(w, "  , addr    : the 1st address is set to line 1.")
+			fmt.Fprintln(w, "  ; addr    : the 1st address is set to the current line.")
+			fmt.Fprintln(w, "  ,         : equals '1,$', i.e. the first to last lines in the buffer.")
+			fmt.Fprintln(w, "  %         : equals '1,$' as well.")
+			fmt.Fprintln(w, "  ;         : equals '.;$', i.e. the current to last lines in the buffer.")
 		case commandAppend:
-			fmt.Println(" ", commandAppend, "Appends text after the addressed line.")
-			fmt.Println("\n  Text is entered in input mode, i.e. any number of lines, terminated by a fullstop on its own line.")
-			fmt.Println("  Specifying the address '0' (zero) adds the entered text at the beginning of the buffer.")
-			fmt.Println("\n  Ex.: 2a      appends text after line 2.")
+			fmt.Fprintln(w, " ", commandAppend, "Appends text after the addressed line.")
+			fmt.Fprintln(w, "\n  Text is entered in input mode, i.e. any number of lines, terminated by a fullstop on its own line.")
+			fmt.Fprintln(w, "  A line containing only a fullstop can be entered as \\. (a backslash is removed from such a line).")
+			fmt.Fprintln(w, "  Specifying the address '0' (zero) adds the entered text at the beginning of the buffer.")
+			fmt.Fprintln(w, "  If no text is entered, the buffer is unchanged, and the addressed line becomes the current line.")
+			fmt.Fprintln(w, "\n  Ex.: 2a      appends text after line 2.")
+		case commandAppendText, commandInsertText:
+			fmt.Fprintln(w, " ", commandAppendText, "Appends text to the end of each addressed line.")
+			fmt.Fprintln(w, " ", commandInsertText, "Inserts text at the start of each addressed line.")
+			fmt.Fprintln(w, "\n  The text must be enclosed in delimiters (any character can be used as the delimiter).")
+			fmt.Fprintf(w, "\n  Example: 2,4%s/# / comments out lines 2-4.\n", commandInsertText)
 		case commandChange:
-			fmt.Println(" ", commandChange, "Changes lines in the buffer.")
-			fmt.Println("\n  Ex.: 2-4c      changes lines 2-4.")
+			fmt.Fprintln(w, " ", commandChange, "Changes lines in the buffer.")
+			fmt.Fprintln(w, "\n  The addressed lines are replaced by the text entered in input mode. If no text is entered, they are deleted.")
+			fmt.Fprintln(w, "  A line containing only a fullstop can be entered as \\. (a backslash is removed from such a line).")
+			fmt.Fprintln(w, "\n  Ex.: 2-4c      changes lines 2-4.")
+			fmt.Fprintf(w, "  As for '%s', the deleted lines can be stored in a register (e.g. 2,4%s \"a).\n", commandDelete, commandChange)
+		case commandCount:
+			fmt.Fprintln(w, " ", commandCount, "Counts the lines, words, characters and bytes in the addressed lines.")
+			fmt.Fprintln(w, "\n  If no address is given, the whole buffer is counted.")
+			fmt.Fprintln(w, "  The output format is: lines=<n> words=<n> runes=<n> bytes=<n>")
+			fmt.Fprintf(w, "\n  %s/re/ counts the lines matching the regular expression 're' and the number of matches instead.\n", commandCount)
+			fmt.Fprintln(w, "  The output format is then: lines=<n> matches=<n>")
+			fmt.Fprintf(w, "\n  Example: 2,$%s/TODO/ counts the TODOs from line 2 onwards.\n", commandCount)
 		case commandDelete:
-			fmt.Println(" ", commandDelete, "Deletes lines from the buffer.")
+			fmt.Fprintln(w, " ", commandDelete, "Deletes lines from the buffer.")
+			fmt.Fprintln(w, "\n  The deleted lines are stored in the cut-buffer, or in a register if one is given (\"a to \"z).")
+			fmt.Fprintln(w, "  An upper-case name (\"A to \"Z) appends the deleted lines to the register.")
+			fmt.Fprintf(w, "\n  Example: g/TODO/%s \"A collects all lines containing 'TODO' in the register 'a'.\n", commandDelete)
+		case commandDiff:
+			fmt.Fprintln(w, " ", commandDiff, "Shows the differences between a file and the buffer.")
+			fmt.Fprintln(w, "\n  The differences are shown as a unified diff, i.e. what a 'w' would change in the file.")
+			fmt.Fprintln(w, "  The file defaults to the default filename. Nothing is printed if there are no differences.")
+			fmt.Fprintf(w, "\n  Example: %s !git show HEAD:file.txt compares the buffer with the committed version of the file.\n", commandDiff)
 		case commandEdit, commandEditUnconditionally:
-			fmt.Println(" ", commandEdit, "Edits (reads in) file, if there are no current unsaved changes.")
-			fmt.Println(" ", commandEditUnconditionally, "Edits (reads in) file regardless of any currently unsaved changes.")
-		case commandFilename:
-			fmt.Println(" ", commandFilename, "Sets the default filename.")
+			fmt.Fprintln(w, " ", commandEdit, "Edits (reads in) file, if there are no current unsaved changes.")
+			fmt.Fprintln(w, " ", commandEditUnconditionally, "Edits (reads in) file regardless of any currently unsaved changes.")
+			fmt.Fprintf(w, "\n  If there are unsaved changes, '%s' reports an error, but edits the file if it is repeated immediately.\n", commandEdit)
+			fmt.Fprintf(w, "\n  Example: %s !ls reads the output of the shell command 'ls' into the buffer.\n", commandEdit)
+			fmt.Fprintln(w, "\n  With the setting 'largefiles' (see -large), the lines of the file are only read when they are accessed.")
+		case commandFilename, commandNextFile, commandPreviousFile:
+			fmt.Fprintln(w, " ", commandFilename, "Sets the default filename.")
+			fmt.Fprintln(w, " ", commandNextFile, "Edits the next file given on the command line.")
+			fmt.Fprintln(w, " ", commandPreviousFile, "Edits the previous file given on the command line.")
+			fmt.Fprintf(w, "\n  If there are unsaved changes, '%s' and '%s' do nothing, unless followed by '!' (e.g. %s!).\n",
+				commandNextFile, commandPreviousFile, commandNextFile)
+		case commandDOS, commandUnix:
+			fmt.Fprintln(w, " ", commandDOS, "Writes the buffer with DOS line endings (CR LF).")
+			fmt.Fprintln(w, " ", commandUnix, "Writes the buffer with Unix line endings (LF).")
+			fmt.Fprintln(w, "\n  By default a file is written with the line endings it had when read.")
+		case commandReflow:
+			fmt.Fprintln(w, " ", commandReflow, "Reformats (rewraps) the addressed lines to a maximum line length.")
+			fmt.Fprintln(w, "\n  Paragraphs are separated by blank lines. The indentation of the first line of a paragraph is preserved.")
+			fmt.Fprintln(w, "  The line length defaults to 72 and can be set with the command-line flag '-width'.")
+			fmt.Fprintf(w, "\n  Example: 2,8%s60 rewraps lines 2-8 so that no line is longer than 60 characters.\n", commandReflow)
+			fmt.Fprintf(w, "  Example: 2,8%s /# / rewraps the comment in lines 2-8, keeping '# ' at the start of each line.\n", commandReflow)
 		case commandGlobal, commandGlobalInteractive, commandInverseGlobal, commandInverseGlobalInteractive:
-			fmt.Println(" ", commandGlobal, "Executes the command-list for all matching lines.")
-			fmt.Println(" ", commandGlobalInteractive, "Interactive 'global'.")
-			fmt.Println(" ", commandInverseGlobal, "As 'global' but acts on all lines NOT matching the regex.")
-			fmt.Println(" ", commandInverseGlobalInteractive, "Interactive 'inverse-global'.")
-		case commandHelp:
-			fmt.Println(" ", commandHelp, "Displays this help")
+			fmt.Fprintln(w, " ", commandGlobal, "Executes the command-list for all matching lines.")
+			fmt.Fprintln(w, " ", commandGlobalInteractive, "Interactive 'global'.")
+			fmt.Fprintln(w, " ", commandInverseGlobal, "As 'global' but acts on all lines NOT matching the regex.")
+			fmt.Fprintln(w, " ", commandInverseGlobalInteractive, "Interactive 'inverse-global'.")
+		case commandGrep:
+			fmt.Fprintln(w, " ", commandGrep, "Prints the lines matching a regular expression, with their line numbers.")
+			fmt.Fprintf(w, "\n  As '%s/re/%s', but the buffer is only read: nothing is changed and there is nothing to undo.\n", commandGlobal, commandNumber)
+			fmt.Fprintln(w, "  If no address is given, the whole buffer is searched. When printing to a terminal, the matches are highlighted.")
+			fmt.Fprintf(w, "\n  Example: %s /TODO/ lists the lines containing TODO.\n", commandGrep)
+			fmt.Fprintln(w, " ", commandHelp, "Explains the last error.")
+			fmt.Fprintln(w, " ", commandVerboseErrors, "Toggles verbose error messages.")
+			fmt.Fprintln(w, " ", commandHelpLong, "Displays this help.")
+			fmt.Fprintln(w, "\n  After an error, only '?' is printed, unless verbose error messages have been switched on")
+			fmt.Fprintln(w, "  with the command 'H' or the command-line flag '-v'.")
+		case commandAlias, commandUnalias:
+			fmt.Fprintln(w, " ", commandAlias, "Shows or defines command aliases.")
+			fmt.Fprintln(w, " ", commandUnalias, "Removes an alias.")
+			fmt.Fprintf(w, "\n  %s lists the aliases, %s name shows one alias, %s name = commands defines an alias.\n", commandAlias, commandAlias, commandAlias)
+			fmt.Fprintf(w, "  The commands of an alias are separated by '%s' (write '\\%s' for a '%s' within a command).\n", aliasSeparator, aliasSeparator, aliasSeparator)
+			fmt.Fprintln(w, "  An alias is used when the whole command line is its name; it may use other aliases, but not itself.")
+			fmt.Fprintln(w, "  The commands of an alias are undone together.")
+			fmt.Fprintf(w, "\n  Example: %s wq! = w | Q writes the buffer and quits when 'wq!' is entered.\n", commandAlias)
+			fmt.Fprintf(w, "  Aliases can also be defined in the configuration file, e.g. '%s dd = .d'.\n", commandAlias)
+		case commandOpenBuffer, commandListBuffers, commandSwitchBuffer:
+			fmt.Fprintln(w, " ", commandOpenBuffer, "Opens a file in a new buffer.")
+			fmt.Fprintln(w, " ", commandListBuffers, "Lists the buffers.")
+			fmt.Fprintln(w, " ", commandSwitchBuffer, "Switches to another buffer.")
+			fmt.Fprintf(w, "\n  %s file reads the file into a new buffer (or switches to the buffer if the file is already open).\n", commandOpenBuffer)
+			fmt.Fprintf(w, "  %s lists each buffer with its number, filename and number of lines; '%%' flags the current buffer, '+' unsaved changes.\n", commandListBuffers)
+			fmt.Fprintf(w, "  %s n (or %s file) makes buffer n the current buffer.\n", commandSwitchBuffer, commandSwitchBuffer)
+			fmt.Fprintln(w, "\n  Each buffer has its own current line, marks, undo list and default filename.")
+			fmt.Fprintf(w, "  Lines are copied between buffers with '%s' and '%s', since the cut buffer and the registers are shared.\n", commandYank, commandPut)
+			fmt.Fprintf(w, "  A whole buffer is inserted with '%s #n' or '%s #n'.\n", commandRead, commandPut)
+			fmt.Fprintf(w, "  '%s' refuses to quit whilst any buffer has unsaved changes.\n", commandQuit)
+		case commandHistory:
+			fmt.Fprintln(w, " ", commandHistory, "Prints the command lines entered at the prompt.")
+			fmt.Fprintf(w, "\n  %s n prints the last n command lines.\n", commandHistory)
+			fmt.Fprintln(w, "  When editing a command line, the cursor keys up and down recall previous command lines,")
+			fmt.Fprintln(w, "  and Ctrl-R searches for a previous command line. The history is kept in ~/.red_history.")
 		case commandInsert:
-			fmt.Println(" ", commandInsert, "Inserts text before the addressed line.")
-			fmt.Println("\n  Text is entered in input mode, i.e. any number of lines, terminated by a fullstop on its own line.")
-			fmt.Println("  Specifying the address '0' (zero) adds the entered text at the beginning of the buffer.")
+			fmt.Fprintln(w, " ", commandInsert, "Inserts text before the addressed line.")
+			fmt.Fprintln(w, "\n  Text is entered in input mode, i.e. any number of lines, terminated by a fullstop on its own line.")
+			fmt.Fprintln(w, "  A line containing only a fullstop can be entered as \\. (a backslash is removed from such a line).")
+			fmt.Fprintln(w, "  Specifying the address '0' (zero) adds the entered text at the beginning of the buffer.")
+			fmt.Fprintln(w, "  If no text is entered, the buffer is unchanged, and the addressed line becomes the current line.")
 		case commandJoin:
-			fmt.Println(" ", commandJoin, "Joins the addressed lines, replacing them by a single line containing the joined text.")
-			fmt.Printf("\n  Example: 2,4%s will replace the contents of line 2 with the text of lines 2-4.\n", commandJoin)
-			fmt.Println("  (Newlines are replaced by spaces)")
-		case commandMark:
-			fmt.Println(" ", commandMark, "Marks the given line.")
-			fmt.Println("\n  The mark 'a' can be referred to in an address using the syntax 'a.")
+			fmt.Fprintln(w, " ", commandJoin, "Joins the addressed lines, replacing them by a single line containing the joined text.")
+			fmt.Fprintf(w, "\n  Example: 2,4%s will replace the contents of line 2 with the text of lines 2-4.\n", commandJoin)
+			fmt.Fprintln(w, "  As in ed, the lines are concatenated without a separator, unless a separator has been configured")
+			fmt.Fprintln(w, "  with the command-line flag '-joinsep' or the setting 'joinsep' (e.g. set joinsep=\" \").")
+			fmt.Fprintf(w, "\n  Suffixes: %s+ joins with a space, %s- joins without a separator, %s/sep/ joins with the separator 'sep'.\n", commandJoin, commandJoin, commandJoin)
+			fmt.Fprintln(w, "  With the command-line flag '-J', a single address joins the addressed line with the following line.")
+			fmt.Fprintf(w, "\n  Print suffixes can follow, e.g. 2,4%s+p prints the joined line.\n", commandJoin)
+		case commandMark, commandMarks, commandDeleteMarks:
+			fmt.Fprintln(w, " ", commandMark, "Marks the given line.")
+			fmt.Fprintln(w, " ", commandMarks, "Lists the marks.")
+			fmt.Fprintln(w, " ", commandDeleteMarks, "Deletes marks.")
+			fmt.Fprintln(w, "\n  The mark 'a' can be referred to in an address using the syntax 'a.")
+			fmt.Fprintf(w, "  With an address range, e.g. 1,5%sa, the last line of the range is marked.\n", commandMark)
+			fmt.Fprintf(w, "\n  %s prints each mark with its line number and the contents of the line, %s ab only the marks 'a' and 'b'.\n", commandMarks, commandMarks)
+			fmt.Fprintf(w, "  %s ab deletes the marks 'a' and 'b', %s! deletes all marks.\n", commandDeleteMarks, commandDeleteMarks)
 		case commandMove:
-			fmt.Println(" ", commandMove, "Moves lines in the buffer.")
-			fmt.Println("\n  The addressed lines are moved to after the destination address.")
-			fmt.Println("  Specifying the destination address '0' (zero) moves the addressed lines to the beginning of the buffer.")
-			fmt.Printf("\n  Example: 2,4%s5 moves lines 2-4 to after line 5.\n", commandMove)
+			fmt.Fprintln(w, " ", commandMove, "Moves lines in the buffer.")
+			fmt.Fprintln(w, "\n  The addressed lines are moved to after the destination address.")
+			fmt.Fprintln(w, "  Specifying the destination address '0' (zero) moves the addressed lines to the beginning of the buffer.")
+			fmt.Fprintf(w, "\n  Example: 2,4%s5 moves lines 2-4 to after line 5.\n", commandMove)
 		case commandList, commandNumber, commandPrint:
-			fmt.Println(" ", commandList, "Display the addressed lines.")
-			fmt.Println(" ", commandNumber, "Prints the addressed lines with their line numbers.")
-			fmt.Println(" ", commandPrint, "Prints the addressed lines.")
+			fmt.Fprintln(w, " ", commandList, "Prints the addressed lines unambiguously.")
+			fmt.Fprintln(w, " ", commandNumber, "Prints the addressed lines with their line numbers.")
+			fmt.Fprintln(w, " ", commandPrint, "Prints the addressed lines.")
+			fmt.Fprintf(w, "\n  %s marks the end of each line with '$', prints tabs, backslashes and other special characters\n", commandList)
+			fmt.Fprintln(w, "  as escape sequences (e.g. \\t, \\\\, \\$, \\033), and folds lines longer than 72 characters.")
+			fmt.Fprintln(w, "  If the file did not end with a newline, the last line is shown without '$' (and is written without a newline).")
+			fmt.Fprintln(w, "\n  With the command-line flag '-hl', the current line is marked with '>' when printed.")
+			fmt.Fprintln(w, "  When printing to a terminal, line numbers are coloured, as are the matches of a search (e.g. /re/n).")
+			fmt.Fprintln(w, "  This is controlled by the command-line flag '-color' or 'set color=auto|always|never'.")
+			fmt.Fprintln(w, "\n  These commands can also be given as suffixes to the commands a, c, d, i, j, m, t, u, U, x and X,")
+			fmt.Fprintln(w, "  in which case the current line is printed after the command has been executed.")
+			fmt.Fprintln(w, "  Example: 3d p deletes line 3 and prints the new current line.")
+		case commandNumberLines:
+			fmt.Fprintln(w, " ", commandNumberLines, "Inserts the line number at the start of each addressed line.")
+			fmt.Fprintln(w, "\n  Optionally a printf-style format can be given, enclosed in delimiters.")
+			fmt.Fprintln(w, "  By default the line number is followed by a tab.")
+			fmt.Fprintf(w, "\n  Example: 1,$%s/%%03d: / prefixes each line with its line number, e.g. '001: '.\n", commandNumberLines)
 		case commandPrompt:
-			fmt.Println(" ", commandPrompt, "Sets the prompt.")
+			fmt.Fprintln(w, " ", commandPrompt, "Sets the prompt.")
 		case commandQuit, commandQuitUnconditionally:
-			fmt.Println(" ", commandQuit, "Quits the editor if there are no unsaved changes.")
-			fmt.Println(" ", commandQuitUnconditionally, "Quits the editor without saving.")
+			fmt.Fprintln(w, " ", commandQuit, "Quits the editor if there are no unsaved changes.")
+			fmt.Fprintln(w, " ", commandQuitUnconditionally, "Quits the editor without saving.")
+			fmt.Fprintf(w, "\n  If there are unsaved changes, '%s' reports an error, but quits if it is repeated immediately.\n", commandQuit)
 		case commandRead:
-			fmt.Println(" ", commandRead, "Reads a file and appends it after the addressed line.")
-			fmt.Println("\n  Specifying the address '0' (zero) adds the file's contents at the beginning of the buffer.")
-			fmt.Printf("\n  Example: 2%s myfile.txt appends the contents of myfile.txt after line 2.\n", commandRead)
+			fmt.Fprintln(w, " ", commandRead, "Reads a file and appends it after the addressed line.")
+			fmt.Fprintln(w, "\n  Specifying the address '0' (zero) adds the file's contents at the beginning of the buffer.")
+			fmt.Fprintf(w, "\n  Example: 2%s myfile.txt appends the contents of myfile.txt after line 2.\n", commandRead)
+			fmt.Fprintf(w, "  Example: %s !date appends the output of the shell command 'date' at the end of the buffer.\n", commandRead)
+			fmt.Fprintf(w, "  Example: 0%s #2 inserts the lines of buffer 2 (see '%s') at the beginning of the buffer.\n", commandRead, commandListBuffers)
+		case commandRevert:
+			fmt.Fprintln(w, " ", commandRevert, "Reloads the default file, discarding all changes.")
+			fmt.Fprintf(w, "\n  Unlike '%s', the buffer is always replaced by the file it was read from, and the current line is kept.\n", commandEditUnconditionally)
+			fmt.Fprintln(w, "  The changes cannot be undone.")
+		case commandReverse:
+			fmt.Fprintln(w, " ", commandReverse, "Reverses the order of the addressed lines.")
+			fmt.Fprintln(w, "\n  If no address is given, the whole buffer is reversed. Marks move with their lines.")
+		case commandSort:
+			fmt.Fprintln(w, " ", commandSort, "Sorts the addressed lines.")
+			fmt.Fprintln(w, "\n  If no address is given, the whole buffer is sorted. Marks move with their lines.")
+			fmt.Fprintln(w, "  The argument 'n' sorts by the first number in each line (lines without a number come first).")
+			fmt.Fprintf(w, "  '%s!' sorts in descending order.\n", commandSort)
+			fmt.Fprintf(w, "\n  Example: 2,9%s! n sorts lines 2-9 numerically, largest first.\n", commandSort)
+		case commandUniq:
+			fmt.Fprintln(w, " ", commandUniq, "Removes adjacent duplicate lines from the addressed lines.")
+			fmt.Fprintln(w, "\n  If no address is given, the whole buffer is processed.")
+			fmt.Fprintf(w, "\n  Example: %s followed by %s removes all duplicate lines.\n", commandSort, commandUniq)
 		case commandSubstitute:
-			fmt.Println(" ", commandSubstitute, "Replaces text in lines matching a regular expression.")
-			fmt.Println("\n  Allowed suffixes are: 'g' global, 'count', or 'l', 'n', or 'p'.")
-			fmt.Println("  The 'count' suffix causes only the 'count'th match to be replaced.")
-			fmt.Printf("\n  Example: 2,4%s/re/replacement/g replaces all matches of regex 're' with 'replacement' in lines 2-4.\n", commandSubstitute)
+			fmt.Fprintln(w, " ", commandSubstitute, "Replaces text in lines matching a regular expression.")
+			fmt.Fprintln(w, "\n  Allowed suffixes are: 'g' global, 'count', 'I', or 'l', 'n', or 'p'.")
+			fmt.Fprintln(w, "  The 'count' suffix causes only the 'count'th match to be replaced.")
+			fmt.Fprintln(w, "  The 'I' suffix causes the regular expression to match case-insensitively.")
+			fmt.Fprintln(w, "\n  In the replacement, '&' stands for the matched text and \\1 .. \\9 for the text matched by the groups (...).")
+			fmt.Fprintln(w, "  A backslash removes the special meaning of the following character, e.g. \\& for a literal '&'.")
+			fmt.Fprintln(w, "  A replacement consisting of a single '%' uses the replacement of the previous substitution.")
+			fmt.Fprintln(w, "  A newline escaped by a backslash (i.e. a line ending in '\\', continued on the next line) splits the line.")
+			fmt.Fprintf(w, "\n  %s without a regular expression repeats the previous substitution. Allowed suffixes are:\n", commandSubstitute)
+			fmt.Fprintln(w, "  'g' toggles the global suffix, 'p' toggles printing, 'count' replaces the 'count'th match,")
+			fmt.Fprintln(w, "  and 'r' uses the regular expression of the last search instead.")
+			fmt.Fprintf(w, "\n  Example: 2,4%s/re/replacement/g replaces all matches of regex 're' with 'replacement' in lines 2-4.\n", commandSubstitute)
+		case commandSet:
+			fmt.Fprintln(w, " ", commandSet, "Shows or changes the editor options.")
+			fmt.Fprintf(w, "\n  %s (or %s %s) prints all options, %s name prints one option, and %s name=value changes it.\n", commandSet, commandSet, setAll, commandSet, commandSet)
+			fmt.Fprintln(w, "  A value may be enclosed in double quotes, e.g. set prompt=\"> \". The options are:")
+			for _, s := range settings {
+				fmt.Fprintf(w, "    %-12s %s\n", s.name, s.description)
+			}
+			fmt.Fprintln(w, "\n  The options can also be set in the configuration file ~/.redrc.")
 		case commandTransfer:
-			fmt.Println(" ", commandTransfer, "Copies (transfers) lines to a destination address.")
+			fmt.Fprintln(w, " ", commandTransfer, "Copies (transfers) lines to a destination address.")
+		case commandRetab:
+			fmt.Fprintln(w, " ", commandRetab, "Converts the indentation of the addressed lines between tabs and spaces.")
+			fmt.Fprintln(w, "\n  Allowed arguments are: 's' tabs to spaces (the default), or 't' spaces to tabs.")
+			fmt.Fprintln(w, "  A trailing '!' converts whitespace in the rest of the line as well, not just the indentation.")
+			fmt.Fprintln(w, "  The width of a tab stop can be set with the command-line flag '-t' or with 'set tabstop=n'.")
+			fmt.Fprintln(w, "  The number of lines changed is reported.")
+			fmt.Fprintf(w, "\n  Example: 2,4%st converts leading spaces in lines 2-4 to tabs.\n", commandRetab)
 		case commandUndo:
-			fmt.Println(" ", commandUndo, "Undoes the effect of the last command that modified anything in the buffer.")
-		case commandWrite, commandWriteAppend, "wq":
-			fmt.Println(" ", commandWrite, "Writes the addressed lines to a file.")
-			fmt.Println(" ", "wq", "Writes the addressed lines to a file and exits the program.")
-			fmt.Println(" ", commandWriteAppend, "Appends the addressed lines to a file.")
-			fmt.Printf("\n  Example: 2,4%s rjo.1 writes lines 2-4 to the file 'rjo.1'.\n", commandWrite)
-		case commandPut, commandYank:
-			fmt.Println(" ", commandPut, "Puts (inserts) the cut-buffer after the addressed line.")
-			fmt.Println(" ", commandYank, "Copies (yanks) the addressed lines to the cut-buffer.")
+			fmt.Fprintln(w, " ", commandUndo, "Undoes the effect of the last command that modified anything in the buffer.")
+			fmt.Fprintln(w, "\n  Repeated undo commands undo the commands before that, one at a time.")
+			fmt.Fprintln(w, "  With the command-line flag '-undotoggle', only the last command can be undone, and a second undo undoes the undo.")
+		case commandRedo:
+			fmt.Fprintln(w, " ", commandRedo, "Redoes the changes undone by the last undo command.")
+			fmt.Fprintln(w, "\n  Repeated redo commands redo the undone commands one at a time.")
+			fmt.Fprintln(w, "  Any other change to the buffer means that undone commands can no longer be redone.")
+		case commandWrite, commandWriteAppend, commandWriteQuit, commandWriteAppendQuit:
+			fmt.Fprintln(w, " ", commandWrite, "Writes the addressed lines to a file.")
+			fmt.Fprintln(w, " ", commandWriteQuit, "Writes the addressed lines to a file and exits the program.")
+			fmt.Fprintln(w, " ", commandWriteAppend, "Appends the addressed lines to a file.")
+			fmt.Fprintln(w, " ", commandWriteAppendQuit, "Appends the addressed lines to a file and exits the program.")
+			fmt.Fprintf(w, "\n  Example: 2,4%s rjo.1 writes lines 2-4 to the file 'rjo.1'.\n", commandWrite)
+			fmt.Fprintf(w, "  Example: %s !wc -l writes the buffer to the standard input of the shell command 'wc -l'.\n", commandWrite)
+		case commandPut, commandPutBefore, commandYank:
+			fmt.Fprintln(w, " ", commandPut, "Puts (inserts) the cut-buffer after the addressed line.")
+			fmt.Fprintln(w, " ", commandPutBefore, "Puts (inserts) the cut-buffer before the addressed line.")
+			fmt.Fprintln(w, " ", commandYank, "Copies (yanks) the addressed lines to the cut-buffer.")
+			fmt.Fprintln(w, "\n  Each command can be followed by the name of a register (\"a to \"z), which is then used instead of the cut-buffer.")
+			fmt.Fprintln(w, "  An upper-case name (\"A to \"Z) appends the yanked lines to the register.")
+			fmt.Fprintf(w, "\n  Example: 1,3%s \"a copies lines 1-3 to the register 'a'; %s \"a puts them after the current line.\n", commandYank, commandPut)
+			fmt.Fprintf(w, "\n  %s #n and %s #n put all the lines of buffer n (see '%s').\n", commandPut, commandPutBefore, commandListBuffers)
 		case commandScroll:
-			fmt.Println(" ", commandScroll, "Scrolls n lines starting at the addressed line.")
-			fmt.Println("  The value for 'n' defaults to the window size and can be reset with this command:")
-			fmt.Printf("\n  Example 1: 2%s5 sets the window size to 5 and displays lines 2..7.\n", commandScroll)
-			fmt.Printf("  Example 2: 2%s displays <window-size> lines, starting at line 2.\n", commandScroll)
+			fmt.Fprintln(w, " ", commandScroll, "Scrolls n lines starting at the addressed line.")
+			fmt.Fprintln(w, "  The value for 'n' defaults to the window size and can be reset with this command:")
+			fmt.Fprintln(w, "  (The initial window size can be set with the command-line flag '-w', otherwise the screen size minus two lines is used,")
+			fmt.Fprintln(w, "  following the terminal when it is resized. If the screen size is unknown, the window size is 22 (previously 15), as for ed.)")
+			fmt.Fprintf(w, "\n  Example 1: 2%s5 sets the window size to 5 and displays lines 2..7.\n", commandScroll)
+			fmt.Fprintf(w, "  Example 2: 2%s displays <window-size> lines, starting at line 2.\n", commandScroll)
+			fmt.Fprintf(w, "  Example 3: %s=20 sets the window size to 20 without scrolling, %s= prints the window size.\n", commandScroll, commandScroll)
+		case commandPrintContext:
+			fmt.Fprintln(w, " ", commandPrintContext, "Prints the addressed lines with n lines of context before and after.")
+			fmt.Fprintln(w, "\n  If a regular expression is given, prints each matching line (by default in the whole buffer) with context.")
+			fmt.Fprintln(w, "  The value for 'n' defaults to 2. Groups of lines are separated by '--'.")
+			fmt.Fprintf(w, "\n  Example 1: 10%s3 displays lines 7..13.\n", commandPrintContext)
+			fmt.Fprintf(w, "  Example 2: %s/func/1 displays all lines containing 'func' with one line of context.\n", commandPrintContext)
 		case commandComment:
-			fmt.Println(" ", commandComment, "Enters a comment (i.e. the line is ignored)")
+			fmt.Fprintln(w, " ", commandComment, "Enters a comment (i.e. the line is ignored)")
 		case commandLinenumber:
-			fmt.Println(" ", commandLinenumber, "Prints the line number of the addressed line.")
+			fmt.Fprintln(w, " ", commandLinenumber, "Prints the line number of the addressed line.")
+			fmt.Fprintf(w, "\n  %s%s also prints the byte offset of the line in the file, and its length in bytes and runes,\n", commandLinenumber, linenumberOffsets)
+			fmt.Fprintln(w, "  in the format: line=<n> offset=<n> bytes=<n> runes=<n>")
+			fmt.Fprintln(w, "  The offset includes the line endings of the preceding lines (CR LF, if the file is written with DOS line endings).")
+			fmt.Fprintf(w, "\n  Example: /main/%s%s shows where the next line containing 'main' starts in the file.\n", commandLinenumber, linenumberOffsets)
+		case commandShell:
+			fmt.Fprintln(w, " ", commandShell, "Executes a command via the shell.")
+			fmt.Fprintln(w, "\n  The output of the command is printed, followed by a line containing '!'.")
+			fmt.Fprintln(w, "  An unescaped '%' in the command is replaced by the default filename.")
+			fmt.Fprintf(w, "  %s%s repeats the previous shell command.\n", commandShell, commandShell)
+			fmt.Fprintf(w, "\n  Example: %sls -l %% lists the default file.\n", commandShell)
+			fmt.Fprintln(w, "\n  With an address, the addressed lines are replaced by the output of the command, which reads them as its input.")
+			fmt.Fprintf(w, "  Example: 2,10%ssort sorts the lines 2-10. If the command fails, the buffer is unchanged.\n", commandShell)
+		case commandExtension:
+			fmt.Fprintln(w, " ", commandExtension, "Runs an extension on the addressed lines, replacing them by its result.")
+			fmt.Fprintf(w, "\n  %sname args runs the extension 'name' with the given arguments; %s alone lists the extensions.\n", commandExtension, commandExtension)
+			fmt.Fprintln(w, "  If no address is given, the whole buffer is processed. The replaced lines are stored in the cut-buffer.")
+			fmt.Fprintln(w, "  An extension is an external program, defined in the configuration file (e.g. 'extension upper = tr a-z A-Z'),")
+			fmt.Fprintln(w, "  which reads the lines on its standard input, or a Go function registered by a program embedding the editor.")
+			fmt.Fprintf(w, "\n  Example: 1,5%supper converts the lines 1-5 to upper case.\n", commandExtension)
+			fmt.Fprintf(w, "  (Within an alias, '%s' must be written as '\\%s'.)\n", commandExtension, commandExtension)
+		case commandIgnoreCase:
+			fmt.Fprintln(w, " ", commandIgnoreCase, "Toggles case-insensitive matching of all regular expressions.")
+			fmt.Fprintln(w, "\n  Case-insensitive matching can also be switched on with the command-line flag '-i',")
+			fmt.Fprintln(w, "  or for a single regular expression with the suffix 'I' (see 'help s' and 'help address').")
+		case commandShiftRight, commandShiftLeft:
+			fmt.Fprintln(w, " ", commandShiftRight, "Indents the addressed lines.")
+			fmt.Fprintln(w, " ", commandShiftLeft, "Outdents the addressed lines.")
+			fmt.Fprintln(w, "\n  The indentation is a tab, or a number of spaces set with 'set indent=n'. Empty lines are not indented.")
+			fmt.Fprintf(w, "  A count shifts the lines several times, as does repeating the command, e.g. %s%s is the same as %s2.\n", commandShiftRight, commandShiftRight, commandShiftRight)
+			fmt.Fprintf(w, "\n  Example: 2,4%s2 indents lines 2-4 by two levels.\n", commandShiftRight)
+		case commandTemplate:
+			fmt.Fprintln(w, " ", commandTemplate, "Inserts expanded template text after the addressed line.")
+			fmt.Fprintln(w, "\n  Either the name of a template or the text itself (enclosed in delimiters) can be given.")
+			fmt.Fprintln(w, "  Predefined templates are 'date', 'time' and 'datetime'.")
+			fmt.Fprintln(w, "  Further templates can be defined in the file ~/.red_templates (or the file given with '-templates'),")
+			fmt.Fprintln(w, "  one per line in the form 'name = text'.")
+			fmt.Fprintln(w, "  The placeholders {date}, {time}, {datetime}, {file} and {env:NAME} are expanded.")
+			fmt.Fprintln(w, "  The sequence \\n in the template starts a new line.")
+			fmt.Fprintf(w, "\n  Example: 0%s/Last changed: {date}/ inserts a line at the beginning of the buffer.\n", commandTemplate)
 		default:
-			return fmt.Errorf("Command '%s' not recognised. Enter '%s' for a list of all commands", subcmd, commandHelp)
+			return fmt.Errorf("%w: '%s'. Enter '%s' for a list of all commands", ErrUnrecognisedCommand, subcmd, commandHelpLong)
 		}
 	} else {
-		fmt.Println(" ", commandAppend, "Appends text after the addressed line.")
-		fmt.Println(" ", commandChange, "Changes lines in the buffer.")
-		fmt.Println(" ", commandDelete, "Deletes lines from the buffer.")
-		fmt.Println(" ", commandEdit, "Edits (reads in) file, if there are no current unsaved changes.")
-		fmt.Println(" ", commandEditUnconditionally, "Edits (reads in) file regardless of any currently unsaved changes.")
-		fmt.Println(" ", commandFilename, "Sets the default filename.")
-		fmt.Println(" ", commandGlobal, "Executes the command-list for all matching lines.")
-		fmt.Println(" ", commandGlobalInteractive, "Interactive 'global'.")
-		fmt.Println(" ", commandHelp, "Displays this help. (Specify another command to get help on that command)")
-		fmt.Println(" ", commandInsert, "Inserts text before the addressed line.")
-		fmt.Println(" ", commandJoin, "Joins the addressed lines, replacing them by a single line containing the joined text.")
-		fmt.Println(" ", commandMark, "Marks the given line.")
-		fmt.Println(" ", commandList, "Display the addressed lines.")
-		fmt.Println(" ", commandMove, "Moves lines in the buffer.")
-		fmt.Println(" ", commandNumber, "Prints the addressed lines with their line numbers.")
-		fmt.Println(" ", commandPrint, "Prints the addressed lines.")
-		fmt.Println(" ", commandPrompt, "Sets the prompt.")
-		fmt.Println(" ", commandQuit, "Quits the editor if there are no unsaved changes.")
-		fmt.Println(" ", commandQuitUnconditionally, "Quits the editor without saving changes.")
-		fmt.Println(" ", commandRead, "Reads file and appends it after the addressed line.")
-		fmt.Println(" ", commandSubstitute, "Replaces text in lines matching a regular expression.")
-		fmt.Println(" ", commandTransfer, "Copies (transfers) lines to a destination address.")
-		fmt.Println(" ", commandUndo, "Undoes the effect of the last command that modified anything in the buffer.")
-		fmt.Println(" ", commandInverseGlobal, "As 'global' but acts on all lines NOT matching the regex.")
-		fmt.Println(" ", commandInverseGlobalInteractive, "Interactive 'inverse-global'.")
-		fmt.Println(" ", commandWrite, "Writes the addressed lines to a file.")
-		fmt.Println(" ", commandWriteAppend, "Appends the addressed lines to a file.")
-		fmt.Println(" ", commandPut, "Puts (inserts) the cut-buffer after the addressed line.")
-		fmt.Println(" ", commandYank, "Copies (yanks) lines to the cut-buffer.")
-		fmt.Println(" ", commandScroll, "Scrolls n lines starting at the addressed line.")
-		fmt.Println(" ", commandComment, "Enters a comment (i.e. the line is ignored)")
-		fmt.Println(" ", commandLinenumber, "Prints the line number of the addressed line.")
-		fmt.Println("\nEnter h <cmd> for more help on a specific command.")
-		fmt.Println("Enter h address for help on addresses.")
+		fmt.Fprintln(w, " ", commandAppend, "Appends text after the addressed line.")
+		fmt.Fprintln(w, " ", commandAppendText, "Appends text to the end of each addressed line.")
+		fmt.Fprintln(w, " ", commandAlias, "Shows or defines command aliases.")
+		fmt.Fprintln(w, " ", commandChange, "Changes lines in the buffer.")
+		fmt.Fprintln(w, " ", commandCount, "Counts the lines, words, characters and bytes in the addressed lines.")
+		fmt.Fprintln(w, " ", commandDelete, "Deletes lines from the buffer.")
+		fmt.Fprintln(w, " ", commandDiff, "Shows the differences between a file and the buffer.")
+		fmt.Fprintln(w, " ", commandEdit, "Edits (reads in) file, if there are no current unsaved changes.")
+		fmt.Fprintln(w, " ", commandEditUnconditionally, "Edits (reads in) file regardless of any currently unsaved changes.")
+		fmt.Fprintln(w, " ", commandFilename, "Sets the default filename.")
+		fmt.Fprintln(w, " ", commandNextFile, "Edits the next file given on the command line.")
+		fmt.Fprintln(w, " ", commandPreviousFile, "Edits the previous file given on the command line.")
+		fmt.Fprintln(w, " ", commandDOS, "Writes the buffer with DOS line endings (CR LF).")
+		fmt.Fprintln(w, " ", commandUnix, "Writes the buffer with Unix line endings (LF).")
+		fmt.Fprintln(w, " ", commandReflow, "Reformats (rewraps) the addressed lines to a maximum line length.")
+		fmt.Fprintln(w, " ", commandGlobal, "Executes the command-list for all matching lines.")
+		fmt.Fprintln(w, " ", commandGlobalInteractive, "Interactive 'global'.")
+		fmt.Fprintln(w, " ", commandGrep, "Prints the lines matching a regular expression, with their line numbers.")
+		fmt.Fprintln(w, " ", commandHelp, "Explains the last error.")
+		fmt.Fprintln(w, " ", commandVerboseErrors, "Toggles verbose error messages.")
+		fmt.Fprintln(w, " ", commandHelpLong, "Displays this help. (Specify another command to get help on that command)")
+		fmt.Fprintln(w, " ", commandHistory, "Prints the command lines entered at the prompt.")
+		fmt.Fprintln(w, " ", commandInsert, "Inserts text before the addressed line.")
+		fmt.Fprintln(w, " ", commandInsertText, "Inserts text at the start of each addressed line.")
+		fmt.Fprintln(w, " ", commandJoin, "Joins the addressed lines, replacing them by a single line containing the joined text.")
+		fmt.Fprintln(w, " ", commandMark, "Marks the given line.")
+		fmt.Fprintln(w, " ", commandMarks, "Lists the marks.")
+		fmt.Fprintln(w, " ", commandDeleteMarks, "Deletes marks.")
+		fmt.Fprintln(w, " ", commandList, "Prints the addressed lines unambiguously.")
+		fmt.Fprintln(w, " ", commandListBuffers, "Lists the buffers.")
+		fmt.Fprintln(w, " ", commandMove, "Moves lines in the buffer.")
+		fmt.Fprintln(w, " ", commandNumber, "Prints the addressed lines with their line numbers.")
+		fmt.Fprintln(w, " ", commandOpenBuffer, "Opens a file in a new buffer.")
+		fmt.Fprintln(w, " ", commandNumberLines, "Inserts the line number at the start of each addressed line.")
+		fmt.Fprintln(w, " ", commandPrint, "Prints the addressed lines.")
+		fmt.Fprintln(w, " ", commandPrompt, "Sets the prompt.")
+		fmt.Fprintln(w, " ", commandQuit, "Quits the editor if there are no unsaved changes.")
+		fmt.Fprintln(w, " ", commandQuitUnconditionally, "Quits the editor without saving changes.")
+		fmt.Fprintln(w, " ", commandRead, "Reads file and appends it after the addressed line.")
+		fmt.Fprintln(w, " ", commandRevert, "Reloads the default file, discarding all changes.")
+		fmt.Fprintln(w, " ", commandReverse, "Reverses the order of the addressed lines.")
+		fmt.Fprintln(w, " ", commandSubstitute, "Replaces text in lines matching a regular expression.")
+		fmt.Fprintln(w, " ", commandSet, "Shows or changes the editor options.")
+		fmt.Fprintln(w, " ", commandSort, "Sorts the addressed lines.")
+		fmt.Fprintln(w, " ", commandSwitchBuffer, "Switches to another buffer.")
+		fmt.Fprintln(w, " ", commandTransfer, "Copies (transfers) lines to a destination address.")
+		fmt.Fprintln(w, " ", commandRetab, "Converts the indentation of the addressed lines between tabs and spaces.")
+		fmt.Fprintln(w, " ", commandUndo, "Undoes the effect of the last command that modified anything in the buffer.")
+		fmt.Fprintln(w, " ", commandRedo, "Redoes the changes undone by the last undo command.")
+		fmt.Fprintln(w, " ", commandUniq, "Removes adjacent duplicate lines from the addressed lines.")
+		fmt.Fprintln(w, " ", commandUnalias, "Removes an alias.")
+		fmt.Fprintln(w, " ", commandInverseGlobal, "As 'global' but acts on all lines NOT matching the regex.")
+		fmt.Fprintln(w, " ", commandInverseGlobalInteractive, "Interactive 'inverse-global'.")
+		fmt.Fprintln(w, " ", commandWrite, "Writes the addressed lines to a file.")
+		fmt.Fprintln(w, " ", commandWriteQuit, "Writes the addressed lines to a file and exits the program.")
+		fmt.Fprintln(w, " ", commandWriteAppend, "Appends the addressed lines to a file.")
+		fmt.Fprintln(w, " ", commandWriteAppendQuit, "Appends the addressed lines to a file and exits the program.")
+		fmt.Fprintln(w, " ", commandPut, "Puts (inserts) the cut-buffer after the addressed line.")
+		fmt.Fprintln(w, " ", commandPutBefore, "Puts (inserts) the cut-buffer before the addressed line.")
+		fmt.Fprintln(w, " ", commandYank, "Copies (yanks) lines to the cut-buffer.")
+		fmt.Fprintln(w, " ", commandScroll, "Scrolls n lines starting at the addressed line.")
+		fmt.Fprintln(w, " ", commandPrintContext, "Prints the addressed lines with n lines of context before and after.")
+		fmt.Fprintln(w, " ", commandComment, "Enters a comment (i.e. the line is ignored)")
+		fmt.Fprintln(w, " ", commandLinenumber, "Prints the line number of the addressed line.")
+		fmt.Fprintln(w, " ", commandTemplate, "Inserts expanded template text after the addressed line.")
+		fmt.Fprintln(w, " ", commandShell, "Executes a command via the shell.")
+		fmt.Fprintln(w, " ", commandIgnoreCase, "Toggles case-insensitive matching of all regular expressions.")
+		fmt.Fprintln(w, " ", commandShiftRight, "Indents the addressed lines.")
+		fmt.Fprintln(w, " ", commandShiftLeft, "Outdents the addressed lines.")
+		fmt.Fprintln(w, " ", commandExtension, "Runs an extension on the addressed lines, replacing them by its result.")
+		fmt.Fprintf(w, "\nEnter %s <cmd> for more help on a specific command.\n", commandHelpLong)
+		fmt.Fprintf(w, "Enter %s address for help on addresses.\n", commandHelpLong)
+	}
+	fmt.Fprintln(w)
+	return nil
+}
+
+/*
+ExplainLastError prints the message of the last error.
+
+ h
+
+ Nothing is printed if there has not been an error.
+ For compatibility, 'h' followed by a command is equivalent to 'help' for that command.
+*/
+func (cmd Command) ExplainLastError(state *State) error {
+	if strings.TrimSpace(cmd.restOfCmd) != "" {
+		return cmd.Help(state)
+	}
+	if state.LastError != nil {
+		fmt.Fprintln(state.Stdout, state.LastError)
+	}
+	return nil
+}
+
+/*
+ToggleVerboseErrors switches verbose error messages on or off.
+
+ H
+
+ When verbose error messages are switched on, the message of the last error (if any) is printed.
+*/
+func (cmd Command) ToggleVerboseErrors(state *State) error {
+	state.VerboseErrors = !state.VerboseErrors
+	if state.VerboseErrors && state.LastError != nil {
+		fmt.Fprintln(state.Stdout, state.LastError)
 	}
-	fmt.Println()
 	return nil
 }
+
+/*
+ReportError stores the error as the last error, and prints '?' followed (in verbose mode) by the error message.
+ In the messages mode 'tagged' (see ProgramFlags.Messages), the error message is always printed, as a single tagged line.
+*/
+func (state *State) ReportError(err error) {
+	state.LastError = err
+	if state.Messages == messagesTagged {
+		state.message(messageError, "%s", err)
+		return
+	}
+	state.message(messageError, "?")
+	if state.VerboseErrors {
+		state.message(messageError, "%s", err)
+	}
+}
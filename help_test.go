@@ -0,0 +1,101 @@
+package red
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseHelpCommands(t *testing.T) {
+	data := []struct {
+		cmdLine      string
+		expectedCmd  string
+		expectedRest string
+	}{
+		{"h", commandHelp, ""},
+		{"H", commandVerboseErrors, ""},
+		{"help", commandHelpLong, ""},
+		{"help s", commandHelpLong, "s"},
+		{"help  address ", commandHelpLong, "address"},
+		{"h s", commandHelp, "s"},
+		{"helpful", commandHelp, "elpful"},
+	}
+	for _, test := range data {
+		t.Run(fmt.Sprintf(">>%s<<", test.cmdLine), func(t *testing.T) {
+			cmd, err := ParseCommand(test.cmdLine, false)
+			if err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertString(t, "wrong command", cmd.cmd, test.expectedCmd)
+			assertString(t, "wrong rest of command", cmd.restOfCmd, test.expectedRest)
+		})
+	}
+}
+
+func TestExplainLastError(t *testing.T) {
+	state := resetState([]string{"1"})
+	var output bytes.Buffer
+	state.Stdout = &output
+
+	steps := []struct {
+		cmdLine        string
+		expectedOutput string
+	}{
+		{"h", ""}, // no error yet
+		{"H", ""},
+		{"H", ""},
+	}
+	for _, step := range steps {
+		output.Reset()
+		if err := processCommandLine(t, state, step.cmdLine); err != nil {
+			t.Fatalf("command '%s': error: %s", step.cmdLine, err)
+		}
+		assertString(t, "wrong output for "+step.cmdLine, output.String(), step.expectedOutput)
+	}
+
+	state.ReportError(ErrNothingToUndo)
+	assertString(t, "wrong output for non-verbose error", output.String(), "?\n")
+	if !errors.Is(state.LastError, ErrNothingToUndo) {
+		t.Fatalf("expected last error to be stored, got %v", state.LastError)
+	}
+	for _, step := range []struct {
+		cmdLine        string
+		expectedOutput string
+	}{
+		{"h", "nothing to undo\n"},
+		{"H", "nothing to undo\n"}, // verbose mode on
+	} {
+		output.Reset()
+		if err := processCommandLine(t, state, step.cmdLine); err != nil {
+			t.Fatalf("command '%s': error: %s", step.cmdLine, err)
+		}
+		assertString(t, "wrong output for "+step.cmdLine, output.String(), step.expectedOutput)
+	}
+	output.Reset()
+	state.ReportError(ErrNothingToRedo)
+	assertString(t, "wrong output for verbose error", output.String(), "?\nnothing to redo\n")
+}
+
+func TestHelpLongForm(t *testing.T) {
+	state := resetState([]string{"1"})
+	var output bytes.Buffer
+	state.Stdout = &output
+	if err := processCommandLine(t, state, "help"); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if !strings.Contains(output.String(), "Explains the last error.") {
+		t.Fatalf("expected command listing, got: %s", output.String())
+	}
+	output.Reset()
+	if err := processCommandLine(t, state, "help s"); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if !strings.Contains(output.String(), "Replaces text") {
+		t.Fatalf("expected help for 's', got: %s", output.String())
+	}
+	if err := processCommandLine(t, state, "help xyz"); err == nil {
+		t.Fatalf("expected error for unknown command")
+	}
+}
@@ -0,0 +1,163 @@
+package red
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// name of the history file in the user's home directory
+const historyFilename string = ".red_history"
+
+// the number of command lines kept in the history
+const defaultHistorySize int = 500
+
+var ErrInvalidHistoryCount error = errors.New("invalid number of history entries")
+
+/*
+History stores the command lines entered at the prompt, the oldest first.
+ The history is shown by the command 'history', and can be recalled when editing a command line
+ (see package terminal).
+*/
+type History struct {
+	entries    []string
+	MaxEntries int // the maximum number of entries, older entries are discarded
+}
+
+/*
+NewHistory creates an empty history which keeps at most 'maxEntries' command lines.
+*/
+func NewHistory(maxEntries int) *History {
+	return &History{MaxEntries: maxEntries}
+}
+
+/*
+Add adds a command line to the history.
+ Empty lines, lines consisting of several lines (e.g. a continued global command),
+ and repetitions of the previous command line are ignored.
+*/
+func (h *History) Add(cmdLine string) {
+	cmdLine = strings.TrimSuffix(cmdLine, "\n")
+	if strings.TrimSpace(cmdLine) == "" || strings.Contains(cmdLine, "\n") {
+		return
+	}
+	if len(h.entries) != 0 && h.entries[len(h.entries)-1] == cmdLine {
+		return
+	}
+	h.entries = append(h.entries, cmdLine)
+	if h.MaxEntries > 0 && len(h.entries) > h.MaxEntries {
+		h.entries = h.entries[len(h.entries)-h.MaxEntries:]
+	}
+}
+
+/*
+Len returns the number of entries in the history.
+*/
+func (h *History) Len() int {
+	return len(h.entries)
+}
+
+/*
+Entry returns the i'th entry of the history, 0 being the oldest.
+*/
+func (h *History) Entry(i int) string {
+	return h.entries[i]
+}
+
+/*
+Load adds the command lines read from 'reader' (one per line) to the history.
+*/
+func (h *History) Load(reader io.Reader) error {
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		h.Add(scanner.Text())
+	}
+	return scanner.Err()
+}
+
+/*
+Save writes the history to 'writer', one command line per line.
+*/
+func (h *History) Save(writer io.Writer) error {
+	w := bufio.NewWriter(writer)
+	for _, entry := range h.entries {
+		if _, err := fmt.Fprintln(w, entry); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+/*
+DefaultHistoryFile returns the name of the file '.red_history' in the user's home directory,
+or "" if the home directory is not known.
+*/
+func DefaultHistoryFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, historyFilename)
+}
+
+/*
+LoadHistoryFile adds the command lines stored in the given file to the history.
+ A file which does not exist is ignored.
+*/
+func (h *History) LoadHistoryFile(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	return h.Load(f)
+}
+
+/*
+SaveHistoryFile writes the history to the given file, replacing its contents.
+*/
+func (h *History) SaveHistoryFile(filename string) error {
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err = h.Save(f); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+/*
+PrintHistory prints the command lines entered at the prompt, numbered, the oldest first.
+
+ history [n]
+
+ If 'n' is given, only the last n command lines are printed.
+ The current address is unchanged.
+*/
+func (cmd Command) PrintHistory(state *State) error {
+	if err := cmd.validateAddress(state); err != nil {
+		return err
+	}
+	start := 0
+	if rest := strings.TrimSpace(cmd.restOfCmd); rest != "" {
+		n, err := strconv.Atoi(rest)
+		if err != nil || n < 0 {
+			return fmt.Errorf("%s: %w: '%s'", cmd.cmd, ErrInvalidHistoryCount, rest)
+		}
+		start = maxIntOf(state.History.Len()-n, 0)
+	}
+	for i := start; i < state.History.Len(); i++ {
+		fmt.Fprintf(state.Stdout, "%5d  %s\n", i+1, state.History.Entry(i))
+	}
+	return nil
+}
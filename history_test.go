@@ -0,0 +1,80 @@
+package red
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHistoryAdd(t *testing.T) {
+	history := NewHistory(3)
+	for _, cmdLine := range []string{"1p", "", "  ", "2p\n", "2p", "g/x/p\\\nd", "3p", "4p"} {
+		history.Add(cmdLine)
+	}
+	var output bytes.Buffer
+	if err := history.Save(&output); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertString(t, "wrong history", output.String(), "2p\n3p\n4p\n")
+}
+
+func TestHistoryFile(t *testing.T) {
+	dir, err := os.MkdirTemp("", "red-history")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, historyFilename)
+
+	history := NewHistory(10)
+	// a missing file is not an error
+	if err = history.LoadHistoryFile(filename); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	history.Add("1p")
+	history.Add("s/a/b/")
+	if err = history.SaveHistoryFile(filename); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	loaded := NewHistory(10)
+	if err = loaded.LoadHistoryFile(filename); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertInt(t, "wrong nbr of entries", loaded.Len(), 2)
+	assertString(t, "wrong entry", loaded.Entry(1), "s/a/b/")
+}
+
+func TestPrintHistory(t *testing.T) {
+	data := []struct {
+		cmdLine        string
+		expectedOutput string
+	}{
+		{"history", "    1  1p\n    2  2p\n    3  3p\n"},
+		{"history 2", "    2  2p\n    3  3p\n"},
+		{"history 5", "    1  1p\n    2  2p\n    3  3p\n"},
+		{"history 0", ""},
+	}
+	for _, test := range data {
+		state := resetState([]string{"a"})
+		for _, cmdLine := range []string{"1p", "2p", "3p"} {
+			state.History.Add(cmdLine)
+		}
+		var output bytes.Buffer
+		state.Stdout = &output
+		if err := processCommandLine(t, state, test.cmdLine); err != nil {
+			t.Fatalf("command '%s': error: %s", test.cmdLine, err)
+		}
+		assertString(t, "wrong output for "+test.cmdLine, output.String(), test.expectedOutput)
+	}
+	for _, cmdLine := range []string{"history x", "history -1", "1history"} {
+		state := resetState([]string{"a"})
+		if err := processCommandLine(t, state, cmdLine); err == nil {
+			t.Fatalf("command '%s': expected error", cmdLine)
+		}
+	}
+	if err := processCommandLine(t, resetState([]string{"a"}), "g/a/history"); err == nil || !strings.Contains(err.Error(), ErrNotAllowedInGlobalCommand.Error()) {
+		t.Fatalf("expected error for history in global command, got %v", err)
+	}
+}
@@ -0,0 +1,52 @@
+package red
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"sync/atomic"
+)
+
+var ErrInterrupted error = errors.New("interrupted")
+
+/*
+HandleInterrupt installs a handler for SIGINT (Ctrl-C), which then no longer terminates the program.
+
+ Instead, a running print, global or substitute command is aborted with an error,
+ so that the user returns to the command prompt. Any changes already made can be undone with 'u'.
+*/
+func HandleInterrupt(state *State) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	go func() {
+		for range signals {
+			state.Interrupt()
+		}
+	}()
+}
+
+/*
+Interrupt requests that the running command be aborted.
+It may be called from another goroutine.
+*/
+func (state *State) Interrupt() {
+	atomic.StoreInt32(&state.interrupted, 1)
+}
+
+/*
+ Returns ErrInterrupted if an interrupt has been requested (see Interrupt), and clears the request.
+ Long-running commands call this regularly and stop if an error is returned.
+*/
+func (state *State) checkInterrupt() error {
+	if atomic.CompareAndSwapInt32(&state.interrupted, 1, 0) {
+		return ErrInterrupted
+	}
+	return nil
+}
+
+/*
+ Clears any outstanding interrupt request.
+*/
+func (state *State) clearInterrupt() {
+	atomic.StoreInt32(&state.interrupted, 0)
+}
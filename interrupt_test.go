@@ -0,0 +1,77 @@
+package red
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+/*
+ A writer which requests an interrupt each time something is written, i.e. the command is interrupted
+ as soon as it produces output.
+*/
+type interruptingWriter struct {
+	state *State
+	bytes.Buffer
+}
+
+func (w *interruptingWriter) Write(p []byte) (int, error) {
+	w.state.Interrupt()
+	return w.Buffer.Write(p)
+}
+
+func TestInterruptPrint(t *testing.T) {
+	state := resetState([]string{"1", "2", "3", "4"})
+	state.lineNbr = 4
+	output := &interruptingWriter{state: state}
+	state.Stdout = output
+	if err := processCommandLine(t, state, "1,4p"); !errors.Is(err, ErrInterrupted) {
+		t.Fatalf("expected ErrInterrupted, got %v", err)
+	}
+	assertString(t, "wrong output", output.String(), "1\n")
+	assertInt(t, "wrong state.lineNbr!", state.lineNbr, 4)
+
+	// the next command is not affected
+	if err := processCommandLine(t, state, "2p"); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+}
+
+func TestInterruptGlobal(t *testing.T) {
+	state := resetState([]string{"1", "2", "3", "4"})
+	state.lineNbr = 1
+	state.Stdout = &interruptingWriter{state: state}
+	if err := processCommandLine(t, state, "g/./s/$/x/p"); !errors.Is(err, ErrInterrupted) {
+		t.Fatalf("expected ErrInterrupted, got %v", err)
+	}
+	assertBufferContents(t, state.Buffer, "1x\n2\n3\n4\n")
+	if err := processCommandLine(t, state, "u"); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertBufferContents(t, state.Buffer, "1\n2\n3\n4\n")
+}
+
+func TestInterruptSubstitute(t *testing.T) {
+	state := resetState([]string{"1", "2"})
+	state.lineNbr = 1
+	cmd, err := ParseCommand("1,2s/$/x/", false)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	state.Interrupt()
+	if err := cmd.CmdSubstitute(state); !errors.Is(err, ErrInterrupted) {
+		t.Fatalf("expected ErrInterrupted, got %v", err)
+	}
+	assertBufferContents(t, state.Buffer, "1\n2\n")
+}
+
+func TestInterruptBeforeCommandIsIgnored(t *testing.T) {
+	state := resetState([]string{"1", "2"})
+	var output bytes.Buffer
+	state.Stdout = &output
+	state.Interrupt()
+	if err := processCommandLine(t, state, "1,2p"); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertString(t, "wrong output", output.String(), "1\n2\n")
+}
@@ -0,0 +1,88 @@
+package red
+
+import (
+	"errors"
+	"fmt"
+)
+
+var errInvariantViolated error = errors.New("invariant violated")
+
+/*
+CheckInvariants checks the consistency of the given state, and returns an error describing the first inconsistency found.
+
+ The following is checked:
+  - the buffer, cut buffer and registers are present and only contain lines
+  - the current line number is within the buffer
+  - all marks are within the buffer
+  - the addresses of the next undo command can be resolved
+*/
+func CheckInvariants(state *State) error {
+	if state.Buffer == nil || state.CutBuffer == nil || state.undo == nil || state.redo == nil {
+		return fmt.Errorf("%w: buffer, cut buffer, undo or redo list is nil", errInvariantViolated)
+	}
+	for lineNbr := 1; lineNbr <= state.Buffer.Len(); lineNbr++ {
+		if line, err := state.Buffer.Get(lineNbr); err != nil || line == nil {
+			return fmt.Errorf("%w: buffer line %d is missing: %v", errInvariantViolated, lineNbr, err)
+		}
+	}
+	for el := state.CutBuffer.Front(); el != nil; el = el.Next() {
+		if _, ok := el.Value.(Line); !ok {
+			return fmt.Errorf("%w: cut buffer contains a non-line: %T", errInvariantViolated, el.Value)
+		}
+	}
+	for name, lines := range state.registers {
+		for el := lines.Front(); el != nil; el = el.Next() {
+			if _, ok := el.Value.(Line); !ok {
+				return fmt.Errorf("%w: register '%s' contains a non-line: %T", errInvariantViolated, name, el.Value)
+			}
+		}
+	}
+
+	// current line
+	bufferLen := state.Buffer.Len()
+	if state.lineNbr < 0 || state.lineNbr > bufferLen {
+		return fmt.Errorf("%w: current line %d is not within the buffer (%d lines)", errInvariantViolated, state.lineNbr, bufferLen)
+	}
+
+	// marks
+	for name, lineNbr := range state.marks {
+		if lineNbr < 1 || lineNbr > bufferLen {
+			return fmt.Errorf("%w: mark '%s' refers to line %d, buffer contains %d lines", errInvariantViolated, name, lineNbr, bufferLen)
+		}
+	}
+
+	// the next undo command, i.e. the last command of the most recent undo transaction
+	if state.undo.Len() != 0 {
+		transaction, ok := state.undo.Front().Value.(*undoTransaction)
+		if !ok {
+			return fmt.Errorf("%w: undo list contains a non-transaction: %T", errInvariantViolated, state.undo.Front().Value)
+		}
+		undo, ok := transaction.undos.Back().Value.(Undo)
+		if !ok {
+			return fmt.Errorf("%w: undo transaction contains a non-undo: %T", errInvariantViolated, transaction.undos.Back().Value)
+		}
+		if err := checkUndoIsResolvable(undo, state); err != nil {
+			return fmt.Errorf("%w: undo command '%s': %s", errInvariantViolated, undo.cmd.cmd, err)
+		}
+	}
+	return nil
+}
+
+/*
+ Checks that the addresses of the given undo command can be resolved against the current state.
+*/
+func checkUndoIsResolvable(undo Undo, state *State) error {
+	cmd := undo.cmd
+	if !cmd.addressIsResolved {
+		if err := cmd.resolveAddress(state); err != nil {
+			return err
+		}
+	}
+	if cmd.resolved.start > cmd.resolved.end {
+		return fmt.Errorf("start line %d > end line %d", cmd.resolved.start, cmd.resolved.end)
+	}
+	if cmd.resolved.start < 0 || cmd.resolved.end > state.Buffer.Len() {
+		return fmt.Errorf("lines %d..%d are not within the buffer (%d lines)", cmd.resolved.start, cmd.resolved.end, state.Buffer.Len())
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package red
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckInvariants(t *testing.T) {
+	state := resetState([]string{"a", "b", "c"})
+	if err := CheckInvariants(state); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if err := moveToLine(2, state); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	state.addMark("x", 3)
+	if err := CheckInvariants(state); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+}
+
+func TestCheckInvariantsViolated(t *testing.T) {
+	data := []struct {
+		name  string
+		setup func(state *State)
+	}{
+		{"line nbr too large", func(state *State) { state.lineNbr = 4 }},
+		{"line nbr negative", func(state *State) { state.lineNbr = -1 }},
+		{"mark out of range", func(state *State) { state.addMark("x", 4) }},
+		{"missing line", func(state *State) { state.Buffer.(*sliceBuffer).lines[1] = nil }},
+		{"not a line", func(state *State) { state.CutBuffer.PushBack("d") }},
+		{"undo not resolvable", func(state *State) { state.addUndo(2, 5, commandDelete, nil) }},
+	}
+	for _, test := range data {
+		t.Run(test.name, func(t *testing.T) {
+			state := resetState([]string{"a", "b", "c"})
+			if err := moveToLine(3, state); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			test.setup(state)
+			if err := CheckInvariants(state); !errors.Is(err, errInvariantViolated) {
+				t.Fatalf("expected invariant violation, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestCheckStateAfterEachCommand(t *testing.T) {
+	state := resetState([]string{"1", "2", "3", "4", "5"})
+	state.CheckState = true
+	if err := moveToLine(1, state); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	for _, cmdLine := range []string{"2ka", "3,4m0", "2,3t$", "1,2j", "4,5y", "1x", "2,3s/./x/", "1d", "u"} {
+		cmd, err := ParseCommand(cmdLine, false)
+		if err != nil {
+			t.Fatalf("command '%s': error: %s", cmdLine, err)
+		}
+		if _, err = cmd.ProcessCommand(state, nil, false); err != nil {
+			t.Fatalf("command '%s': error: %s", cmdLine, err)
+		}
+	}
+	assertBufferContents(t, state.Buffer, "34\nx\nx\n1\n2\n5\n4\n1\n")
+}
@@ -0,0 +1,370 @@
+package red
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var ErrOverwriteLargeFile error = errors.New("the file from which the buffer is read cannot be overwritten in place")
+
+// returned by openLargeFile if the file must be read as usual
+var errNotALargeFile error = errors.New("file cannot be read lazily")
+
+// the number of bytes read from a large file at once
+const largeFileWindowSize int = 64 * 1024
+
+/*
+ A file which can be read lazily, see largeFileBuffer.
+*/
+type largeFile interface {
+	fs.File
+	io.ReaderAt
+}
+
+/*
+largeFileBuffer stores the lines of a file which may be larger than memory (see ProgramFlags.LargeFiles).
+
+ The buffer only stores the position in the file of each line, and reads the lines from the file when they are accessed.
+ Only lines which are changed or inserted are kept in memory.
+ The file must therefore not be changed whilst it is being edited (a 'w' replaces it by a new file, see checkOverwrite).
+
+ A line read from the file is returned as a new Line each time it is accessed, i.e. it has no identity.
+ Lines which must be identifiable (i.e. the lines marked by 'g') are therefore kept in memory, see pin.
+*/
+type largeFileBuffer struct {
+	file           largeFile
+	lines          []fileLine
+	dos            bool   // whether lines ending with CR LF are to be returned with LF (see stripDOSLineEndings)
+	noFinalNewline bool   // whether the last line of the file does not end with a newline
+	window         []byte // the part of the file read last
+	windowOffset   int64  // the position of the window in the file
+	windowCapacity []byte // the memory used for the window
+}
+
+/*
+ A line of a largeFileBuffer: either the position of the line in the file, or the line itself.
+*/
+type fileLine struct {
+	offset int64 // position of the line in the file
+	length int   // length of the line in the file, including the line ending
+	line   *Line // the line, if it is kept in memory
+}
+
+/*
+ Opens the file and indexes its lines, returning a buffer which reads the lines lazily.
+ The number of bytes in the file is returned, and whether the file contains mixed line endings.
+
+ Returns errNotALargeFile if the file cannot be read lazily, i.e. a remote file, a file requiring a codec
+ (e.g. a '.gz' file), a file which is not UTF-8 (including a file starting with a byte order mark),
+ or a file whose file system does not support random access.
+*/
+func openLargeFile(fsys FileSystem, filename, defaultEncoding string) (buffer *largeFileBuffer, nbrBytesRead int, mixed bool, err error) {
+	if _, ok := findRemoteFiles(filename); ok {
+		return nil, 0, false, errNotALargeFile
+	}
+	enc, err := normaliseEncoding(defaultEncoding)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	if enc != encodingUTF8 {
+		return nil, 0, false, errNotALargeFile
+	}
+	f, err := fsys.Open(filename)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	file, ok := f.(largeFile)
+	if !ok {
+		f.Close()
+		return nil, 0, false, errNotALargeFile
+	}
+	reader := bufio.NewReader(file)
+	header, _ := reader.Peek(maxIntOf(maxMagicLength(), 4))
+	if findFileCodec(filename, header) != nil || hasByteOrderMark(header) {
+		file.Close()
+		return nil, 0, false, errNotALargeFile
+	}
+	buffer = &largeFileBuffer{file: file}
+	nbrDOS, nbrUnix, err := buffer.indexLines(reader)
+	if err != nil {
+		file.Close()
+		return nil, 0, false, err
+	}
+	buffer.dos = nbrDOS > nbrUnix
+	for _, line := range buffer.lines {
+		nbrBytesRead += line.length
+	}
+	return buffer, nbrBytesRead, nbrDOS > 0 && nbrUnix > 0, nil
+}
+
+func hasByteOrderMark(header []byte) bool {
+	for _, bom := range byteOrderMarks {
+		if bytes.HasPrefix(header, bom.bom) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ Reads the file, storing the position of each line. Returns the number of lines with DOS and with Unix line endings.
+*/
+func (b *largeFileBuffer) indexLines(reader *bufio.Reader) (nbrDOS, nbrUnix int, err error) {
+	var offset int64
+	var previous byte // the last byte of the previous part of a line
+	for err != io.EOF {
+		length := 0
+		var part []byte
+		for {
+			part, err = reader.ReadSlice('\n')
+			length += len(part)
+			if err != bufio.ErrBufferFull {
+				break
+			}
+			previous = part[len(part)-1]
+		}
+		if err != nil && err != io.EOF {
+			return 0, 0, err
+		}
+		if length == 0 {
+			continue
+		}
+		b.noFinalNewline = !bytes.HasSuffix(part, []byte(unixLineEnding))
+		if !b.noFinalNewline {
+			if bytes.HasSuffix(part, []byte(dosLineEnding)) || (len(part) == 1 && previous == dosLineEnding[0]) {
+				nbrDOS++
+			} else {
+				nbrUnix++
+			}
+		}
+		b.lines = append(b.lines, fileLine{offset: offset, length: length})
+		offset += int64(length)
+		previous = 0
+	}
+	return nbrDOS, nbrUnix, nil
+}
+
+/*
+ If large-file mode is on (see ProgramFlags.LargeFiles), opens the file to be edited by 'e' as a largeFileBuffer.
+ Returns a nil buffer if the file is to be read as usual, e.g. the output of a shell command or a compressed file.
+*/
+func (state *State) openLargeFileForEdit(potentialFilename string) (buffer *largeFileBuffer, nbrBytesRead int, mixed bool, err error) {
+	if !state.LargeFiles || isShellCommand(potentialFilename) {
+		return nil, 0, false, nil
+	}
+	if err = state.checkRestrictedFilename(potentialFilename); err != nil {
+		return nil, 0, false, err
+	}
+	filename, err := getFilename(potentialFilename, state, true)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	buffer, nbrBytesRead, mixed, err = openLargeFile(state.FileSystem, filename, state.Encoding)
+	if errors.Is(err, errNotALargeFile) {
+		return nil, 0, false, nil
+	}
+	return buffer, nbrBytesRead, mixed, err
+}
+
+/*
+ Returns an error if writing 'filename' would overwrite the file from which the lines are read.
+ This is the case if the file cannot be replaced atomically (see OSFileSystem), e.g. because it has further hard links,
+ or if 'inPlace' is set (see the setting 'inplace').
+ Other file systems are expected to replace a file, rather than to overwrite it.
+*/
+func (b *largeFileBuffer) checkOverwrite(fsys FileSystem, filename string, inPlace bool) error {
+	if fsys != OSFileSystem {
+		return nil
+	}
+	if target, err := filepath.EvalSymlinks(filename); err == nil {
+		filename = target
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		return nil
+	}
+	fileInfo, err := b.file.Stat()
+	if err != nil || !os.SameFile(info, fileInfo) {
+		return nil
+	}
+	if inPlace || !info.Mode().IsRegular() || hasHardLinks(info) {
+		return fmt.Errorf("%w: %s", ErrOverwriteLargeFile, filename)
+	}
+	return nil
+}
+
+/*
+ Returns the line, reading it from the file if it is not kept in memory.
+*/
+func (b *largeFileBuffer) read(l fileLine) (*Line, error) {
+	if l.line != nil {
+		return l.line, nil
+	}
+	data, err := b.readAt(l.offset, l.length)
+	if err != nil {
+		return nil, err
+	}
+	text := string(data)
+	if b.dos && strings.HasSuffix(text, dosLineEnding) {
+		text = strings.TrimSuffix(text, dosLineEnding) + unixLineEnding
+	}
+	// the last line of a file which does not end with a newline (see state.noFinalNewline)
+	if !strings.HasSuffix(text, unixLineEnding) {
+		text += unixLineEnding
+	}
+	return &Line{text}, nil
+}
+
+/*
+ Returns 'length' bytes of the file at 'offset'. The data is only valid until the next call.
+
+ The file is read in windows of largeFileWindowSize bytes, so that consecutive lines
+ (forwards, e.g. when printing, or backwards, e.g. for '?re?') are read with few system calls.
+*/
+func (b *largeFileBuffer) readAt(offset int64, length int) ([]byte, error) {
+	if length > largeFileWindowSize {
+		data := make([]byte, length)
+		if n, err := b.file.ReadAt(data, offset); n < length {
+			return nil, err
+		}
+		return data, nil
+	}
+	if offset < b.windowOffset || offset+int64(length) > b.windowOffset+int64(len(b.window)) {
+		start := offset
+		if offset < b.windowOffset {
+			// reading backwards
+			start = offset + int64(length) - int64(largeFileWindowSize)
+			if start < 0 {
+				start = 0
+			}
+		}
+		if b.windowCapacity == nil {
+			b.windowCapacity = make([]byte, largeFileWindowSize)
+		}
+		n, err := b.file.ReadAt(b.windowCapacity, start)
+		if n < int(offset-start)+length {
+			b.window = nil
+			if err == nil || err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, fmt.Errorf("reading line at offset %d: %w", offset, err)
+		}
+		b.window, b.windowOffset = b.windowCapacity[:n], start
+	}
+	pos := int(offset - b.windowOffset)
+	return b.window[pos : pos+length], nil
+}
+
+/*
+ A buffer whose lines are only identifiable by their pointers once they have been pinned, see largeFileBuffer.
+*/
+type linePinner interface {
+	pin(lineNbr int) (*Line, error)
+}
+
+/*
+ Keeps the line in memory, so that it can be identified by its pointer (as by 'g', see markMatchingLines).
+ Returns the line.
+*/
+func (b *largeFileBuffer) pin(lineNbr int) (*Line, error) {
+	if lineNbr < 1 || lineNbr > len(b.lines) {
+		return nil, errorInvalidLine(fmt.Sprintf("%d, max line: %d", lineNbr, len(b.lines)), nil)
+	}
+	line, err := b.read(b.lines[lineNbr-1])
+	if err != nil {
+		return nil, err
+	}
+	b.lines[lineNbr-1].line = line
+	return line, nil
+}
+
+/*
+ Closes the file. Called when the buffer is replaced, see replaceBuffer.
+*/
+func (b *largeFileBuffer) Close() error {
+	return b.file.Close()
+}
+
+func (b *largeFileBuffer) Len() int {
+	return len(b.lines)
+}
+
+func (b *largeFileBuffer) Get(lineNbr int) (*Line, error) {
+	if lineNbr < 1 || lineNbr > len(b.lines) {
+		return nil, errorInvalidLine(fmt.Sprintf("%d, max line: %d", lineNbr, len(b.lines)), nil)
+	}
+	return b.read(b.lines[lineNbr-1])
+}
+
+func (b *largeFileBuffer) Set(lineNbr int, line Line) error {
+	if lineNbr < 1 || lineNbr > len(b.lines) {
+		return errorInvalidLine(fmt.Sprintf("%d, max line: %d", lineNbr, len(b.lines)), nil)
+	}
+	b.lines[lineNbr-1] = fileLine{line: &line}
+	return nil
+}
+
+func (b *largeFileBuffer) InsertAfter(lineNbr int, lines *list.List) error {
+	if lineNbr < 0 || lineNbr > len(b.lines) {
+		return errorInvalidLine(fmt.Sprintf("%d, max line: %d", lineNbr, len(b.lines)), nil)
+	}
+	nbrLines := lines.Len()
+	if nbrLines == 0 {
+		return nil
+	}
+	newLines := make([]fileLine, 0, nbrLines)
+	for el := lines.Front(); el != nil; el = el.Next() {
+		line := el.Value.(Line)
+		newLines = append(newLines, fileLine{line: &line})
+	}
+	oldLen := len(b.lines)
+	// make room, then move the following lines up
+	b.lines = append(b.lines, newLines...)
+	copy(b.lines[lineNbr+nbrLines:], b.lines[lineNbr:oldLen])
+	copy(b.lines[lineNbr:], newLines)
+	return nil
+}
+
+func (b *largeFileBuffer) DeleteRange(startLineNbr, endLineNbr int) (*list.List, error) {
+	if err := checkLineRange(startLineNbr, endLineNbr, b); err != nil {
+		return nil, err
+	}
+	deleted := list.New()
+	for _, l := range b.lines[startLineNbr-1 : endLineNbr] {
+		line, err := b.read(l)
+		if err != nil {
+			return nil, err
+		}
+		deleted.PushBack(*line)
+	}
+	oldLen := len(b.lines)
+	b.lines = append(b.lines[:startLineNbr-1], b.lines[endLineNbr:]...)
+	// release the lines no longer referenced
+	tail := b.lines[len(b.lines):oldLen]
+	for i := range tail {
+		tail[i] = fileLine{}
+	}
+	return deleted, nil
+}
+
+func (b *largeFileBuffer) Iterate(startLineNbr, endLineNbr int, fn func(lineNbr int, line *Line)) error {
+	if err := checkLineRange(startLineNbr, endLineNbr, b); err != nil {
+		return err
+	}
+	for lineNbr := startLineNbr; lineNbr <= endLineNbr; lineNbr++ {
+		line, err := b.read(b.lines[lineNbr-1])
+		if err != nil {
+			return err
+		}
+		fn(lineNbr, line)
+	}
+	return nil
+}
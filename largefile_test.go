@@ -0,0 +1,262 @@
+package red
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+/*
+ Writes the contents to a temporary file, and opens it as a largeFileBuffer.
+ The file is removed by calling the returned function.
+*/
+func createLargeFileBuffer(t *testing.T, contents string) (*largeFileBuffer, string, func()) {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "red-large")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	filename := filepath.Join(dir, "file.txt")
+	if err := os.WriteFile(filename, []byte(contents), 0666); err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("error: %s", err)
+	}
+	buffer, nbrBytesRead, _, err := openLargeFile(OSFileSystem, filename, "")
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("error: %s", err)
+	}
+	assertInt(t, "wrong nbr of bytes", nbrBytesRead, len(contents))
+	return buffer, filename, func() {
+		buffer.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestLargeFileBufferReading(t *testing.T) {
+	var contents strings.Builder
+	nbrLines := 20000
+	for i := 1; i <= nbrLines; i++ {
+		fmt.Fprintf(&contents, "line %d\n", i)
+	}
+	buffer, _, cleanup := createLargeFileBuffer(t, contents.String())
+	defer cleanup()
+	assertInt(t, "wrong nbr of lines", buffer.Len(), nbrLines)
+
+	// forwards, backwards and jumping around, so that the window is read in both directions
+	var lineNbrs []int
+	for i := 1; i <= nbrLines; i += 7 {
+		lineNbrs = append(lineNbrs, i)
+	}
+	for i := nbrLines; i >= 1; i -= 13 {
+		lineNbrs = append(lineNbrs, i)
+	}
+	lineNbrs = append(lineNbrs, 1, nbrLines, 10000, 3, 19999, 10001)
+	for _, lineNbr := range lineNbrs {
+		line, err := buffer.Get(lineNbr)
+		if err != nil {
+			t.Fatalf("line %d: error: %s", lineNbr, err)
+		}
+		assertString(t, fmt.Sprintf("wrong line %d", lineNbr), line.Line, fmt.Sprintf("line %d\n", lineNbr))
+	}
+	assertBufferContents(t, buffer, contents.String())
+}
+
+func TestLargeFileBufferChanges(t *testing.T) {
+	data := []struct {
+		name     string
+		change   func(buffer Buffer) error
+		expected string
+	}{
+		{"insert at start", func(b Buffer) error { return b.InsertAfter(0, createListOfLines([]string{"x", "y"})) }, "x\ny\n1\n2\n3\n4\n"},
+		{"insert", func(b Buffer) error { return b.InsertAfter(2, createListOfLines([]string{"x", "y"})) }, "1\n2\nx\ny\n3\n4\n"},
+		{"append", func(b Buffer) error { return b.InsertAfter(4, createListOfLines([]string{"x"})) }, "1\n2\n3\n4\nx\n"},
+		{"set", func(b Buffer) error { return b.Set(3, Line{"x\n"}) }, "1\n2\nx\n4\n"},
+		{"delete", func(b Buffer) error { _, err := b.DeleteRange(2, 3); return err }, "1\n4\n"},
+		{"delete all", func(b Buffer) error { _, err := b.DeleteRange(1, 4); return err }, ""},
+		{"insert then delete", func(b Buffer) error {
+			if err := b.InsertAfter(1, createListOfLines([]string{"x"})); err != nil {
+				return err
+			}
+			_, err := b.DeleteRange(1, 2)
+			return err
+		}, "2\n3\n4\n"},
+	}
+	for _, test := range data {
+		t.Run(test.name, func(t *testing.T) {
+			buffer, _, cleanup := createLargeFileBuffer(t, "1\n2\n3\n4\n")
+			defer cleanup()
+			// the same change to a sliceBuffer gives the same result
+			for _, b := range []Buffer{buffer, createBuffer([]string{"1", "2", "3", "4"})} {
+				if err := test.change(b); err != nil {
+					t.Fatalf("error: %s", err)
+				}
+				assertBufferContents(t, b, test.expected)
+			}
+		})
+	}
+}
+
+func TestLargeFileBufferInvalidLines(t *testing.T) {
+	buffer, _, cleanup := createLargeFileBuffer(t, "1\n2\n3\n")
+	defer cleanup()
+	if _, err := buffer.Get(4); err == nil {
+		t.Fatalf("expected error for Get(4)")
+	}
+	if err := buffer.InsertAfter(4, createListOfLines([]string{"x"})); err == nil {
+		t.Fatalf("expected error for InsertAfter(4)")
+	}
+	if _, err := buffer.DeleteRange(2, 4); err == nil {
+		t.Fatalf("expected error for DeleteRange(2,4)")
+	}
+	assertBufferContents(t, buffer, "1\n2\n3\n")
+}
+
+func TestLargeFileLineEndings(t *testing.T) {
+	longLine := strings.Repeat("x", 4095) // the CR is at the end of the first part read (see indexLines)
+	data := []struct {
+		name           string
+		contents       string
+		expected       string
+		dos, mixed     bool
+		noFinalNewline bool
+	}{
+		{"unix", "a\nb\n", "a\nb\n", false, false, false},
+		{"dos", "a\r\nb\r\n", "a\nb\n", true, false, false},
+		{"no final newline", "a\nb", "a\nb\n", false, false, true},
+		{"dos, no final newline", "a\r\nb", "a\nb\n", true, false, true},
+		{"mixed", "a\r\nb\r\nc\n", "a\nb\nc\n", true, true, false},
+		{"long lines", longLine + "\r\n" + longLine + longLine + "\r\n", longLine + "\n" + longLine + longLine + "\n", true, false, false},
+	}
+	for _, test := range data {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := os.MkdirTemp("", "red-large")
+			if err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			defer os.RemoveAll(dir)
+			filename := filepath.Join(dir, "file.txt")
+			if err := os.WriteFile(filename, []byte(test.contents), 0666); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			buffer, _, mixed, err := openLargeFile(OSFileSystem, filename, "")
+			if err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			defer buffer.Close()
+			assertBufferContents(t, buffer, test.expected)
+			if buffer.dos != test.dos || mixed != test.mixed || buffer.noFinalNewline != test.noFinalNewline {
+				t.Fatalf("got dos %t, mixed %t, no final newline %t", buffer.dos, mixed, buffer.noFinalNewline)
+			}
+		})
+	}
+}
+
+func TestEditLargeFile(t *testing.T) {
+	buffer, filename, cleanup := createLargeFileBuffer(t, "a\r\nb1\r\nc\r\nb2\r\nd")
+	defer cleanup()
+	buffer.Close()
+
+	var out bytes.Buffer
+	state := NewState()
+	state.Stdout = &out
+	state.LargeFiles = true
+	if err := processCommandLine(t, state, "e "+filename); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if _, ok := state.Buffer.(*largeFileBuffer); !ok {
+		t.Fatalf("expected a largeFileBuffer, got %T", state.Buffer)
+	}
+	assertString(t, "wrong output", out.String(), "5L, 15C\n")
+	// 'g' finds the marked lines, although they are read from the file
+	state.Stdin = strings.NewReader("e\n.\n")
+	for _, cmdLine := range []string{"g/b/s/$/x/", "1d", "$a", "w"} {
+		if err := processCommandLine(t, state, cmdLine); err != nil {
+			t.Fatalf("command '%s': error: %s", cmdLine, err)
+		}
+	}
+	assertBufferContents(t, state.Buffer, "b1x\nc\nb2x\nd\ne\n")
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertString(t, "wrong file contents", string(contents), "b1x\r\nc\r\nb2x\r\nd\r\ne")
+	// the lines are still read from the original file
+	assertBufferContents(t, state.Buffer, "b1x\nc\nb2x\nd\ne\n")
+}
+
+func TestEditLargeFileFallback(t *testing.T) {
+	dir, err := os.MkdirTemp("", "red-large")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "file.txt")
+	// a file with a byte order mark is read as usual
+	if err := os.WriteFile(filename, []byte("\xef\xbb\xbfa\nb\n"), 0666); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	state := NewState()
+	state.Silent = true
+	state.LargeFiles = true
+	if err := processCommandLine(t, state, "e "+filename); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if _, ok := state.Buffer.(*largeFileBuffer); ok {
+		t.Fatalf("expected the file to be read as usual")
+	}
+	assertBufferContents(t, state.Buffer, "a\nb\n")
+}
+
+func TestWriteLargeFileWithHardLinks(t *testing.T) {
+	buffer, filename, cleanup := createLargeFileBuffer(t, "a\nb\n")
+	defer cleanup()
+	buffer.Close()
+	link := filepath.Join(filepath.Dir(filename), "link.txt")
+	if err := os.Link(filename, link); err != nil {
+		t.Skipf("cannot create hard link: %s", err)
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if !hasHardLinks(info) {
+		t.Skip("hard links are not detected on this platform")
+	}
+
+	state := NewState()
+	state.Silent = true
+	state.LargeFiles = true
+	if err := processCommandLine(t, state, "e "+filename); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if err := processCommandLine(t, state, "w"); !errors.Is(err, ErrOverwriteLargeFile) {
+		t.Fatalf("expected ErrOverwriteLargeFile, got %v", err)
+	}
+	// writing another file is fine
+	if err := processCommandLine(t, state, "w "+link+".new"); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+}
+
+func TestWriteLargeFileInPlace(t *testing.T) {
+	buffer, filename, cleanup := createLargeFileBuffer(t, "a\nb\n")
+	defer cleanup()
+	buffer.Close()
+
+	state := NewState()
+	state.Silent = true
+	state.LargeFiles = true
+	state.WriteInPlace = true
+	if err := processCommandLine(t, state, "e "+filename); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if err := processCommandLine(t, state, "w"); !errors.Is(err, ErrOverwriteLargeFile) {
+		t.Fatalf("expected ErrOverwriteLargeFile, got %v", err)
+	}
+	assertBufferContents(t, state.Buffer, "a\nb\n")
+}
@@ -0,0 +1,90 @@
+package red
+
+import (
+	"container/list"
+	"fmt"
+	"strings"
+)
+
+const (
+	unixLineEnding = "\n"
+	dosLineEnding  = "\r\n"
+)
+
+/*
+ Determines the line endings of the lines read from a file.
+ Returns true if most lines end with "\r\n" (DOS line endings), in which case the "\r" is removed from these lines.
+ Also returns whether the file contains both kinds of line endings.
+*/
+func stripDOSLineEndings(listOfLines *list.List) (dos, mixed bool) {
+	nbrDOS, nbrUnix := 0, 0
+	for el := listOfLines.Front(); el != nil; el = el.Next() {
+		switch line := el.Value.(Line).Line; {
+		case strings.HasSuffix(line, dosLineEnding):
+			nbrDOS++
+		case strings.HasSuffix(line, unixLineEnding):
+			nbrUnix++
+		}
+	}
+	if nbrDOS > nbrUnix {
+		for el := listOfLines.Front(); el != nil; el = el.Next() {
+			if line := el.Value.(Line).Line; strings.HasSuffix(line, dosLineEnding) {
+				el.Value = Line{strings.TrimSuffix(line, dosLineEnding) + unixLineEnding}
+			}
+		}
+	}
+	return nbrDOS > nbrUnix, nbrDOS > 0 && nbrUnix > 0
+}
+
+/*
+ Returns the name of the line endings, for messages.
+*/
+func lineEndingName(dos bool) string {
+	if dos {
+		return "DOS"
+	}
+	return "Unix"
+}
+
+/*
+ A buffer whose lines are returned with DOS line endings,
+ used to write a file which originally had DOS line endings (see state.dosLineEndings).
+*/
+type dosLineEndingBuffer struct {
+	Buffer
+}
+
+func (b dosLineEndingBuffer) Get(lineNbr int) (*Line, error) {
+	line, err := b.Buffer.Get(lineNbr)
+	if err != nil || !strings.HasSuffix(line.Line, unixLineEnding) {
+		return line, err
+	}
+	return &Line{strings.TrimSuffix(line.Line, unixLineEnding) + dosLineEnding}, nil
+}
+
+/*
+SetLineEndings handles the commands 'dos' and 'unix', which set the line endings with which the buffer is written.
+
+ By default a file is written with the line endings it had when read (for a file with mixed line endings, those of the majority of its lines).
+ Changing the line endings counts as a change to the buffer.
+*/
+func (cmd Command) SetLineEndings(state *State) error {
+	if err := cmd.validateAddress(state); err != nil {
+		return err
+	}
+	if rest := strings.TrimSpace(cmd.restOfCmd); rest != "" {
+		return fmt.Errorf("%s: %w: '%s'", cmd.cmd, ErrInvalidSuffix, rest)
+	}
+	state.setLineEndings(cmd.cmd == commandDOS)
+	return nil
+}
+
+/*
+ Sets the line endings with which the buffer is written. A change counts as a change to the buffer.
+*/
+func (state *State) setLineEndings(dos bool) {
+	if dos != state.dosLineEndings {
+		state.dosLineEndings = dos
+		state.changedSinceLastWrite = true
+	}
+}
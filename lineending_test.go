@@ -0,0 +1,87 @@
+package red
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestStripDOSLineEndings(t *testing.T) {
+	data := []struct {
+		lines         []string
+		expectedDOS   bool
+		expectedMixed bool
+		expected      string
+	}{
+		{[]string{"1\n", "2\n"}, false, false, "1\n2\n"},
+		{[]string{"1\r\n", "2\r\n"}, true, false, "1\n2\n"},
+		{[]string{"1\r\n", "2\r\n", "3\n"}, true, true, "1\n2\n3\n"},
+		{[]string{"1\r\n", "2\n", "3\n"}, false, true, "1\r\n2\n3\n"},
+		{[]string{"1\r\n", "2"}, true, false, "1\n2"},
+	}
+	for i, test := range data {
+		listOfLines := createListOfLines(nil)
+		for _, line := range test.lines {
+			listOfLines.PushBack(Line{line})
+		}
+		dos, mixed := stripDOSLineEndings(listOfLines)
+		if dos != test.expectedDOS || mixed != test.expectedMixed {
+			t.Fatalf("test %d: expected dos %t mixed %t, got %t %t", i, test.expectedDOS, test.expectedMixed, dos, mixed)
+		}
+		assertBufferContents(t, newBufferOf(listOfLines), test.expected)
+	}
+}
+
+func TestDOSLineEndingsArePreserved(t *testing.T) {
+	const filename string = "dos.txt"
+	const outputFilename string = "dos.out"
+	if err := os.WriteFile(filename, []byte("1\r\n2\r\n3"), 0666); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.Remove(filename)
+	defer os.Remove(outputFilename)
+
+	state := NewState()
+	var output bytes.Buffer
+	state.Stdout = &output
+	steps := []struct {
+		cmdLine          string
+		expectedContents string // of the output file, after the command
+	}{
+		{"e " + filename, ""},
+		{"2s/2/two/", ""},
+		{"w " + outputFilename, "1\r\ntwo\r\n3"},
+		{"unix", ""},
+		{"w " + outputFilename, "1\ntwo\n3"},
+		{"dos", ""},
+		{"w " + outputFilename, "1\r\ntwo\r\n3"},
+	}
+	for _, step := range steps {
+		if err := processCommandLine(t, state, step.cmdLine); err != nil {
+			t.Fatalf("command '%s': error: %s", step.cmdLine, err)
+		}
+		if step.expectedContents != "" {
+			contents, err := os.ReadFile(outputFilename)
+			if err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertString(t, "wrong file contents after "+step.cmdLine, string(contents), step.expectedContents)
+		}
+	}
+	assertBufferContents(t, state.Buffer, "1\ntwo\n3\n")
+}
+
+func TestSetLineEndings(t *testing.T) {
+	state := resetState([]string{"1"})
+	if err := processCommandLine(t, state, "dos"); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if !state.dosLineEndings || !state.changedSinceLastWrite {
+		t.Fatalf("expected DOS line endings and a changed buffer")
+	}
+	for _, cmdLine := range []string{"1dos", "unix x"} {
+		if err := processCommandLine(t, state, cmdLine); err == nil {
+			t.Fatalf("command '%s': expected error", cmdLine)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package red
+
+/*
+Listener is notified of changes to the buffer, e.g. by a linter or a user interface embedding the editor
+(see State.AddListener).
+
+ The listeners are called synchronously after each change, in the order in which they were added,
+ also for the changes made by 'u' and by the commands of a 'g'.
+ A command may change the buffer in several steps, e.g. 'c' deletes and then inserts lines.
+ The line numbers refer to the buffer after the change. A listener must not change the buffer.
+
+ To be notified of only some of the events, embed NopListener.
+*/
+type Listener interface {
+	OnLinesInserted(afterLineNbr, nbrLines int)            // nbrLines lines have been inserted after the given line (0: at the start)
+	OnLinesDeleted(startLineNbr, endLineNbr int)           // the given lines have been deleted
+	OnLineChanged(lineNbr int)                             // the text of the line has been changed, e.g. by 's'
+	OnFileLoaded(filename string, nbrLines int)            // the buffer has been replaced by the contents of the file, e.g. by 'e'
+	OnWrite(filename string, startLineNbr, endLineNbr int) // the given lines have been written to the file, e.g. by 'w'
+}
+
+/*
+NopListener implements Listener, ignoring all events.
+*/
+type NopListener struct{}
+
+func (NopListener) OnLinesInserted(afterLineNbr, nbrLines int)            {}
+func (NopListener) OnLinesDeleted(startLineNbr, endLineNbr int)           {}
+func (NopListener) OnLineChanged(lineNbr int)                             {}
+func (NopListener) OnFileLoaded(filename string, nbrLines int)            {}
+func (NopListener) OnWrite(filename string, startLineNbr, endLineNbr int) {}
+
+/*
+AddListener registers a listener to be notified of changes to the buffer.
+*/
+func (state *State) AddListener(listener Listener) {
+	state.listeners = append(state.listeners, listener)
+}
+
+/*
+RemoveListener removes a listener registered by AddListener.
+*/
+func (state *State) RemoveListener(listener Listener) {
+	for i, l := range state.listeners {
+		if l == listener {
+			state.listeners = append(state.listeners[:i:i], state.listeners[i+1:]...)
+			return
+		}
+	}
+}
+
+/*
+ Called whenever the text of a line has been changed in place (see changeLines).
+*/
+func (state *State) lineChanged(lineNbr int) {
+	for _, l := range state.listeners {
+		l.OnLineChanged(lineNbr)
+	}
+}
@@ -0,0 +1,91 @@
+package red
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+/*
+ Records the events as strings.
+*/
+type recordingListener struct {
+	events []string
+}
+
+func (l *recordingListener) OnLinesInserted(afterLineNbr, nbrLines int) {
+	l.events = append(l.events, fmt.Sprintf("inserted %d after %d", nbrLines, afterLineNbr))
+}
+func (l *recordingListener) OnLinesDeleted(startLineNbr, endLineNbr int) {
+	l.events = append(l.events, fmt.Sprintf("deleted %d,%d", startLineNbr, endLineNbr))
+}
+func (l *recordingListener) OnLineChanged(lineNbr int) {
+	l.events = append(l.events, fmt.Sprintf("changed %d", lineNbr))
+}
+func (l *recordingListener) OnFileLoaded(filename string, nbrLines int) {
+	l.events = append(l.events, fmt.Sprintf("loaded %s %d", filepath.Base(filename), nbrLines))
+}
+func (l *recordingListener) OnWrite(filename string, startLineNbr, endLineNbr int) {
+	l.events = append(l.events, fmt.Sprintf("wrote %s %d,%d", filepath.Base(filename), startLineNbr, endLineNbr))
+}
+
+func TestListener(t *testing.T) {
+	data := []struct {
+		cmdLine  string
+		expected string
+	}{
+		{"2d", "deleted 2,2"},
+		{"1,2m$", "deleted 1,2;inserted 2 after 2"},
+		{"2s/b/x/", "changed 2"},
+		{"2s/b/x\\\ny/", "changed 2;inserted 1 after 2"},
+		{"g/[bd]/s/$/!/", "changed 2;changed 4"},
+		{"2d|u", "deleted 2,2;inserted 1 after 1"},
+		{"1,2j", "deleted 1,2;inserted 1 after 0"},
+	}
+	for _, test := range data {
+		t.Run(test.cmdLine, func(t *testing.T) {
+			state := resetState([]string{"a", "b", "c", "d"})
+			state.lineNbr = 1
+			listener := &recordingListener{}
+			state.AddListener(listener)
+			for _, cmdLine := range strings.Split(test.cmdLine, "|") {
+				if err := processCommandLine(t, state, cmdLine); err != nil {
+					t.Fatalf("command '%s': error: %s", cmdLine, err)
+				}
+			}
+			assertString(t, "wrong events", strings.Join(listener.events, ";"), test.expected)
+		})
+	}
+}
+
+func TestListenerFileEvents(t *testing.T) {
+	dir, err := os.MkdirTemp("", "red-listener")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "file.txt")
+	if err := os.WriteFile(filename, []byte("a\nb\nc\n"), 0666); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	state := NewState()
+	state.Stdout = io.Discard
+	listener := &recordingListener{}
+	state.AddListener(listener)
+	for _, cmdLine := range []string{"e " + filename, "2,3w", "w " + filename + ".new"} {
+		if err := processCommandLine(t, state, cmdLine); err != nil {
+			t.Fatalf("command '%s': error: %s", cmdLine, err)
+		}
+	}
+	assertString(t, "wrong events", strings.Join(listener.events, ";"), "loaded file.txt 3;wrote file.txt 2,3;wrote file.txt.new 1,3")
+
+	// no further events once removed
+	state.RemoveListener(listener)
+	if err := processCommandLine(t, state, "1d"); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertInt(t, "wrong nbr of events", len(listener.events), 3)
+}
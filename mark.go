@@ -1,6 +1,11 @@
 package red
 
-import "fmt"
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
 
 /**
 addMark adds the given mark to the list of marks.
@@ -10,74 +15,158 @@ func (state *State) addMark(name string, lineNbr int) {
 	state.marks[name] = lineNbr
 }
 
-// updateMarks updates the line numbers of marks after various operations
-// destination only relevant for 'move'
-func (state *State) updateMarks(cmdIdent string, startLine, endLine, destination int) error {
-	if startLine > endLine {
-		return fmt.Errorf("updateMarks: bad line numbers: start: %d, end: %d", startLine, endLine)
-	}
-	switch cmdIdent {
-	case commandDelete:
-		// after lines have been deleted, any marks in the range should be removed
-		// and any marks 'above' the range should be reducted to reflect the new line numbers
-		nbrLinesDeleted := endLine - startLine + 1
-		for markName, lineNbr := range state.marks {
-			if lineNbr <= endLine && lineNbr >= startLine {
-				delete(state.marks, markName)
-			} else if lineNbr > endLine {
-				state.marks[markName] = lineNbr - nbrLinesDeleted
-			}
+/*
+ Returns the names of the marks given in 'str', e.g. "ab" or "a b", in the order given.
+ If 'str' is empty, the names of all defined marks are returned, sorted.
+*/
+func (state *State) markNames(str string) ([]string, error) {
+	var names []string
+	for _, ch := range strings.Join(strings.Fields(str), "") {
+		if ch < 'a' || ch > 'z' {
+			return nil, fmt.Errorf("%w: '%c'", ErrBadMarkName, ch)
 		}
-	case commandMove:
-		nbrLinesMoved := endLine - startLine + 1
-		movingFromAbove := startLine > destination
-		for markName, lineNbr := range state.marks {
-			// marks in the range should be removed
-			// marks between range and destination should be reduced
-			// range below destination: marks above destination should be increased
-			// marks above destination not affected (if range came from above destination)
-			switch movingFromAbove {
-			case true:
-				if lineNbr > endLine || lineNbr <= destination {
-					// no-op
-				} else if lineNbr <= endLine && lineNbr >= startLine {
-					delete(state.marks, markName)
-				} else {
-					state.marks[markName] = lineNbr + nbrLinesMoved
-				}
-			case false:
-				if lineNbr < startLine || lineNbr > destination {
-					// no-op
-				} else if lineNbr <= endLine && lineNbr >= startLine {
-					delete(state.marks, markName)
-				} else {
-					state.marks[markName] = lineNbr - nbrLinesMoved
-				}
-			}
-			/*
-				switch {
-				case (!movingFromAbove && mark.lineNbr < startLine)|| (movingFromAbove && mark.lineNbr > endLine):
-					// no-op
-				case mark.lineNbr <= destination:
-					if !movingFromAbove {
-						state.marks[mark.name] = Mark{name: mark.name, lineNbr: mark.lineNbr - nbrLinesMoved}
-					}
-				case mark.lineNbr > destination:
-					if !movingFromAbove {
-						state.marks[mark.name] = Mark{name: mark.name, lineNbr: mark.lineNbr - nbrLinesMoved}
-					}
-				default:
-					return fmt.Errorf("updateMarks: hit default in switch for mark: %v", mark)
-				}
-			*/
-			/*
-				} else if mark.lineNbr > destination {
-					state.marks[mark.name] = Mark{name: mark.name, lineNbr: mark.lineNbr + nbrLinesMoved}
-				}
-			*/
+		names = append(names, string(ch))
+	}
+	if len(names) == 0 {
+		for name := range state.marks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	return names, nil
+}
+
+/*
+ListMarks prints the marks with their line numbers and the contents of the marked lines.
+
+ marks [names]
+
+ If no names are given (e.g. 'marks ab'), all marks are listed.
+ The current address is unchanged.
+*/
+func (cmd Command) ListMarks(state *State) error {
+	if err := cmd.validateAddress(state); err != nil {
+		return err
+	}
+	names, err := state.markNames(cmd.restOfCmd)
+	if err != nil {
+		return fmt.Errorf("%s: %w", cmd.cmd, err)
+	}
+	for _, name := range names {
+		lineNbr, ok := state.marks[name]
+		if !ok {
+			return fmt.Errorf("%s: %w: '%s'", cmd.cmd, ErrNoSuchMark, name)
 		}
-	default:
-		return fmt.Errorf("updateMarks: unrecognised command identifier: '%s'", cmdIdent)
+		line, err := state.Buffer.Get(lineNbr)
+		if err != nil {
+			return fmt.Errorf("%s: %w", cmd.cmd, err)
+		}
+		fmt.Fprintf(state.Stdout, "%s %5d  %s\n", name, lineNbr, strings.TrimSuffix(line.Line, "\n"))
 	}
 	return nil
 }
+
+/*
+DeleteMarks deletes the given marks.
+
+ delmarks names
+ delmarks!
+
+ The form with '!' deletes all marks.
+ The current address is unchanged.
+*/
+func (cmd Command) DeleteMarks(state *State) error {
+	if err := cmd.validateAddress(state); err != nil {
+		return err
+	}
+	rest := strings.TrimSpace(cmd.restOfCmd)
+	if rest == "!" {
+		state.marks = make(map[string]int)
+		return nil
+	}
+	if rest == "" {
+		return fmt.Errorf("%s: %w", cmd.cmd, ErrBadMarkName)
+	}
+	names, err := state.markNames(rest)
+	if err != nil {
+		return fmt.Errorf("%s: %w", cmd.cmd, err)
+	}
+	for _, name := range names {
+		if _, ok := state.marks[name]; !ok {
+			return fmt.Errorf("%s: %w: '%s'", cmd.cmd, ErrNoSuchMark, name)
+		}
+	}
+	for _, name := range names {
+		delete(state.marks, name)
+	}
+	return nil
+}
+
+/*
+ Called whenever lines have been inserted into the buffer after line 'afterLine' (see appendLines):
+ the marks of the following lines are moved down, and the listeners are notified.
+*/
+func (state *State) linesInserted(afterLine, nbrLines int) {
+	for name, lineNbr := range state.marks {
+		if lineNbr > afterLine {
+			state.marks[name] = lineNbr + nbrLines
+		}
+	}
+	for _, l := range state.listeners {
+		l.OnLinesInserted(afterLine, nbrLines)
+	}
+}
+
+/*
+ Returns the marks of the lines 'startLine' to 'endLine', or nil if there are none.
+*/
+func (state *State) marksInRange(startLine, endLine int) map[string]int {
+	var marks map[string]int
+	for name, lineNbr := range state.marks {
+		if lineNbr >= startLine && lineNbr <= endLine {
+			if marks == nil {
+				marks = make(map[string]int)
+			}
+			marks[name] = lineNbr
+		}
+	}
+	return marks
+}
+
+/*
+ Called whenever the lines 'startLine' to 'endLine' have been deleted from the buffer (see deleteLines):
+ the marks of the deleted lines are removed, the marks of the following lines are moved up,
+ and the listeners are notified.
+ A moved or changed line is deleted and re-inserted, and therefore loses its mark.
+
+ The addresses stored in the undo list need no adjustment, since the undo commands are executed
+ in the reverse order of the changes, i.e. each one is executed on the buffer as it was after its change.
+*/
+func (state *State) linesDeleted(startLine, endLine int) {
+	nbrLinesDeleted := endLine - startLine + 1
+	for name, lineNbr := range state.marks {
+		if lineNbr >= startLine && lineNbr <= endLine {
+			delete(state.marks, name)
+		} else if lineNbr > endLine {
+			state.marks[name] = lineNbr - nbrLinesDeleted
+		}
+	}
+	for _, l := range state.listeners {
+		l.OnLinesDeleted(startLine, endLine)
+	}
+}
+
+/*
+ Replaces the buffer by the contents of the file (e.g. for 'e'). The previous buffer is closed if necessary
+ (see largeFileBuffer), all marks are removed, and the listeners are notified.
+*/
+func (state *State) replaceBuffer(buffer Buffer, filename string) {
+	if closer, ok := state.Buffer.(io.Closer); ok {
+		closer.Close()
+	}
+	state.Buffer = buffer
+	state.marks = make(map[string]int)
+	for _, l := range state.listeners {
+		l.OnFileLoaded(filename, buffer.Len())
+	}
+}
@@ -1,6 +1,12 @@
 package red
 
-import "testing"
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
 
 func TestMultipleMarks(t *testing.T) {
 	state := resetState([]string{"1", "2", "3", "4", "5"})
@@ -45,8 +51,8 @@ func TestInvalidNameOfMark(t *testing.T) {
 	}
 	state := resetState([]string{"1", "2", "3", "4", "5"})
 	cmd.resolveAddress(state)
-	if err = cmd.Mark(state); err != errBadMarkname {
-		t.Fatalf("expected 'errBadMarkname', got '%v'", err)
+	if err = cmd.Mark(state); err != ErrBadMarkName {
+		t.Fatalf("expected 'ErrBadMarkName', got '%v'", err)
 	}
 }
 
@@ -135,6 +141,186 @@ func assertElementDoesNotExist(t *testing.T, marks map[string]int, key string) {
 	}
 }
 
+func TestMarkAddresses(t *testing.T) {
+	data := []struct {
+		cmdLine          string
+		expectedContents string
+		expectedLineNbr  int
+	}{
+		{"'a,'bd", "1\n4\n5\n", 2},
+		{"'a;+1d", "1\n4\n5\n", 2},
+		{"'a-,'b+m$", "5\n1\n2\n3\n4\n", 5},
+		{"1m'b", "2\n3\n1\n4\n5\n", 3},
+		{"$t'a", "1\n2\n5\n3\n4\n5\n", 3},
+		{"'b+1t0", "4\n1\n2\n3\n4\n5\n", 1},
+	}
+	for i, test := range data {
+		t.Run(fmt.Sprintf("test %d: >>%s<<", i, test.cmdLine), func(t *testing.T) {
+			state := resetState([]string{"1", "2", "3", "4", "5"})
+			state.lineNbr = 1
+			state.addMark("a", 2)
+			state.addMark("b", 3)
+			if err := processCommandLine(t, state, test.cmdLine); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertBufferContents(t, state.Buffer, test.expectedContents)
+			assertInt(t, "wrong state.lineNbr!", state.lineNbr, test.expectedLineNbr)
+		})
+	}
+}
+
+func TestUnknownMark(t *testing.T) {
+	for _, cmdLine := range []string{"'zp", "1,'zp", "1m'z", "1t'z"} {
+		state := resetState([]string{"1", "2", "3"})
+		state.lineNbr = 1
+		state.addMark("a", 2)
+		err := processCommandLine(t, state, cmdLine)
+		if !errors.Is(err, ErrNoSuchMark) {
+			t.Fatalf("command '%s': expected ErrNoSuchMark, got %v", cmdLine, err)
+		}
+	}
+}
+
+func TestMarkRange(t *testing.T) {
+	state := resetState([]string{"1", "2", "3", "4"})
+	_addMark(t, state, "2,3", "a")
+	assertInt(t, "mark 'a' not pointing at correct line.", state.marks["a"], 3)
+}
+
+func TestListMarks(t *testing.T) {
+	data := []struct {
+		cmdLine        string
+		expectedOutput string
+		expectedError  error
+	}{
+		{"marks", "a     3  three\nb     1  one\n", nil},
+		{"marks b", "b     1  one\n", nil},
+		{"marks ba", "b     1  one\na     3  three\n", nil},
+		{"marks c", "", ErrNoSuchMark},
+		{"marks 1", "", ErrBadMarkName},
+		{"1marks", "", ErrAddressMayNotBeSpecified},
+	}
+	for _, test := range data {
+		state := resetState([]string{"one", "two", "three"})
+		var output strings.Builder
+		state.Stdout = &output
+		state.addMark("b", 1)
+		state.addMark("a", 3)
+		err := processCommandLine(t, state, test.cmdLine)
+		if test.expectedError == nil && err != nil {
+			t.Fatalf("command '%s': error: %s", test.cmdLine, err)
+		} else if !errors.Is(err, test.expectedError) {
+			t.Fatalf("command '%s': expected error '%s', got %v", test.cmdLine, test.expectedError, err)
+		}
+		assertString(t, "wrong output for "+test.cmdLine, output.String(), test.expectedOutput)
+	}
+}
+
+func TestDeleteMarks(t *testing.T) {
+	data := []struct {
+		cmdLine       string
+		expectedMarks string
+		expectError   bool
+	}{
+		{"delmarks a", "bc", false},
+		{"delmarks a c", "b", false},
+		{"delmarks!", "", false},
+		{"delmarks", "abc", true},
+		{"delmarks az", "abc", true}, // no mark is deleted if one does not exist
+	}
+	for _, test := range data {
+		state := resetState([]string{"1", "2", "3"})
+		for _, name := range []string{"a", "b", "c"} {
+			state.addMark(name, 1)
+		}
+		err := processCommandLine(t, state, test.cmdLine)
+		if test.expectError != (err != nil) {
+			t.Fatalf("command '%s': expected error: %t, got %v", test.cmdLine, test.expectError, err)
+		}
+		names, _ := state.markNames("")
+		assertString(t, "wrong marks after "+test.cmdLine, strings.Join(names, ""), test.expectedMarks)
+	}
+}
+
+// the marks follow the lines when lines are inserted or deleted by any command
+func TestMarksAfterChanges(t *testing.T) {
+	data := []struct {
+		cmdLines      []string
+		expectedMarks string
+	}{
+		{[]string{"1d"}, "a1 b3"},
+		{[]string{"2d"}, "b3"},
+		{[]string{"2i"}, "a4 b6"},
+		{[]string{"2a"}, "a2 b6"},
+		{[]string{"4a"}, "a2 b4"},
+		{[]string{"1c"}, "a3 b5"},
+		{[]string{"2,3c"}, "b4"},
+		{[]string{"1,2j"}, "b3"},
+		{[]string{"4,5j"}, "a2"},
+		{[]string{"1t3"}, "a2 b5"},
+		{[]string{"4,5t0"}, "a4 b6"},
+		{[]string{"3m0"}, "a3 b4"},
+		{[]string{"1y", "2x"}, "a2 b5"},
+		{[]string{"1X"}, "a3 b5"},
+		{[]string{"1s/1/x\\\ny/"}, "a3 b5"},
+		{[]string{"1d", "u"}, "a2 b4"},
+		{[]string{"2d", "u"}, "a2 b4"},
+		{[]string{"2,$d", "u"}, "a2 b4"},
+		{[]string{"2,$d", "1d", "u", "u"}, "a2 b4"},
+		{[]string{"3a", "u"}, "a2 b4"},
+		{[]string{"2,3j", "u"}, "b4"},
+		{[]string{"g/[13]/d"}, "a1 b2"},
+	}
+	for _, test := range data {
+		state := resetState([]string{"1", "2", "3", "4", "5"})
+		state.lineNbr = 1
+		state.Stdout = io.Discard
+		state.Stdin = strings.NewReader("x\ny\n.\n")
+		state.CutBuffer.PushBack(Line{"x\n"})
+		state.addMark("a", 2)
+		state.addMark("b", 4)
+		for _, cmdLine := range test.cmdLines {
+			if err := processCommandLine(t, state, cmdLine); err != nil {
+				t.Fatalf("command '%s': error: %s", cmdLine, err)
+			}
+		}
+		names, _ := state.markNames("")
+		var marks []string
+		for _, name := range names {
+			marks = append(marks, fmt.Sprintf("%s%d", name, state.marks[name]))
+		}
+		assertString(t, fmt.Sprintf("wrong marks after %v", test.cmdLines), strings.Join(marks, " "), test.expectedMarks)
+		if err := CheckInvariants(state); err != nil {
+			t.Fatalf("%v: %s", test.cmdLines, err)
+		}
+	}
+}
+
+func TestMarkRestoredByUndo(t *testing.T) {
+	state := resetState([]string{"1", "2", "3", "4"})
+	state.Stdout = io.Discard
+	for _, cmdLine := range []string{"3ka", "2,$d", "u", "'ad"} {
+		if err := processCommandLine(t, state, cmdLine); err != nil {
+			t.Fatalf("command '%s': error: %s", cmdLine, err)
+		}
+	}
+	assertBufferContents(t, state.Buffer, "1\n2\n4\n")
+}
+
+func TestMarksRemovedByEdit(t *testing.T) {
+	state := resetState([]string{"1", "2", "3"})
+	state.Stdout = io.Discard
+	state.addMark("a", 3)
+	state.Shell = func(command string, stdin io.Reader, stdout, stderr io.Writer) error {
+		_, err := io.WriteString(stdout, "x\n")
+		return err
+	}
+	if err := processCommandLine(t, state, "E !cmd"); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertInt(t, "number of marks", len(state.marks), 0)
+}
+
 func _addMark(t *testing.T, state *State, addrRange, markName string) {
 	var err error
 	var cmd Command
@@ -0,0 +1,52 @@
+package red
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrInvalidMessagesMode error = errors.New("invalid messages mode")
+
+// the values of the option 'messages' (see ProgramFlags.Messages)
+const (
+	messagesStdout string = "stdout" // informational messages are mixed with the output of the commands (the default)
+	messagesStderr string = "stderr" // informational messages and errors are written to stderr
+	messagesTagged string = "tagged" // informational messages and errors are written as lines starting with messageSigil
+)
+
+// starts each informational message in the messages mode 'tagged', e.g. '@@ count 3L, 42C'
+const messageSigil string = "@@"
+
+// the kinds of informational message, which follow messageSigil in the messages mode 'tagged'
+const (
+	messageCount   string = "count"   // lines and bytes read or written, e.g. by 'e', 'r' and 'w'
+	messageChanged string = "changed" // the number of lines changed, e.g. by 's'
+	messageInfo    string = "info"    // other information, e.g. the '!' after a shell command
+	messageError   string = "error"   // an error (see ReportError)
+)
+
+/*
+CheckMessages returns an error if the given messages mode is not one of stdout, stderr or tagged.
+*/
+func CheckMessages(mode string) error {
+	switch mode {
+	case messagesStdout, messagesStderr, messagesTagged:
+		return nil
+	}
+	return fmt.Errorf("%w: '%s' (expected %s, %s or %s)", ErrInvalidMessagesMode, mode, messagesStdout, messagesStderr, messagesTagged)
+}
+
+/*
+ Writes an informational message of the given kind (e.g. messageCount), as determined by the option 'messages':
+ to stdout as is, to stderr, or to stdout prefixed by messageSigil and the kind.
+*/
+func (state *State) message(kind string, format string, args ...interface{}) {
+	switch state.Messages {
+	case messagesStderr:
+		fmt.Fprintf(state.Stderr, format+"\n", args...)
+	case messagesTagged:
+		fmt.Fprintf(state.Stdout, "%s %s %s\n", messageSigil, kind, fmt.Sprintf(format, args...))
+	default:
+		fmt.Fprintf(state.Stdout, format+"\n", args...)
+	}
+}
@@ -0,0 +1,49 @@
+package red
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestCheckMessages(t *testing.T) {
+	for _, mode := range []string{"stdout", "stderr", "tagged"} {
+		if err := CheckMessages(mode); err != nil {
+			t.Fatalf("mode %s: error: %s", mode, err)
+		}
+	}
+	if err := CheckMessages("json"); !errors.Is(err, ErrInvalidMessagesMode) {
+		t.Fatalf("expected ErrInvalidMessagesMode, got %v", err)
+	}
+}
+
+func TestMessages(t *testing.T) {
+	data := []struct {
+		mode           string
+		verbose        bool
+		expectedStdout string
+		expectedStderr string
+	}{
+		{messagesStdout, false, "1 lines changed\nb\n?\n", ""},
+		{messagesStdout, true, "1 lines changed\nb\n?\nset: unknown setting: 'nosuchsetting'\n", ""},
+		{messagesStderr, true, "b\n", "1 lines changed\n?\nset: unknown setting: 'nosuchsetting'\n"},
+		{messagesTagged, false, "@@ changed 1 lines changed\nb\n@@ error set: unknown setting: 'nosuchsetting'\n", ""},
+	}
+	for _, test := range data {
+		t.Run(test.mode, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			state := resetState([]string{"a"})
+			state.Stdout, state.Stderr = &stdout, &stderr
+			state.Messages = test.mode
+			state.VerboseErrors = test.verbose
+			for _, cmdLine := range []string{"1s/a/b/", "p"} {
+				if err := processCommandLine(t, state, cmdLine); err != nil {
+					t.Fatalf("command '%s': error: %s", cmdLine, err)
+				}
+			}
+			state.ReportError(processCommandLine(t, state, "set nosuchsetting"))
+			assertString(t, "wrong stdout", stdout.String(), test.expectedStdout)
+			assertString(t, "wrong stderr", stderr.String(), test.expectedStderr)
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package red
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// the argument of the '=' command which prints the position of the line in the file
+const linenumberOffsets string = "b"
+
+/*
+ Returns the byte offset (from 0) at which the line starts in the file as written by 'w',
+ i.e. including the line endings (see SetLineEndings). The offset of line 0 is 0.
+ The offsets assume UTF-8, i.e. they do not apply to a file written in another encoding.
+*/
+func (state *State) byteOffset(lineNbr int) (int64, error) {
+	if lineNbr < 0 || lineNbr > state.Buffer.Len() {
+		return 0, errorInvalidLine(fmt.Sprintf("%d, max line: %d", lineNbr, state.Buffer.Len()), nil)
+	}
+	var offset int64
+	if lineNbr <= 1 {
+		return offset, nil
+	}
+	if indexer, ok := state.Buffer.(lengthIndexer); ok {
+		return state.indexedByteOffset(indexer, lineNbr)
+	}
+	err := state.Buffer.Iterate(1, lineNbr-1, func(_ int, line *Line) {
+		offset += int64(state.writtenLength(line.Line))
+	})
+	return offset, err
+}
+
+/*
+ Returns the byte offset of the line using the cumulative line lengths kept by the buffer.
+ Every line before the given line ends with a newline, which takes up an extra byte with DOS line endings.
+*/
+func (state *State) indexedByteOffset(indexer lengthIndexer, lineNbr int) (int64, error) {
+	offset, err := indexer.cumulativeLength(lineNbr - 1)
+	if err != nil {
+		return 0, err
+	}
+	if state.dosLineEndings {
+		offset += int64(lineNbr - 1)
+	}
+	return offset, nil
+}
+
+/*
+ Returns the number of the line which contains the given byte offset (from 0) in the file as written by 'w',
+ i.e. the inverse of byteOffset. The line ending belongs to the line it ends.
+ Returns errInvalidLine if the offset lies beyond the end of the buffer.
+*/
+func (state *State) lineAtByteOffset(offset int64) (int, error) {
+	nbrLines := state.Buffer.Len()
+	outOfRange := func() error {
+		return errorInvalidLine(fmt.Sprintf("byte offset %d lies beyond the end of the buffer", offset), nil)
+	}
+	if offset < 0 || nbrLines == 0 {
+		return -1, outOfRange()
+	}
+	if indexer, ok := state.Buffer.(lengthIndexer); ok {
+		// the first line whose end lies after the offset
+		var err error
+		index := sort.Search(nbrLines, func(i int) bool {
+			end, indexErr := state.indexedByteOffset(indexer, i+2)
+			if indexErr != nil {
+				err = indexErr
+				return true
+			}
+			return end > offset
+		})
+		if err != nil {
+			return -1, err
+		}
+		if index == nbrLines {
+			return -1, outOfRange()
+		}
+		return index + 1, nil
+	}
+	lineNbr := -1
+	var end int64
+	err := state.Buffer.Iterate(1, nbrLines, func(n int, line *Line) {
+		end += int64(state.writtenLength(line.Line))
+		if lineNbr == -1 && end > offset {
+			lineNbr = n
+		}
+	})
+	if err != nil {
+		return -1, err
+	}
+	if lineNbr == -1 {
+		return -1, outOfRange()
+	}
+	return lineNbr, nil
+}
+
+/*
+ Returns the number of bytes the line takes up when written, i.e. including the line ending.
+*/
+func (state *State) writtenLength(line string) int {
+	if state.dosLineEndings && strings.HasSuffix(line, "\n") {
+		return len(line) + 1
+	}
+	return len(line)
+}
+
+/*
+ Prints the line number, the byte offset in the file and the length (without the line ending)
+ in bytes and runes of the given line, in the (stable) format: line=<n> offset=<n> bytes=<n> runes=<n>
+*/
+func printLineOffsets(state *State, lineNbr int) error {
+	offset, err := state.byteOffset(lineNbr)
+	if err != nil {
+		return err
+	}
+	var text string
+	if lineNbr > 0 {
+		line, err := state.Buffer.Get(lineNbr)
+		if err != nil {
+			return err
+		}
+		text = strings.TrimSuffix(line.Line, "\n")
+	}
+	fmt.Fprintf(state.Stdout, "line=%d offset=%d bytes=%d runes=%d\n", lineNbr, offset, len(text), utf8.RuneCountInString(text))
+	return nil
+}
@@ -0,0 +1,99 @@
+package red
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestLinenumberOffsets(t *testing.T) {
+	data := []struct {
+		cmdLine        string
+		dos            bool
+		expectedOutput string
+	}{
+		{"=", false, "2\n"},
+		{"=b", false, "line=2 offset=4 bytes=7 runes=5\n"},
+		{"1=b", false, "line=1 offset=0 bytes=3 runes=3\n"},
+		{"$= b", false, "line=3 offset=12 bytes=0 runes=0\n"},
+		{"0=b", false, "line=0 offset=0 bytes=0 runes=0\n"},
+		{"$=b", true, "line=3 offset=14 bytes=0 runes=0\n"},
+	}
+	for _, test := range data {
+		t.Run(test.cmdLine, func(t *testing.T) {
+			var output bytes.Buffer
+			state := resetState([]string{"abc", "grüße", ""})
+			state.Stdout = &output
+			state.lineNbr = 2
+			state.dosLineEndings = test.dos
+			if err := processCommandLine(t, state, test.cmdLine); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertString(t, "wrong output", output.String(), test.expectedOutput)
+			assertInt(t, "wrong line nbr", state.lineNbr, 2)
+		})
+	}
+}
+
+func TestLinenumberBadArgument(t *testing.T) {
+	state := resetState([]string{"a"})
+	state.lineNbr = 1
+	if err := processCommandLine(t, state, "=x"); !errors.Is(err, ErrInvalidArgument) {
+		t.Fatalf("expected ErrInvalidArgument, got %v", err)
+	}
+}
+
+func TestByteOffsetAddress(t *testing.T) {
+	data := []struct {
+		cmdLine         string
+		dos             bool
+		expectedLineNbr int
+	}{
+		{"&0", false, 1},
+		{"&3", false, 1},
+		{"&4", false, 2},
+		{"&11", false, 2},
+		{"&12", false, 3},
+		{"&4+1", false, 3},
+		{"&4", true, 1},
+		{"&5", true, 2},
+		{"&15", true, 3},
+	}
+	for _, test := range data {
+		// both with the line lengths kept by the buffer, and without (when iterating over the lines)
+		for _, indexed := range []bool{true, false} {
+			t.Run(fmt.Sprintf("%s dos=%t indexed=%t", test.cmdLine, test.dos, indexed), func(t *testing.T) {
+				state := resetState([]string{"abc", "grüße", ""})
+				state.Stdout = io.Discard
+				if !indexed {
+					state.Buffer = struct{ Buffer }{state.Buffer}
+				}
+				state.dosLineEndings = test.dos
+				if err := processCommandLine(t, state, test.cmdLine); err != nil {
+					t.Fatalf("error: %s", err)
+				}
+				assertInt(t, "wrong line nbr", state.lineNbr, test.expectedLineNbr)
+			})
+		}
+	}
+}
+
+func TestByteOffsetAddressErrors(t *testing.T) {
+	state := resetState([]string{"abc", "grüße", ""})
+	for _, cmdLine := range []string{"&13", "&9999999999"} {
+		if err := processCommandLine(t, state, cmdLine); !errors.Is(err, ErrAddressOutOfRange) {
+			t.Fatalf("command '%s': expected ErrAddressOutOfRange, got %v", cmdLine, err)
+		}
+	}
+	// '#' is always a comment, also when followed by a digit
+	state.lineNbr = 1
+	for _, cmdLine := range []string{"# 12 comment", "#1 d", "#2 lines", "#1 this is a comment", "#0 comment", "#12"} {
+		if err := processCommandLine(t, state, cmdLine); err != nil {
+			t.Fatalf("command '%s': error: %s", cmdLine, err)
+		}
+	}
+	assertInt(t, "wrong line nbr", state.lineNbr, 1)
+	assertBufferContents(t, state.Buffer, "abc\ngrüße\n\n")
+}
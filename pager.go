@@ -0,0 +1,64 @@
+package red
+
+import (
+	"fmt"
+	"strings"
+)
+
+// shown when the output is paused
+const morePrompt string = "--More--"
+
+/*
+MorePrompt is called by the print commands when a screenful of output has been printed (see ProgramFlags.PageSize).
+ It returns the number of lines to print before asking again, usually 'pageSize' (e.g. on Space) or 1 (e.g. on Enter),
+ or 0 if the output is to be stopped.
+*/
+type MorePrompt func(pageSize int) (nbrLines int)
+
+/*
+ Called before a line is printed by the print commands. Returns false if no more lines are to be printed,
+ because the user has stopped the output at the '--More--' prompt.
+
+ The lines printed by a top-level command (including e.g. all the lines printed by 'g/re/p') are counted,
+ and after state.PageSize lines the user is asked whether to continue (see state.MorePrompt).
+*/
+func (state *State) pageLine() bool {
+	if state.PageSize <= 0 {
+		return true
+	}
+	if state.pagerStopped {
+		return false
+	}
+	if state.pagerLinesLeft <= 0 {
+		prompt := state.MorePrompt
+		if prompt == nil {
+			prompt = state.readMorePrompt
+		}
+		if state.pagerLinesLeft = prompt(state.PageSize); state.pagerLinesLeft <= 0 {
+			state.pagerStopped = true
+			return false
+		}
+	}
+	state.pagerLinesLeft--
+	return true
+}
+
+/*
+ Resets the pager at the start of a top-level command.
+*/
+func (state *State) resetPager() {
+	state.pagerLinesLeft = state.PageSize
+	state.pagerStopped = false
+}
+
+/*
+ The default MorePrompt, reading a line of input: 'q' stops the output, anything else continues with a page.
+*/
+func (state *State) readMorePrompt(pageSize int) int {
+	fmt.Fprint(state.Stdout, morePrompt)
+	answer, err := state.InputReader().ReadString('\n')
+	if err != nil || strings.TrimSpace(answer) == "q" {
+		return 0
+	}
+	return pageSize
+}
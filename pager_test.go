@@ -0,0 +1,76 @@
+package red
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+/*
+ Returns a MorePrompt which returns the given answers in turn, and counts how often it was called.
+*/
+func stubMorePrompt(answers []int, calls *int) MorePrompt {
+	return func(pageSize int) int {
+		*calls++
+		if len(answers) == 0 {
+			return 0
+		}
+		answer := answers[0]
+		answers = answers[1:]
+		return answer
+	}
+}
+
+func TestPager(t *testing.T) {
+	data := []struct {
+		cmdLine         string
+		answers         []int
+		expectedOutput  string
+		expectedCalls   int
+		expectedLineNbr int
+	}{
+		{"1,3p", nil, "1\n2\n3\n", 0, 3},             // fits onto one page
+		{",p", []int{3}, "1\n2\n3\n4\n5\n6\n", 1, 6}, // Space: another page
+		{",p", []int{1, 0}, "1\n2\n3\n4\n", 2, 6},    // Enter: one more line, then q
+		{",p", []int{0}, "1\n2\n3\n", 1, 6},          // q
+		{"g/./p", []int{0}, "1\n2\n3\n", 1, 6},       // the lines of all commands of a global command are counted
+		{"1,4n", []int{3}, "   1\t 1\n   2\t 2\n   3\t 3\n   4\t 4\n", 1, 4},
+	}
+	for i, test := range data {
+		t.Run(fmt.Sprintf("test %d: >>%s<<", i, test.cmdLine), func(t *testing.T) {
+			state := resetState([]string{"1", "2", "3", "4", "5", "6"})
+			var output bytes.Buffer
+			state.Stdout = &output
+			state.PageSize = 3
+			calls := 0
+			state.MorePrompt = stubMorePrompt(test.answers, &calls)
+			if err := processCommandLine(t, state, test.cmdLine); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertString(t, "wrong output", output.String(), test.expectedOutput)
+			assertInt(t, "wrong nbr of prompts", calls, test.expectedCalls)
+			assertInt(t, "wrong state.lineNbr!", state.lineNbr, test.expectedLineNbr)
+
+			// the next command starts with a new page
+			output.Reset()
+			if err := processCommandLine(t, state, "1,2p"); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertString(t, "wrong output of next command", output.String(), "1\n2\n")
+		})
+	}
+}
+
+func TestPagerDefaultPrompt(t *testing.T) {
+	state := resetState([]string{"1", "2", "3", "4", "5"})
+	var output bytes.Buffer
+	state.Stdout = &output
+	state.PageSize = 2
+	state.Input = bufio.NewReader(strings.NewReader("\nq\n"))
+	if err := processCommandLine(t, state, ",p"); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertString(t, "wrong output", output.String(), "1\n2\n--More--3\n4\n--More--")
+}
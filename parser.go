@@ -0,0 +1,294 @@
+package red
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// the commands consisting of a single character (see the constants command*)
+const singleCharCommands string = "aAcCdeEfFgGhHiIjklmnNpPqQrstTuUvVwWxXyzZ#=@!~><|"
+
+var (
+	errUnexpected        error = errors.New("unexpected")
+	errUnterminatedRegex error = errors.New("unterminated regular expression")
+	errInvalidMark       error = errors.New("invalid mark")
+	errInvalidNumber     error = errors.New("invalid number")
+)
+
+/*
+SyntaxError records an error in a command line, e.g. "unexpected ';' at column 7".
+*/
+type SyntaxError struct {
+	Column int    // the column at which the error was found, starting at 1
+	Text   string // the text in error
+	Err    error  // the kind of error, e.g. an unrecognised command
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s '%s' at column %d", e.Err, e.Text, e.Column)
+}
+
+func (e *SyntaxError) Unwrap() error { return e.Err }
+
+/*
+ The parts of a command line as split by the commandParser.
+ The columns refer to the command line, starting at 1.
+*/
+type commandLine struct {
+	addrRange  AddressRange // the address range
+	addrString string       // the text of the address range
+	cmd        string       // the (single-character) command, or "" if no command was given
+	cmdColumn  int          // the column of the command
+	rest       string       // the (untrimmed) rest of the command line after the command
+	restColumn int          // the column at which the rest starts
+}
+
+/*
+ A hand-written parser for command lines of the form 'addr1 sep addr2 cmd rest',
+ where everything is optional and whitespace is allowed between the elements.
+
+ An address consists of any number of the parts
+   .  $  n  +n  -n  +  -  'x  /re/  ?re?
+ where a regex may be followed by the suffix 'I'. The separator is ',' or ';'.
+ Instead of an address range, '%' denotes the whole buffer.
+
+ The rest of the command line is not parsed, since its syntax depends on the command
+ (and it may span several lines, e.g. the command-list of a 'g' command).
+*/
+type commandParser struct {
+	input string
+	pos   int // index of the next character to be parsed
+}
+
+/*
+ Splits the command line into address range, command and the rest of the command line.
+*/
+func parseCommandLine(str string) (commandLine, error) {
+	p := commandParser{input: str}
+	addrRange, err := p.parseRange()
+	if err != nil {
+		return commandLine{}, err
+	}
+	line := commandLine{addrRange: addrRange, addrString: strings.TrimSpace(str[:p.pos])}
+	p.skipSpace()
+	if p.atEnd() {
+		return line, nil
+	}
+	ch, size := utf8.DecodeRuneInString(p.input[p.pos:])
+	if !strings.ContainsRune(singleCharCommands, ch) {
+		if strings.ContainsRune(".$+-0123456789'/?,;%&", ch) {
+			return commandLine{}, p.errorAt(p.pos, errUnexpected, string(ch))
+		}
+		return commandLine{}, p.errorAt(p.pos, ErrUnrecognisedCommand, string(ch))
+	}
+	line.cmd, line.cmdColumn = string(ch), p.column(p.pos)
+	p.pos += size
+	line.rest, line.restColumn = p.input[p.pos:], p.column(p.pos)
+	return line, nil
+}
+
+/*
+ Parses an address range. If no address is given, the range is not specified.
+*/
+func (p *commandParser) parseRange() (AddressRange, error) {
+	p.skipSpace()
+	if p.accept(identPercent) {
+		return wholeBufferRange(), nil
+	}
+	start, err := p.parseAddress()
+	if err != nil {
+		return AddressRange{}, err
+	}
+	var separator string
+	switch {
+	case p.accept(separatorComma):
+		separator = separatorComma
+	case p.accept(separatorSemicolon):
+		separator = separatorSemicolon
+	default:
+		if start.isNotSpecified() {
+			return AddressRange{start, start, separatorComma}, nil
+		}
+		return AddressRange{start, newUnspecifiedAddress(), ""}, nil
+	}
+	end, err := p.parseAddress()
+	if err != nil {
+		return AddressRange{}, err
+	}
+	if start.isNotSpecified() && end.isNotSpecified() {
+		if separator == separatorComma {
+			// ',' == '1,$'
+			return wholeBufferRange(), nil
+		}
+		// ';' == '.,$'
+		return AddressRange{Address{[]addressPart{{addrIdent: identDot}}}, Address{[]addressPart{{addrIdent: identDollar}}}, separatorComma}, nil
+	}
+	return AddressRange{start, end, separator}, nil
+}
+
+/*
+ Returns the range '1,$'.
+*/
+func wholeBufferRange() AddressRange {
+	return AddressRange{newAbsoluteAddress(1), Address{[]addressPart{{addrIdent: identDollar}}}, separatorComma}
+}
+
+/*
+ Parses an address, i.e. any number of address parts. If there are none, the address is not specified.
+ Whitespace following the address is skipped.
+*/
+func (p *commandParser) parseAddress() (Address, error) {
+	var address Address
+	for {
+		p.skipSpace()
+		start := p.pos
+		var part addressPart
+		switch {
+		case p.accept(identDot):
+			part = addressPart{addrIdent: identDot}
+		case p.accept(identDollar):
+			part = addressPart{addrIdent: identDollar}
+		case p.accept(identMark):
+			if p.atEnd() || p.input[p.pos] < 'a' || p.input[p.pos] > 'z' {
+				return Address{}, p.errorAt(start, errInvalidMark, p.input[start:minIntOf(p.pos+1, len(p.input))])
+			}
+			part = addressPart{addrIdent: identMark, info: p.input[p.pos : p.pos+1]}
+			p.pos++
+		case p.accept(identRegexForward), p.accept(identRegexBackward):
+			delimiter := p.input[start:p.pos]
+			end := strings.Index(p.input[p.pos:], delimiter)
+			if end < 0 {
+				return Address{}, p.errorAt(start, errUnterminatedRegex, p.input[start:])
+			}
+			part = addressPart{addrIdent: delimiter, info: p.input[p.pos : p.pos+end]}
+			p.pos += end + len(delimiter)
+			part.ignoreCase = p.acceptIgnoreCaseSuffix()
+		case p.acceptNumber():
+			nbr := p.input[start:p.pos]
+			if _, err := strconv.Atoi(nbr); err != nil {
+				return Address{}, p.errorAt(start, errInvalidNumber, nbr)
+			}
+			part = addressPart{addrIdent: identSignedNbr, info: nbr}
+		case p.acceptByteOffset():
+			nbr := p.input[start+len(identByteOffset) : p.pos]
+			if _, err := strconv.ParseInt(nbr, 10, 64); err != nil {
+				return Address{}, p.errorAt(start, errInvalidNumber, p.input[start:p.pos])
+			}
+			part = addressPart{addrIdent: identByteOffset, info: nbr}
+		case p.accept(identInc):
+			part = addressPart{addrIdent: identInc}
+		case p.accept(identDec):
+			part = addressPart{addrIdent: identDec}
+		default:
+			if len(address.internal) == 0 {
+				return newUnspecifiedAddress(), nil
+			}
+			return address, nil
+		}
+		address.internal = append(address.internal, part)
+	}
+}
+
+/*
+ Reports an error if anything other than whitespace remains to be parsed.
+*/
+func (p *commandParser) expectEnd() error {
+	p.skipSpace()
+	if !p.atEnd() {
+		ch, _ := utf8.DecodeRuneInString(p.input[p.pos:])
+		return p.errorAt(p.pos, errUnexpected, string(ch))
+	}
+	return nil
+}
+
+/*
+ If the input continues with 'str', skips it and returns true.
+*/
+func (p *commandParser) accept(str string) bool {
+	if strings.HasPrefix(p.input[p.pos:], str) {
+		p.pos += len(str)
+		return true
+	}
+	return false
+}
+
+/*
+ If the input continues with a number, optionally signed, skips it and returns true.
+*/
+func (p *commandParser) acceptNumber() bool {
+	end := p.pos
+	if end < len(p.input) && (p.input[end] == identInc[0] || p.input[end] == identDec[0]) {
+		end++
+	}
+	digits := end
+	for end < len(p.input) && p.input[end] >= '0' && p.input[end] <= '9' {
+		end++
+	}
+	if end == digits {
+		return false
+	}
+	p.pos = end
+	return true
+}
+
+/*
+ If the input continues with the suffix 'I' of a regex address (e.g. '/re/I'), skips it and returns true.
+ An 'I' followed by a delimiter (e.g. '/re/I/# /') is the command 'I' instead, i.e. is not accepted.
+*/
+func (p *commandParser) acceptIgnoreCaseSuffix() bool {
+	if !strings.HasPrefix(p.input[p.pos:], suffixIgnoreCase) {
+		return false
+	}
+	next := p.pos + len(suffixIgnoreCase)
+	if next < len(p.input) && isTextDelimiter(p.input[next]) {
+		return false
+	}
+	p.pos = next
+	return true
+}
+
+/*
+ Returns true if the character can start the delimited text of a command such as 'I/text/',
+ i.e. cannot continue an address or start a command.
+*/
+func isTextDelimiter(ch byte) bool {
+	isAlphanumeric := (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9')
+	return !isAlphanumeric && !strings.ContainsRune(" \t+-,;", rune(ch))
+}
+
+/*
+ If the input continues with a byte offset, i.e. '&' immediately followed by digits, skips it and returns true.
+ ('#' would be more obvious, but would turn comments starting with a digit, e.g. '#1 ...', into commands.)
+*/
+func (p *commandParser) acceptByteOffset() bool {
+	next := p.pos + len(identByteOffset)
+	if !strings.HasPrefix(p.input[p.pos:], identByteOffset) || next >= len(p.input) || p.input[next] < '0' || p.input[next] > '9' {
+		return false
+	}
+	p.pos = next
+	return p.acceptNumber()
+}
+
+func (p *commandParser) skipSpace() {
+	for !p.atEnd() && strings.ContainsRune(" \t\r\n", rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *commandParser) atEnd() bool {
+	return p.pos >= len(p.input)
+}
+
+/*
+ Returns the column (starting at 1) of the given index into the input.
+*/
+func (p *commandParser) column(pos int) int {
+	return utf8.RuneCountInString(p.input[:pos]) + 1
+}
+
+func (p *commandParser) errorAt(pos int, err error, text string) error {
+	return &SyntaxError{Column: p.column(pos), Text: text, Err: err}
+}
@@ -0,0 +1,113 @@
+package red
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	defaultContextLines int    = 2    // default number of lines of context for the print-context command
+	contextSeparator    string = "--" // printed between groups of lines
+)
+
+/*
+PrintContext prints the addressed lines together with n lines of context before and after each line.
+
+ (.,.)Z[n]
+ (1,$)Z/re/[n]   prints each line matching the regular expression 're' with its context
+
+ If n is not specified, 2 lines of context are printed.
+ Lines are printed with their line numbers. Overlapping groups of lines are merged,
+ otherwise the groups are separated by a line containing "--".
+
+ The current address is set to the address of the last addressed (or matching) line.
+*/
+func (cmd Command) PrintContext(state *State) error {
+	return cmd._printContext(state, state.Stdout)
+}
+func (cmd Command) _printContext(state *State, writer io.Writer) error {
+	if err := cmd.validateAddress(state); err != nil {
+		return err
+	}
+	arg := strings.TrimSpace(cmd.restOfCmd)
+	var re *regexp.Regexp
+	startLineNbr, endLineNbr := cmd.resolved.start, cmd.resolved.end
+	if arg != "" && !strings.ContainsAny(arg[0:1], "0123456789") {
+		var reStr string
+		var err error
+		if reStr, arg, err = splitDelimitedRegex(arg); err != nil {
+			return fmt.Errorf("print context: %w", err)
+		}
+		if re, err = state.compileRegex(reStr, false); err != nil {
+			return fmt.Errorf("print context: %w", err)
+		}
+		state.lastSearchRE = re
+		// the default range for a regex is the whole buffer
+		if !cmd.addrRange.IsSpecified() {
+			startLineNbr, endLineNbr = 1, state.Buffer.Len()
+		}
+	}
+	nbrContextLines := defaultContextLines
+	if arg != "" {
+		var err error
+		if nbrContextLines, err = strconv.Atoi(arg); err != nil || nbrContextLines < 0 {
+			return fmt.Errorf("print context: %w: invalid number of lines: '%s'", ErrInvalidArgument, arg)
+		}
+	}
+	if startLineNbr == 0 {
+		return fmt.Errorf("print context: %w", errorInvalidLine("start line is 0", nil))
+	}
+
+	// collect the lines to be printed
+	var lineNbrs []int
+	collectFn := func(lineNbr int, line *Line, state *State) {
+		if re == nil || matchesLine(re, line) {
+			lineNbrs = append(lineNbrs, lineNbr)
+		}
+	}
+	if err := iterateLines(startLineNbr, endLineNbr, state, collectFn); err != nil {
+		return fmt.Errorf("print context: %w", err)
+	}
+	if len(lineNbrs) == 0 {
+		return fmt.Errorf("print context: %w", ErrNoMatch)
+	}
+
+	// print the groups, merging overlapping groups
+	groupStart, groupEnd := -1, -1
+	for _, lineNbr := range lineNbrs {
+		start := maxIntOf(1, lineNbr-nbrContextLines)
+		end := minIntOf(state.Buffer.Len(), lineNbr+nbrContextLines)
+		if groupStart != -1 && start > groupEnd+1 {
+			if err := _printRangeHighlighted(writer, groupStart, groupEnd, state, true, false, re); err != nil {
+				return err
+			}
+			fmt.Fprintln(writer, contextSeparator)
+			groupStart = -1
+		}
+		if groupStart == -1 {
+			groupStart = start
+		}
+		groupEnd = end
+	}
+	if err := _printRangeHighlighted(writer, groupStart, groupEnd, state, true, false, re); err != nil {
+		return err
+	}
+	return moveToLine(lineNbrs[len(lineNbrs)-1], state)
+}
+
+/*
+ Splits a string of the form '/re/rest' into 're' and 'rest'.
+ Any character can be used as the delimiter.
+*/
+func splitDelimitedRegex(str string) (re, rest string, err error) {
+	delimiter, size := utf8.DecodeRuneInString(str)
+	endOfRE := strings.IndexRune(str[size:], delimiter)
+	if endOfRE == -1 {
+		return "", "", ErrMissingDelimiter
+	}
+	return str[size : size+endOfRE], strings.TrimSpace(str[2*size+endOfRE:]), nil
+}
@@ -0,0 +1,51 @@
+package red
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestPrintContext(t *testing.T) {
+	data := []struct {
+		addrRange       string
+		arg             string
+		expectedOutput  string
+		expectedLineNbr int
+	}{
+		{"4", "1", "   3\t 3\n   4\t 4\n   5\t 5\n", 4},
+		{"1", "", "   1\t 1\n   2\t 2\n   3\t 3\n", 1},
+		{"", "/[29]/1", "   1\t 1\n   2\t 2\n   3\t 3\n--\n   8\t 8\n   9\t 9\n  10\t 10\n", 9},
+		{"", "/[45]/0", "   4\t 4\n   5\t 5\n", 5}, // adjacent groups are merged
+		{"1,5", "/[29]/", "   1\t 1\n   2\t 2\n   3\t 3\n   4\t 4\n", 2},
+	}
+
+	for i, test := range data {
+		t.Run(fmt.Sprintf("test %d: >>%s%s%s<<", i, test.addrRange, commandPrintContext, test.arg), func(t *testing.T) {
+			state := resetState([]string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10"})
+			state.lineNbr = 1
+			cmd, err := createCommandAndResolveAddressRange(state, newValidRange(test.addrRange), commandPrintContext, test.arg)
+			if err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			var buff bytes.Buffer
+			if err = cmd._printContext(state, &buff); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertString(t, "wrong output", buff.String(), test.expectedOutput)
+			assertInt(t, "wrong state.lineNbr!", state.lineNbr, test.expectedLineNbr)
+		})
+	}
+}
+
+func TestPrintContextNoMatch(t *testing.T) {
+	state := resetState([]string{"1", "2", "3"})
+	cmd, err := createCommandAndResolveAddressRange(state, newValidRange(""), commandPrintContext, "/x/")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	var buff bytes.Buffer
+	if err = cmd._printContext(state, &buff); err == nil {
+		t.Fatalf("expected error, got output: %s", buff.String())
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"os"
 	"regexp"
 	"strconv"
 	"strings"
@@ -13,18 +12,71 @@ import (
 
 // suffixes for the 's' command
 const (
-	suffixGlobal string = "g" // every match is replaced
-	suffixList   string = "l" // list
-	suffixNumber string = "n" // number
-	suffixPrint  string = "p" // print
+	suffixGlobal     string = "g" // every match is replaced
+	suffixIgnoreCase string = "I" // the regex matches case-insensitively (also allowed after a regex address)
+	suffixList       string = "l" // list
+	suffixNumber     string = "n" // number
+	suffixPrint      string = "p" // print
+	suffixRegex      string = "r" // (repeated substitution only) use the regex of the last search
 )
 
+// the suffixes of the repeat form of the 's' command, e.g. 'sgp'
+var repeatSubstRE = regexp.MustCompile(`^[gpr0-9]*$`)
+
 var (
-	errSyntaxMissingDelimiter error = errors.New("missing delimiter")
-	errNoSubstitutions        error = errors.New("no substitution performed")
-	errNoPreviousRegex        error = errors.New("no previous regex")
+	ErrMissingDelimiter      error = errors.New("missing delimiter")
+	ErrNoSubstitutions       error = errors.New("no substitution performed")
+	ErrNoPreviousRegex       error = errors.New("no previous regex")
+	ErrNoPreviousCommandList error = errors.New("no previous command-list")
+	ErrUnexpectedCommandList error = errors.New("a command-list may not be specified")
+	ErrInvalidSuffix         error = errors.New("invalid suffix")
+	ErrGlobalAndCount        error = errors.New("suffixes 'g' and 'count' cannot be combined")
 )
 
+/*
+substSuffixes stores the parsed suffixes of an 's' command.
+*/
+type substSuffixes struct {
+	global     bool   // every match is replaced
+	count      int    // only the count-th match is replaced (if global is not set)
+	print      string // the print suffixes 'l', 'n', 'p'
+	ignoreCase bool   // the regex matches case-insensitively
+}
+
+/*
+ Parses the suffixes of an 's' command: any combination of 'g', 'count', 'I', 'l', 'n', and 'p'.
+ By default (no 'g' and no 'count') the first match is replaced.
+*/
+func parseSubstSuffixes(suffixes string) (substSuffixes, error) {
+	parsed := substSuffixes{count: 1}
+	countStr := ""
+	for _, ch := range strings.TrimSpace(suffixes) {
+		switch {
+		case string(ch) == suffixGlobal:
+			parsed.global = true
+		case string(ch) == suffixIgnoreCase:
+			parsed.ignoreCase = true
+		case string(ch) == suffixList, string(ch) == suffixNumber, string(ch) == suffixPrint:
+			parsed.print += string(ch)
+		case ch >= '0' && ch <= '9':
+			countStr += string(ch)
+		default:
+			return substSuffixes{}, fmt.Errorf("%w: '%c'", ErrInvalidSuffix, ch)
+		}
+	}
+	if countStr != "" {
+		if parsed.global {
+			return substSuffixes{}, ErrGlobalAndCount
+		}
+		count, err := strconv.Atoi(countStr)
+		if err != nil || count < 1 {
+			return substSuffixes{}, fmt.Errorf("%w: count '%s'", ErrInvalidSuffix, countStr)
+		}
+		parsed.count = count
+	}
+	return parsed, nil
+}
+
 /*
 CmdGlobal processes the global command, which makes two passes over the file.
  On the first pass, all the addressed lines matching a regular expression re are marked.
@@ -46,20 +98,281 @@ CmdGlobal processes the global command, which makes two passes over the file.
     is equivalent to a '.+1p' command.
 
  (This is similar to the Substitute command, except the replacement string can be a list of commands)
+
+ The 'v' command is also processed here: it acts on all addressed lines NOT matching the regex.
+
+ The interactive commands 'G' and 'V' are also processed here. Instead of a command-list,
+ each marked line is printed and a command-list is read from the user, which is executed for this line.
+ A newline alone does nothing, and a single '&' repeats the previous command-list.
 */
 func (cmd Command) CmdGlobal(state *State) error {
-	currentLineNbr := state.lineNbr
-	startLineNbr, endLineNbr, err := cmd.addrRange.getAddressRange(state.lineNbr, state.Buffer, state.marks)
-	if err != nil {
+	if err := cmd.validateAddress(state); err != nil {
 		return err
 	}
+	startLineNbr, endLineNbr := cmd.resolved.start, cmd.resolved.end
+	if !cmd.addrRange.IsSpecified() {
+		startLineNbr, endLineNbr = 1, state.Buffer.Len()
+	}
+	re, commandList, err := parseGlobalCommand(cmd.restOfCmd, state)
+	if err != nil {
+		return fmt.Errorf("global: %w", err)
+	}
+	interactive := cmd.cmd == commandGlobalInteractive || cmd.cmd == commandInverseGlobalInteractive
+	var commands []globalCommand
+	if interactive {
+		if commandList != "" {
+			return fmt.Errorf("global: %w", ErrUnexpectedCommandList)
+		}
+	} else if commands, err = parseCommandList(commandList); err != nil {
+		return fmt.Errorf("global: %w", err)
+	}
+	invert := cmd.cmd == commandInverseGlobal || cmd.cmd == commandInverseGlobalInteractive
+	marked, err := markMatchingLines(startLineNbr, endLineNbr, state, re, invert)
+	if err != nil {
+		return fmt.Errorf("global: %w", err)
+	}
+	// whilst executing the command-list, lines which are deleted or changed are unmarked
+	buffer := &markingBuffer{Buffer: state.Buffer, marked: make(map[*Line]bool, len(marked))}
+	for _, m := range marked {
+		buffer.marked[m.line] = true
+	}
+	state.Buffer = buffer
+	defer func() { state.Buffer = buffer.Buffer }()
+	return executeCommandList(state, buffer, marked, commands, interactive)
+}
+
+/*
+globalCommand stores one command of the command-list of a 'g' command,
+together with the text to be entered, if the command is 'a', 'c', or 'i'.
+*/
+type globalCommand struct {
+	cmd  Command
+	text *list.List
+}
+
+/*
+markedLine stores a line marked by the first pass of a 'g' command.
+*/
+type markedLine struct {
+	line    *Line
+	lineNbr int // the line number when marked
+}
 
-	// find matching lines
+/*
+markingBuffer is used whilst the command-list of a 'g' command is executed.
+It keeps track of the marked lines, unmarking any line which is deleted or changed.
+*/
+type markingBuffer struct {
+	Buffer
+	marked map[*Line]bool
+}
 
-	fmt.Println("not yet implemented", startLineNbr, endLineNbr, currentLineNbr)
+func (b *markingBuffer) Set(lineNbr int, line Line) error {
+	if oldLine, err := b.Buffer.Get(lineNbr); err == nil {
+		delete(b.marked, oldLine)
+	}
+	return b.Buffer.Set(lineNbr, line)
+}
+
+func (b *markingBuffer) DeleteRange(startLineNbr, endLineNbr int) (*list.List, error) {
+	_ = b.Buffer.Iterate(startLineNbr, endLineNbr, func(lineNbr int, line *Line) { delete(b.marked, line) })
+	return b.Buffer.DeleteRange(startLineNbr, endLineNbr)
+}
+
+/*
+ Splits the argument of a 'g' command of the form '/re/command-list' into the regex and the command-list.
+ An empty regex refers to the previous regex.
+*/
+func parseGlobalCommand(str string, state *State) (*regexp.Regexp, string, error) {
+	if str == "" {
+		return nil, "", ErrMissingDelimiter
+	}
+	reStr, commandList, err := splitDelimitedRegex(str)
+	if err != nil {
+		return nil, "", err
+	}
+	if reStr == "" {
+		if state.lastSearchRE == nil {
+			return nil, "", ErrNoPreviousRegex
+		}
+		return state.lastSearchRE, commandList, nil
+	}
+	re, err := state.compileRegex(reStr, false)
+	if err != nil {
+		return nil, "", err
+	}
+	state.lastSearchRE = re
+	return re, commandList, nil
+}
+
+/*
+ Parses the command-list of a 'g' command.
+
+ The lines of a multi-line command-list are separated by newlines, each line apart from the last
+ being terminated by a backslash.
+ An empty line is equivalent to the command 'p'.
+ The commands 'a', 'c', and 'i' take the following lines as their input, up to a line containing a single '.'
+ or the end of the command-list.
+*/
+func parseCommandList(commandList string) ([]globalCommand, error) {
+	lines := strings.Split(commandList, "\n")
+	for i := 0; i < len(lines)-1; i++ {
+		if !strings.HasSuffix(lines[i], `\`) {
+			return nil, fmt.Errorf("line %d of command-list is not terminated by a backslash", i+1)
+		}
+		lines[i] = strings.TrimSuffix(lines[i], `\`)
+	}
+	var commands []globalCommand
+	for i := 0; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) == "" {
+			lines[i] = commandPrint
+		}
+		cmd, err := ParseCommand(lines[i], false)
+		if err != nil {
+			return nil, err
+		}
+		var text *list.List
+		switch cmd.cmd {
+		case commandAppend, commandInsert, commandChange:
+			text = list.New()
+			for i++; i < len(lines) && lines[i] != "."; i++ {
+				text.PushBack(Line{unescapeInputLine(lines[i] + "\n")})
+			}
+		}
+		commands = append(commands, globalCommand{cmd: cmd, text: text})
+	}
+	return commands, nil
+}
+
+/*
+ The first pass of the 'g' command: marks all lines in the given range matching the regex.
+ If 'invert' is set (for the 'v' command), all lines NOT matching the regex are marked.
+ The marked lines of a buffer whose lines are read lazily are pinned, so that they can be found again.
+*/
+func markMatchingLines(startLineNbr, endLineNbr int, state *State, re *regexp.Regexp, invert bool) ([]markedLine, error) {
+	var marked []markedLine
+	if state.Buffer.Len() == 0 {
+		return marked, nil
+	}
+	pinner, _ := state.Buffer.(linePinner)
+	var pinErr error
+	// don't use iterateLines, since the current line must not change
+	err := state.Buffer.Iterate(startLineNbr, endLineNbr, func(lineNbr int, line *Line) {
+		if matchesLine(re, line) != invert {
+			if pinner != nil && pinErr == nil {
+				line, pinErr = pinner.pin(lineNbr)
+			}
+			marked = append(marked, markedLine{line: line, lineNbr: lineNbr})
+		}
+	})
+	if err == nil {
+		err = pinErr
+	}
+	return marked, err
+}
+
+/*
+ The second pass of the 'g' command: executes the command-list for each marked line,
+ with the current line set to the marked line.
+ Lines which have been deleted or modified by the command-list in the meantime are skipped.
+
+ If 'interactive' is set, the command-list is read from the user for each line.
+
+ A substitution which does not match a line is not an error,
+ but it is an error if the command-list contains a substitution which did not match any line.
+*/
+func executeCommandList(state *State, buffer *markingBuffer, marked []markedLine, commands []globalCommand, interactive bool) error {
+	var previousCommands []globalCommand
+	var substituted, substitutionFailed bool
+	// how far the lines have moved up or down in the buffer since they were marked (as of the previous marked line)
+	offset := 0
+	for _, m := range marked {
+		if err := state.checkInterrupt(); err != nil {
+			return err
+		}
+		if !buffer.marked[m.line] {
+			continue
+		}
+		lineNbr := findLine(m.line, buffer, m.lineNbr+offset)
+		if lineNbr == 0 {
+			continue
+		}
+		state.lineNbr = lineNbr
+		offset = lineNbr - m.lineNbr
+		if interactive {
+			var err error
+			if commands, err = readInteractiveCommandList(state, state.Stdout, previousCommands); err != nil {
+				if err == io.EOF {
+					return nil
+				}
+				return err
+			}
+			if len(commands) != 0 {
+				previousCommands = commands
+			}
+		}
+		for _, gc := range commands {
+			_, err := gc.cmd.ProcessCommand(state, gc.text, true)
+			if gc.cmd.cmd == commandSubstitute {
+				if errors.Is(err, ErrNoSubstitutions) {
+					substitutionFailed = true
+					continue
+				}
+				substituted = substituted || err == nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if substitutionFailed && !substituted {
+		return ErrNoSubstitutions
+	}
 	return nil
 }
 
+/*
+ Prints the current line and reads the command-list to execute for it from the user.
+ An empty line returns an empty command-list, '&' returns the previous command-list.
+*/
+func readInteractiveCommandList(state *State, writer io.Writer, previousCommands []globalCommand) ([]globalCommand, error) {
+	line, err := state.Buffer.Get(state.lineNbr)
+	if err != nil {
+		return nil, err
+	}
+	_printLine(writer, state.lineNbr, line.Line, false, false)
+	commandList, err := readCommandList(state.InputReader())
+	if err != nil {
+		return nil, err
+	}
+	switch strings.TrimSpace(commandList) {
+	case "":
+		return nil, nil
+	case "&":
+		if previousCommands == nil {
+			return nil, ErrNoPreviousCommandList
+		}
+		return previousCommands, nil
+	}
+	return parseCommandList(commandList)
+}
+
+/*
+ Returns the line number of the given line, or 0 if the line is not (or no longer) in the buffer.
+ The search starts at the expected line number 'hint' and works outwards in both directions.
+*/
+func findLine(target *Line, buffer Buffer, hint int) int {
+	bufferLen := buffer.Len()
+	for distance := 0; hint-distance >= 1 || hint+distance <= bufferLen; distance++ {
+		for _, lineNbr := range []int{hint + distance, hint - distance} {
+			if line, err := buffer.Get(lineNbr); err == nil && line == target {
+				return lineNbr
+			}
+		}
+	}
+	return 0
+}
+
 /*
 CmdSubstitute replaces text in the addressed lines matching a regular expression re with replacement.
  By default, only the first match in each line is replaced.
@@ -102,11 +415,11 @@ CmdSubstitute replaces text in the addressed lines matching a regular expression
 	 The 'r' suffix causes the re of the last search to be used instead of the re of the last
 	 substitution (if the search happened after the substitution).
 
- Undo is handled by a 'special' internal command 'internalCommandUndoSubst'.
+ Each changed line is undone by a 'change' command.
 */
 func (cmd Command) CmdSubstitute(state *State) error {
 
-	startLineNbr, endLineNbr, err := cmd.addrRange.getAddressRange(state.lineNbr, state.Buffer, state.marks)
+	startLineNbr, endLineNbr, err := cmd.addrRange.getAddressRange(state)
 	if err != nil {
 		return err
 	}
@@ -114,51 +427,52 @@ func (cmd Command) CmdSubstitute(state *State) error {
 	var nbrLinesChanged int
 	var undoList *list.List
 	regexCommand := strings.TrimSpace(cmd.restOfCmd)
-	if regexCommand != "" {
-		re, replacement, suffixes, err := parseRegexCommand(regexCommand)
-		if err != nil {
-			return err
-		}
-		nbrLinesChanged, undoList, err = processLines(os.Stdout, startLineNbr, endLineNbr, state, re, replacement, suffixes)
-		if err != nil {
-			return err
+	if !repeatSubstRE.MatchString(regexCommand) {
+		re, replacement, suffixes, parseErr := parseRegexCommand(regexCommand)
+		if parseErr != nil {
+			return parseErr
 		}
+		nbrLinesChanged, undoList, err = processLines(state.Stdout, startLineNbr, endLineNbr, state, re, replacement, suffixes)
 	} else {
-		// TODO need to handle flags on a pure "s" command
-		suffixes := strings.TrimSpace(cmd.restOfCmd)
-		nbrLinesChanged, undoList, err = processLinesUsingPreviousSubst(os.Stdout, startLineNbr, endLineNbr, state, suffixes)
+		nbrLinesChanged, undoList, err = processLinesUsingPreviousSubst(state.Stdout, startLineNbr, endLineNbr, state, regexCommand)
 	}
 
-	if err != nil {
+	// if interrupted, the lines which have already been changed must still be recorded for undo
+	interrupted := errors.Is(err, ErrInterrupted)
+	if err != nil && !interrupted {
 		return err
 	}
 	if nbrLinesChanged == 0 {
-		return errNoSubstitutions
+		if interrupted {
+			return err
+		}
+		return ErrNoSubstitutions
 	}
 
-	fmt.Printf("%d lines changed\n", nbrLinesChanged)
+	state.message(messageChanged, "%d lines changed", nbrLinesChanged)
 
 	if undoList.Len() != nbrLinesChanged {
-		panic(fmt.Sprintf("changed %d lines but undoList contains %d elements", nbrLinesChanged, undoList.Len()))
+		return fmt.Errorf("substitute: changed %d lines but undoList contains %d elements", nbrLinesChanged, undoList.Len())
 	}
-	state.addUndo(1, 1, internalCommandUndoSubst, undoList, cmd)
+	state.addUndoList(undoList)
 
 	state.changedSinceLastWrite = true
-	return nil
+	return err
 }
 
 func parseRegexCommand(regexCommand string) (re, replacement, suffixes string, err error) {
 	delimiter := regexCommand[0:1]
 	split := strings.Split(regexCommand, delimiter)
 	if len(split) != 4 || split[1] == "" {
-		return "", "", "", errSyntaxMissingDelimiter
+		return "", "", "", ErrMissingDelimiter
 	}
 	return split[1], split[2], split[3], nil
 }
 
 /*
  Repeats the previous substitution if one is present in state.
- suffixes: gpln or <count> (see doc)
+ suffixes: any combination of 'g', 'p', 'r' and <count> (see doc).
+ The suffixes modify the stored suffixes of the previous substitution, i.e. they apply to further repeats as well.
 
  Returns:
   - number of lines matched
@@ -166,19 +480,50 @@ func parseRegexCommand(regexCommand string) (re, replacement, suffixes string, e
 */
 func processLinesUsingPreviousSubst(writer io.Writer, startLineNbr, endLineNbr int,
 	state *State, suffixes string) (int, *list.List, error) {
-	if state.lastSubstRE != nil {
-		// if no suffixes defined, use previously stored
-		if suffixes == "" {
-			suffixes = state.lastSubstSuffixes
+	if state.lastSubstRE == nil {
+		return 0, nil, ErrNoPreviousRegex
+	}
+	re := state.lastSubstRE
+	parsedSuffixes := state.lastSubstSuffixes
+	countStr := ""
+	for _, ch := range suffixes {
+		switch {
+		case string(ch) == suffixGlobal:
+			parsedSuffixes.global = !parsedSuffixes.global
+			parsedSuffixes.count = 1
+		case string(ch) == suffixPrint:
+			if parsedSuffixes.print == "" {
+				parsedSuffixes.print = suffixPrint
+			} else {
+				parsedSuffixes.print = ""
+			}
+		case string(ch) == suffixRegex:
+			if state.lastSearchRE == nil {
+				return 0, nil, ErrNoPreviousRegex
+			}
+			re = state.lastSearchRE
+		default: // a digit
+			countStr += string(ch)
 		}
-		return replaceLines(writer, startLineNbr, endLineNbr, state, state.lastSubstRE, state.lastSubstReplacement, suffixes)
 	}
-	return 0, nil, errNoPreviousRegex
+	if countStr != "" {
+		if strings.Contains(suffixes, suffixGlobal) {
+			return 0, nil, ErrGlobalAndCount
+		}
+		count, err := strconv.Atoi(countStr)
+		if err != nil || count < 1 {
+			return 0, nil, fmt.Errorf("%w: count '%s'", ErrInvalidSuffix, countStr)
+		}
+		parsedSuffixes.global = false
+		parsedSuffixes.count = count
+	}
+	state.lastSubstSuffixes = parsedSuffixes
+	return replaceLines(writer, startLineNbr, endLineNbr, state, re, state.lastSubstReplacement, parsedSuffixes)
 }
 
 /*
  Replace lines between start and end matching 'reStr'.
- suffixes: gpln or <count> (see doc)
+ suffixes: gIpln or <count> (see doc)
 
  Returns:
   - number of lines matched
@@ -188,66 +533,203 @@ func processLinesUsingPreviousSubst(writer io.Writer, startLineNbr, endLineNbr i
 */
 func processLines(writer io.Writer, startLineNbr, endLineNbr int,
 	state *State, reStr, replacement, suffixes string) (int, *list.List, error) {
-	re, err := regexp.Compile(reStr)
+	parsedSuffixes, err := parseSubstSuffixes(suffixes)
+	if err != nil {
+		return 0, nil, err
+	}
+	re, err := state.compileRegex(reStr, parsedSuffixes.ignoreCase)
 	if err != nil {
 		return 0, nil, err
 	}
+	// a single '%' stands for the replacement of the previous substitution
+	if replacement == "%" {
+		if state.lastSubstRE == nil {
+			return 0, nil, ErrNoPreviousRegex
+		}
+		replacement = state.lastSubstReplacement
+	} else {
+		replacement = convertReplacement(replacement)
+	}
 	state.lastSubstRE = re
 	state.lastSubstReplacement = replacement
-	state.lastSubstSuffixes = suffixes
-	return replaceLines(writer, startLineNbr, endLineNbr, state, re, replacement, suffixes)
+	state.lastSubstSuffixes = parsedSuffixes
+	return replaceLines(writer, startLineNbr, endLineNbr, state, re, replacement, parsedSuffixes)
+}
+
+/*
+ Compiles the regex. The regex matches case-insensitively if ignoreCase is set
+ or if case-insensitive matching has been switched on for all regexes (see state.IgnoreCase).
+*/
+func (state *State) compileRegex(reStr string, ignoreCase bool) (*regexp.Regexp, error) {
+	if ignoreCase || state.IgnoreCase {
+		reStr = "(?i)" + reStr
+	}
+	return regexp.Compile(reStr)
+}
+
+/*
+ Returns true if the regex matches the text of the line (without its trailing newline).
+*/
+func matchesLine(re *regexp.Regexp, line *Line) bool {
+	return re.MatchString(strings.TrimSuffix(line.Line, "\n"))
+}
+
+/*
+ Converts the replacement text of an 's' command to the template syntax of regexp.Expand:
+ an unescaped '&' becomes the whole match, '\1'..'\9' become the corresponding capture groups,
+ any other character preceded by a backslash is taken literally, and '$' is escaped.
+*/
+func convertReplacement(replacement string) string {
+	var sb strings.Builder
+	for i := 0; i < len(replacement); i++ {
+		ch := replacement[i]
+		if ch == '\\' && i+1 < len(replacement) {
+			i++
+			ch = replacement[i]
+			if ch >= '1' && ch <= '9' {
+				sb.WriteString("${" + string(ch) + "}")
+				continue
+			}
+		} else if ch == '&' {
+			sb.WriteString("${0}")
+			continue
+		}
+		if ch == '$' {
+			sb.WriteString("$$")
+		} else {
+			sb.WriteByte(ch)
+		}
+	}
+	return sb.String()
 }
 
 /*
  Replace lines between start and end matching the given regexp.
- suffixes: gpln or <count> (see doc)
 
  Returns:
   - number of lines matched
   - a list of undo objects to undo these changes (empty list if no lines changed)
+
+ If interrupted (see state.Interrupt), the lines changed so far are returned together with ErrInterrupted.
 */
 func replaceLines(writer io.Writer, startLineNbr, endLineNbr int,
-	state *State, re *regexp.Regexp, replacement, suffixes string) (int, *list.List, error) {
+	state *State, re *regexp.Regexp, replacement string, suffixes substSuffixes) (int, *list.List, error) {
 
 	// evaluate suffixes
-	printLineNumbers := strings.Contains(suffixes, suffixNumber)
-	printLine := strings.Contains(suffixes, suffixPrint)
-	printLineList := strings.Contains(suffixes, suffixList)
-	if printLineList {
-		fmt.Fprintf(writer, "(suffix %s not supported, defaulting to %s)", suffixList, suffixPrint)
-		printLine = true
-	}
-	//global := strings.Contains(suffixes, suffixGlobal)
+	printLineNumbers := strings.Contains(suffixes.print, suffixNumber)
+	printLine := strings.Contains(suffixes.print, suffixPrint)
+	printLineList := strings.Contains(suffixes.print, suffixList)
 
-	moveToLine(startLineNbr, state)
+	if err := checkLineRange(startLineNbr, endLineNbr, state.Buffer); err != nil {
+		return 0, nil, err
+	}
 	nbrLinesMatched := 0
+	lastLineMatched := 0
+	var lastReplacements [][]int // the positions of the replaced text in the last line changed
 	undoList := list.New()
+	var interrupted error
 
-	el := state.dotline
 	for lineNbr := startLineNbr; lineNbr <= endLineNbr; lineNbr++ {
-		line := el.Value.(Line)
-		if re.MatchString(line.Line) {
+		// the lines changed so far are kept, and can be undone
+		if interrupted = state.checkInterrupt(); interrupted != nil {
+			break
+		}
+		linePtr, err := state.Buffer.Get(lineNbr)
+		if err != nil {
+			return 0, nil, err
+		}
+		line := *linePtr
+		if changedLine, spans, replaced := replaceMatches(re, line.Line, replacement, suffixes); replaced {
 			nbrLinesMatched++
-			// currently always "global" -- check out ReplaceAllFunc possibly?
-			changedLine := re.ReplaceAllString(line.Line, replacement)
-			if printLine || printLineNumbers {
-				_printLine(writer, lineNbr, changedLine, printLineNumbers)
+			// an (escaped) newline in the replacement splits the line
+			newLines := strings.SplitAfter(changedLine, "\n")
+			if len(newLines) > 1 && newLines[len(newLines)-1] == "" {
+				newLines = newLines[:len(newLines)-1]
+			}
+			if err := state.Buffer.Set(lineNbr, Line{newLines[0]}); err != nil {
+				return 0, nil, err
 			}
-			el.Value = Line{changedLine}
-			// create undo command -- is handled as a 'change' on this line
-			currentLine, err := newAddress(strconv.Itoa(lineNbr))
+			state.lineChanged(lineNbr)
+			if len(newLines) > 1 {
+				insertedLines := list.New()
+				for _, newLine := range newLines[1:] {
+					insertedLines.PushBack(Line{newLine})
+				}
+				if err := state.Buffer.InsertAfter(lineNbr, insertedLines); err != nil {
+					return 0, nil, err
+				}
+				state.linesInserted(lineNbr, insertedLines.Len())
+			}
+			// create undo command -- is handled as a 'change' on the resulting line(s)
+			firstLine, err := newAddress(strconv.Itoa(lineNbr))
 			if err != nil {
 				return 0, nil, err
 			}
-			undoCommand := Command{addrRange: AddressRange{currentLine, currentLine, separatorComma}, cmd: commandChange, restOfCmd: ""}
+			lineNbr += len(newLines) - 1
+			endLineNbr += len(newLines) - 1
+			lastLine, err := newAddress(strconv.Itoa(lineNbr))
+			if err != nil {
+				return 0, nil, err
+			}
+			lastLineMatched = lineNbr
+			lastReplacements = nil
+			if len(newLines) == 1 {
+				lastReplacements = spans
+			}
+			undoCommand := Command{addrRange: AddressRange{firstLine, lastLine, separatorComma}, cmd: commandChange, restOfCmd: ""}
 			tmpList := list.New()
 			tmpList.PushFront(line)
-			undoList.PushBack(Undo{undoCommand, tmpList, Command{} /* TODO */})
+			undoList.PushBack(Undo{cmd: undoCommand, text: tmpList})
 		}
+	}
+	// the current line is set to the last line changed, otherwise remains unchanged
+	if lastLineMatched != 0 {
+		if err := moveToLine(lastLineMatched, state); err != nil {
+			return 0, nil, err
+		}
+		// the print suffixes apply to the last line changed
+		if printLine || printLineNumbers || printLineList {
+			line, err := state.Buffer.Get(lastLineMatched)
+			if err != nil {
+				return 0, nil, err
+			}
+			// the replaced text is highlighted when colouring is on
+			state.lineRenderer(writer, nil).printLine(writer, lastLineMatched, line.Line, printLineNumbers, printLineList, lastReplacements)
+		}
+	}
+	return nbrLinesMatched, undoList, interrupted
+}
 
-		el = el.Next()
+/*
+ Replaces the matches of the regexp in the line: all matches if suffixes.global is set,
+ otherwise only the suffixes.count-th match.
+ The trailing newline of the line is not part of the text being matched.
+ Returns the new line, the positions of the replacement texts in the new line, and false if no match was replaced.
+*/
+func replaceMatches(re *regexp.Regexp, line, replacement string, suffixes substSuffixes) (string, [][]int, bool) {
+	if strings.HasSuffix(line, "\n") {
+		changedLine, spans, replaced := replaceMatches(re, strings.TrimSuffix(line, "\n"), replacement, suffixes)
+		return changedLine + "\n", spans, replaced
+	}
+	matches := re.FindAllStringSubmatchIndex(line, -1)
+	if len(matches) == 0 || (!suffixes.global && len(matches) < suffixes.count) {
+		return line, nil, false
+	}
+	var result []byte
+	var spans [][]int
+	lastIndex := 0
+	for i, match := range matches {
+		if !suffixes.global && i+1 != suffixes.count {
+			continue
+		}
+		result = append(result, line[lastIndex:match[0]]...)
+		start := len(result)
+		result = re.ExpandString(result, replacement, line, match)
+		spans = append(spans, []int{start, len(result)})
+		lastIndex = match[1]
 	}
-	return nbrLinesMatched, undoList, nil
+	result = append(result, line[lastIndex:]...)
+	return string(result), spans, true
 }
 
 /*
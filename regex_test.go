@@ -1,8 +1,10 @@
 package red
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
+	"io"
 	"regexp"
 	"strings"
 	"testing"
@@ -10,7 +12,7 @@ import (
 
 func TestSubstitute(t *testing.T) {
 	state := State{}
-	state.Buffer = createListOfLines([]string{"rjo", "rjo", "my name is rjo", "bar"})
+	state.Buffer = createBuffer([]string{"rjo", "rjo", "my name is rjo", "bar"})
 
 	// to capture the output
 	var buff bytes.Buffer // implements io.Writer
@@ -22,12 +24,230 @@ func TestSubstitute(t *testing.T) {
 	if nbrLinesChanged != 2 {
 		t.Fatalf("wrong number of lines changed, expected %d but got %d", 2, nbrLinesChanged)
 	}
-	if buff.String() != "foobar\nmy name is foobar\n" {
+	// only the last line changed is printed
+	if buff.String() != "my name is foobar\n" {
 		t.Fatalf("changed lines '%s'", buff.String())
 	}
 
 }
 
+func TestSubstituteCount(t *testing.T) {
+	data := []struct {
+		cmd            string
+		expectedBuffer string
+	}{
+		{"s/a/x/", "xaa\nb\n"},
+		{"s/a/x/g", "xxx\nb\n"},
+		{"s/a/x/2", "axa\nb\n"},
+		{"s/a/x/3p", "aax\nb\n"},
+		{"s/a*/x/g", "x\nb\n"},
+		{"1,$s/b*/x/g", "xaxaxax\nx\n"},
+		{"s/$/!/", "aaa!\nb\n"},
+	}
+	for i, test := range data {
+		t.Run(fmt.Sprintf("test %d: >>%s<<", i, test.cmd), func(t *testing.T) {
+			state := resetState([]string{"aaa", "b"})
+			state.lineNbr = 1
+			if err := processCommandLine(t, state, test.cmd); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertBufferContents(t, state.Buffer, test.expectedBuffer)
+		})
+	}
+}
+
+func TestSubstituteIgnoreCase(t *testing.T) {
+	data := []struct {
+		cmd            string
+		ignoreCase     bool // global flag
+		expectedBuffer string
+	}{
+		{"s/a/x/g", false, "xAx\nB\n"},
+		{"s/a/x/gI", false, "xxx\nB\n"},
+		{"s/a/x/Ig", false, "xxx\nB\n"},
+		{"s/a/x/2I", false, "axa\nB\n"},
+		{"s/a/x/g", true, "xxx\nB\n"},
+		{"/b/Is/b/x/I", false, "aAa\nx\n"},
+		{"/b/s/b/x/", true, "aAa\nx\n"},
+		{"g/b/s/./x/", true, "aAa\nx\n"},
+	}
+	for i, test := range data {
+		t.Run(fmt.Sprintf("test %d: >>%s<<", i, test.cmd), func(t *testing.T) {
+			state := resetState([]string{"aAa", "B"})
+			state.lineNbr = 1
+			state.IgnoreCase = test.ignoreCase
+			state.Stdout = io.Discard
+			if err := processCommandLine(t, state, test.cmd); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertBufferContents(t, state.Buffer, test.expectedBuffer)
+		})
+	}
+}
+
+func TestIgnoreCaseSuffixAndInsertText(t *testing.T) {
+	data := []struct {
+		cmd            string
+		expectedBuffer string
+	}{
+		{"/foo/I/# /", "a\n# foo\nFoo\n"},
+		{"/foo/ I/# /", "a\n# foo\nFoo\n"},
+		{"/FOO/II/# /", "a\n# foo\nFoo\n"},
+		{"/FOO/I;/FOO/II/# /", "a\n# foo\n# Foo\n"},
+		{"/FOO/IA/!/", "a\nfoo!\nFoo\n"},
+		{"/FOO/I+1d", "a\nfoo\n"},
+	}
+	for i, test := range data {
+		t.Run(fmt.Sprintf("test %d: >>%s<<", i, test.cmd), func(t *testing.T) {
+			state := resetState([]string{"a", "foo", "Foo"})
+			state.lineNbr = 1
+			if err := processCommandLine(t, state, test.cmd); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertBufferContents(t, state.Buffer, test.expectedBuffer)
+		})
+	}
+}
+
+func TestToggleIgnoreCase(t *testing.T) {
+	state := resetState([]string{"aAa", "B"})
+	state.lineNbr = 1
+	state.Stdout = io.Discard
+	if err := processCommandLine(t, state, "/b/"); err == nil {
+		t.Fatalf("expected error, case-sensitive search should not match")
+	}
+	for _, cmdLine := range []string{"~", "/b/"} {
+		if err := processCommandLine(t, state, cmdLine); err != nil {
+			t.Fatalf("command '%s': error: %s", cmdLine, err)
+		}
+	}
+	assertInt(t, "wrong state.lineNbr!", state.lineNbr, 2)
+	if err := processCommandLine(t, state, "~"); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if state.IgnoreCase {
+		t.Fatalf("expected case-insensitive matching to be switched off")
+	}
+	if err := processCommandLine(t, state, "1~"); err == nil {
+		t.Fatalf("expected error, no address allowed")
+	}
+}
+
+func TestSubstituteReplacement(t *testing.T) {
+	data := []struct {
+		cmd            string
+		expectedBuffer string
+	}{
+		{"s/b+/[&]/", "a[bb]c 1-2\n"},
+		{"s/b+/\\&/", "a&c 1-2\n"},
+		{"s/([0-9])-([0-9])/\\2-\\1/", "abbc 2-1\n"},
+		{"s/(a)(b+)/\\2&\\1/", "bbabbac 1-2\n"},
+		{"s/(x)?a/<\\1>/", "<>bbc 1-2\n"}, // a group which does not match is replaced by the empty string
+		{"s/a/$1\\$/", "$1$bbc 1-2\n"},
+		{"s/c/\\\\/", "abb\\ 1-2\n"},
+	}
+	for i, test := range data {
+		t.Run(fmt.Sprintf("test %d: >>%s<<", i, test.cmd), func(t *testing.T) {
+			state := resetState([]string{"abbc 1-2"})
+			state.lineNbr = 1
+			if err := processCommandLine(t, state, test.cmd); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertBufferContents(t, state.Buffer, test.expectedBuffer)
+		})
+	}
+}
+
+func TestSubstitutePreviousReplacement(t *testing.T) {
+	state := resetState([]string{"a1", "b2"})
+	state.lineNbr = 1
+	if err := processCommandLine(t, state, "s/[0-9]/<&>/"); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if err := processCommandLine(t, state, "2s/b/%/"); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertBufferContents(t, state.Buffer, "a<1>\n<b>2\n")
+}
+
+func TestSubstituteRepeat(t *testing.T) {
+	state := resetState([]string{"a a", "a a", "a a", "a b", "a a"})
+	state.lineNbr = 1
+	var output bytes.Buffer
+	state.Stdout = &output
+	steps := []struct {
+		cmd            string
+		expectedBuffer string
+		expectedOutput string
+	}{
+		{"s/a/x/", "x a\na a\na a\na b\na a\n", ""},
+		{"2s", "x a\nx a\na a\na b\na a\n", ""},
+		{"3sg", "x a\nx a\nx x\na b\na a\n", ""},
+		{"1s", "x x\nx a\nx x\na b\na a\n", ""}, // the global suffix is still set
+		{"2s1p", "x x\nx x\nx x\na b\na a\n", "x x\n"},
+		{"5s2p", "x x\nx x\nx x\na b\na x\n", ""}, // 'p' toggles the print suffix again
+		{"g/b/", "x x\nx x\nx x\na b\na x\n", "a b\n"},
+		{"4s1r", "x x\nx x\nx x\na x\na x\n", ""}, // uses the regex of the last search
+	}
+	for _, step := range steps {
+		output.Reset()
+		if err := processCommandLine(t, state, step.cmd); err != nil {
+			t.Fatalf("command '%s': error: %s", step.cmd, err)
+		}
+		assertBufferContents(t, state.Buffer, step.expectedBuffer)
+		assertString(t, "wrong output for "+step.cmd, strings.Replace(output.String(), "1 lines changed\n", "", 1), step.expectedOutput)
+	}
+	for _, cmdLine := range []string{"s2g", "s0"} {
+		if err := processCommandLine(t, state, cmdLine); err == nil {
+			t.Fatalf("command '%s': expected error", cmdLine)
+		}
+	}
+}
+
+func TestSubstituteSplitLine(t *testing.T) {
+	data := []struct {
+		cmd             string
+		expectedBuffer  string
+		expectedLineNbr int
+		expectedMark    int
+	}{
+		{"1s/ /\\\n/g", "a\nb\nc\nd e\n", 3, 4},
+		{"1,2s/ /\\\n/", "a\nb c\nd\ne\n", 4, 3},
+		{"2s/e$/\\\n/", "a b c\nd \n\n", 3, 2},
+	}
+	for i, test := range data {
+		t.Run(fmt.Sprintf("test %d: >>%s<<", i, test.cmd), func(t *testing.T) {
+			state := resetState([]string{"a b c", "d e"})
+			state.lineNbr = 1
+			state.addMark("x", 2)
+			if err := processCommandLine(t, state, test.cmd); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertBufferContents(t, state.Buffer, test.expectedBuffer)
+			assertInt(t, "wrong state.lineNbr!", state.lineNbr, test.expectedLineNbr)
+			assertInt(t, "wrong mark", state.marks["x"], test.expectedMark)
+			if err := processCommandLine(t, state, "u"); err != nil {
+				t.Fatalf("undo: error: %s", err)
+			}
+			assertBufferContents(t, state.Buffer, "a b c\nd e\n")
+		})
+	}
+}
+
+func TestSubstituteCountErrors(t *testing.T) {
+	data := []string{"s/a/x/4", "s/a/x/0", "s/a/x/2g", "s/a/x/q"}
+	for i, test := range data {
+		t.Run(fmt.Sprintf("test %d: >>%s<<", i, test), func(t *testing.T) {
+			state := resetState([]string{"aaa", "b"})
+			state.lineNbr = 1
+			if err := processCommandLine(t, state, test); err == nil {
+				t.Fatalf("expected error")
+			}
+			assertBufferContents(t, state.Buffer, "aaa\nb\n")
+		})
+	}
+}
+
 func TestFindNamedMatches(t *testing.T) {
 	//re := regexp.MustCompile(`(?P<special>[\.\$ ]|'[a-z]|\/.*\/|\?.*\?|[+-]?\d*|[-+])`)
 	re := regexp.MustCompile(`(?P<special>[\.\$])|(?P<mark>'[a-z])|(?P<reFor>\/[^/]*\/)|(?P<reBack>\?[^\?]*\?)|(?P<signednbr>[+-]?\d+)|(?P<incdec>[-+])`)
@@ -48,8 +268,7 @@ func TestFindNamedMatches(t *testing.T) {
 			// char(s) were skipped during the previous call of FindStringIndex -- either spaces or error
 			trimmed := strings.TrimSpace(str[index:startOfMatch])
 			if len(trimmed) != 0 {
-				locnString, errorDesc := analyzeParseError(index, startOfMatch, trimmed)
-				t.Fatalf("%s at posn %s: >>%s<<", errorDesc, locnString, str[index:startOfMatch])
+				t.Fatalf("unrecognised at posn %d-%d: >>%s<<", index, startOfMatch, trimmed)
 			}
 		}
 		fmt.Printf("%02d-%02d >>%s<<\n", startOfMatch, index+loc[1], str[startOfMatch:index+loc[1]])
@@ -60,3 +279,155 @@ func TestFindNamedMatches(t *testing.T) {
 	}
 	//t.Fail()
 }
+
+func TestGlobal(t *testing.T) {
+	data := []struct {
+		buffer          []string
+		cmd             string
+		expectedBuffer  string
+		expectedLineNbr int
+	}{
+		{[]string{"x1", "a", "x2", "b"}, "g/x/d", "a\nb\n", 2},
+		{[]string{"x1", "a", "x2", "b"}, "2,$g/x/d", "x1\na\nb\n", 3},
+		{[]string{"x1", "a", "x2", "b"}, "g/^[ab]/s/^/!/", "x1\n!a\nx2\n!b\n", 4},
+		// lines without a match are not an error
+		{[]string{"x1", "a", "x2", "b"}, "g/./s/x/y/", "y1\na\ny2\nb\n", 4},
+		// the second line is modified when processing the first, and is therefore unmarked
+		{[]string{"x1", "x2", "x3", "z"}, "g/x/+1s/x/y/", "x1\ny2\nx3\nz\n", 3},
+		{[]string{"x1", "a", "x2"}, "g/x/m0", "x2\nx1\na\n", 1},
+		// multi-line command-list
+		{[]string{"x1", "a", "x2"}, "g/x/s/x/y/\\\na\\\nnew", "y1\nnew\na\ny2\nnew\n", 5},
+		{[]string{"x1", "a", "x2"}, "g/x/i\\\nnew\\\n.\\\n+1d", "new\na\nnew\n", 3},
+		{[]string{"x1", "a"}, "g/x/a\\\n\\.\\\n.", "x1\n.\na\n", 2},
+		// no match: current line is unchanged
+		{[]string{"x1", "a", "x2"}, "g/z/d", "x1\na\nx2\n", 2},
+		// lines are tracked by identity: the second line has the same content after the change, but is still unmarked (and not processed again)
+		{[]string{"a", "a", "c"}, "g/a/+1s/a/a/\\\ns/^/!/", "a\n!a\nc\n", 2},
+	}
+	for i, test := range data {
+		t.Run(fmt.Sprintf("test %d: >>%s<<", i, test.cmd), func(t *testing.T) {
+			state := resetState(test.buffer)
+			if err := moveToLine(2, state); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			cmd, err := ParseCommand(test.cmd, false)
+			if err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			if _, err = cmd.ProcessCommand(state, nil, false); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertBufferContents(t, state.Buffer, test.expectedBuffer)
+			if state.lineNbr != test.expectedLineNbr {
+				t.Fatalf("expected current line %d but got %d", test.expectedLineNbr, state.lineNbr)
+			}
+			if err = CheckInvariants(state); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+		})
+	}
+}
+
+func TestGlobalErrors(t *testing.T) {
+	data := []string{"g", "g/x", "g/x/g/x/d", "g/x/u", "g/x/d\ny", "g//d", "g/x/s/z/y/"}
+	for i, test := range data {
+		t.Run(fmt.Sprintf("test %d: >>%s<<", i, test), func(t *testing.T) {
+			state := resetState([]string{"x1", "a", "x2"})
+			cmd, err := ParseCommand(test, false)
+			if err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			if _, err = cmd.ProcessCommand(state, nil, false); err == nil {
+				t.Fatalf("expected error")
+			}
+		})
+	}
+}
+
+func TestInverseGlobal(t *testing.T) {
+	data := []struct {
+		buffer          []string
+		cmd             string
+		expectedBuffer  string
+		expectedLineNbr int
+	}{
+		{[]string{"x1", "a", "x2", "b"}, "v/x/d", "x1\nx2\n", 2},
+		{[]string{"x1", "a", "x2", "b"}, "1,3v/x/d", "x1\nx2\nb\n", 2},
+		{[]string{"x1", "a", "x2", "b"}, "v/x/s/^/!/", "x1\n!a\nx2\n!b\n", 4},
+		{[]string{"x1", "a", "x2", "b"}, "v/x/p", "x1\na\nx2\nb\n", 4},
+		{[]string{"x1", "a", "x2", "b"}, "v/x/", "x1\na\nx2\nb\n", 4},
+		{[]string{"x1", "a", "x2", "b"}, "v/x/s/a/A/\\\np", "x1\nA\nx2\nb\n", 4},
+		{[]string{"x1", "a", "x2", "b"}, "v/x/p\\\n-1d", "a\nb\n", 2},
+		// all lines match: nothing to do, current line is unchanged
+		{[]string{"x1", "x2", "x3"}, "v/x/d", "x1\nx2\nx3\n", 2},
+	}
+	for i, test := range data {
+		t.Run(fmt.Sprintf("test %d: >>%s<<", i, test.cmd), func(t *testing.T) {
+			state := resetState(test.buffer)
+			if err := moveToLine(2, state); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			cmd, err := ParseCommand(test.cmd, false)
+			if err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			if _, err = cmd.ProcessCommand(state, nil, false); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertBufferContents(t, state.Buffer, test.expectedBuffer)
+			if state.lineNbr != test.expectedLineNbr {
+				t.Fatalf("expected current line %d but got %d", test.expectedLineNbr, state.lineNbr)
+			}
+		})
+	}
+}
+
+func TestGlobalInteractive(t *testing.T) {
+	data := []struct {
+		cmd            string
+		input          string
+		expectedBuffer string
+		expectErr      bool
+	}{
+		{"G/x/", "s/x/y/\n\n&\n", "y1\na\nx2\nb\ny3\n", false},
+		{"G/x/", "d\n", "a\nx2\nb\nx3\n", false}, // EOF after the first line
+		{"G/x/", "s/x/y/\\\n+1d\n\n\n", "y1\nx2\nb\nx3\n", false},
+		{"V/x/", "d\n&\n", "x1\nx2\nx3\n", false},
+		{"2,4V/x/", "s/a/A/\n\n", "x1\nA\nx2\nb\nx3\n", false},
+		{"G/x/", "&\n", "x1\na\nx2\nb\nx3\n", true},
+		{"G/x/", "g/a/d\n", "x1\na\nx2\nb\nx3\n", true},
+		{"G/x/d", "", "x1\na\nx2\nb\nx3\n", true},
+	}
+	for i, test := range data {
+		t.Run(fmt.Sprintf("test %d: >>%s<<", i, test.cmd), func(t *testing.T) {
+			state := resetState([]string{"x1", "a", "x2", "b", "x3"})
+			state.Input = bufio.NewReader(strings.NewReader(test.input))
+			cmd, err := ParseCommand(test.cmd, false)
+			if err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			_, err = cmd.ProcessCommand(state, nil, false)
+			if test.expectErr && err == nil {
+				t.Fatalf("expected error")
+			} else if !test.expectErr && err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertBufferContents(t, state.Buffer, test.expectedBuffer)
+		})
+	}
+}
+
+func TestGlobalInteractivePrintsLines(t *testing.T) {
+	state := resetState([]string{"x1", "a", "x2"})
+	state.Input = bufio.NewReader(strings.NewReader("\n\n"))
+	var output bytes.Buffer
+	state.Stdout = &output
+	cmd, err := ParseCommand("G/x/", false)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if _, err = cmd.ProcessCommand(state, nil, false); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertString(t, "wrong output", output.String(), "x1\nx2\n")
+}
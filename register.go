@@ -0,0 +1,67 @@
+package red
+
+import (
+	"container/list"
+	"errors"
+	"strings"
+)
+
+var ErrBadRegisterName error = errors.New(`a name of a register must be '"' followed by one char: a-z or A-Z`)
+
+// prefix of the name of a register, e.g. "a
+const registerPrefix string = `"`
+
+/*
+ Parses the register given after the commands 'y', 'x' and 'X', e.g. "a.
+ Returns the name of the register in lower case, or "" if no register was given (i.e. the cut buffer is to be used),
+ and whether the name was given in upper case, which means that yanked lines are appended to the register.
+*/
+func parseRegisterName(restOfCmd string) (name string, appendTo bool, err error) {
+	restOfCmd = strings.TrimSpace(restOfCmd)
+	if restOfCmd == "" {
+		return "", false, nil
+	}
+	if len(restOfCmd) != 2 || !strings.HasPrefix(restOfCmd, registerPrefix) {
+		return "", false, ErrBadRegisterName
+	}
+	switch ch := restOfCmd[1]; {
+	case ch >= 'a' && ch <= 'z':
+		return string(ch), false, nil
+	case ch >= 'A' && ch <= 'Z':
+		return strings.ToLower(string(ch)), true, nil
+	default:
+		return "", false, ErrBadRegisterName
+	}
+}
+
+/*
+ Returns the contents of the given register, or of the cut buffer if name is "".
+ An unused register is empty.
+*/
+func (state *State) register(name string) *list.List {
+	if name == "" {
+		return state.CutBuffer
+	}
+	if lines, ok := state.registers[name]; ok {
+		return lines
+	}
+	return list.New()
+}
+
+/*
+ Stores the lines in the given register, or in the cut buffer if name is "".
+ If appendTo is set, the lines are appended to the current contents of the register.
+*/
+func (state *State) setRegister(name string, lines *list.List, appendTo bool) {
+	if appendTo {
+		newLines := list.New()
+		newLines.PushBackList(state.register(name))
+		newLines.PushBackList(lines)
+		lines = newLines
+	}
+	if name == "" {
+		state.CutBuffer = lines
+	} else {
+		state.registers[name] = lines
+	}
+}
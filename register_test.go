@@ -0,0 +1,99 @@
+package red
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseRegisterName(t *testing.T) {
+	data := []struct {
+		restOfCmd        string
+		expectedName     string
+		expectedAppendTo bool
+		expectedErr      error
+	}{
+		{"", "", false, nil},
+		{` "a`, "a", false, nil},
+		{`"z`, "z", false, nil},
+		{`"B`, "b", true, nil},
+		{`a`, "", false, ErrBadRegisterName},
+		{`"`, "", false, ErrBadRegisterName},
+		{`"1`, "", false, ErrBadRegisterName},
+		{`"ab`, "", false, ErrBadRegisterName},
+	}
+	for i, test := range data {
+		t.Run(fmt.Sprintf("test %d: >>%s<<", i, test.restOfCmd), func(t *testing.T) {
+			name, appendTo, err := parseRegisterName(test.restOfCmd)
+			if !errors.Is(err, test.expectedErr) {
+				t.Fatalf("expected error %v, got %v", test.expectedErr, err)
+			}
+			assertString(t, "wrong name", name, test.expectedName)
+			if appendTo != test.expectedAppendTo {
+				t.Fatalf("expected appendTo %t", test.expectedAppendTo)
+			}
+		})
+	}
+}
+
+func TestNamedRegisters(t *testing.T) {
+	state := resetState([]string{"1", "2", "3", "4", "5"})
+	state.lineNbr = 1
+	steps := []struct {
+		cmdLine          string
+		expectedContents string
+		expectedLineNbr  int
+	}{
+		{`1,2y "p`, "1\n2\n3\n4\n5\n", 1},
+		{`4y`, "1\n2\n3\n4\n5\n", 1},
+		{`5y "P`, "1\n2\n3\n4\n5\n", 1},
+		{`5x "p`, "1\n2\n3\n4\n5\n1\n2\n5\n", 8},
+		{`1X "p p`, "1\n2\n5\n1\n2\n3\n4\n5\n1\n2\n5\n", 3},
+		{`11x`, "1\n2\n5\n1\n2\n3\n4\n5\n1\n2\n5\n4\n", 12},
+	}
+	for _, step := range steps {
+		if err := processCommandLine(t, state, step.cmdLine); err != nil {
+			t.Fatalf("command '%s': error: %s", step.cmdLine, err)
+		}
+		assertBufferContents(t, state.Buffer, step.expectedContents)
+		assertInt(t, "wrong state.lineNbr for "+step.cmdLine, state.lineNbr, step.expectedLineNbr)
+	}
+}
+
+func TestNamedRegisterErrors(t *testing.T) {
+	for _, cmdLine := range []string{`y a`, `y "1`, `x "ab`} {
+		state := resetState([]string{"1", "2"})
+		state.lineNbr = 1
+		if err := processCommandLine(t, state, cmdLine); !errors.Is(err, ErrBadRegisterName) {
+			t.Fatalf("command '%s': expected ErrBadRegisterName, got %v", cmdLine, err)
+		}
+		assertBufferContents(t, state.Buffer, "1\n2\n")
+	}
+}
+
+func TestDeleteToRegister(t *testing.T) {
+	state := resetState([]string{"a1", "b", "a2", "c", "a3"})
+	state.lineNbr = 1
+	state.Input = bufio.NewReader(strings.NewReader("new\n.\n")) // input for the command 'c'
+	steps := []struct {
+		cmdLine          string
+		expectedContents string
+		expectedLineNbr  int
+	}{
+		{`4d "b`, "a1\nb\na2\na3\n", 4},
+		{`g/a/d "A`, "b\n", 1},
+		{`1x "a`, "b\na1\na2\na3\n", 4},
+		{`1c "b`, "new\na1\na2\na3\n", 1},
+		{`4x "b`, "new\na1\na2\na3\nb\n", 5},
+	}
+	for _, step := range steps {
+		if err := processCommandLine(t, state, step.cmdLine); err != nil {
+			t.Fatalf("command '%s': error: %s", step.cmdLine, err)
+		}
+		assertBufferContents(t, state.Buffer, step.expectedContents)
+		assertInt(t, "wrong state.lineNbr for "+step.cmdLine, state.lineNbr, step.expectedLineNbr)
+	}
+	assertInt(t, "cut buffer should not have been used", state.CutBuffer.Len(), 0)
+}
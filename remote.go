@@ -0,0 +1,230 @@
+package red
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+var (
+	ErrReadOnly           error = errors.New("file is read-only")
+	ErrInvalidURL         error = errors.New("invalid URL")
+	ErrRemoteNotFound     error = errors.New("remote file could not be read")
+	ErrAppendNotSupported error = errors.New("cannot append to a remote file")
+)
+
+/*
+RemoteFiles gives access to files identified by URLs, e.g. https://host/file.
+*/
+type RemoteFiles interface {
+	// Open returns a reader of the contents of the file
+	Open(url string) (io.ReadCloser, error)
+	// Create returns a writer which replaces the contents of the file; the file has been written once the writer is closed
+	Create(url string) (io.WriteCloser, error)
+}
+
+// the RemoteFiles for each URL scheme
+var remoteFiles = map[string]RemoteFiles{
+	"http":  httpFiles{},
+	"https": httpFiles{},
+	"ssh":   sshFiles{},
+	"sftp":  sshFiles{}, // for compatibility: the sftp protocol is not used
+}
+
+// the maximum time for reading a file via HTTP(S), including the transfer of its contents
+var httpTimeout time.Duration = 60 * time.Second
+
+/*
+RegisterRemoteFiles registers the RemoteFiles for URLs with the given scheme (e.g. "s3"), replacing any existing registration.
+*/
+func RegisterRemoteFiles(scheme string, files RemoteFiles) {
+	remoteFiles[scheme] = files
+}
+
+/*
+ Returns the RemoteFiles responsible for the filename, if it is a URL with a registered scheme.
+*/
+func findRemoteFiles(filename string) (RemoteFiles, bool) {
+	i := strings.Index(filename, "://")
+	if i <= 0 {
+		return nil, false
+	}
+	files, ok := remoteFiles[filename[:i]]
+	return files, ok
+}
+
+/*
+ Writes the lines to the remote file, using the codec if required.
+ (Remote files are not replaced atomically.)
+*/
+func writeRemoteFile(files RemoteFiles, filename string, buffer Buffer, startLineNbr, endLineNbr int) (nbrBytesWritten int, err error) {
+	codec := findFileCodec(filename, nil)
+	if codec != nil && codec.NewWriter == nil {
+		return 0, fmt.Errorf("%s: %w", codec.Name, errWriteNotSupported)
+	}
+	w, err := files.Create(filename)
+	if err != nil {
+		return 0, err
+	}
+	if nbrBytesWritten, err = writeWithCodec(w, codec, buffer, startLineNbr, endLineNbr); err != nil {
+		w.Close()
+		return 0, err
+	}
+	return nbrBytesWritten, w.Close()
+}
+
+/*
+ Files which are read via HTTP(S). These files are read-only.
+*/
+type httpFiles struct{}
+
+func (httpFiles) Open(url string) (io.ReadCloser, error) {
+	// a server which does not respond must not block the editor
+	client := &http.Client{Timeout: httpTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s", ErrRemoteNotFound, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+func (httpFiles) Create(url string) (io.WriteCloser, error) {
+	return nil, fmt.Errorf("%s: %w", url, ErrReadOnly)
+}
+
+/*
+ Files which are read and written using the ssh command, e.g. ssh://user@host:port/path/to/file.
+ The file is read by running 'cat' on the remote host, and written by 'cat >', i.e. the remote host needs a shell,
+ but no sftp server. The scheme 'sftp' is handled in the same way.
+ A path starting with '/~/' is relative to the home directory.
+*/
+type sshFiles struct{}
+
+func (sshFiles) Open(url string) (io.ReadCloser, error) {
+	cmd, err := sshCommand(url, "cat")
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &sshReader{stdout, cmd}, nil
+}
+
+func (sshFiles) Create(url string) (io.WriteCloser, error) {
+	cmd, err := sshCommand(url, "cat >")
+	if err != nil {
+		return nil, err
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &sshWriter{stdin, cmd}, nil
+}
+
+/*
+ Returns the ssh command which runs the remote command with the path of the file as its argument.
+*/
+func sshCommand(rawURL, remoteCommand string) (*exec.Cmd, error) {
+	args, path, err := sshArgs(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return exec.Command("ssh", append(args, remoteCommand+" "+path)...), nil
+}
+
+/*
+ Returns the arguments of the ssh command for the URL, and the (quoted) path of the file on the remote host.
+*/
+func sshArgs(rawURL string) (args []string, path string, err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %s", ErrInvalidURL, err)
+	}
+	if u.Hostname() == "" || u.Path == "" || u.Path == "/" {
+		return nil, "", fmt.Errorf("%w: %s", ErrInvalidURL, rawURL)
+	}
+	if u.Port() != "" {
+		args = append(args, "-p", u.Port())
+	}
+	host := u.Hostname()
+	if u.User != nil {
+		host = u.User.Username() + "@" + host
+	}
+	args = append(args, "--", host)
+	if strings.HasPrefix(u.Path, "/~/") {
+		// the home directory must not be quoted
+		return args, "~/" + shellQuote(u.Path[len("/~/"):]), nil
+	}
+	return args, shellQuote(u.Path), nil
+}
+
+/*
+ Quotes the string for the shell.
+*/
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// reads the output of the ssh command; at the end of the output, an error is returned if the command failed
+type sshReader struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+}
+
+func (r *sshReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if err == io.EOF {
+		if waitErr := r.wait(); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+func (r *sshReader) Close() error {
+	r.ReadCloser.Close()
+	return r.wait()
+}
+
+func (r *sshReader) wait() error {
+	if r.cmd.ProcessState != nil {
+		// already finished
+		return nil
+	}
+	if err := r.cmd.Wait(); err != nil {
+		return fmt.Errorf("ssh: %w", err)
+	}
+	return nil
+}
+
+// writes to the input of the ssh command; the command is waited for when closed
+type sshWriter struct {
+	io.WriteCloser
+	cmd *exec.Cmd
+}
+
+func (w *sshWriter) Close() error {
+	w.WriteCloser.Close()
+	if err := w.cmd.Wait(); err != nil {
+		return fmt.Errorf("ssh: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package red
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPFiles(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/file.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, "1\n2\n")
+	}))
+	defer server.Close()
+
+	state := NewState()
+	state.Stdout = io.Discard
+	if err := processCommandLine(t, state, "e "+server.URL+"/file.txt"); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertBufferContents(t, state.Buffer, "1\n2\n")
+	assertString(t, "wrong default filename", state.defaultFilename, server.URL+"/file.txt")
+	if err := processCommandLine(t, state, "w"); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("expected ErrReadOnly, got %v", err)
+	}
+	if err := processCommandLine(t, state, "E "+server.URL+"/missing.txt"); !errors.Is(err, ErrRemoteNotFound) {
+		t.Fatalf("expected ErrRemoteNotFound, got %v", err)
+	}
+}
+
+func TestHTTPFilesTimeout(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+	defer func(timeout time.Duration) { httpTimeout = timeout }(httpTimeout)
+	httpTimeout = 50 * time.Millisecond
+
+	if _, err := (httpFiles{}).Open(server.URL + "/file.txt"); err == nil {
+		t.Fatalf("expected timeout")
+	}
+}
+
+/*
+ RemoteFiles which are stored in memory.
+*/
+type memoryFiles map[string]string
+
+func (m memoryFiles) Open(url string) (io.ReadCloser, error) {
+	contents, ok := m[url]
+	if !ok {
+		return nil, ErrRemoteNotFound
+	}
+	return io.NopCloser(strings.NewReader(contents)), nil
+}
+
+func (m memoryFiles) Create(url string) (io.WriteCloser, error) {
+	return &memoryFile{files: m, url: url}, nil
+}
+
+type memoryFile struct {
+	bytes.Buffer
+	files memoryFiles
+	url   string
+}
+
+func (f *memoryFile) Close() error {
+	f.files[f.url] = f.String()
+	return nil
+}
+
+func TestRegisterRemoteFiles(t *testing.T) {
+	files := memoryFiles{"mem://file.txt": "1\n2\n"}
+	RegisterRemoteFiles("mem", files)
+	defer delete(remoteFiles, "mem")
+
+	state := NewState()
+	state.Stdout = io.Discard
+	for _, cmdLine := range []string{"e mem://file.txt", "1d", "w", "w mem://copy.txt", "W mem://copy.txt"} {
+		err := processCommandLine(t, state, cmdLine)
+		if cmdLine[0] == 'W' {
+			if !errors.Is(err, ErrAppendNotSupported) {
+				t.Fatalf("expected ErrAppendNotSupported, got %v", err)
+			}
+		} else if err != nil {
+			t.Fatalf("command '%s': error: %s", cmdLine, err)
+		}
+	}
+	assertString(t, "wrong file contents", files["mem://file.txt"], "2\n")
+	assertString(t, "wrong file contents", files["mem://copy.txt"], "2\n")
+}
+
+func TestSSHArgs(t *testing.T) {
+	data := []struct {
+		url          string
+		expectedArgs string
+		expectedPath string
+	}{
+		{"ssh://host/etc/hosts", "-- host", "'/etc/hosts'"},
+		{"sftp://host/etc/hosts", "-- host", "'/etc/hosts'"},
+		{"sftp://user@host:2222/tmp/it's", "-p 2222 -- user@host", `'/tmp/it'\''s'`},
+		{"sftp://host/~/notes.txt", "-- host", "~/'notes.txt'"},
+	}
+	for _, test := range data {
+		args, path, err := sshArgs(test.url)
+		if err != nil {
+			t.Fatalf("%s: error: %s", test.url, err)
+		}
+		assertString(t, "wrong args for "+test.url, strings.Join(args, " "), test.expectedArgs)
+		assertString(t, "wrong path for "+test.url, path, test.expectedPath)
+	}
+	for _, url := range []string{"sftp://host", "sftp:///file", "sftp://host/"} {
+		if _, _, err := sshArgs(url); !errors.Is(err, ErrInvalidURL) {
+			t.Fatalf("%s: expected ErrInvalidURL, got %v", url, err)
+		}
+	}
+}
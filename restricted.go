@@ -0,0 +1,43 @@
+package red
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+)
+
+var ErrRestricted error = errors.New("not allowed in restricted mode")
+
+/*
+ In restricted mode (see ProgramFlags.Restricted), returns an error unless the file given to 'e', 'r' or 'w'
+ is one of the files being edited (see SetFileList). Shell commands and absolute paths are rejected.
+ An empty filename (i.e. the default filename) is always allowed.
+*/
+func (state *State) checkRestrictedFilename(filename string) error {
+	if !state.Restricted || filename == "" {
+		return nil
+	}
+	if isShellCommand(filename) {
+		return fmt.Errorf("%w: shell command", ErrRestricted)
+	}
+	for _, allowed := range state.fileList {
+		if filename == allowed {
+			return nil
+		}
+	}
+	if filepath.IsAbs(filename) {
+		return fmt.Errorf("%w: absolute path '%s'", ErrRestricted, filename)
+	}
+	return fmt.Errorf("%w: '%s'", ErrRestricted, filename)
+}
+
+/*
+ Sets the default filename (command 'f'), unless in restricted mode.
+*/
+func (state *State) setDefaultFilename(filename string) error {
+	if state.Restricted && filename != state.defaultFilename {
+		return fmt.Errorf("%s: %w", commandFilename, ErrRestricted)
+	}
+	state.defaultFilename = filename
+	return nil
+}
@@ -0,0 +1,81 @@
+package red
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRestrictedMode(t *testing.T) {
+	data := []struct {
+		cmdLine string
+		allowed bool
+	}{
+		{"e", true},
+		{"e file.txt", true},
+		{"r other.txt", true},
+		{"w", true},
+		{"w file.txt", true},
+		{"W other.txt", true},
+		{"f file.txt", true},
+		{"e new.txt", false},
+		{"r ../file.txt", false},
+		{"w /etc/passwd", false},
+		{"f new.txt", false},
+		{"f", false},
+		{"e !ls", false},
+		{"r !ls", false},
+		{"w !cat", false},
+		{"!ls", false},
+		{"1,2!sort", false},
+		{"set backup=~", false},
+		{"set backupdir=/tmp", false},
+		{"set backup", true},
+		{"set verbose=on", true},
+	}
+	for i, test := range data {
+		t.Run(fmt.Sprintf("test %d: >>%s<<", i, test.cmdLine), func(t *testing.T) {
+			state := resetState([]string{"1", "2"})
+			state.FileSystem = memoryFileSystem{fstest.MapFS{
+				"file.txt":  {Data: []byte("a\n")},
+				"other.txt": {Data: []byte("b\n")},
+			}}
+			state.SetFileList([]string{"file.txt", "other.txt"})
+			state.defaultFilename = "file.txt"
+			state.Restricted = true
+			state.Stdout = io.Discard
+			var commands []string
+			state.Shell = stubShell(&commands)
+
+			err := processCommandLine(t, state, test.cmdLine)
+			if test.allowed && err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			if !test.allowed && !errors.Is(err, ErrRestricted) {
+				t.Fatalf("expected restricted error, got %v", err)
+			}
+			assertString(t, "default filename changed", state.defaultFilename, "file.txt")
+			assertInt(t, "nbr of shell commands executed", len(commands), 0)
+		})
+	}
+}
+
+func TestRestrictedModeNextFile(t *testing.T) {
+	state := resetState([]string{})
+	state.FileSystem = memoryFileSystem{fstest.MapFS{
+		"file.txt":  {Data: []byte("a\n")},
+		"other.txt": {Data: []byte("b\n")},
+	}}
+	state.SetFileList([]string{"file.txt", "other.txt"})
+	state.Restricted = true
+	state.Stdout = io.Discard
+	for _, cmdLine := range []string{"e file.txt", "fn", "s/b/c/", "w"} {
+		if err := processCommandLine(t, state, cmdLine); err != nil {
+			t.Fatalf("command '%s': error: %s", cmdLine, err)
+		}
+	}
+	assertString(t, "wrong default filename", state.defaultFilename, "other.txt")
+	assertString(t, "wrong contents of file", string(state.FileSystem.(memoryFileSystem).MapFS["other.txt"].Data), "c\n")
+}
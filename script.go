@@ -0,0 +1,96 @@
+package red
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+)
+
+/*
+RunScript executes the commands in commandFile against the contents of inputFile, and returns the transcript,
+i.e. everything the editor wrote (to stdout and stderr) interleaved with the lines it read from the commands file.
+
+ This is intended for golden-file tests: the editor runs in deterministic mode (see ProgramFlags.Deterministic),
+ each command line is shown after the prompt ':', the text for input mode follows its command,
+ and errors are reported with their messages (as after 'H'). Execution stops at 'q' or at the end of the commands file.
+ If inputFile is empty, the buffer is initially empty.
+ An error is only returned if a file cannot be read; errors of the commands are part of the transcript.
+*/
+func RunScript(inputFile, commandFile string) (string, error) {
+	f, err := os.Open(commandFile)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var transcript bytes.Buffer
+	state := NewState()
+	state.Deterministic = true
+	state.VerboseErrors = true
+	state.Stdout = &transcript
+	state.Stderr = &transcript
+	state.Stdin = &echoReader{r: bufio.NewReader(f), echo: &transcript}
+	if inputFile != "" {
+		editCmd := Command{cmd: commandEdit, restOfCmd: inputFile}
+		if err := editCmd.Edit(state); err != nil {
+			return transcript.String(), err
+		}
+	}
+	reader := state.InputReader()
+	for {
+		transcript.WriteString(state.Prompt + " ")
+		cmdLine, err := ReadCommandLine(reader)
+		if err == io.EOF {
+			transcript.WriteString("\n")
+			break
+		}
+		if err != nil {
+			state.ReportError(err)
+			continue
+		}
+		cmd, err := state.ParseCommand(cmdLine)
+		if err != nil {
+			state.ReportError(err)
+			continue
+		}
+		quit, err := cmd.ProcessCommand(state, nil, false)
+		if err != nil {
+			state.ReportError(err)
+		}
+		if quit {
+			break
+		}
+	}
+	return transcript.String(), nil
+}
+
+/*
+ Returns the lines of 'r' and writes each line to 'echo' when it is read.
+ Each call to Read returns at most one line, so that a buffered reader on top of it only reads (and echoes)
+ the lines as they are needed.
+*/
+type echoReader struct {
+	r       *bufio.Reader
+	echo    io.Writer
+	pending []byte // the rest of the current line
+}
+
+func (e *echoReader) Read(p []byte) (int, error) {
+	if len(e.pending) == 0 {
+		line, err := e.r.ReadBytes('\n')
+		if len(line) == 0 {
+			return 0, err
+		}
+		if line[len(line)-1] != '\n' {
+			// the last line of the file, without a newline
+			e.echo.Write(append(line[:len(line):len(line)], '\n'))
+		} else {
+			e.echo.Write(line)
+		}
+		e.pending = line
+	}
+	n := copy(p, e.pending)
+	e.pending = e.pending[n:]
+	return n, nil
+}
@@ -0,0 +1,79 @@
+package red
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// regenerates the golden transcripts, e.g. 'go test -run TestGoldenTranscripts -update'
+var updateGolden = flag.Bool("update", false, "update the golden transcripts in testfiles/golden")
+
+/*
+Runs each commands file 'testfiles/golden/<name>.cmds' against the input file '<name>.txt' (if present)
+and compares the transcript with '<name>.golden'.
+*/
+func TestGoldenTranscripts(t *testing.T) {
+	commandFiles, err := filepath.Glob(filepath.Join("testfiles", "golden", "*.cmds"))
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if len(commandFiles) == 0 {
+		t.Fatalf("no commands files found")
+	}
+	for _, commandFile := range commandFiles {
+		name := strings.TrimSuffix(commandFile, ".cmds")
+		t.Run(filepath.Base(name), func(t *testing.T) {
+			inputFile := name + ".txt"
+			if _, err := os.Stat(inputFile); err != nil {
+				inputFile = ""
+			}
+			transcript, err := RunScript(inputFile, commandFile)
+			if err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			goldenFile := name + ".golden"
+			if *updateGolden {
+				if err := os.WriteFile(goldenFile, []byte(transcript), 0644); err != nil {
+					t.Fatalf("error: %s", err)
+				}
+				return
+			}
+			expected, err := os.ReadFile(goldenFile)
+			if err != nil {
+				t.Fatalf("error reading golden file (use -update to create it): %s", err)
+			}
+			if transcript != string(expected) {
+				t.Errorf("transcript did not match '%s'.\ngot:\n%s\nexpected:\n%s", goldenFile, transcript, expected)
+			}
+		})
+	}
+}
+
+func TestRunScript(t *testing.T) {
+	f, err := os.CreateTemp("", "red-script")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.Remove(f.Name())
+	// the last line has no newline
+	f.WriteString("a\nfirst\n.\n2p\np\nQ\np")
+	f.Close()
+
+	transcript, err := RunScript("", f.Name())
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	// execution stops at 'Q'
+	assertString(t, "wrong transcript", transcript,
+		": a\nfirst\n.\n: 2p\n?\ninvalid start of range: invalid line: 2, max line: 1\n: p\nfirst\n: Q\n")
+
+	if _, err := RunScript("", "/nonexistent/commands"); err == nil {
+		t.Fatalf("expected error for missing commands file")
+	}
+	if _, err := RunScript("/nonexistent/input", f.Name()); err == nil {
+		t.Fatalf("expected error for missing input file")
+	}
+}
@@ -0,0 +1,117 @@
+package red
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// the maximum length of a request, including the input lines
+const maxServeRequestSize int = 64 * 1024 * 1024
+
+/*
+ServeRequest is a request read by Serve: a command line to be executed, together with the text for input mode.
+*/
+type ServeRequest struct {
+	ID      json.RawMessage `json:"id,omitempty"` // returned unchanged in the response
+	Command string          `json:"command"`
+	Input   []string        `json:"input,omitempty"` // the lines for 'a', 'c', 'i' etc., without the terminating "." (see Serve)
+}
+
+/*
+ServeResponse is the response written by Serve for each request.
+*/
+type ServeResponse struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Output []string        `json:"output"`           // the lines written by the command
+	Stderr []string        `json:"stderr,omitempty"` // the lines written to stderr, e.g. by a shell command
+	Dot    int             `json:"dot"`              // the current line after the command
+	Lines  int             `json:"lines"`            // the number of lines in the buffer
+	Dirty  bool            `json:"dirty"`            // whether the buffer has unsaved changes
+	Quit   bool            `json:"quit,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+/*
+Serve executes the requests read from 'r' and writes a response for each to 'w', until EOF or a quit command.
+
+ Requests and responses are JSON objects, one per line (see ServeRequest and ServeResponse), e.g.
+
+  {"id":1,"command":"a","input":["first line","second line"]}
+  {"id":1,"output":[],"dot":2,"lines":2,"dirty":true}
+
+ Each command is executed as by Editor.Execute, i.e. aliases are expanded and its output is returned in the response
+ rather than written to state.Stdout; the same applies to state.Stderr. A request which cannot be decoded gets a response containing just the error.
+
+ As in ed, the input lines end at a line containing only ".", which is added to the lines of the request.
+ Therefore a request whose input contains such a line is rejected, rather than the following lines being lost.
+ An error is only returned if the requests cannot be read or the responses cannot be written.
+*/
+func Serve(state *State, r io.Reader, w io.Writer) error {
+	editor := &Editor{state: state}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxServeRequestSize)
+	encoder := json.NewEncoder(w)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var request ServeRequest
+		if err := json.Unmarshal(scanner.Bytes(), &request); err != nil {
+			if err := encoder.Encode(ServeResponse{Output: []string{}, Error: fmt.Sprintf("invalid request: %s", err)}); err != nil {
+				return err
+			}
+			continue
+		}
+		response := editor.serve(request)
+		if err := encoder.Encode(response); err != nil {
+			return err
+		}
+		if response.Quit {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+/*
+ Executes the command of the request, returning the response.
+*/
+func (e *Editor) serve(request ServeRequest) ServeResponse {
+	for i, line := range request.Input {
+		if line == "." || strings.Contains(line, "\n") {
+			return ServeResponse{ID: request.ID, Output: []string{}, Dot: e.state.lineNbr, Lines: e.Len(), Dirty: e.Dirty(),
+				Error: fmt.Sprintf("%s: input line %d: %q cannot be entered in input mode", ErrInvalidArgument, i+1, line)}
+		}
+	}
+	cmdLine := strings.TrimSuffix(request.Command, "\n")
+	if len(request.Input) > 0 {
+		cmdLine += "\n" + strings.Join(request.Input, "\n") + "\n."
+	}
+	var stderr bytes.Buffer
+	savedStderr := e.state.Stderr
+	e.state.Stderr = &stderr
+	result, err := e.Execute(cmdLine)
+	e.state.Stderr = savedStderr
+	response := ServeResponse{ID: request.ID, Output: splitOutputLines(result.Output), Dot: result.LineNbr, Lines: e.Len(), Dirty: e.Dirty(), Quit: result.Quit}
+	if stderr.Len() > 0 {
+		response.Stderr = splitOutputLines(stderr.String())
+	}
+	if err != nil {
+		response.Error = err.Error()
+	}
+	return response
+}
+
+/*
+ Splits the output into lines, without their newlines. Returns an empty (non-nil) slice for empty output.
+*/
+func splitOutputLines(output string) []string {
+	if output == "" {
+		return []string{}
+	}
+	return strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+}
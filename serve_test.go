@@ -0,0 +1,111 @@
+package red
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestServe(t *testing.T) {
+	requests := `{"id":1,"command":"a","input":["first","second","third"]}
+{"id":"two","command":"1,2p"}
+
+{"command":"2d"}
+not json
+{"id":5,"command":"9p"}
+{"id":6,"command":"q"}
+{"id":7,"command":"Q"}
+{"id":8,"command":"p"}
+`
+	var output bytes.Buffer
+	state := resetState(nil)
+	if err := Serve(state, strings.NewReader(requests), &output); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	// no response for the empty line, nor for the request after 'Q'
+	expected := []ServeResponse{
+		{ID: json.RawMessage(`1`), Output: []string{}, Dot: 3, Lines: 3, Dirty: true},
+		{ID: json.RawMessage(`"two"`), Output: []string{"first", "second"}, Dot: 2, Lines: 3, Dirty: true},
+		{Output: []string{}, Dot: 2, Lines: 2, Dirty: true},
+		{Output: []string{}, Error: "invalid request"},
+		{ID: json.RawMessage(`5`), Output: []string{}, Dot: 2, Lines: 2, Dirty: true, Error: "invalid line: 9"},
+		{ID: json.RawMessage(`6`), Output: []string{}, Dot: 2, Lines: 2, Dirty: true, Error: "unsaved changes"},
+		{ID: json.RawMessage(`7`), Output: []string{}, Dot: 2, Lines: 2, Dirty: true, Quit: true},
+	}
+	responses := strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n")
+	if len(responses) != len(expected) {
+		t.Fatalf("expected %d responses, got %d:\n%s", len(expected), len(responses), output.String())
+	}
+	for i, line := range responses {
+		var response ServeResponse
+		if err := json.Unmarshal([]byte(line), &response); err != nil {
+			t.Fatalf("response %d: error: %s", i, err)
+		}
+		want := expected[i]
+		assertString(t, "wrong id", string(response.ID), string(want.ID))
+		assertString(t, "wrong output", strings.Join(response.Output, ","), strings.Join(want.Output, ","))
+		assertInt(t, "wrong dot", response.Dot, want.Dot)
+		assertInt(t, "wrong nbr of lines", response.Lines, want.Lines)
+		if response.Dirty != want.Dirty || response.Quit != want.Quit {
+			t.Fatalf("response %d: wrong flags: %s", i, line)
+		}
+		if !strings.Contains(response.Error, want.Error) || (want.Error == "") != (response.Error == "") {
+			t.Fatalf("response %d: expected error containing '%s', got '%s'", i, want.Error, response.Error)
+		}
+	}
+}
+
+func TestServeInputLines(t *testing.T) {
+	// the input lines are terminated by "." automatically
+	state := resetState([]string{"a", "b"})
+	editor := &Editor{state: state}
+	response := editor.serve(ServeRequest{Command: "1c", Input: []string{"x", "y"}})
+	if response.Error != "" {
+		t.Fatalf("error: %s", response.Error)
+	}
+	assertBufferContents(t, state.Buffer, "x\ny\nb\n")
+	assertInt(t, "wrong dot", response.Dot, 2)
+	// input lines are ignored by a command which does not read any
+	response = editor.serve(ServeRequest{Command: ",p", Input: []string{"ignored"}})
+	assertString(t, "wrong output", strings.Join(response.Output, ","), "x,y,b")
+}
+
+func TestServeInputWithDot(t *testing.T) {
+	// a line containing only "." would end input mode early
+	state := resetState([]string{"a"})
+	editor := &Editor{state: state}
+	response := editor.serve(ServeRequest{Command: "a", Input: []string{"x", ".", "y"}})
+	if !strings.Contains(response.Error, ErrInvalidArgument.Error()) {
+		t.Fatalf("expected error, got '%s'", response.Error)
+	}
+	assertBufferContents(t, state.Buffer, "a\n")
+	// a line starting or ending with "." is fine
+	response = editor.serve(ServeRequest{Command: "$a", Input: []string{".x", "y."}})
+	if response.Error != "" {
+		t.Fatalf("error: %s", response.Error)
+	}
+	assertBufferContents(t, state.Buffer, "a\n.x\ny.\n")
+}
+
+func TestServeStderr(t *testing.T) {
+	var stderr bytes.Buffer
+	state := resetState([]string{"a"})
+	state.Stderr = &stderr
+	state.Shell = func(command string, stdin io.Reader, stdout, stderr io.Writer) error {
+		fmt.Fprintln(stdout, "out")
+		fmt.Fprintln(stderr, "err")
+		return nil
+	}
+	editor := &Editor{state: state}
+	response := editor.serve(ServeRequest{Command: "!cmd"})
+	assertString(t, "wrong output", strings.Join(response.Output, ","), "out,!")
+	assertString(t, "wrong stderr", strings.Join(response.Stderr, ","), "err")
+	// stderr is restored after the request
+	assertString(t, "wrong stderr", stderr.String(), "")
+	if state.Stderr != &stderr {
+		t.Fatalf("stderr not restored")
+	}
+}
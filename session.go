@@ -0,0 +1,223 @@
+package red
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrNoSuchBuffer error = errors.New("no such buffer")
+
+// the name listed by 'ls' for a buffer without a filename
+const unnamedBufferName string = "[no name]"
+
+// refers to a buffer of the session by its number in the argument of 'r' and 'x', e.g. 'r #2'
+const bufferRefPrefix string = "#"
+
+/*
+Session holds the buffers being edited, see commands 'new', 'ls' and 'switch'.
+
+ The current buffer is held in State itself (see bufferState). Its entry in 'buffers' is only brought up-to-date
+ when the buffers are switched or listed, see State.buffers. A session which has never been used has just the current buffer.
+ Lines are copied between buffers via the cut buffer or the registers, which are shared by all buffers.
+*/
+type Session struct {
+	buffers []bufferState // all buffers, in the order in which they were opened
+	current int           // index of the current buffer in 'buffers'
+}
+
+/*
+ Returns an empty buffer.
+*/
+func newBufferState() bufferState {
+	return bufferState{Buffer: NewBuffer(), marks: make(map[string]int), undo: list.New(), redo: list.New()}
+}
+
+/*
+ Returns the buffers of the session, having brought the entry of the current buffer up-to-date.
+*/
+func (state *State) buffers() []bufferState {
+	if len(state.session.buffers) == 0 {
+		state.session.buffers = []bufferState{state.bufferState}
+		state.session.current = 0
+	} else {
+		state.session.buffers[state.session.current] = state.bufferState
+	}
+	return state.session.buffers
+}
+
+/*
+ Makes the buffer with the given index the current buffer. The listeners are notified as if the buffer had been loaded.
+*/
+func (state *State) switchBuffer(index int) {
+	buffers := state.buffers()
+	state.bufferState = buffers[index]
+	state.session.current = index
+	for _, l := range state.listeners {
+		l.OnFileLoaded(state.defaultFilename, state.Buffer.Len())
+	}
+}
+
+/*
+ Returns true if the current buffer, or if 'allBuffers' is set any buffer, has unsaved changes.
+*/
+func (state *State) hasUnsavedChanges(allBuffers bool) bool {
+	if state.changedSinceLastWrite || !allBuffers {
+		return state.changedSinceLastWrite
+	}
+	for _, b := range state.buffers() {
+		if b.changedSinceLastWrite {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ If 'arg' refers to a buffer of the session (e.g. '#2', see bufferRefPrefix),
+ returns a copy of the lines of that buffer, their length in bytes, and true.
+ Otherwise returns false (and no error).
+*/
+func (state *State) bufferLines(arg string) (*list.List, int, bool, error) {
+	if !strings.HasPrefix(arg, bufferRefPrefix) {
+		return nil, 0, false, nil
+	}
+	buffers := state.buffers()
+	nbr, err := strconv.Atoi(arg[len(bufferRefPrefix):])
+	if err != nil || nbr < 1 || nbr > len(buffers) {
+		return nil, 0, true, fmt.Errorf("%w: '%s'", ErrNoSuchBuffer, arg)
+	}
+	buffer := buffers[nbr-1].Buffer
+	lines := list.New()
+	nbrBytes := 0
+	if buffer.Len() == 0 {
+		return lines, nbrBytes, true, nil
+	}
+	err = buffer.Iterate(1, buffer.Len(), func(_ int, line *Line) {
+		lines.PushBack(*line)
+		nbrBytes += len(line.Line)
+	})
+	return lines, nbrBytes, true, err
+}
+
+/*
+OpenBuffer opens a file in a new buffer, which becomes the current buffer.
+
+ new [file]
+
+ The file is read as by 'e', and becomes the default filename of the new buffer.
+ If the file is already open in a buffer, that buffer becomes the current buffer instead.
+ Without a file, the new buffer is empty and has no default filename.
+ The other buffers are unchanged, i.e. unsaved changes are kept.
+*/
+func (cmd Command) OpenBuffer(state *State) error {
+	if err := cmd.validateAddress(state); err != nil {
+		return err
+	}
+	filename := strings.TrimSpace(cmd.restOfCmd)
+	buffers := state.buffers()
+	if filename != "" {
+		for i, b := range buffers {
+			if b.defaultFilename == filename {
+				state.switchBuffer(i)
+				return nil
+			}
+		}
+	}
+	previous := state.session.current
+	state.session.buffers = append(buffers, newBufferState())
+	state.bufferState = state.session.buffers[len(state.session.buffers)-1]
+	state.session.current = len(state.session.buffers) - 1
+	if filename == "" {
+		for _, l := range state.listeners {
+			l.OnFileLoaded("", 0)
+		}
+		return nil
+	}
+	editCmd := Command{cmd: commandEditUnconditionally, restOfCmd: filename}
+	if err := editCmd.Edit(state); err != nil {
+		// back to the previous buffer, without the new one
+		state.session.buffers = state.session.buffers[:len(state.session.buffers)-1]
+		state.bufferState = state.session.buffers[previous]
+		state.session.current = previous
+		return fmt.Errorf("%s: %w", cmd.cmd, err)
+	}
+	if !strings.HasPrefix(filename, commandShell) {
+		// also in restricted mode, where 'e' does not change the default filename
+		state.defaultFilename = filename
+	}
+	return nil
+}
+
+/*
+ListBuffers lists the buffers of the session.
+
+ ls
+
+ Each buffer is listed with its number (as used by 'switch'), its default filename and its number of lines.
+ The current buffer is flagged with '%', a buffer with unsaved changes with '+'.
+*/
+func (cmd Command) ListBuffers(state *State) error {
+	if err := cmd.validateAddress(state); err != nil {
+		return err
+	}
+	for i, b := range state.buffers() {
+		if !state.pageLine() {
+			break
+		}
+		printBufferEntry(state, i, b)
+	}
+	return nil
+}
+
+func printBufferEntry(state *State, index int, b bufferState) {
+	flags := ""
+	if index == state.session.current {
+		flags += "%"
+	}
+	if b.changedSinceLastWrite {
+		flags += "+"
+	}
+	name := b.defaultFilename
+	if name == "" {
+		name = unnamedBufferName
+	}
+	fmt.Fprintf(state.Stdout, "%3d %-2s %s (%d lines)\n", index+1, flags, name, b.Buffer.Len())
+}
+
+/*
+SwitchBuffer makes another buffer of the session the current buffer.
+
+ switch [n|file]
+
+ The buffer is given by its number (see 'ls') or by its default filename.
+ Without an argument, the current buffer is listed.
+ Each buffer keeps its own current address, marks and undo list.
+*/
+func (cmd Command) SwitchBuffer(state *State) error {
+	if err := cmd.validateAddress(state); err != nil {
+		return err
+	}
+	arg := strings.TrimSpace(cmd.restOfCmd)
+	buffers := state.buffers()
+	if arg == "" {
+		printBufferEntry(state, state.session.current, buffers[state.session.current])
+		return nil
+	}
+	if nbr, err := strconv.Atoi(arg); err == nil {
+		if nbr < 1 || nbr > len(buffers) {
+			return fmt.Errorf("%s: %w: %d", cmd.cmd, ErrNoSuchBuffer, nbr)
+		}
+		state.switchBuffer(nbr - 1)
+		return nil
+	}
+	for i, b := range buffers {
+		if b.defaultFilename == arg {
+			state.switchBuffer(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: %w: '%s'", cmd.cmd, ErrNoSuchBuffer, arg)
+}
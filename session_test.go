@@ -0,0 +1,156 @@
+package red
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseBufferCommands(t *testing.T) {
+	for cmdLine, expected := range map[string]string{"new x": commandOpenBuffer, "ls": commandListBuffers, "switch 2": commandSwitchBuffer} {
+		cmd, err := ParseCommand(cmdLine, false)
+		if err != nil {
+			t.Fatalf("'%s': error: %s", cmdLine, err)
+		}
+		assertString(t, "wrong command", cmd.cmd, expected)
+	}
+}
+
+func TestBuffers(t *testing.T) {
+	dir, err := os.MkdirTemp("", "red-session")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "file")
+	if err := os.WriteFile(filename, []byte("x\ny\nz\n"), 0644); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+
+	var output bytes.Buffer
+	state := resetState([]string{"a", "b"})
+	state.Stdout = &output
+	state.Silent = true
+	state.defaultFilename = "first"
+	// a change, a mark and the current line in the first buffer
+	for _, cmdLine := range []string{"1ka", "2s/b/B/", "new " + filename, "2", "y", "switch 1", "1x"} {
+		if err := processCommandLine(t, state, cmdLine); err != nil {
+			t.Fatalf("command '%s': error: %s", cmdLine, err)
+		}
+	}
+	// line 'y' has been copied from the second buffer via the cut buffer
+	assertBufferContents(t, state.Buffer, "a\ny\nB\n")
+	assertString(t, "wrong filename", state.defaultFilename, "first")
+	assertInt(t, "wrong mark", state.marks["a"], 1)
+
+	output.Reset()
+	if err := processCommandLine(t, state, "ls"); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertString(t, "wrong output", output.String(), "  1 %+ first (3 lines)\n  2    "+filename+" (3 lines)\n")
+
+	// the second buffer kept its own current line and undo list
+	if err := processCommandLine(t, state, "switch "+filename); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertBufferContents(t, state.Buffer, "x\ny\nz\n")
+	assertInt(t, "wrong line nbr", state.lineNbr, 2)
+	if err := processCommandLine(t, state, "u"); !errors.Is(err, ErrNothingToUndo) {
+		t.Fatalf("expected ErrNothingToUndo, got %v", err)
+	}
+	// opening the file again switches to its buffer
+	if err := processCommandLine(t, state, "switch 1"); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if err := processCommandLine(t, state, "new "+filename); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertInt(t, "wrong nbr of buffers", len(state.buffers()), 2)
+	assertString(t, "wrong filename", state.defaultFilename, filename)
+
+	// 'q' also refuses to quit because of the changes in the first buffer
+	cmd, err := ParseCommand("q", false)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	quit, err := cmd.ProcessCommand(state, nil, false)
+	if quit || !errors.Is(err, ErrUnsavedChanges) {
+		t.Fatalf("expected ErrUnsavedChanges, got quit=%t, %v", quit, err)
+	}
+}
+
+func TestOpenEmptyBuffer(t *testing.T) {
+	var output bytes.Buffer
+	state := resetState([]string{"a"})
+	state.Stdout = &output
+	for _, cmdLine := range []string{"new", "switch"} {
+		if err := processCommandLine(t, state, cmdLine); err != nil {
+			t.Fatalf("command '%s': error: %s", cmdLine, err)
+		}
+	}
+	assertString(t, "wrong output", output.String(), "  2 %  "+unnamedBufferName+" (0 lines)\n")
+}
+
+func TestBufferErrors(t *testing.T) {
+	state := resetState([]string{"a"})
+	for _, cmdLine := range []string{"switch 2", "switch 0", "switch nosuchfile"} {
+		if err := processCommandLine(t, state, cmdLine); !errors.Is(err, ErrNoSuchBuffer) {
+			t.Fatalf("command '%s': expected ErrNoSuchBuffer, got %v", cmdLine, err)
+		}
+	}
+	// a file which cannot be read does not leave a new buffer behind
+	if err := processCommandLine(t, state, "new /nonexistent/file"); err == nil {
+		t.Fatalf("expected error")
+	}
+	assertInt(t, "wrong nbr of buffers", len(state.buffers()), 1)
+	assertBufferContents(t, state.Buffer, "a\n")
+	if err := processCommandLine(t, state, "1ls"); !errors.Is(err, ErrAddressMayNotBeSpecified) {
+		t.Fatalf("expected ErrAddressMayNotBeSpecified, got %v", err)
+	}
+}
+
+func TestInsertBuffer(t *testing.T) {
+	data := []struct {
+		cmdLine         string
+		expected        string
+		expectedLineNbr int
+	}{
+		{"1r #2", "a\nx\ny\nb\n", 3},
+		{"r #2", "a\nb\nx\ny\n", 4},
+		{"0r #1", "a\nb\na\nb\n", 2},
+		{"1x #2", "a\nx\ny\nb\n", 3},
+		{"1X #2", "x\ny\na\nb\n", 2},
+		{"r #3", "a\nb\n", 2}, // an empty buffer
+	}
+	for _, test := range data {
+		t.Run(test.cmdLine, func(t *testing.T) {
+			state := resetState([]string{"a", "b"})
+			state.Stdout = io.Discard
+			state.lineNbr = 2
+			// buffer 2 contains 'x' and 'y', buffer 3 is empty
+			state.buffers()
+			second := newBufferState()
+			second.Buffer = createBuffer([]string{"x", "y"})
+			state.session.buffers = append(state.session.buffers, second, newBufferState())
+			if err := processCommandLine(t, state, test.cmdLine); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertBufferContents(t, state.Buffer, test.expected)
+			assertInt(t, "wrong line nbr", state.lineNbr, test.expectedLineNbr)
+			if err := processCommandLine(t, state, "u"); err != nil && !errors.Is(err, ErrNothingToUndo) {
+				t.Fatalf("undo: error: %s", err)
+			}
+			assertBufferContents(t, state.Buffer, "a\nb\n")
+		})
+	}
+	state := resetState([]string{"a"})
+	state.lineNbr = 1
+	for _, cmdLine := range []string{"r #2", "x #0", "x #a"} {
+		if err := processCommandLine(t, state, cmdLine); !errors.Is(err, ErrNoSuchBuffer) {
+			t.Fatalf("command '%s': expected ErrNoSuchBuffer, got %v", cmdLine, err)
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package red
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUnknownSetting error = errors.New("unknown setting")
+	ErrInvalidSetting error = errors.New("invalid value")
+	errMissingValue   error = errors.New("expected 'name = value'")
+)
+
+// lists all settings, see command 'set'
+const setAll string = "all"
+
+/*
+ An editor option, which can be set in the configuration file (see LoadConfig) or with the command 'set'.
+*/
+type setting struct {
+	name        string
+	description string
+	get         func(state *State) string
+	set         func(state *State, value string) error
+	restricted  bool // whether the setting may not be changed in restricted mode (see ProgramFlags.Restricted)
+}
+
+/*
+ The registry of the editor options, in the order in which they are listed.
+*/
+var settings = []setting{
+	stringSetting("prompt", "the prompt string", func(state *State) *string { return &state.Prompt }),
+	boolSetting("showprompt", "whether the prompt is shown (see command 'P')", func(state *State) *bool { return &state.ShowPrompt }),
+	intSetting("windowsize", "the window size for the scroll command 'z'", func(state *State) *int { return &state.WindowSize }),
+	intSetting("tabstop", "the width of a tab stop", func(state *State) *int { return &state.TabStop }),
+	intSetting("width", "the maximum line length for reformatting (command 'F')", func(state *State) *int { return &state.TextWidth }),
+	{
+		name:        "indent",
+		description: "the indentation added or removed by the commands '>' and '<': tab or a number of spaces",
+		get: func(state *State) string {
+			if state.Indent == "\t" {
+				return indentTab
+			}
+			return strconv.Itoa(len(state.Indent))
+		},
+		set: func(state *State, value string) error {
+			if value == indentTab {
+				state.Indent = "\t"
+				return nil
+			}
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return fmt.Errorf("%w: '%s' (expected tab or a positive number)", ErrInvalidSetting, value)
+			}
+			state.Indent = strings.Repeat(" ", n)
+			return nil
+		},
+	},
+	stringSetting("joinsep", "the default separator for the join command", func(state *State) *string { return &state.JoinSeparator }),
+	boolSetting("joinnext", "whether a join command with one address joins with the next line", func(state *State) *bool { return &state.JoinNext }),
+	boolSetting("highlight", "whether the current line is marked when printing", func(state *State) *bool { return &state.HighlightDot }),
+	{
+		name:        "color",
+		description: "when line numbers and matches are coloured: auto (only on a terminal), always or never",
+		get:         func(state *State) string { return state.Color },
+		set: func(state *State, value string) error {
+			if err := CheckColor(value); err != nil {
+				return err
+			}
+			state.Color = value
+			return nil
+		},
+	},
+	{
+		name:        "messages",
+		description: "where byte counts, 'lines changed' and errors are written: stdout, stderr or tagged (stdout, prefixed by '" + messageSigil + "')",
+		get:         func(state *State) string { return state.Messages },
+		set: func(state *State, value string) error {
+			if err := CheckMessages(value); err != nil {
+				return err
+			}
+			state.Messages = value
+			return nil
+		},
+	},
+	boolSetting("ignorecase", "whether regular expressions match case-insensitively (see command '~')", func(state *State) *bool { return &state.IgnoreCase }),
+	boolSetting("verbose", "whether error messages are printed instead of '?' (see command 'H')", func(state *State) *bool { return &state.VerboseErrors }),
+	boolSetting("undotoggle", "GNU-compatible undo: 'u' undoes a previous 'u'", func(state *State) *bool { return &state.UndoToggle }),
+	// in restricted mode, backups could be written anywhere
+	restrictedSetting(stringSetting("backup", "the suffix of the backup made before 'w' overwrites a file (\"\": no backup)", func(state *State) *string { return &state.BackupSuffix })),
+	restrictedSetting(stringSetting("backupdir", "the directory for backups (\"\": the directory of the file)", func(state *State) *string { return &state.BackupDir })),
+	boolSetting("inplace", "whether 'w' overwrites a file in place, keeping its hard links and inode, rather than replacing it", func(state *State) *bool { return &state.WriteInPlace }),
+	{
+		name:        "encoding",
+		description: "the encoding of files without a byte order mark",
+		get:         func(state *State) string { return state.Encoding },
+		set: func(state *State, value string) error {
+			if err := CheckEncoding(value); err != nil {
+				return err
+			}
+			state.Encoding = value
+			return nil
+		},
+	},
+	{
+		name:        "lineendings",
+		description: "the line endings with which the buffer is written: dos or unix (see commands 'dos' and 'unix')",
+		get: func(state *State) string {
+			if state.dosLineEndings {
+				return commandDOS
+			}
+			return commandUnix
+		},
+		set: func(state *State, value string) error {
+			if value != commandDOS && value != commandUnix {
+				return fmt.Errorf("%w: '%s' (expected dos or unix)", ErrInvalidSetting, value)
+			}
+			state.setLineEndings(value == commandDOS)
+			return nil
+		},
+	},
+	boolSetting("largefiles", "whether 'e' reads the lines of a file only when they are accessed, for files larger than memory", func(state *State) *bool { return &state.LargeFiles }),
+	durationSetting("autosave", "the interval at which unsaved changes are written to a recovery file (0: never; only read on startup)", func(state *State) *time.Duration { return &state.AutosaveInterval }),
+}
+
+func stringSetting(name, description string, field func(state *State) *string) setting {
+	return setting{
+		name:        name,
+		description: description,
+		get:         func(state *State) string { return *field(state) },
+		set: func(state *State, value string) error {
+			*field(state) = value
+			return nil
+		},
+	}
+}
+
+func boolSetting(name, description string, field func(state *State) *bool) setting {
+	return setting{
+		name:        name,
+		description: description,
+		get: func(state *State) string {
+			if *field(state) {
+				return "on"
+			}
+			return "off"
+		},
+		set: func(state *State, value string) error {
+			switch strings.ToLower(value) {
+			case "on", "yes", "true", "1":
+				*field(state) = true
+			case "off", "no", "false", "0":
+				*field(state) = false
+			default:
+				return fmt.Errorf("%w: '%s' (expected on or off)", ErrInvalidSetting, value)
+			}
+			return nil
+		},
+	}
+}
+
+/*
+ A setting whose value is a positive number.
+*/
+func intSetting(name, description string, field func(state *State) *int) setting {
+	return setting{
+		name:        name,
+		description: description,
+		get:         func(state *State) string { return strconv.Itoa(*field(state)) },
+		set: func(state *State, value string) error {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return fmt.Errorf("%w: '%s' (expected a positive number)", ErrInvalidSetting, value)
+			}
+			*field(state) = n
+			return nil
+		},
+	}
+}
+
+func durationSetting(name, description string, field func(state *State) *time.Duration) setting {
+	return setting{
+		name:        name,
+		description: description,
+		get:         func(state *State) string { return field(state).String() },
+		set: func(state *State, value string) error {
+			d, err := time.ParseDuration(value)
+			if err != nil || d < 0 {
+				return fmt.Errorf("%w: '%s' (expected a duration, e.g. 60s)", ErrInvalidSetting, value)
+			}
+			*field(state) = d
+			return nil
+		},
+	}
+}
+
+/*
+ Marks the setting as not changeable in restricted mode.
+*/
+func restrictedSetting(s setting) setting {
+	s.restricted = true
+	return s
+}
+
+/*
+ Returns the setting with the given name.
+*/
+func findSetting(name string) (setting, error) {
+	for _, s := range settings {
+		if s.name == name {
+			return s, nil
+		}
+	}
+	return setting{}, fmt.Errorf("%w: '%s'", ErrUnknownSetting, name)
+}
+
+/*
+SetOption sets the editor option with the given name, e.g. "prompt" or "windowsize".
+ Boolean options accept on/off (or yes/no, true/false, 1/0).
+ In restricted mode, the options which determine where files are written (e.g. "backupdir") cannot be changed.
+*/
+func (state *State) SetOption(name, value string) error {
+	s, err := findSetting(name)
+	if err != nil {
+		return err
+	}
+	if s.restricted && state.Restricted {
+		return fmt.Errorf("%s: %w", name, ErrRestricted)
+	}
+	if err = s.set(state, value); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+/*
+Option returns the current value of the editor option with the given name.
+*/
+func (state *State) Option(name string) (string, error) {
+	s, err := findSetting(name)
+	if err != nil {
+		return "", err
+	}
+	return s.get(state), nil
+}
+
+/*
+ Splits a setting of the form 'name = value' into name and value.
+ A value may be enclosed in double quotes, e.g. to set a prompt ending with a space: 'prompt = "> "'.
+*/
+func parseSetting(str string) (name, value string, err error) {
+	pos := strings.Index(str, "=")
+	if pos < 0 {
+		return "", "", errMissingValue
+	}
+	name = strings.TrimSpace(str[:pos])
+	value = strings.TrimSpace(str[pos+1:])
+	if strings.HasPrefix(value, "\"") {
+		if value, err = strconv.Unquote(value); err != nil {
+			return "", "", fmt.Errorf("%w: invalid quoted value %s", ErrInvalidSetting, value)
+		}
+	}
+	return name, value, nil
+}
+
+/*
+ Formats the value of a setting so that it can be read by parseSetting,
+ i.e. values with leading or trailing spaces (and empty values) are quoted.
+*/
+func formatSetting(name, value string) string {
+	if value == "" || value != strings.TrimSpace(value) || strings.HasPrefix(value, "\"") {
+		value = strconv.Quote(value)
+	}
+	return name + "=" + value
+}
+
+/*
+Set shows or changes the editor options.
+
+ set [all]          prints all options
+ set name           prints the value of the option
+ set name=value     sets the option
+
+ The current address is unchanged.
+*/
+func (cmd Command) Set(state *State) error {
+	if err := cmd.validateAddress(state); err != nil {
+		return err
+	}
+	rest := strings.TrimSpace(cmd.restOfCmd)
+	switch {
+	case rest == "" || rest == setAll:
+		for _, s := range settings {
+			fmt.Fprintln(state.Stdout, formatSetting(s.name, s.get(state)))
+		}
+	case strings.Contains(rest, "="):
+		name, value, err := parseSetting(rest)
+		if err == nil {
+			err = state.SetOption(name, value)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", cmd.cmd, err)
+		}
+	default:
+		value, err := state.Option(rest)
+		if err != nil {
+			return fmt.Errorf("%s: %w", cmd.cmd, err)
+		}
+		fmt.Fprintln(state.Stdout, formatSetting(rest, value))
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package red
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSettingsRoundTrip(t *testing.T) {
+	state := NewState()
+	state.WindowSize = 22
+	state.Prompt = ":"
+	// each value returned by Option must be accepted by SetOption
+	for _, s := range settings {
+		value, err := state.Option(s.name)
+		if err != nil {
+			t.Fatalf("%s: error: %s", s.name, err)
+		}
+		if err = state.SetOption(s.name, value); err != nil {
+			t.Fatalf("%s: error setting '%s': %s", s.name, value, err)
+		}
+		if s.description == "" {
+			t.Fatalf("%s: missing description", s.name)
+		}
+	}
+}
+
+func TestSetOption(t *testing.T) {
+	state := NewState()
+	data := []struct {
+		name, value, expected string
+	}{
+		{"highlight", "true", "on"},
+		{"highlight", "OFF", "off"},
+		{"joinsep", ", ", ", "},
+		{"width", "60", "60"},
+		{"autosave", "90s", "1m30s"},
+		{"encoding", "latin1", "latin1"},
+	}
+	for _, test := range data {
+		if err := state.SetOption(test.name, test.value); err != nil {
+			t.Fatalf("%s=%s: error: %s", test.name, test.value, err)
+		}
+		value, _ := state.Option(test.name)
+		assertString(t, "wrong value of "+test.name, value, test.expected)
+	}
+	if _, err := state.Option("nosuchoption"); !errors.Is(err, ErrUnknownSetting) {
+		t.Fatalf("expected unknown setting, got %v", err)
+	}
+}
+
+func TestSetCommand(t *testing.T) {
+	data := []struct {
+		cmdLine        string
+		expectedOutput string
+	}{
+		{"set windowsize=30", ""},
+		{"set windowsize", "windowsize=30\n"},
+		{"set prompt = \"> \"", ""},
+		{"set prompt", "prompt=\"> \"\n"},
+		{"set joinsep", "joinsep=\"\"\n"},
+		{"set highlight=yes", ""},
+		{"set highlight", "highlight=on\n"},
+		{"set lineendings", "lineendings=unix\n"},
+	}
+	state := resetState([]string{"a"})
+	for _, test := range data {
+		var output bytes.Buffer
+		state.Stdout = &output
+		if err := processCommandLine(t, state, test.cmdLine); err != nil {
+			t.Fatalf("command '%s': error: %s", test.cmdLine, err)
+		}
+		assertString(t, "wrong output for "+test.cmdLine, output.String(), test.expectedOutput)
+	}
+	assertInt(t, "wrong window size", state.WindowSize, 30)
+	assertString(t, "wrong prompt", state.Prompt, "> ")
+
+	for _, cmdLine := range []string{"set lineendings=dos", "set all", "set"} {
+		var output bytes.Buffer
+		state.Stdout = &output
+		if err := processCommandLine(t, state, cmdLine); err != nil {
+			t.Fatalf("command '%s': error: %s", cmdLine, err)
+		}
+		if cmdLine != "set lineendings=dos" {
+			if lines := strings.Count(output.String(), "\n"); lines != len(settings) {
+				t.Fatalf("%s: expected %d lines, got %d:\n%s", cmdLine, len(settings), lines, output.String())
+			}
+			if !strings.Contains(output.String(), "\nlineendings=dos\n") {
+				t.Fatalf("%s: lineendings not listed:\n%s", cmdLine, output.String())
+			}
+		}
+	}
+	if !state.dosLineEndings || !state.changedSinceLastWrite {
+		t.Fatalf("expected changed line endings")
+	}
+
+	for _, cmdLine := range []string{"set nosuchoption", "set width=0", "set highlight=maybe", "set prompt=\"x", "1set", "g/a/set"} {
+		if err := processCommandLine(t, resetState([]string{"a"}), cmdLine); err == nil {
+			t.Fatalf("command '%s': expected error", cmdLine)
+		}
+	}
+}
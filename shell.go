@@ -0,0 +1,187 @@
+package red
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+var (
+	ErrMissingShellCommand    error = errors.New("shell command missing")
+	ErrNoPreviousShellCommand error = errors.New("no previous shell command")
+)
+
+/*
+ShellExecutor runs a shell command, reading its input from stdin (nil: no input)
+and writing its output to stdout and stderr.
+*/
+type ShellExecutor func(command string, stdin io.Reader, stdout, stderr io.Writer) error
+
+// the shell used by the default ShellExecutor
+const defaultShell string = "/bin/sh"
+
+/*
+NewShellExecutor returns a ShellExecutor which runs commands using the given shell, as 'shell -c command'.
+*/
+func NewShellExecutor(shell string) ShellExecutor {
+	return func(command string, stdin io.Reader, stdout, stderr io.Writer) error {
+		c := exec.Command(shell, "-c", command)
+		c.Stdin = stdin
+		c.Stdout = stdout
+		c.Stderr = stderr
+		return c.Run()
+	}
+}
+
+/*
+ShellEscape executes a command via the shell.
+
+ !command
+ (.,.)!command
+
+ The output of the command is printed, followed by a line containing '!' (unless in script mode, see state.Silent).
+ An unescaped '%' in the command is replaced by the default filename.
+ If the command starts with '!', this is replaced by the previous shell command, i.e. '!!' repeats the previous command.
+ If the command was changed by one of these replacements, it is printed before it is executed.
+
+ If an address is given, the addressed lines are filtered through the command instead (see filterLines).
+ Otherwise the current address is unchanged.
+*/
+func (cmd Command) ShellEscape(state *State) error {
+	if err := cmd.validateAddress(state); err != nil {
+		return err
+	}
+	command, err := state.expandShellCommand(cmd.restOfCmd, state.Stdout)
+	if err != nil {
+		return err
+	}
+	if cmd.addrRange.IsSpecified() {
+		return cmd.filterLines(state, command)
+	}
+	if err = state.Shell(command, nil, state.Stdout, state.Stderr); err != nil {
+		return fmt.Errorf("%s: %w", commandShell, err)
+	}
+	if !state.Silent {
+		state.message(messageInfo, "%s", commandShell)
+	}
+	return nil
+}
+
+/*
+ Replaces the addressed lines by the output of the shell command, which reads the lines as its input (e.g. '2,10!sort').
+ If the command fails, the buffer is unchanged.
+
+ The lines are replaced as by 'c', i.e. the replaced lines are stored in the cut buffer,
+ and the current address is set to the last line of the output.
+ If the command has no output, the lines are deleted.
+*/
+func (cmd Command) filterLines(state *State, command string) error {
+	var input, output bytes.Buffer
+	if _, err := WriteWriter(bufio.NewWriter(&input), state.Buffer, cmd.resolved.start, cmd.resolved.end); err != nil {
+		return err
+	}
+	if err := state.Shell(command, &input, &output, state.Stderr); err != nil {
+		return fmt.Errorf("%s%s: %w", commandShell, command, err)
+	}
+	_, listOfLines, err := ReadReader(bufio.NewReader(&output))
+	if err != nil {
+		return err
+	}
+	terminateLastLine(listOfLines)
+	changeCmd, err := cmd.createNewResolvedCommand(commandChange, "")
+	if err != nil {
+		return err
+	}
+	return changeCmd.Change(state, listOfLines)
+}
+
+/*
+ Returns true if the given filename (of an 'e', 'r' or 'w' command) denotes a shell command, i.e. starts with '!'.
+*/
+func isShellCommand(filename string) bool {
+	return strings.HasPrefix(filename, commandShell)
+}
+
+/*
+ Runs the shell command and returns its output as a list of lines, together with the number of bytes read.
+*/
+func (state *State) readFromShellCommand(command string) (nbrBytesRead int, listOfLines *list.List, err error) {
+	if command, err = state.expandShellCommand(command, state.Stdout); err != nil {
+		return 0, nil, err
+	}
+	var output bytes.Buffer
+	if err = state.Shell(command, nil, &output, state.Stderr); err != nil {
+		return 0, nil, fmt.Errorf("%s%s: %w", commandShell, command, err)
+	}
+	return ReadReader(bufio.NewReader(&output))
+}
+
+/*
+ Runs the shell command with the lines 'startLineNbr' til 'endLineNbr' of the buffer as its input.
+ The output of the command is printed. The number of bytes written is returned.
+*/
+func (state *State) writeToShellCommand(command string, startLineNbr, endLineNbr int) (nbrBytesWritten int, err error) {
+	if command, err = state.expandShellCommand(command, state.Stdout); err != nil {
+		return 0, err
+	}
+	var input bytes.Buffer
+	if nbrBytesWritten, err = WriteWriter(bufio.NewWriter(&input), state.Buffer, startLineNbr, endLineNbr); err != nil {
+		return 0, err
+	}
+	if err = state.Shell(command, &input, state.Stdout, state.Stderr); err != nil {
+		return 0, fmt.Errorf("%s%s: %w", commandShell, command, err)
+	}
+	return nbrBytesWritten, nil
+}
+
+/*
+ Expands the given shell command, replacing a leading '!' by the previous shell command,
+ and an unescaped '%' by the default filename.
+ If the command was changed, it is printed to the writer.
+
+ The expanded command is stored as the previous shell command.
+ No shell command may be run in restricted mode.
+*/
+func (state *State) expandShellCommand(command string, writer io.Writer) (string, error) {
+	if state.Restricted {
+		return "", fmt.Errorf("%s: %w", commandShell, ErrRestricted)
+	}
+	expanded := false
+	if strings.HasPrefix(command, commandShell) {
+		if state.lastShellCommand == "" {
+			return "", ErrNoPreviousShellCommand
+		}
+		command = state.lastShellCommand + command[len(commandShell):]
+		expanded = true
+	}
+	var sb strings.Builder
+	for i := 0; i < len(command); i++ {
+		switch {
+		case command[i] == '\\' && i+1 < len(command) && command[i+1] == '%':
+			sb.WriteByte('%')
+			i++
+		case command[i] == '%':
+			if state.defaultFilename == "" {
+				return "", ErrMissingFilename
+			}
+			sb.WriteString(state.defaultFilename)
+			expanded = true
+		default:
+			sb.WriteByte(command[i])
+		}
+	}
+	command = sb.String()
+	if strings.TrimSpace(command) == "" {
+		return "", ErrMissingShellCommand
+	}
+	if expanded {
+		fmt.Fprintln(writer, command)
+	}
+	state.lastShellCommand = command
+	return command, nil
+}
@@ -0,0 +1,199 @@
+package red
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+)
+
+/*
+ Returns a ShellExecutor which does not run anything, but stores the commands and echoes them to stdout.
+*/
+func stubShell(commands *[]string) ShellExecutor {
+	return func(command string, stdin io.Reader, stdout, stderr io.Writer) error {
+		*commands = append(*commands, command)
+		fmt.Fprintf(stdout, "ran: %s\n", command)
+		return nil
+	}
+}
+
+func TestShellEscape(t *testing.T) {
+	state := resetState([]string{"1", "2"})
+	state.defaultFilename = "file.txt"
+	var commands []string
+	state.Shell = stubShell(&commands)
+	var output bytes.Buffer
+	state.Stdout = &output
+
+	steps := []struct {
+		cmdLine         string
+		expectedCommand string
+		expectedOutput  string
+	}{
+		{"!echo hi", "echo hi", "ran: echo hi\n!\n"},
+		{"!!", "echo hi", "echo hi\nran: echo hi\n!\n"},
+		{"!! there", "echo hi there", "echo hi there\nran: echo hi there\n!\n"},
+		{"!cat %", "cat file.txt", "cat file.txt\nran: cat file.txt\n!\n"},
+		{"!echo \\%", "echo %", "ran: echo %\n!\n"},
+	}
+	for _, step := range steps {
+		output.Reset()
+		if err := processCommandLine(t, state, step.cmdLine); err != nil {
+			t.Fatalf("command '%s': error: %s", step.cmdLine, err)
+		}
+		assertString(t, "wrong command for "+step.cmdLine, commands[len(commands)-1], step.expectedCommand)
+		assertString(t, "wrong output for "+step.cmdLine, output.String(), step.expectedOutput)
+	}
+	assertInt(t, "wrong state.lineNbr!", state.lineNbr, 0)
+}
+
+func TestShellEscapeErrors(t *testing.T) {
+	data := []struct {
+		cmdLine         string
+		defaultFilename string
+	}{
+		{"!!", ""},    // no previous command
+		{"!", ""},     // no command
+		{"!ls %", ""}, // no default filename
+		{"0!ls", "x"}, // invalid address
+		{"3!ls", "x"}, // invalid address
+	}
+	for i, test := range data {
+		t.Run(fmt.Sprintf("test %d: >>%s<<", i, test.cmdLine), func(t *testing.T) {
+			state := resetState([]string{"1", "2"})
+			state.defaultFilename = test.defaultFilename
+			var commands []string
+			state.Shell = stubShell(&commands)
+			if err := processCommandLine(t, state, test.cmdLine); err == nil {
+				t.Fatalf("expected error")
+			}
+			assertInt(t, "nbr of commands executed", len(commands), 0)
+		})
+	}
+}
+
+func TestNewShellExecutor(t *testing.T) {
+	if _, err := os.Stat(defaultShell); err != nil {
+		t.Skip("no /bin/sh")
+	}
+	runShellCommand := NewShellExecutor(defaultShell)
+	var stdout, stderr bytes.Buffer
+	if err := runShellCommand("cat; echo err >&2", bytes.NewBufferString("input\n"), &stdout, &stderr); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertString(t, "stdout", stdout.String(), "input\n")
+	assertString(t, "stderr", stderr.String(), "err\n")
+	if err := runShellCommand("exit 1", nil, &stdout, &stderr); err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+/*
+ Returns a ShellExecutor which does not run anything, but stores the commands and the input,
+ and writes the given output to stdout.
+*/
+func stubPipe(commands *[]string, input *bytes.Buffer, output string) ShellExecutor {
+	return func(command string, stdin io.Reader, stdout, stderr io.Writer) error {
+		*commands = append(*commands, command)
+		if stdin != nil {
+			io.Copy(input, stdin)
+		}
+		io.WriteString(stdout, output)
+		return nil
+	}
+}
+
+func TestReadWriteEditShellCommand(t *testing.T) {
+	data := []struct {
+		cmdLine          string
+		expectedCommand  string
+		expectedInput    string
+		expectedContents string
+		expectedLineNbr  int
+		expectedChanged  bool
+	}{
+		{"1r !ls", "ls", "", "1\na\nb\n2\n3\n", 3, true},
+		{"r !!", "ls", "", "1\n2\n3\na\nb\n", 5, true},
+		{"e !ls -l", "ls -l", "", "a\nb\n", 2, false},
+		{"2,3w !wc", "wc", "2\n3\n", "1\n2\n3\n", 1, false},
+		{"w !cat >%", "cat >file.txt", "1\n2\n3\n", "1\n2\n3\n", 1, false},
+	}
+	for i, test := range data {
+		t.Run(fmt.Sprintf("test %d: >>%s<<", i, test.cmdLine), func(t *testing.T) {
+			state := resetState([]string{"1", "2", "3"})
+			state.lineNbr = 1
+			state.defaultFilename = "file.txt"
+			state.lastShellCommand = "ls"
+			state.Stdout = io.Discard
+			var commands []string
+			var input bytes.Buffer
+			state.Shell = stubPipe(&commands, &input, "a\nb\n")
+			if err := processCommandLine(t, state, test.cmdLine); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertString(t, "wrong command", commands[0], test.expectedCommand)
+			assertString(t, "wrong input", input.String(), test.expectedInput)
+			assertBufferContents(t, state.Buffer, test.expectedContents)
+			assertInt(t, "wrong state.lineNbr!", state.lineNbr, test.expectedLineNbr)
+			assertString(t, "default filename changed", state.defaultFilename, "file.txt")
+			if state.changedSinceLastWrite != test.expectedChanged {
+				t.Fatalf("expected changedSinceLastWrite %t", test.expectedChanged)
+			}
+		})
+	}
+}
+
+func TestShellFilter(t *testing.T) {
+	data := []struct {
+		cmdLine         string
+		output          string
+		expectedInput   string
+		expectedBuffer  string
+		expectedLineNbr int
+	}{
+		{"2,3!sort -r", "c\nb\n", "b\nc\n", "a\nc\nb\nd\n", 3},
+		{"2!expand", "x\ny\nz", "b\n", "a\nx\ny\nz\nc\nd\n", 4},
+		{",!tac", "d\nc\nb\na\n", "a\nb\nc\nd\n", "d\nc\nb\na\n", 4},
+		{"3,4!grep x", "", "c\nd\n", "a\nb\n", 2},
+	}
+	for _, test := range data {
+		t.Run(test.cmdLine, func(t *testing.T) {
+			state := resetState([]string{"a", "b", "c", "d"})
+			state.lineNbr = 1
+			var commands []string
+			var input bytes.Buffer
+			state.Shell = stubPipe(&commands, &input, test.output)
+			if err := processCommandLine(t, state, test.cmdLine); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertString(t, "wrong input", input.String(), test.expectedInput)
+			assertBufferContents(t, state.Buffer, test.expectedBuffer)
+			assertInt(t, "wrong line nbr", state.lineNbr, test.expectedLineNbr)
+			if !state.changedSinceLastWrite {
+				t.Fatalf("expected buffer to be changed")
+			}
+			// the filter is undone as one change
+			if err := processCommandLine(t, state, "u"); err != nil {
+				t.Fatalf("undo: error: %s", err)
+			}
+			assertBufferContents(t, state.Buffer, "a\nb\nc\nd\n")
+		})
+	}
+}
+
+func TestShellFilterFails(t *testing.T) {
+	state := resetState([]string{"a", "b"})
+	state.Shell = func(command string, stdin io.Reader, stdout, stderr io.Writer) error {
+		io.WriteString(stdout, "partial output\n")
+		return fmt.Errorf("exit status 1")
+	}
+	if err := processCommandLine(t, state, "1,2!false"); err == nil {
+		t.Fatalf("expected error")
+	}
+	assertBufferContents(t, state.Buffer, "a\nb\n")
+	if state.changedSinceLastWrite {
+		t.Fatalf("expected buffer to be unchanged")
+	}
+}
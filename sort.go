@@ -0,0 +1,209 @@
+package red
+
+import (
+	"container/list"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// arguments for the sort command
+const (
+	sortNumeric string = "n" // sort by the first number in each line
+	sortReverse string = "!" // sort in descending order
+)
+
+// the number used by a numeric sort: an optional sign, digits and an optional fraction
+var sortNumberRE = regexp.MustCompile(`[-+]?[0-9]+(\.[0-9]+)?`)
+
+/*
+Sort sorts the addressed lines.
+
+ (1,$)sort[!] [n]
+   !   sorts in descending order
+   n   sorts by the first (decimal) number in each line; lines without a number come first
+
+ Otherwise the lines are sorted lexicographically (by byte value).
+ The sort is stable, i.e. lines which compare equal keep their order.
+ If no address is specified, the whole buffer is sorted.
+
+ The current address is set to the address of the last line sorted.
+ Marks move with their lines.
+*/
+func (cmd Command) Sort(state *State) error {
+	if err := cmd.validateAddress(state); err != nil {
+		return err
+	}
+	args := strings.TrimSpace(cmd.restOfCmd)
+	descending := strings.HasPrefix(args, sortReverse)
+	args = strings.TrimSpace(strings.TrimPrefix(args, sortReverse))
+	if args != "" && args != sortNumeric {
+		return fmt.Errorf("%s: %w: '%s'", cmd.cmd, ErrInvalidArgument, args)
+	}
+	numeric := args == sortNumeric
+	return cmd.rearrangeLines(state, func(lines []string) []int {
+		order := make([]int, len(lines))
+		for i := range order {
+			order[i] = i
+		}
+		var less func(a, b int) bool
+		if numeric {
+			keys := make([]sortKey, len(lines))
+			for i, line := range lines {
+				keys[i] = newSortKey(line)
+			}
+			less = func(a, b int) bool { return keys[a].less(keys[b]) }
+		} else {
+			less = func(a, b int) bool { return lines[a] < lines[b] }
+		}
+		sort.SliceStable(order, func(i, j int) bool {
+			if descending {
+				return less(order[j], order[i])
+			}
+			return less(order[i], order[j])
+		})
+		return order
+	})
+}
+
+/*
+Uniq removes adjacent duplicate lines from the addressed lines, keeping the first of each run of identical lines.
+
+ (1,$)uniq
+
+ If no address is specified, the whole buffer is processed.
+
+ The current address is set to the address of the last remaining line of the addressed lines.
+ The marks of removed lines move to the line which was kept.
+*/
+func (cmd Command) Uniq(state *State) error {
+	if err := cmd.validateAddress(state); err != nil {
+		return err
+	}
+	return cmd.rearrangeLines(state, func(lines []string) []int {
+		var order []int
+		for i, line := range lines {
+			if i == 0 || line != lines[i-1] {
+				order = append(order, i)
+			}
+		}
+		return order
+	})
+}
+
+/*
+Reverse reverses the order of the addressed lines.
+
+ (1,$)reverse
+
+ If no address is specified, the whole buffer is reversed.
+
+ The current address is set to the address of the last line reversed.
+ Marks move with their lines.
+*/
+func (cmd Command) Reverse(state *State) error {
+	if err := cmd.validateAddress(state); err != nil {
+		return err
+	}
+	return cmd.rearrangeLines(state, func(lines []string) []int {
+		order := make([]int, len(lines))
+		for i := range order {
+			order[i] = len(lines) - 1 - i
+		}
+		return order
+	})
+}
+
+/*
+ Replaces the addressed lines by a selection of the same lines in a new order.
+
+ 'arrange' is given the text of the addressed lines, and returns the indexes of the lines in their new order.
+ Lines whose index is not returned are removed; this is only valid for a line identical to the line before it (see Uniq),
+ and its marks move to that line.
+
+ The change is made by a 'c' command, which is where the undo is handled.
+ The marks within the addressed lines are set again afterwards, since 'c' removes them.
+*/
+func (cmd Command) rearrangeLines(state *State, arrange func(lines []string) []int) error {
+	startLineNbr, endLineNbr := cmd.resolved.start, cmd.resolved.end
+	if !cmd.addrRange.IsSpecified() {
+		startLineNbr, endLineNbr = 1, state.Buffer.Len()
+	}
+	if state.Buffer.Len() == 0 {
+		return nil
+	}
+	originalLines, err := copyLines(startLineNbr, endLineNbr, state)
+	if err != nil {
+		return fmt.Errorf("%s: %w", cmd.cmd, err)
+	}
+	lines := make([]string, 0, originalLines.Len())
+	for el := originalLines.Front(); el != nil; el = el.Next() {
+		lines = append(lines, el.Value.(Line).Line)
+	}
+	order := arrange(lines)
+
+	// the new position of each original line; a removed line takes the position of the line before it
+	newIndex := make([]int, len(lines))
+	for i := range newIndex {
+		newIndex[i] = -1
+	}
+	newLines := list.New()
+	unchanged := len(order) == len(lines)
+	for i, index := range order {
+		newIndex[index] = i
+		newLines.PushBack(Line{lines[index]})
+		unchanged = unchanged && lines[index] == lines[i]
+	}
+	if unchanged {
+		return moveToLine(endLineNbr, state)
+	}
+	for i := range newIndex {
+		if newIndex[i] == -1 {
+			newIndex[i] = newIndex[i-1]
+		}
+	}
+	marks := make(map[string]int)
+	for name, lineNbr := range state.marks {
+		if lineNbr >= startLineNbr && lineNbr <= endLineNbr {
+			marks[name] = startLineNbr + newIndex[lineNbr-startLineNbr]
+		}
+	}
+
+	changeCommand := Command{addrRange: cmd.addrRange, addressIsResolved: true, resolved: resolvedAddress{start: startLineNbr, end: endLineNbr}, cmd: commandChange}
+	if err = changeCommand.Change(state, newLines); err != nil {
+		return err
+	}
+	for name, lineNbr := range marks {
+		state.addMark(name, lineNbr)
+	}
+	return nil
+}
+
+/*
+ The key of a line for a numeric sort.
+*/
+type sortKey struct {
+	hasNumber bool
+	number    float64
+}
+
+func newSortKey(line string) sortKey {
+	str := sortNumberRE.FindString(line)
+	if str == "" {
+		return sortKey{}
+	}
+	number, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return sortKey{}
+	}
+	return sortKey{hasNumber: true, number: number}
+}
+
+func (k sortKey) less(other sortKey) bool {
+	if k.hasNumber != other.hasNumber {
+		return !k.hasNumber
+	}
+	return k.number < other.number
+}
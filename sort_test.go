@@ -0,0 +1,127 @@
+package red
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseSortCommands(t *testing.T) {
+	data := []struct {
+		cmdLine      string
+		expectedCmd  string
+		expectedRest string
+	}{
+		{"sort", commandSort, ""},
+		{",sort! n", commandSort, "! n"},
+		{"2,3uniq", commandUniq, ""},
+		{"reverse", commandReverse, ""},
+		{"revert", commandRevert, ""},
+	}
+	for _, test := range data {
+		t.Run(fmt.Sprintf(">>%s<<", test.cmdLine), func(t *testing.T) {
+			cmd, err := ParseCommand(test.cmdLine, false)
+			if err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertString(t, "wrong command", cmd.cmd, test.expectedCmd)
+			assertString(t, "wrong rest of command", cmd.restOfCmd, test.expectedRest)
+		})
+	}
+}
+
+func TestSortUniqReverse(t *testing.T) {
+	data := []struct {
+		cmdLine         string
+		buffer          []string
+		expected        string
+		expectedLineNbr int
+	}{
+		{"sort", []string{"c", "a", "B", "b"}, "B\na\nb\nc\n", 4},
+		{"sort!", []string{"c", "a", "B", "b"}, "c\nb\na\nB\n", 4},
+		{"2,3sort", []string{"c", "b", "a", "0"}, "c\na\nb\n0\n", 3},
+		{"sort n", []string{"x 10", "x 9", "none", "-1.5", "x 9.5"}, "none\n-1.5\nx 9\nx 9.5\nx 10\n", 5},
+		{"sort! n", []string{"1 a", "2", "1 b", "none"}, "2\n1 a\n1 b\nnone\n", 4},
+		{"uniq", []string{"a", "a", "b", "a", "b", "b"}, "a\nb\na\nb\n", 4},
+		{"3,$uniq", []string{"a", "a", "b", "b", "b", "c"}, "a\na\nb\nc\n", 4},
+		{"reverse", []string{"a", "b", "c"}, "c\nb\na\n", 3},
+		{"2,3reverse", []string{"a", "b", "c", "d"}, "a\nc\nb\nd\n", 3},
+	}
+	for _, test := range data {
+		t.Run(test.cmdLine, func(t *testing.T) {
+			state := resetState(test.buffer)
+			if err := processCommandLine(t, state, test.cmdLine); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertBufferContents(t, state.Buffer, test.expected)
+			assertInt(t, "wrong line nbr", state.lineNbr, test.expectedLineNbr)
+			if !state.changedSinceLastWrite {
+				t.Fatalf("expected buffer to be changed")
+			}
+			// a single undo restores the original lines
+			if err := processCommandLine(t, state, "u"); err != nil {
+				t.Fatalf("undo: error: %s", err)
+			}
+			assertBufferContents(t, state.Buffer, strings.Join(test.buffer, "\n")+"\n")
+		})
+	}
+}
+
+func TestSortUnchanged(t *testing.T) {
+	for _, cmdLine := range []string{"sort", "uniq", "2,3reverse"} {
+		t.Run(cmdLine, func(t *testing.T) {
+			state := resetState([]string{"a", "b", "b", "c"})
+			if err := processCommandLine(t, state, cmdLine); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			if cmdLine == "uniq" {
+				assertBufferContents(t, state.Buffer, "a\nb\nc\n")
+				return
+			}
+			assertBufferContents(t, state.Buffer, "a\nb\nb\nc\n")
+			if state.changedSinceLastWrite {
+				t.Fatalf("expected buffer to be unchanged")
+			}
+			if err := processCommandLine(t, state, "u"); !errors.Is(err, ErrNothingToUndo) {
+				t.Fatalf("expected ErrNothingToUndo, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSortMarks(t *testing.T) {
+	state := resetState([]string{"c", "a", "a", "b", "x"})
+	for _, cmdLine := range []string{"1ka", "3kb", "4kc", "5kd", "1,4sort"} {
+		if err := processCommandLine(t, state, cmdLine); err != nil {
+			t.Fatalf("command '%s': error: %s", cmdLine, err)
+		}
+	}
+	assertBufferContents(t, state.Buffer, "a\na\nb\nc\nx\n")
+	assertInt(t, "wrong mark a", state.marks["a"], 4)
+	assertInt(t, "wrong mark b", state.marks["b"], 2)
+	assertInt(t, "wrong mark c", state.marks["c"], 3)
+	assertInt(t, "wrong mark d", state.marks["d"], 5)
+
+	// the mark of a removed duplicate moves to the line which is kept
+	if err := processCommandLine(t, state, "uniq"); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertBufferContents(t, state.Buffer, "a\nb\nc\nx\n")
+	assertInt(t, "wrong mark b", state.marks["b"], 1)
+	assertInt(t, "wrong mark d", state.marks["d"], 4)
+}
+
+func TestSortErrors(t *testing.T) {
+	state := resetState([]string{"a", "b"})
+	if err := processCommandLine(t, state, "sort x"); !errors.Is(err, ErrInvalidArgument) {
+		t.Fatalf("expected ErrInvalidArgument, got %v", err)
+	}
+	// an empty buffer is not an error
+	state = resetState(nil)
+	for _, cmdLine := range []string{"sort", "uniq", "reverse"} {
+		if err := processCommandLine(t, state, cmdLine); err != nil {
+			t.Fatalf("command '%s': error: %s", cmdLine, err)
+		}
+	}
+}
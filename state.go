@@ -1,9 +1,13 @@
 package red
 
 import (
+	"bufio"
 	"container/list"
-	"fmt"
+	"io"
+	"os"
 	"regexp"
+	"sync"
+	"time"
 )
 
 type Line struct {
@@ -14,29 +18,89 @@ type Line struct {
 State stores the global state.
 */
 type State struct {
+	bufferState                                // the current buffer, its marks, undo list and file (see Session)
+	session              Session               // the other buffers being edited, see commands 'new', 'ls' and 'switch'
+	CutBuffer            *list.List            // the cut buffer, set by commands c, d, j, s or y
+	registers            map[string]*list.List // the named registers 'a'-'z', see commands 'y', 'x' and 'X'
+	listeners            []Listener            // notified of changes to the buffer, see AddListener
+	lastSubstRE          *regexp.Regexp        // the previous substitution regexp
+	lastSubstReplacement string                // the previous substitution replacement string
+	lastSubstSuffixes    substSuffixes         // the previous substitution suffixes
+	lastSearchRE         *regexp.Regexp        // the previous search regexp
+	currentUndo          *undoTransaction      // collects the undo commands of the command currently being processed
+	warnedCommand        string                // the command ('q' or 'e') just refused because of unsaved changes, see checkUnsavedChanges
+	Templates            map[string]string     // named templates for the template command
+	aliases              map[string][]string   // the commands of the user-defined aliases, see command 'alias'
+	extensions           map[string]extension  // the extensions run by the command '|', see RegisterExtension
+	Stdin                io.Reader             // where user input is read from, defaults to os.Stdin
+	Input                *bufio.Reader         // buffered reader on Stdin, created when first needed (see InputReader)
+	Stdout               io.Writer             // where the output of the commands is written to, defaults to os.Stdout
+	Stderr               io.Writer             // where diagnostics are written to, defaults to os.Stderr
+	Shell                ShellExecutor         // runs shell commands, e.g. for the '!' command
+	FileSystem           FileSystem            // where files are read from and written to, defaults to OSFileSystem
+	lastShellCommand     string                // the previous shell command
+	LastError            error                 // the last error, explained by the command 'h'
+	History              *History              // the command lines entered at the prompt, see command 'history'
+	fileList             []string              // the files to be edited, see commands 'fn' and 'fp'
+	fileIndex            int                   // index of the current file in fileList
+	interrupted          int32                 // set (atomically) by Interrupt, see checkInterrupt
+	commandMutex         *sync.Mutex           // held whilst a top-level command is processed, see StartAutosave
+	terminalWindowSize   int                   // the window size derived from the terminal size, see HandleWindowResize
+	MorePrompt           MorePrompt            // asks whether to continue when a page of output has been printed, see PageSize
+	pagerLinesLeft       int                   // the number of lines which can be printed before the next '--More--'
+	pagerStopped         bool                  // whether the output of the current command was stopped at the '--More--' prompt
+	ProgramFlags
+}
+
+/*
+bufferState is the part of the state which belongs to one buffer, i.e. to one file being edited.
+ Its fields are promoted into State, where they always refer to the current buffer;
+ everything else in State (e.g. the cut buffer, the registers and the settings) is shared by all buffers.
+*/
+type bufferState struct {
 	// the last line number is accessible via buffer.Len()
-	Buffer                *list.List     // the current buffer -- should never be null
-	CutBuffer             *list.List     // the cut buffer, set by commands c, d, j, s or y
-	dotline               *list.Element  // the current (dot) line -- can be null
+	Buffer                Buffer         // the current buffer -- should never be null
 	marks                 map[string]int // file marks
-	lineNbr               int            // the current line number
-	lastSubstRE           *regexp.Regexp // the previous substitution regexp
-	lastSubstReplacement  string         // the previous substitution replacement string
-	lastSubstSuffixes     string         // the previous substitution suffixes
-	lastSearchRE          *regexp.Regexp // the previous search regexp
-	undo                  *list.List     // list of commands to undo
-	processingUndo        bool           // if currently processing an undo (therefore don't add undo commands)
+	lineNbr               int            // the current (dot) line number, 0 if the buffer is empty
+	undo                  *list.List     // list of undo transactions, the most recent first
+	redo                  *list.List     // list of undone transactions which can be redone, the most recently undone first
 	changedSinceLastWrite bool           // whether the buffer has been changed since the last write
-	ProgramFlags
+	noFinalNewline        bool           // whether the file read by 'e' did not end with a newline, see Write
+	dosLineEndings        bool           // whether the buffer is written with DOS line endings, see SetLineEndings
+	fileEncoding          fileEncoding   // the encoding of the file read by 'e', see Write
+	defaultFilename       string         // name of the default file
+	recoveryFilename      string         // the recovery file written by the last autosave
 }
 
 type ProgramFlags struct {
-	defaultFilename string // name of the default file
-	WindowSize      int    // window size - for scroll command
-	Debug           bool   // cmdline flag: debugging activated?
-	ShowMemory      bool   // cmdline flag: show memory stats?
-	Prompt          string // cmdline flag: the prompt string
-	ShowPrompt      bool   // whether to show the prompt
+	WindowSize       int           // window size - for scroll command
+	PageSize         int           // the print commands pause after this many lines, 0: no paging (see MorePrompt)
+	TabStop          int           // width of a tab stop - for retab command
+	TextWidth        int           // maximum line length - for reflow command
+	Indent           string        // the indentation added or removed by the shift commands '>' and '<'
+	JoinSeparator    string        // separator used by the join command
+	JoinNext         bool          // whether a join command with one address joins with the next line
+	HighlightDot     bool          // whether the current line is marked when printing
+	Color            string        // cmdline flag: when line numbers and matches are coloured: auto (on a terminal), always or never
+	Messages         string        // cmdline flag: where informational messages and errors are written: stdout, stderr or tagged (see CheckMessages)
+	IgnoreCase       bool          // whether regexes match case-insensitively
+	VerboseErrors    bool          // whether error messages are printed, or just '?' (see command 'H')
+	Debug            bool          // cmdline flag: debugging activated?
+	ShowMemory       bool          // cmdline flag: show memory stats?
+	Silent           bool          // cmdline flag: script mode, i.e. no byte counts from e, r, w and no '!' after shell commands
+	Deterministic    bool          // cmdline flag: suppress or normalise nondeterministic output (e.g. for golden-file tests)
+	UndoToggle       bool          // cmdline flag: GNU-compatible undo: only the last command can be undone, and 'u' undoes a previous 'u'
+	CheckState       bool          // cmdline flag: check the invariants of the state after each command?
+	BackupSuffix     string        // cmdline flag: suffix of the backup made of a file before 'w' overwrites it (see BackupFile)
+	BackupDir        string        // cmdline flag: directory for the backups (default: the directory of the file)
+	WriteInPlace     bool          // cmdline flag: 'w' overwrites an existing file in place rather than replacing it (see OSFileSystem)
+	Restricted       bool          // cmdline flag: restricted mode, i.e. no shell commands and only the files given on the command line can be edited
+	AutosaveInterval time.Duration // cmdline flag: the interval at which unsaved changes are written to a recovery file, see StartAutosave
+	Encoding         string        // cmdline flag: the encoding of files without a byte order mark (default UTF-8, see CheckEncoding)
+	LargeFiles       bool          // cmdline flag: 'e' reads the lines of a file only when they are accessed (see largeFileBuffer)
+	TempDir          string        // the directory for temporary files (default: os.TempDir), see ApplyEnvironment
+	Prompt           string        // cmdline flag: the prompt string
+	ShowPrompt       bool          // whether to show the prompt
 }
 
 /*
@@ -44,37 +108,44 @@ Undo stores information about the inverse of the current command, and is stored
  Some commands (e.g. move) require a multi-command undo. This is handled internally using a special command.
 */
 type Undo struct {
-	cmd         Command    // the command required to undo what has just been changed
-	text        *list.List // text which was changed
-	originalCmd Command    // for when we implement 'redo'
+	cmd   Command        // the command required to undo what has just been changed
+	text  *list.List     // text which was changed
+	marks map[string]int // marks to be set after the undo command has been executed (e.g. those of deleted lines)
 }
 
 /*
 NewState initialises a state structure.
 */
 func NewState() *State {
-	state := State{}
-	state.Buffer = list.New()
+	state := State{bufferState: newBufferState()}
 	state.CutBuffer = list.New()
-	state.marks = make(map[string]int)
-	state.undo = list.New()
+	state.registers = make(map[string]*list.List)
+	state.commandMutex = &sync.Mutex{}
+	state.Templates = defaultTemplates()
+	state.Stdin = os.Stdin
+	state.Stdout = os.Stdout
+	state.Stderr = os.Stderr
+	state.Shell = NewShellExecutor(defaultShell)
+	state.FileSystem = OSFileSystem
+	state.History = NewHistory(defaultHistorySize)
 	state.Prompt = ":" // default prompt
+	state.TabStop = 8  // default tab stop
+	state.TextWidth = 72
+	state.Indent = "\t"
+	state.Color = colorAuto
+	state.Messages = messagesStdout
+	state.JoinSeparator = "" // as in ed, lines are joined without a separator
 
 	return &state
 }
 
 /*
- Adds an undo command to the list held in the state.
- Does nothing if we're already processing an "undo".
+InputReader returns the reader for user input (commands, input-mode text, etc.), creating a reader on state.Stdin if none has been set.
+ All user input must be read via this reader, since it may buffer more than the current line.
 */
-func (state *State) addUndo(start, end int, command string, text *list.List, origCmd Command) {
-	if !state.processingUndo {
-		startAddr := newAbsoluteAddress(start)
-		endAddr := newAbsoluteAddress(end)
-		undoCommand := Undo{Command{addrRange: AddressRange{startAddr, endAddr, separatorComma}, cmd: command, restOfCmd: ""}, text, origCmd}
-		if state.Debug {
-			fmt.Println("added undo:", undoCommand)
-		}
-		state.undo.PushFront(undoCommand)
+func (state *State) InputReader() *bufio.Reader {
+	if state.Input == nil {
+		state.Input = bufio.NewReader(state.Stdin)
 	}
+	return state.Input
 }
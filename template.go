@@ -0,0 +1,168 @@
+package red
+
+import (
+	"bufio"
+	"container/list"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// formats used to expand the date/time placeholders
+const (
+	templateDateFormat     string = "2006-01-02"
+	templateTimeFormat     string = "15:04:05"
+	templateDateTimeFormat string = "2006-01-02 15:04:05"
+)
+
+var (
+	// matches the placeholders {date}, {time}, {datetime}, {file} and {env:NAME}
+	templatePlaceholderRE = regexp.MustCompile(`\{(date|time|datetime|file|env:[A-Za-z_][A-Za-z0-9_]*)\}`)
+	// the current time -- can be replaced in tests
+	timeNow = time.Now
+	// the time used instead of the current time if state.Deterministic is set
+	deterministicTime = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+)
+
+/*
+defaultTemplates returns the predefined templates.
+*/
+func defaultTemplates() map[string]string {
+	return map[string]string{
+		"date":     "{date}",
+		"time":     "{time}",
+		"datetime": "{datetime}",
+	}
+}
+
+// name of the templates config file in the user's home directory
+const templatesFilename string = ".red_templates"
+
+/*
+LoadTemplatesFile reads template definitions from the given file and adds them to state.Templates (see LoadTemplates).
+If no filename is given, the file '.red_templates' in the user's home directory is read, if present.
+*/
+func LoadTemplatesFile(state *State, filename string) error {
+	mustExist := filename != ""
+	if !mustExist {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil
+		}
+		filename = home + string(os.PathSeparator) + templatesFilename
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		if !mustExist && errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	if err = LoadTemplates(state, f); err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	return nil
+}
+
+/*
+LoadTemplates reads template definitions and adds them to state.Templates, replacing any existing template of the same name.
+
+ Each line defines one template in the form 'name = text'.
+ Empty lines and lines starting with '#' are ignored.
+*/
+func LoadTemplates(state *State, reader io.Reader) error {
+	scanner := bufio.NewScanner(reader)
+	for lineNbr := 1; scanner.Scan(); lineNbr++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pos := strings.Index(line, "=")
+		if pos < 1 {
+			return fmt.Errorf("line %d: expected 'name = text'", lineNbr)
+		}
+		name := strings.TrimSpace(line[:pos])
+		if strings.ContainsAny(name, " \t") {
+			return fmt.Errorf("line %d: invalid template name '%s'", lineNbr, name)
+		}
+		state.Templates[name] = strings.TrimSpace(line[pos+1:])
+	}
+	return scanner.Err()
+}
+
+/*
+Template inserts expanded template text after the addressed line.
+
+ (.)@name      inserts the template 'name' (see state.Templates and LoadTemplates)
+ (.)@/text/    inserts 'text' (any character can be used as the delimiter)
+
+ The following placeholders are expanded:
+   {date} {time} {datetime}  the current date and/or time
+   {file}                    the default filename
+   {env:NAME}                the value of the environment variable NAME
+ The sequence '\n' in the template starts a new line.
+ If state.Deterministic is set, the date and time are always 2000-01-01 00:00:00 (UTC).
+
+ The address '0' (zero) is valid for this command; it inserts the text at the beginning of the buffer.
+ The current address is set to the address of the last line inserted.
+
+ Calls internally AppendInsert, which is where the undo is handled.
+*/
+func (cmd Command) Template(state *State) error {
+	if err := cmd.validateAddress(state); err != nil {
+		return err
+	}
+	arg := strings.TrimSpace(cmd.restOfCmd)
+	if arg == "" {
+		return fmt.Errorf("template: %w: missing template name or text", ErrInvalidArgument)
+	}
+	var template string
+	if t, defined := state.Templates[arg]; defined {
+		template = t
+	} else {
+		var err error
+		if template, err = parseDelimitedArg(arg); err != nil {
+			return fmt.Errorf("template: %w: unknown template '%s'", ErrInvalidArgument, arg)
+		}
+	}
+
+	newLines := list.New()
+	for _, line := range strings.Split(expandTemplate(template, state), `\n`) {
+		newLines.PushBack(Line{line + "\n"})
+	}
+	appendCommand, err := cmd.createNewResolvedCommand(commandAppend, "")
+	if err != nil {
+		return err
+	}
+	return appendCommand.AppendInsert(state, newLines)
+}
+
+/*
+ Replaces the placeholders in the template with their current values.
+*/
+func expandTemplate(template string, state *State) string {
+	now := timeNow()
+	if state.Deterministic {
+		now = deterministicTime
+	}
+	return templatePlaceholderRE.ReplaceAllStringFunc(template, func(placeholder string) string {
+		name := placeholder[1 : len(placeholder)-1]
+		switch name {
+		case "date":
+			return now.Format(templateDateFormat)
+		case "time":
+			return now.Format(templateTimeFormat)
+		case "datetime":
+			return now.Format(templateDateTimeFormat)
+		case "file":
+			return state.defaultFilename
+		default:
+			return os.Getenv(strings.TrimPrefix(name, "env:"))
+		}
+	})
+}
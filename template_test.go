@@ -0,0 +1,109 @@
+package red
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTemplate(t *testing.T) {
+	timeNow = func() time.Time { return time.Date(2021, time.March, 4, 15, 6, 7, 0, time.UTC) }
+	defer func() { timeNow = time.Now }()
+	os.Setenv("RED_TEMPLATE_TEST", "xyz")
+	defer os.Unsetenv("RED_TEMPLATE_TEST")
+
+	data := []struct {
+		addrRange        string
+		arg              string
+		expectedContents string
+		expectedLineNbr  int
+	}{
+		{"1", "date", "a\n2021-03-04\nb\n", 2},
+		{"0", "/{datetime} {file}/", "2021-03-04 15:06:07 myfile\na\nb\n", 1},
+		{"2", "|Author: {env:RED_TEMPLATE_TEST}\\nDate: {date}|", "a\nb\nAuthor: xyz\nDate: 2021-03-04\n", 4},
+		{"2", "header", "a\nb\n# myfile\n# ---\n", 4},
+	}
+
+	for i, test := range data {
+		t.Run(fmt.Sprintf("test %d: >>%s%s%s<<", i, test.addrRange, commandTemplate, test.arg), func(t *testing.T) {
+			var err error
+			var cmd Command
+			state := resetState([]string{"a", "b"})
+			state.defaultFilename = "myfile"
+			state.Templates["header"] = `# {file}\n# ---`
+			if cmd, err = createCommandAndResolveAddressRange(state, newValidRange(test.addrRange), commandTemplate, test.arg); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			if err = cmd.Template(state); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			assertInt(t, "wrong state.lineNbr!", state.lineNbr, test.expectedLineNbr)
+			assertBufferContents(t, state.Buffer, test.expectedContents)
+		})
+	}
+}
+
+func TestUnknownTemplate(t *testing.T) {
+	state := resetState([]string{"a", "b"})
+	cmd, err := createCommandAndResolveAddressRange(state, newValidRange("1"), commandTemplate, "nosuchtemplate")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if err = cmd.Template(state); err == nil {
+		t.Fatalf("expected error for unknown template")
+	}
+}
+
+func TestTemplateDeterministic(t *testing.T) {
+	state := resetState([]string{"a"})
+	state.Deterministic = true
+	cmd, err := createCommandAndResolveAddressRange(state, newValidRange("1"), commandTemplate, "datetime")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if err = cmd.Template(state); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertBufferContents(t, state.Buffer, "a\n2000-01-01 00:00:00\n")
+}
+
+func TestLoadTemplates(t *testing.T) {
+	state := resetState([]string{})
+	config := "# my templates\n\nsig = -- {env:USER}\nheader=# {file}\\n# ---\ndate = {datetime}\n"
+	if err := LoadTemplates(state, strings.NewReader(config)); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertString(t, "template sig", state.Templates["sig"], "-- {env:USER}")
+	assertString(t, "template header", state.Templates["header"], `# {file}\n# ---`)
+	assertString(t, "template date", state.Templates["date"], "{datetime}")
+	assertString(t, "template time", state.Templates["time"], "{time}")
+}
+
+func TestLoadTemplatesErrors(t *testing.T) {
+	for _, config := range []string{"no equals sign", "= text", "two words = text"} {
+		if err := LoadTemplates(resetState([]string{}), strings.NewReader(config)); err == nil {
+			t.Fatalf("expected error for '%s'", config)
+		}
+	}
+}
+
+func TestLoadTemplatesFile(t *testing.T) {
+	f, err := os.CreateTemp("", "red-templates")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.Remove(f.Name())
+	fmt.Fprintln(f, "greeting = hello")
+	f.Close()
+
+	state := resetState([]string{})
+	if err = LoadTemplatesFile(state, f.Name()); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	assertString(t, "template greeting", state.Templates["greeting"], "hello")
+	if err = LoadTemplatesFile(state, f.Name()+".missing"); err == nil {
+		t.Fatalf("expected error for missing file")
+	}
+}
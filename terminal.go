@@ -0,0 +1,68 @@
+package red
+
+import (
+	"io"
+	"os"
+	"strconv"
+)
+
+// window size used if the screen size can't be determined (as for ed, which assumes a 24-line screen)
+const defaultWindowSize int = 22
+
+/*
+TerminalWindowSize returns the window size to be used for the scroll command,
+i.e. the screen size minus two lines, or 22 if the screen size can't be determined.
+
+The screen size is queried from the terminal (stdout). If stdout is not a terminal,
+the environment variable LINES is used, if set.
+*/
+func TerminalWindowSize() int {
+	if rows, ok := terminalRows(os.Stdout); ok && rows > 2 {
+		return rows - 2
+	}
+	if lines, err := strconv.Atoi(os.Getenv("LINES")); err == nil && lines > 2 {
+		return lines - 2
+	}
+	return defaultWindowSize
+}
+
+/*
+ Returns true if the writer is a terminal.
+*/
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	_, ok = terminalRows(f)
+	return ok
+}
+
+/*
+HandleWindowResize keeps state.WindowSize up to date (see TerminalWindowSize) when the terminal is resized,
+unless the window size has since been set otherwise, e.g. with 'z=n'.
+ The current window size is assumed to have been derived from the terminal size.
+ Returns a function which stops the handling.
+*/
+func HandleWindowResize(state *State) (stop func()) {
+	state.terminalWindowSize = state.WindowSize
+	return notifyWindowResize(func() {
+		state.commandMutex.Lock()
+		defer state.commandMutex.Unlock()
+		state.resizeWindow(TerminalWindowSize())
+	})
+}
+
+/*
+ Sets the window size to the new size, if the window size is still the one derived from the terminal size.
+*/
+func (state *State) resizeWindow(newSize int) {
+	if state.WindowSize == state.terminalWindowSize {
+		state.WindowSize = newSize
+	}
+	if state.PageSize > 0 {
+		// a screenful, leaving one line for the '--More--' prompt
+		state.PageSize = newSize + 1
+	}
+	state.terminalWindowSize = newSize
+}
@@ -0,0 +1,93 @@
+package terminal
+
+import (
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+/*
+Completer completes the text before the cursor when Tab is pressed (see LineEditor.Completer).
+*/
+type Completer interface {
+	// Complete returns the candidates for replacing the text head[start:], where 'head' is the line up to the cursor.
+	// Returns ok=false if nothing can be completed at this position.
+	Complete(head string) (start int, candidates []string, ok bool)
+}
+
+// a command line consisting of simple addresses (line numbers, '.', '$', marks, offsets),
+// a command and a filename, e.g. '1,$w file'
+var filenameCommandRE = regexp.MustCompile(`^(?:[0-9.$,;+\- ]|'[a-z])*([a-zA-Z]+) +([^ !][^ ]*|)$`)
+
+/*
+FilenameCompleter completes the filenames given to the commands 'Commands' (e.g. 'e' or 'w').
+ The filenames are looked up in the file system FS: relative names in its directory ".",
+ absolute names as given (which requires an FS such as red.OSFileSystem which accepts these).
+*/
+type FilenameCompleter struct {
+	FS       fs.FS
+	Commands []string
+}
+
+func (c FilenameCompleter) Complete(head string) (start int, candidates []string, ok bool) {
+	match := filenameCommandRE.FindStringSubmatchIndex(head)
+	if match == nil || !c.isFilenameCommand(head[match[2]:match[3]]) {
+		return 0, nil, false
+	}
+	start = match[4]
+	word := head[start:]
+	dir, prefix := path.Split(word)
+	readDir := "."
+	if dir != "" {
+		readDir = path.Clean(dir)
+	}
+	entries, err := fs.ReadDir(c.FS, readDir)
+	if err != nil {
+		return start, nil, true
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		// hidden files are only completed if asked for
+		if !strings.HasPrefix(name, prefix) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(prefix, ".")) {
+			continue
+		}
+		if entry.IsDir() {
+			name += "/"
+		}
+		candidates = append(candidates, dir+name)
+	}
+	sort.Strings(candidates)
+	return start, candidates, true
+}
+
+func (c FilenameCompleter) isFilenameCommand(cmd string) bool {
+	for _, command := range c.Commands {
+		if cmd == command {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ Returns the longest common prefix of the strings.
+*/
+func commonPrefix(strs []string) string {
+	if len(strs) == 0 {
+		return ""
+	}
+	prefix := strs[0]
+	for _, s := range strs[1:] {
+		for !strings.HasPrefix(s, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	// don't split a multi-byte character
+	for !utf8.ValidString(prefix) {
+		prefix = prefix[:len(prefix)-1]
+	}
+	return prefix
+}
@@ -0,0 +1,114 @@
+package terminal
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+var testFS = fstest.MapFS{
+	"file.txt":         {},
+	"file2.txt":        {},
+	"notes.md":         {},
+	".hidden":          {},
+	"dir/a.go":         {},
+	"dir/b.go":         {},
+	"dir/sub/c.go":     {},
+	"äpfel/birnen.txt": {},
+}
+
+func TestFilenameCompleter(t *testing.T) {
+	completer := FilenameCompleter{FS: testFS, Commands: []string{"e", "r", "w", "f"}}
+	data := []struct {
+		head               string
+		expectedOK         bool
+		expectedStart      int
+		expectedCandidates string
+	}{
+		{"e ", true, 2, "dir/,file.txt,file2.txt,notes.md,äpfel/"},
+		{"e fi", true, 2, "file.txt,file2.txt"},
+		{"e n", true, 2, "notes.md"},
+		{"e .", true, 2, ".hidden"},
+		{"e x", true, 2, ""},
+		{"r dir/", true, 2, "dir/a.go,dir/b.go,dir/sub/"},
+		{"1,$w dir/s", true, 5, "dir/sub/"},
+		{"'a,.+2w  d", true, 9, "dir/"},
+		{"f missing/x", true, 2, ""},
+		{"e", false, 0, ""},
+		{"e !ls", false, 0, ""},
+		{"p fi", false, 0, ""},
+		{"s/a/b/ fi", false, 0, ""},
+		{"e file.txt x", false, 0, ""},
+	}
+	for i, test := range data {
+		t.Run(fmt.Sprintf("test %d: %q", i, test.head), func(t *testing.T) {
+			start, candidates, ok := completer.Complete(test.head)
+			if ok != test.expectedOK {
+				t.Fatalf("expected ok=%t", test.expectedOK)
+			}
+			if start != test.expectedStart {
+				t.Fatalf("expected start %d, got %d", test.expectedStart, start)
+			}
+			if got := strings.Join(candidates, ","); got != test.expectedCandidates {
+				t.Fatalf("expected candidates %q, got %q", test.expectedCandidates, got)
+			}
+		})
+	}
+}
+
+func TestCommonPrefix(t *testing.T) {
+	data := []struct {
+		strs     []string
+		expected string
+	}{
+		{nil, ""},
+		{[]string{"abc"}, "abc"},
+		{[]string{"abc", "abd", "ab"}, "ab"},
+		{[]string{"xyz", "abc"}, ""},
+		{[]string{"äb", "ö"}, ""}, // 'ä' and 'ö' share their first byte
+	}
+	for _, test := range data {
+		if got := commonPrefix(test.strs); got != test.expected {
+			t.Fatalf("%v: expected %q, got %q", test.strs, test.expected, got)
+		}
+	}
+}
+
+func TestTabCompletion(t *testing.T) {
+	data := []struct {
+		input          string
+		command        bool
+		expected       string
+		expectedOutput string // expected to be contained in the output
+	}{
+		{"e n\t\r", true, "e notes.md", ""},
+		{"e fi\t\r", true, "e file", ""},
+		{"e file\t\r", true, "e file", "\nfile.txt  file2.txt\n"},
+		{"w d\ts\t\r", true, "w dir/sub/", ""},
+		{"w d\t\x01\x06\x06\x06\x0bx\r", true, "w dx", ""}, // editing continues after completion
+		{"e x\t\r", true, "e x", "\a"},
+		{"s/a/\t/\r", true, "s/a/\t/", ""}, // nothing to complete: a tab is inserted
+		{"e n\t\r", false, "e n\t", ""},    // input mode
+	}
+	for i, test := range data {
+		t.Run(fmt.Sprintf("test %d: %q", i, test.input), func(t *testing.T) {
+			var output strings.Builder
+			editor := NewLineEditor(strings.NewReader(test.input), &output)
+			editor.Completer = FilenameCompleter{FS: testFS, Commands: []string{"e", "w"}}
+			if test.command {
+				editor.SetPrompt(": ")
+			}
+			line, err := editor.ReadLine()
+			if err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			if line != test.expected {
+				t.Fatalf("expected %q, got %q", test.expected, line)
+			}
+			if !strings.Contains(output.String(), test.expectedOutput) {
+				t.Fatalf("expected output to contain %q, got %q", test.expectedOutput, output.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,551 @@
+/*
+Package terminal provides interactive line editing for the command prompt and input mode of red.
+*/
+package terminal
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// control characters
+const (
+	keyCtrlA     rune = 0x01
+	keyCtrlB     rune = 0x02
+	keyCtrlC     rune = 0x03
+	keyCtrlD     rune = 0x04
+	keyCtrlE     rune = 0x05
+	keyCtrlF     rune = 0x06
+	keyCtrlH     rune = 0x08
+	keyCtrlK     rune = 0x0b
+	keyCtrlG     rune = 0x07
+	keyCtrlL     rune = 0x0c
+	keyEnter     rune = 0x0d
+	keyNewline   rune = 0x0a
+	keyCtrlN     rune = 0x0e
+	keyCtrlP     rune = 0x10
+	keyCtrlR     rune = 0x12
+	keyCtrlU     rune = 0x15
+	keyCtrlW     rune = 0x17
+	keyCtrlY     rune = 0x19
+	keyEscape    rune = 0x1b
+	keyBackspace rune = 0x7f
+)
+
+/*
+LineEditor reads lines from a terminal, allowing them to be edited before they are entered.
+
+ Supported keys:
+  left, right / Ctrl-B, Ctrl-F   move the cursor one character
+  Alt-B, Alt-F                   move the cursor one word
+  Home, End / Ctrl-A, Ctrl-E     move the cursor to the start or end of the line
+  Backspace, Delete              delete the character before or under the cursor
+  Ctrl-D                         delete the character under the cursor, or end of input if the line is empty
+  Ctrl-K                         kill (cut) the rest of the line
+  Ctrl-U                         kill the line up to the cursor
+  Ctrl-W                         kill the word before the cursor
+  Ctrl-Y                         yank (insert) the most recently killed text
+  up, down / Ctrl-P, Ctrl-N      recall the previous or next line of the history
+  Ctrl-R                         search backwards in the history (Enter accepts, Ctrl-G cancels)
+  Tab                            complete the text before the cursor (in a command line, see Completer)
+  Ctrl-C                         abandon the line
+  Ctrl-L                         redraw the line
+
+ A LineEditor is an io.Reader which returns the entered lines, each terminated by "\n",
+ and can therefore be used as the input of the editor (see red.State.Stdin).
+ The line is assumed to fit onto one line of the terminal.
+*/
+type LineEditor struct {
+	History   History   // the previously entered lines, may be nil
+	Completer Completer // completes command lines, may be nil
+
+	in      *bufio.Reader
+	out     io.Writer
+	fd      uintptr // the file descriptor of the terminal
+	raw     bool    // whether the terminal is switched into raw mode whilst reading a line
+	prompt  string  // the prompt for the next line, see SetPrompt
+	command bool    // whether the line being read is a command line, see SetPrompt
+	line    []rune  // the line being edited
+	pos     int     // the position of the cursor in the line
+	column  int     // the position of the cursor on the screen, relative to the start of the prompt
+	killed  []rune  // the most recently killed text, see Ctrl-Y
+	pending []byte  // the part of the entered line not yet returned by Read
+	recall  int     // the index of the history entry being shown, History.Len() for the new line
+	newLine []rune  // the new line, whilst a history entry is being shown
+}
+
+/*
+History gives access to the previously entered lines, the oldest (index 0) first.
+*/
+type History interface {
+	Len() int
+	Entry(i int) string
+}
+
+/*
+NewLineEditor creates a line editor reading from 'in' and echoing to 'out'.
+ If 'in' is a terminal, it is switched into raw mode whilst a line is being read.
+*/
+func NewLineEditor(in io.Reader, out io.Writer) *LineEditor {
+	editor := &LineEditor{in: bufio.NewReader(in), out: out}
+	if f, ok := in.(*os.File); ok && IsTerminal(f.Fd()) {
+		editor.fd = f.Fd()
+		editor.raw = true
+	}
+	return editor
+}
+
+/*
+SetPrompt sets the prompt which is shown when the next line is read, which is a command line.
+ The prompt is only used for one line, i.e. subsequent lines (e.g. in input mode) have no prompt,
+ and Tab inserts a tab instead of completing the line.
+*/
+func (e *LineEditor) SetPrompt(prompt string) {
+	e.prompt = prompt
+	e.command = true
+}
+
+/*
+Read implements io.Reader. Each call returns (at most) one line.
+*/
+func (e *LineEditor) Read(p []byte) (int, error) {
+	if len(e.pending) == 0 {
+		line, err := e.ReadLine()
+		if err != nil {
+			return 0, err
+		}
+		e.pending = []byte(line + "\n")
+	}
+	n := copy(p, e.pending)
+	e.pending = e.pending[n:]
+	return n, nil
+}
+
+/*
+ReadLine reads and returns a line, without its line terminator.
+ Returns io.EOF if Ctrl-D is entered on an empty line, or the input is exhausted.
+*/
+func (e *LineEditor) ReadLine() (string, error) {
+	if e.raw {
+		restore, err := makeRaw(e.fd)
+		if err != nil {
+			return "", err
+		}
+		defer restore()
+	}
+	prompt, command := e.prompt, e.command
+	e.prompt, e.command = "", false
+	e.line = e.line[:0]
+	e.pos = 0
+	e.refresh(prompt)
+	e.recall = e.historyLen()
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			if err == io.EOF && len(e.line) != 0 {
+				break
+			}
+			return "", err
+		}
+		if r == keyCtrlR {
+			if r = e.searchHistory(); r == keyCtrlG {
+				e.refresh(prompt)
+				continue
+			}
+		}
+		if r == '\t' && command && e.Completer != nil && e.complete(prompt) {
+			continue
+		}
+		if done, err := e.handleKey(r); done {
+			return string(e.line), err
+		}
+		e.refresh(prompt)
+	}
+	return e.enter(), nil
+}
+
+/*
+ Processes the key. Returns true if the line is finished, or there is no more input (io.EOF).
+*/
+func (e *LineEditor) handleKey(r rune) (done bool, err error) {
+	switch r {
+	case keyEnter, keyNewline:
+		e.enter()
+		return true, nil
+	case keyCtrlD:
+		if len(e.line) == 0 {
+			e.enter()
+			return true, io.EOF
+		}
+		e.deleteChars(e.pos, minInt(e.pos+1, len(e.line)))
+	case keyCtrlC:
+		io.WriteString(e.out, "^C\n")
+		e.column = 0
+		e.line = e.line[:0]
+		e.pos = 0
+		e.recall = e.historyLen()
+	case keyCtrlA:
+		e.pos = 0
+	case keyCtrlE:
+		e.pos = len(e.line)
+	case keyCtrlB:
+		e.pos = maxInt(e.pos-1, 0)
+	case keyCtrlF:
+		e.pos = minInt(e.pos+1, len(e.line))
+	case keyBackspace, keyCtrlH:
+		e.deleteChars(maxInt(e.pos-1, 0), e.pos)
+	case keyCtrlK:
+		e.kill(e.pos, len(e.line))
+	case keyCtrlU:
+		e.kill(0, e.pos)
+	case keyCtrlW:
+		e.kill(e.previousWord(), e.pos)
+	case keyCtrlY:
+		e.insert(e.killed)
+	case keyCtrlP:
+		e.recallEntry(e.recall - 1)
+	case keyCtrlN:
+		e.recallEntry(e.recall + 1)
+	case keyCtrlL:
+		// redrawn by the caller
+	case keyEscape:
+		e.escapeSequence()
+	default:
+		if unicode.IsPrint(r) || r == '\t' {
+			e.insert([]rune{r})
+		}
+	}
+	return false, nil
+}
+
+/*
+ Completes the text before the cursor as far as possible (see Completer).
+ If there are several possible completions, these are listed.
+ Returns false if there is nothing to complete at the cursor position.
+*/
+func (e *LineEditor) complete(prompt string) bool {
+	head := string(e.line[:e.pos])
+	start, candidates, ok := e.Completer.Complete(head)
+	if !ok {
+		return false
+	}
+	word := head[start:]
+	prefix := commonPrefix(candidates)
+	switch {
+	case len(candidates) == 0:
+		io.WriteString(e.out, "\a")
+	case len(prefix) > len(word) && strings.HasPrefix(prefix, word):
+		e.insert([]rune(prefix[len(word):]))
+	case len(candidates) > 1:
+		var sb strings.Builder
+		sb.WriteString("\n")
+		for i, candidate := range candidates {
+			if i > 0 {
+				sb.WriteString("  ")
+			}
+			sb.WriteString(path.Base(candidate))
+			if strings.HasSuffix(candidate, "/") {
+				sb.WriteString("/")
+			}
+		}
+		sb.WriteString("\n")
+		io.WriteString(e.out, sb.String())
+		e.column = 0
+	}
+	e.refresh(prompt)
+	return true
+}
+
+func (e *LineEditor) historyLen() int {
+	if e.History == nil {
+		return 0
+	}
+	return e.History.Len()
+}
+
+/*
+ Replaces the line by the given history entry, or by the new line if index is History.Len().
+ The new line is kept whilst history entries are shown.
+*/
+func (e *LineEditor) recallEntry(index int) {
+	if index < 0 || index > e.historyLen() || index == e.recall {
+		return
+	}
+	if e.recall == e.historyLen() {
+		e.newLine = append(e.newLine[:0], e.line...)
+	}
+	e.recall = index
+	if index == e.historyLen() {
+		e.line = append(e.line[:0], e.newLine...)
+	} else {
+		e.line = []rune(e.History.Entry(index))
+	}
+	e.pos = len(e.line)
+}
+
+/*
+ Searches backwards in the history for the entries containing the text typed so far (reverse-i-search).
+ Ctrl-R searches for the next older match, Backspace removes the last character of the search text.
+
+ Enter or any other key (e.g. a cursor key) accepts the match, which replaces the line;
+ the key is then returned for further processing.
+ Ctrl-G cancels the search, leaving the line unchanged, and is returned.
+*/
+func (e *LineEditor) searchHistory() rune {
+	var query []rune
+	match := -1 // index of the matching entry
+	for {
+		e.refreshSearch(string(query), match)
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return keyCtrlG
+		}
+		switch {
+		case r == keyCtrlG:
+			return r
+		case r == keyCtrlR:
+			if match > 0 {
+				match = e.findEntry(string(query), match-1)
+			}
+		case r == keyBackspace || r == keyCtrlH:
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				match = e.findEntry(string(query), e.historyLen()-1)
+			}
+		case unicode.IsPrint(r):
+			query = append(query, r)
+			from := match
+			if from < 0 {
+				from = e.historyLen() - 1
+			}
+			match = e.findEntry(string(query), from)
+		default:
+			if match >= 0 {
+				e.recallEntry(match)
+			}
+			return r
+		}
+	}
+}
+
+/*
+ Returns the index of the newest history entry at or before 'from' containing the text, or -1.
+*/
+func (e *LineEditor) findEntry(text string, from int) int {
+	if text == "" {
+		return -1
+	}
+	for i := minInt(from, e.historyLen()-1); i >= 0; i-- {
+		if strings.Contains(e.History.Entry(i), text) {
+			return i
+		}
+	}
+	return -1
+}
+
+/*
+ Shows the state of the history search instead of the prompt and the line.
+*/
+func (e *LineEditor) refreshSearch(query string, match int) {
+	text := "(reverse-i-search)'" + query + "': "
+	if match >= 0 {
+		text += e.History.Entry(match)
+	}
+	var sb strings.Builder
+	if e.column > 0 {
+		fmt.Fprintf(&sb, "\x1b[%dD", e.column)
+	}
+	sb.WriteString(text)
+	sb.WriteString("\x1b[K")
+	io.WriteString(e.out, sb.String())
+	e.column = utf8.RuneCountInString(text)
+}
+
+/*
+More shows the prompt "--More--" and waits for a key: Space continues with a page ('pageSize' lines),
+Enter with one line, and 'q' (or Ctrl-C, Ctrl-D) stops the output.
+ Returns the number of lines to be printed, 0 to stop. It can be used as red.State.MorePrompt.
+*/
+func (e *LineEditor) More(pageSize int) int {
+	if e.raw {
+		restore, err := makeRaw(e.fd)
+		if err != nil {
+			return pageSize
+		}
+		defer restore()
+	}
+	io.WriteString(e.out, "--More--")
+	// the prompt is removed again
+	defer io.WriteString(e.out, "\r\x1b[K")
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return 0
+		}
+		switch r {
+		case ' ':
+			return pageSize
+		case keyEnter, keyNewline:
+			return 1
+		case 'q', 'Q', keyCtrlC, keyCtrlD:
+			return 0
+		}
+	}
+}
+
+/*
+ Handles the escape sequences sent by the cursor keys etc.
+*/
+func (e *LineEditor) escapeSequence() {
+	r, _, err := e.in.ReadRune()
+	if err != nil {
+		return
+	}
+	switch r {
+	case 'b', 'B':
+		e.pos = e.previousWord()
+		return
+	case 'f', 'F':
+		e.pos = e.nextWord()
+		return
+	case '[', 'O':
+	default:
+		return
+	}
+	// CSI: parameters followed by a final character in the range '@' to '~'
+	var params strings.Builder
+	for {
+		if r, _, err = e.in.ReadRune(); err != nil {
+			return
+		}
+		if r >= '@' && r <= '~' {
+			break
+		}
+		params.WriteRune(r)
+	}
+	switch {
+	case r == 'A':
+		e.recallEntry(e.recall - 1)
+	case r == 'B':
+		e.recallEntry(e.recall + 1)
+	case r == 'D':
+		e.pos = maxInt(e.pos-1, 0)
+	case r == 'C':
+		e.pos = minInt(e.pos+1, len(e.line))
+	case r == 'H', r == '~' && (params.String() == "1" || params.String() == "7"):
+		e.pos = 0
+	case r == 'F', r == '~' && (params.String() == "4" || params.String() == "8"):
+		e.pos = len(e.line)
+	case r == '~' && params.String() == "3":
+		e.deleteChars(e.pos, minInt(e.pos+1, len(e.line)))
+	}
+}
+
+/*
+ Finishes the line and returns it.
+*/
+func (e *LineEditor) enter() string {
+	io.WriteString(e.out, "\n")
+	e.column = 0
+	return string(e.line)
+}
+
+/*
+ Inserts the runes at the cursor position.
+*/
+func (e *LineEditor) insert(runes []rune) {
+	line := make([]rune, 0, len(e.line)+len(runes))
+	line = append(line, e.line[:e.pos]...)
+	line = append(line, runes...)
+	e.line = append(line, e.line[e.pos:]...)
+	e.pos += len(runes)
+}
+
+/*
+ Deletes the characters from 'start' (inclusive) to 'end' (exclusive), leaving the cursor at 'start'.
+*/
+func (e *LineEditor) deleteChars(start, end int) {
+	if start >= end {
+		return
+	}
+	e.line = append(e.line[:start], e.line[end:]...)
+	e.pos = start
+}
+
+/*
+ Deletes the characters from 'start' to 'end', and stores them for Ctrl-Y.
+*/
+func (e *LineEditor) kill(start, end int) {
+	if start >= end {
+		return
+	}
+	e.killed = append([]rune(nil), e.line[start:end]...)
+	e.deleteChars(start, end)
+}
+
+/*
+ Returns the start of the word before the cursor.
+*/
+func (e *LineEditor) previousWord() int {
+	pos := e.pos
+	for pos > 0 && unicode.IsSpace(e.line[pos-1]) {
+		pos--
+	}
+	for pos > 0 && !unicode.IsSpace(e.line[pos-1]) {
+		pos--
+	}
+	return pos
+}
+
+/*
+ Returns the end of the word after the cursor.
+*/
+func (e *LineEditor) nextWord() int {
+	pos := e.pos
+	for pos < len(e.line) && unicode.IsSpace(e.line[pos]) {
+		pos++
+	}
+	for pos < len(e.line) && !unicode.IsSpace(e.line[pos]) {
+		pos++
+	}
+	return pos
+}
+
+/*
+ Redraws the prompt and the line, and positions the cursor.
+ Anything written before the prompt (e.g. a question) is left on the screen.
+*/
+func (e *LineEditor) refresh(prompt string) {
+	var sb strings.Builder
+	if e.column > 0 {
+		fmt.Fprintf(&sb, "\x1b[%dD", e.column)
+	}
+	sb.WriteString(prompt)
+	sb.WriteString(string(e.line))
+	sb.WriteString("\x1b[K") // erase the rest of the screen line
+	if n := len(e.line) - e.pos; n > 0 {
+		fmt.Fprintf(&sb, "\x1b[%dD", n)
+	}
+	io.WriteString(e.out, sb.String())
+	e.column = utf8.RuneCountInString(prompt) + e.pos
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,148 @@
+package terminal
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReadLine(t *testing.T) {
+	data := []struct {
+		input    string
+		expected string
+	}{
+		{"abc\r", "abc"},
+		{"abc\n", "abc"},
+		{"abc", "abc"},
+		{"abc\x02\x02X\r", "aXbc"},             // Ctrl-B
+		{"abc\x1b[D\x1b[DX\r", "aXbc"},         // left arrow
+		{"abc\x01X\x05Y\r", "XabcY"},           // Ctrl-A, Ctrl-E
+		{"abc\x1b[H\x1b[C\x1b[3~\r", "ac"},     // Home, right arrow, Delete
+		{"abc\x7f\x08d\r", "ad"},               // Backspace, Ctrl-H
+		{"abc\x02\x02\x04\r", "ac"},            // Ctrl-D
+		{"abc def\x1bb\x0b\r", "abc "},         // Alt-B, Ctrl-K
+		{"abc def\x1bb\x15\r", "def"},          // Ctrl-U
+		{"abc def  \x17\r", "abc "},            // Ctrl-W
+		{"abc def\x17\x01\x19 \r", "def abc "}, // Ctrl-Y
+		{"abc\x03def\r", "def"},                // Ctrl-C
+		{"äöü\x02ß\r", "äößü"},
+		{"a\x1b[1;5Cb\r", "ab"}, // unknown sequence
+	}
+	for i, test := range data {
+		t.Run(fmt.Sprintf("test %d: %q", i, test.input), func(t *testing.T) {
+			editor := NewLineEditor(strings.NewReader(test.input), io.Discard)
+			line, err := editor.ReadLine()
+			if err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			if line != test.expected {
+				t.Fatalf("expected %q, got %q", test.expected, line)
+			}
+		})
+	}
+}
+
+func TestReadLineEOF(t *testing.T) {
+	for _, input := range []string{"", "\x04"} {
+		editor := NewLineEditor(strings.NewReader(input), io.Discard)
+		if _, err := editor.ReadLine(); err != io.EOF {
+			t.Fatalf("input %q: expected EOF, got %v", input, err)
+		}
+	}
+}
+
+func TestReadLinePrompt(t *testing.T) {
+	var output strings.Builder
+	editor := NewLineEditor(strings.NewReader("ab\x02\r"), &output)
+	editor.SetPrompt(": ")
+	if _, err := editor.ReadLine(); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	expected := ": \x1b[K" + "\x1b[2D: a\x1b[K" + "\x1b[3D: ab\x1b[K" + "\x1b[4D: ab\x1b[K\x1b[1D" + "\n"
+	if output.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, output.String())
+	}
+	// the prompt is used for one line only
+	if editor.prompt != "" {
+		t.Fatalf("prompt not reset: %q", editor.prompt)
+	}
+}
+
+func TestLineEditorAsReader(t *testing.T) {
+	editor := NewLineEditor(strings.NewReader("a\r1\x7f2\rx\x04"), io.Discard)
+	reader := bufio.NewReader(editor)
+	for _, expected := range []string{"a\n", "2\n", "x\n"} {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("error: %s", err)
+		}
+		if line != expected {
+			t.Fatalf("expected %q, got %q", expected, line)
+		}
+	}
+}
+
+type testHistory []string
+
+func (h testHistory) Len() int           { return len(h) }
+func (h testHistory) Entry(i int) string { return h[i] }
+
+func TestHistoryRecall(t *testing.T) {
+	data := []struct {
+		input    string
+		expected string
+	}{
+		{"\x1b[A\r", "3p"},
+		{"\x1b[A\x1b[A\r", "s/a/b/"},
+		{"\x1b[A\x1b[A\x1b[A\x1b[A\x1b[A\r", "1,2p"}, // stops at the oldest entry
+		{"x\x1b[A\x1b[A\x1b[B\x1b[B\r", "x"},         // back to the new line
+		{"\x10\x10\x0e\r", "3p"},                     // Ctrl-P, Ctrl-N
+		{"\x1b[A\x7f4\r", "34"},                      // a recalled line can be edited
+		{"\x12a\r", "s/a/b/"},                        // Ctrl-R
+		{"\x12p\r", "3p"},                            // newest match first
+		{"\x12p\x12\r", "1,2p"},                      // Ctrl-R again: next older match
+		{"\x12s/a\x7f\x7f\x7f\x7f\x7fp\r", "3p"},     // Backspace
+		{"x\x12s/\x07\r", "x"},                       // Ctrl-G cancels
+		{"\x12s/\x1b[D\x1b[3~\r", "s/a/b"},           // a cursor key accepts the match, and is processed
+		{"\x12zzz\r", ""},                            // no match
+	}
+	for i, test := range data {
+		t.Run(fmt.Sprintf("test %d: %q", i, test.input), func(t *testing.T) {
+			editor := NewLineEditor(strings.NewReader(test.input), io.Discard)
+			editor.History = testHistory{"1,2p", "s/a/b/", "3p"}
+			line, err := editor.ReadLine()
+			if err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			if line != test.expected {
+				t.Fatalf("expected %q, got %q", test.expected, line)
+			}
+		})
+	}
+}
+
+func TestMore(t *testing.T) {
+	data := []struct {
+		input    string
+		expected int
+	}{
+		{" ", 20},
+		{"\r", 1},
+		{"q", 0},
+		{"\x03", 0},
+		{"x ", 20}, // other keys are ignored
+		{"", 0},
+	}
+	for _, test := range data {
+		var output strings.Builder
+		editor := NewLineEditor(strings.NewReader(test.input), &output)
+		if got := editor.More(20); got != test.expected {
+			t.Fatalf("input %q: expected %d, got %d", test.input, test.expected, got)
+		}
+		if output.String() != "--More--\r\x1b[K" {
+			t.Fatalf("input %q: wrong output %q", test.input, output.String())
+		}
+	}
+}
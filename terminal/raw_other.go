@@ -0,0 +1,18 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd
+
+package terminal
+
+import "errors"
+
+/*
+IsTerminal returns true if the file descriptor refers to a terminal.
+ Terminals are not supported on this platform.
+*/
+func IsTerminal(fd uintptr) bool {
+	return false
+}
+
+func makeRaw(fd uintptr) (restore func(), err error) {
+	return nil, errors.New("raw mode not supported")
+}
@@ -0,0 +1,20 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd
+
+package red
+
+import "os"
+
+/*
+ The terminal size cannot be queried on this platform.
+*/
+func terminalRows(f *os.File) (int, bool) {
+	return 0, false
+}
+
+/*
+ Resizing is not signalled on this platform.
+*/
+func notifyWindowResize(resized func()) (stop func()) {
+	return func() {}
+}
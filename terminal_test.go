@@ -0,0 +1,54 @@
+package red
+
+import (
+	"os"
+	"testing"
+)
+
+func TestTerminalWindowSize(t *testing.T) {
+	defer os.Setenv("LINES", os.Getenv("LINES"))
+
+	data := []struct {
+		lines              string
+		expectedWindowSize int
+	}{
+		{"40", 38},
+		{"", defaultWindowSize},
+		{"xyz", defaultWindowSize},
+		{"2", defaultWindowSize},
+	}
+	for _, test := range data {
+		os.Setenv("LINES", test.lines)
+		assertInt(t, "LINES="+test.lines, TerminalWindowSize(), test.expectedWindowSize)
+	}
+}
+
+func TestTerminalRowsOfFile(t *testing.T) {
+	f, err := os.CreateTemp("", "red-terminal")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if _, ok := terminalRows(f); ok {
+		t.Fatalf("a regular file is not a terminal")
+	}
+}
+
+func TestResizeWindow(t *testing.T) {
+	state := resetState([]string{})
+	state.WindowSize = 20
+	stop := HandleWindowResize(state)
+	defer stop()
+
+	state.resizeWindow(30)
+	assertInt(t, "window size not resized", state.WindowSize, 30)
+	// set by the user: no longer follows the terminal
+	state.WindowSize = 5
+	state.resizeWindow(40)
+	assertInt(t, "window size set by the user was changed", state.WindowSize, 5)
+	// ... until set to the terminal size again
+	state.WindowSize = 40
+	state.resizeWindow(50)
+	assertInt(t, "window size not resized", state.WindowSize, 50)
+}
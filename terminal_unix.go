@@ -0,0 +1,52 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+// +build linux darwin freebsd netbsd openbsd
+
+package red
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"unsafe"
+)
+
+// the structure returned by the TIOCGWINSZ ioctl
+type winsize struct {
+	rows, cols, xpixel, ypixel uint16
+}
+
+/*
+ Returns the number of rows of the terminal associated with the given file.
+ Returns false if the file is not a terminal.
+*/
+func terminalRows(f *os.File) (int, bool) {
+	var ws winsize
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), uintptr(syscall.TIOCGWINSZ), uintptr(unsafe.Pointer(&ws)))
+	if errno != 0 || ws.rows == 0 {
+		return 0, false
+	}
+	return int(ws.rows), true
+}
+
+/*
+ Calls 'resized' whenever the terminal is resized (SIGWINCH). Returns a function which stops this.
+*/
+func notifyWindowResize(resized func()) (stop func()) {
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(signals, syscall.SIGWINCH)
+	go func() {
+		for {
+			select {
+			case <-signals:
+				resized()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
@@ -0,0 +1,33 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+// +build linux darwin freebsd netbsd openbsd
+
+package red
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestHandleWindowResizeSignal(t *testing.T) {
+	defer os.Setenv("LINES", os.Getenv("LINES"))
+	os.Setenv("LINES", "30")
+	state := resetState([]string{})
+	state.WindowSize = TerminalWindowSize()
+	stop := HandleWindowResize(state)
+	defer stop()
+
+	os.Setenv("LINES", "50")
+	syscall.Kill(os.Getpid(), syscall.SIGWINCH)
+	for i := 0; i < 100; i++ {
+		state.commandMutex.Lock()
+		windowSize := state.WindowSize
+		state.commandMutex.Unlock()
+		if windowSize == 48 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("window size not changed after SIGWINCH")
+}
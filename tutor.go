@@ -0,0 +1,179 @@
+package red
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var errNotAllowedInTutor error = errors.New("command cannot be used in the tutorial")
+
+// the practice buffer for the tutorial
+var tutorPracticeBuffer = []string{
+	"Welcome to the red tutorial.",
+	"This buffer is just for practice: nothing you do here is saved.",
+	"the quick brown fox",
+	"jumps over the lazy dog",
+	"This line has a mistake in it: teh.",
+	"This line should be deleted.",
+	"The end.",
+}
+
+/*
+tutorLesson is one step of the tutorial.
+*/
+type tutorLesson struct {
+	text  string                               // the instructions
+	hint  string                               // shown if the command entered did not complete the lesson
+	check func(cmd Command, state *State) bool // returns true if the command (with resolved addresses) completed the lesson
+}
+
+var tutorLessons = []tutorLesson{
+	{
+		text: "Every command works on a range of lines, given by addresses in front of the command.\n" +
+			"The address ',' means the whole buffer. Print the whole buffer: enter ,p",
+		hint: "enter ,p (a comma followed by p)",
+		check: func(cmd Command, state *State) bool {
+			return isPrintCommand(cmd) && cmd.resolved.start == 1 && cmd.resolved.end == state.Buffer.Len()
+		},
+	},
+	{
+		text: "An address on its own moves to that line and prints it. Go to line 3: enter 3",
+		hint: "enter 3",
+		check: func(cmd Command, state *State) bool {
+			return isPrintCommand(cmd) && cmd.resolved.start == 3 && cmd.resolved.end == 3
+		},
+	},
+	{
+		text: "The command 'n' prints lines together with their line numbers.\n" +
+			"Print lines 3 to 4 with line numbers: enter 3,4n",
+		hint: "enter 3,4n",
+		check: func(cmd Command, state *State) bool {
+			return cmd.cmd == commandNumber && cmd.resolved.start == 3 && cmd.resolved.end == 4
+		},
+	},
+	{
+		text: "A regular expression between slashes finds the next line which matches.\n" +
+			"Find the line containing 'lazy': enter /lazy/",
+		hint: "enter /lazy/",
+		check: func(cmd Command, state *State) bool {
+			return isPrintCommand(cmd) && strings.HasPrefix(cmd.parsedAddrString, identRegexForward) && state.lineNbr == 4
+		},
+	},
+	{
+		text: "The command 's/old/new/' substitutes text. Line 5 contains a typo.\n" +
+			"Replace 'teh' with 'the' in line 5: enter 5s/teh/the/",
+		hint: "enter 5s/teh/the/",
+		check: func(cmd Command, state *State) bool {
+			return tutorLineEquals(state, 5, "This line has a mistake in it: the.")
+		},
+	},
+	{
+		text: "The command 'd' deletes lines. Delete line 6: enter 6d",
+		hint: "enter 6d",
+		check: func(cmd Command, state *State) bool {
+			return state.Buffer.Len() == len(tutorPracticeBuffer)-1 && tutorLineEquals(state, 6, "The end.")
+		},
+	},
+	{
+		text: "The command 'u' undoes the last change. Bring back the deleted line: enter u",
+		hint: "enter u",
+		check: func(cmd Command, state *State) bool {
+			return cmd.cmd == commandUndo && tutorLineEquals(state, 6, "This line should be deleted.")
+		},
+	},
+}
+
+/*
+ Returns true if the given line exists and has the expected contents.
+*/
+func tutorLineEquals(state *State, lineNbr int, expected string) bool {
+	line, err := state.Buffer.Get(lineNbr)
+	return err == nil && line.Line == expected+"\n"
+}
+
+/*
+Tutor walks the user through the basic commands, lesson by lesson,
+checking each command entered.
+*/
+type Tutor struct {
+	lessonNbr int // the current lesson, zero-based
+}
+
+/*
+NewTutor creates a tutor, together with a state containing the practice buffer.
+*/
+func NewTutor() (*Tutor, *State) {
+	state := NewState()
+	lines := list.New()
+	for _, line := range tutorPracticeBuffer {
+		lines.PushBack(Line{line + "\n"})
+	}
+	state.Buffer = newBufferOf(lines)
+	// start at the end of the buffer, like after reading a file
+	_ = moveToLine(state.Buffer.Len(), state)
+	return &Tutor{}, state
+}
+
+/*
+Done returns true if all lessons have been completed.
+*/
+func (t *Tutor) Done() bool {
+	return t.lessonNbr >= len(tutorLessons)
+}
+
+/*
+Lesson returns the instructions for the current lesson.
+*/
+func (t *Tutor) Lesson() string {
+	if t.Done() {
+		return "Congratulations, you have completed the tutorial!"
+	}
+	return fmt.Sprintf("[%d/%d] %s", t.lessonNbr+1, len(tutorLessons), tutorLessons[t.lessonNbr].text)
+}
+
+/*
+Hint returns the hint for the current lesson.
+*/
+func (t *Tutor) Hint() string {
+	if t.Done() {
+		return ""
+	}
+	return "Not quite: " + tutorLessons[t.lessonNbr].hint
+}
+
+/*
+Execute processes the given command line and checks whether it completed the current lesson,
+in which case the tutor moves on to the next lesson.
+
+ Returns TRUE if the lesson was completed.
+ Returns TRUE for 'quit' if the user wants to leave the tutorial.
+ Commands which access files or run shell commands are not allowed.
+*/
+func (t *Tutor) Execute(state *State, cmdLine string) (completed bool, quit bool, err error) {
+	cmd, err := ParseCommand(cmdLine, state.Debug)
+	if err != nil {
+		return false, false, err
+	}
+	switch cmd.cmd {
+	case commandQuit, commandQuitUnconditionally:
+		// the practice buffer is never saved, so no need to check for changes
+		return false, true, nil
+	case commandEdit, commandEditUnconditionally, commandNextFile, commandPreviousFile, commandOpenBuffer,
+		commandRead, commandDiff, commandRevert, commandWrite, commandWriteAppend, commandWriteQuit, commandWriteAppendQuit, commandShell, commandExtension:
+		return false, false, errNotAllowedInTutor
+	}
+	// resolve the addresses now, so that they can be checked afterwards
+	if err = cmd.resolveAddress(state); err != nil {
+		return false, false, err
+	}
+	if _, err = cmd.ProcessCommand(state, nil, false); err != nil {
+		return false, false, err
+	}
+	if t.Done() || !tutorLessons[t.lessonNbr].check(cmd, state) {
+		return false, false, nil
+	}
+	t.lessonNbr++
+	return true, false, nil
+}
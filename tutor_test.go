@@ -0,0 +1,46 @@
+package red
+
+import (
+	"testing"
+)
+
+func TestTutor(t *testing.T) {
+	tutor, state := NewTutor()
+	commands := []string{",p", "3", "3,4n", "/lazy/", "5s/teh/the/", "6d", "u"}
+	assertInt(t, "wrong number of lessons", len(commands), len(tutorLessons))
+	for i, cmdLine := range commands {
+		if tutor.Done() {
+			t.Fatalf("tutor finished too early, at command %d", i)
+		}
+		completed, quit, err := tutor.Execute(state, cmdLine)
+		if err != nil {
+			t.Fatalf("command '%s': error: %s", cmdLine, err)
+		}
+		if !completed || quit {
+			t.Fatalf("command '%s': expected lesson %d to be completed", cmdLine, i+1)
+		}
+	}
+	if !tutor.Done() {
+		t.Fatalf("expected tutor to be finished")
+	}
+}
+
+func TestTutorLessonNotCompleted(t *testing.T) {
+	tutor, state := NewTutor()
+	// wrong range for the first lesson
+	completed, _, err := tutor.Execute(state, "1,2p")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if completed {
+		t.Fatalf("lesson should not have been completed")
+	}
+	assertString(t, "wrong hint", tutor.Hint(), "Not quite: enter ,p (a comma followed by p)")
+
+	if _, _, err = tutor.Execute(state, "w somefile"); err == nil {
+		t.Fatalf("expected error for write command")
+	}
+	if _, quit, _ := tutor.Execute(state, "q"); !quit {
+		t.Fatalf("expected quit")
+	}
+}
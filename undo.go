@@ -0,0 +1,138 @@
+package red
+
+import (
+	"container/list"
+	"fmt"
+)
+
+/*
+undoTransaction stores the undo commands for all changes made by one command,
+in the order in which the changes were made. They are undone in reverse order.
+
+ A command such as 'g' (or 'u' itself) executes further commands;
+ the changes made by these commands all belong to the transaction of the enclosing command.
+*/
+type undoTransaction struct {
+	undos     *list.List // list of Undo
+	lineNbr   int        // the current line before the command was executed
+	cutBuffer *list.List // the cut buffer after the command was executed (restored by a 'redo')
+	keepRedo  bool       // if set, the redo list is not cleared when storing this transaction (i.e. for a 'redo')
+}
+
+/*
+ Starts a new undo transaction, which will collect the undo commands of the current command.
+*/
+func (state *State) beginUndoTransaction() {
+	state.currentUndo = &undoTransaction{undos: list.New(), lineNbr: state.lineNbr}
+}
+
+/*
+ Ends the current undo transaction. If the command changed anything, the transaction is stored in the undo list,
+ and the redo list is cleared (unless the command was a redo).
+
+ In 'UndoToggle' mode only the most recent transaction is kept.
+*/
+func (state *State) endUndoTransaction() {
+	transaction := state.currentUndo
+	state.currentUndo = nil
+	if transaction == nil || transaction.undos.Len() == 0 {
+		return
+	}
+	transaction.cutBuffer = state.CutBuffer
+	if state.UndoToggle {
+		state.undo.Init()
+	}
+	state.undo.PushFront(transaction)
+	if !transaction.keepRedo {
+		state.redo.Init()
+	}
+}
+
+/*
+ Stores the changes collected so far in the current undo transaction (i.e. those made by an undo) in the redo list,
+ together with the cut buffer as it was after the command which has been undone.
+ The current transaction is then empty.
+*/
+func (state *State) moveCurrentUndoToRedo(cutBuffer *list.List) {
+	if state.currentUndo.undos.Len() == 0 {
+		return
+	}
+	state.redo.PushFront(&undoTransaction{undos: state.currentUndo.undos, lineNbr: state.currentUndo.lineNbr, cutBuffer: cutBuffer})
+	state.currentUndo.undos = list.New()
+}
+
+/*
+ Adds an undo command to the current undo transaction.
+ If there is no current transaction (i.e. the command was not called via ProcessCommand),
+ the undo command is stored as a transaction of its own.
+
+ The text is copied, since lists such as the cut buffer may be changed later on.
+*/
+func (state *State) addUndo(start, end int, command string, text *list.List) {
+	state.addUndoWithMarks(start, end, command, text, nil)
+}
+
+/*
+ As addUndo, for a change which removed marks (e.g. a delete): the marks are set again once the change has been undone.
+*/
+func (state *State) addUndoWithMarks(start, end int, command string, text *list.List, marks map[string]int) {
+	var textCopy *list.List
+	if text != nil {
+		textCopy = list.New()
+		textCopy.PushBackList(text)
+	}
+	startAddr := newAbsoluteAddress(start)
+	endAddr := newAbsoluteAddress(end)
+	state.pushUndo(Undo{cmd: Command{addrRange: AddressRange{startAddr, endAddr, separatorComma}, cmd: command, restOfCmd: ""}, text: textCopy, marks: marks})
+}
+
+/*
+ Adds a list of undo commands (e.g. one for each line changed by a substitution) to the current undo transaction.
+ If there is no current transaction, the undo commands are stored together as a new transaction.
+*/
+func (state *State) addUndoList(undoList *list.List) {
+	if state.currentUndo == nil {
+		state.beginUndoTransaction()
+		defer state.endUndoTransaction()
+	}
+	for el := undoList.Front(); el != nil; el = el.Next() {
+		state.pushUndo(el.Value.(Undo))
+	}
+}
+
+func (state *State) pushUndo(undo Undo) {
+	if state.Debug {
+		fmt.Fprintln(state.Stdout, "added undo:", undo)
+	}
+	if state.currentUndo == nil {
+		state.beginUndoTransaction()
+		defer state.endUndoTransaction()
+	}
+	state.currentUndo.undos.PushBack(undo)
+}
+
+/*
+ Undoes the changes stored in the transaction, in reverse order.
+ Any changes made are recorded in the current undo transaction, and any marks removed by a change are set again.
+
+ The current line is restored to its value before the original command.
+ The commands executed here (e.g. a 'd') would overwrite the cut buffer, therefore it is saved beforehand and restored afterwards.
+*/
+func (transaction *undoTransaction) apply(state *State) error {
+	savedCutBuffer := state.CutBuffer
+	defer func() { state.CutBuffer = savedCutBuffer }()
+
+	for el := transaction.undos.Back(); el != nil; el = el.Prev() {
+		undo := el.Value.(Undo)
+		if state.Debug {
+			fmt.Fprintln(state.Stdout, undo.cmd)
+		}
+		if _, err := undo.cmd.ProcessCommand(state, undo.text, false); err != nil {
+			return fmt.Errorf("undo: %w", err)
+		}
+		for name, lineNbr := range undo.marks {
+			state.addMark(name, lineNbr)
+		}
+	}
+	return moveToLine(minIntOf(transaction.lineNbr, state.Buffer.Len()), state)
+}
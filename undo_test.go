@@ -0,0 +1,213 @@
+package red
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+/*
+ Processes the given command line via ProcessCommand.
+*/
+func processCommandLine(t *testing.T, state *State, cmdLine string) error {
+	t.Helper()
+	cmd, err := ParseCommand(cmdLine, false)
+	if err != nil {
+		t.Fatalf("command '%s': error: %s", cmdLine, err)
+	}
+	_, err = cmd.ProcessCommand(state, nil, false)
+	return err
+}
+
+func TestUndo(t *testing.T) {
+	inputFile, err := os.CreateTemp("", "red-undo")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.Remove(inputFile.Name())
+	if _, err = inputFile.WriteString("r1\nr2\n"); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	inputFile.Close()
+
+	data := [][]string{
+		{"2d"},
+		{"5d"},
+		{"4,5d"},
+		{"1,$d"},
+		{"2,3j"},
+		{"1,5j"},
+		{"1,2m4"},
+		{"4,5m0"},
+		{"5m0"},
+		{"2,3m$"},
+		{"1,2t5"},
+		{"3t0"},
+		{"r " + inputFile.Name()},
+		{"0r " + inputFile.Name()},
+		{"2y", "4x"},
+		{"1,$s/[0-9]/x/"},
+		{"2,4A/!/"},
+		{"1,$N"},
+		{"g/[24]/d"},
+		{"g/./m0"},
+		{"v/3/s/^/!/"},
+		{"g/3/a\\\nnew1\\\nnew2"},
+		{"g/[15]/i\\\nnew"},
+		{"g/[35]/c\\\nnew"},
+		{"g/[24]/s/[0-9]/x/\\\n-1d"},
+	}
+	for i, cmds := range data {
+		t.Run(fmt.Sprintf("test %d: >>%s<<", i, strings.Join(cmds, ";")), func(t *testing.T) {
+			state := resetState([]string{"1", "2", "3", "4", "5"})
+			state.CheckState = true
+			if err := moveToLine(2, state); err != nil {
+				t.Fatalf("error: %s", err)
+			}
+			for _, cmdLine := range cmds {
+				if err := processCommandLine(t, state, cmdLine); err != nil {
+					t.Fatalf("command '%s': error: %s", cmdLine, err)
+				}
+			}
+			if err := processCommandLine(t, state, commandUndo); err != nil {
+				t.Fatalf("undo: error: %s", err)
+			}
+			assertBufferContents(t, state.Buffer, "1\n2\n3\n4\n5\n")
+			assertInt(t, "wrong state.lineNbr!", state.lineNbr, 2)
+		})
+	}
+}
+
+func TestUndoMultiStep(t *testing.T) {
+	state := resetState([]string{"1", "2", "3", "4", "5"})
+	state.CheckState = true
+	if err := moveToLine(5, state); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	steps := []struct {
+		cmd      string
+		expected string
+	}{
+		{"1d", "2\n3\n4\n5\n"},
+		{"p", "2\n3\n4\n5\n"}, // does not change the buffer, therefore not undone
+		{"1,2m$", "4\n5\n2\n3\n"},
+		{"g/[23]/s/^/x/", "4\n5\nx2\nx3\n"},
+		{"1,2j", "45\nx2\nx3\n"},
+	}
+	for _, step := range steps {
+		if err := processCommandLine(t, state, step.cmd); err != nil {
+			t.Fatalf("command '%s': error: %s", step.cmd, err)
+		}
+		assertBufferContents(t, state.Buffer, step.expected)
+	}
+	// undo the steps one at a time
+	for i := len(steps) - 2; i >= 0; i-- {
+		if steps[i+1].cmd == "p" {
+			continue
+		}
+		if err := processCommandLine(t, state, commandUndo); err != nil {
+			t.Fatalf("undo: error: %s", err)
+		}
+		assertBufferContents(t, state.Buffer, steps[i].expected)
+	}
+	if err := processCommandLine(t, state, commandUndo); err != nil {
+		t.Fatalf("undo: error: %s", err)
+	}
+	assertBufferContents(t, state.Buffer, "1\n2\n3\n4\n5\n")
+	assertInt(t, "wrong state.lineNbr!", state.lineNbr, 5)
+
+	if err := processCommandLine(t, state, commandUndo); !errors.Is(err, ErrNothingToUndo) {
+		t.Fatalf("expected error '%s', got: %v", ErrNothingToUndo, err)
+	}
+}
+
+func TestUndoToggle(t *testing.T) {
+	state := resetState([]string{"1", "2", "3"})
+	state.UndoToggle = true
+	state.CheckState = true
+	for _, cmdLine := range []string{"1d", "1d"} {
+		if err := processCommandLine(t, state, cmdLine); err != nil {
+			t.Fatalf("command '%s': error: %s", cmdLine, err)
+		}
+	}
+	assertBufferContents(t, state.Buffer, "3\n")
+	// 'u' undoes the last command, a further 'u' undoes the undo
+	for _, expected := range []string{"2\n3\n", "3\n", "2\n3\n"} {
+		if err := processCommandLine(t, state, commandUndo); err != nil {
+			t.Fatalf("undo: error: %s", err)
+		}
+		assertBufferContents(t, state.Buffer, expected)
+	}
+	assertInt(t, "wrong undo len", state.undo.Len(), 1)
+}
+
+func TestRedo(t *testing.T) {
+	state := resetState([]string{"1", "2", "3"})
+	state.CheckState = true
+	if err := moveToLine(3, state); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	steps := []struct {
+		cmd               string
+		expected          string
+		expectedLineNbr   int
+		expectedCutBuffer string
+	}{
+		{"1d", "2\n3\n", 1, "1\n"},
+		{"$t0", "3\n2\n3\n", 1, "1\n"},
+		{"u", "2\n3\n", 1, "1\n"},
+		{"u", "1\n2\n3\n", 3, "1\n"},
+		{"2y", "1\n2\n3\n", 3, "2\n"}, // does not clear the redo list
+		{"U", "2\n3\n", 1, "1\n"},     // the cut buffer is set as after the original 'd'
+		{"U", "3\n2\n3\n", 1, "1\n"},
+		{"u", "2\n3\n", 1, "1\n"},
+		{"p", "2\n3\n", 1, "1\n"}, // does not clear the redo list
+		{"U", "3\n2\n3\n", 1, "1\n"},
+		{"u", "2\n3\n", 1, "1\n"},
+		{"2s/3/x/", "2\nx\n", 2, "1\n"}, // clears the redo list
+		{"u", "2\n3\n", 1, "1\n"},
+		{"U", "2\nx\n", 2, "1\n"},
+	}
+	for _, step := range steps {
+		if err := processCommandLine(t, state, step.cmd); err != nil {
+			t.Fatalf("command '%s': error: %s", step.cmd, err)
+		}
+		assertBufferContents(t, state.Buffer, step.expected)
+		assertInt(t, fmt.Sprintf("command '%s': wrong state.lineNbr!", step.cmd), state.lineNbr, step.expectedLineNbr)
+		assertListContents(t, state.CutBuffer, step.expectedCutBuffer)
+	}
+	if err := processCommandLine(t, state, commandRedo); !errors.Is(err, ErrNothingToRedo) {
+		t.Fatalf("expected error '%s', got: %v", ErrNothingToRedo, err)
+	}
+	// the redo list was cleared by the substitution
+	for _, cmdLine := range []string{"u", "u"} {
+		if err := processCommandLine(t, state, cmdLine); err != nil {
+			t.Fatalf("command '%s': error: %s", cmdLine, err)
+		}
+	}
+	assertBufferContents(t, state.Buffer, "1\n2\n3\n")
+	for _, expected := range []string{"2\n3\n", "2\nx\n"} {
+		if err := processCommandLine(t, state, commandRedo); err != nil {
+			t.Fatalf("redo: error: %s", err)
+		}
+		assertBufferContents(t, state.Buffer, expected)
+	}
+	if err := processCommandLine(t, state, commandRedo); !errors.Is(err, ErrNothingToRedo) {
+		t.Fatalf("expected error '%s', got: %v", ErrNothingToRedo, err)
+	}
+}
+
+func TestRedoInToggleMode(t *testing.T) {
+	state := resetState([]string{"1", "2"})
+	state.UndoToggle = true
+	for _, cmdLine := range []string{"1d", "u"} {
+		if err := processCommandLine(t, state, cmdLine); err != nil {
+			t.Fatalf("command '%s': error: %s", cmdLine, err)
+		}
+	}
+	if err := processCommandLine(t, state, commandRedo); !errors.Is(err, ErrNothingToRedo) {
+		t.Fatalf("expected error '%s', got: %v", ErrNothingToRedo, err)
+	}
+}
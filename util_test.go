@@ -20,6 +20,13 @@ func createListOfLines(lines []string) *list.List {
 	return listOfLines
 }
 
+/*
+Creates a Buffer containing the given lines.
+*/
+func createBuffer(lines []string) Buffer {
+	return newBufferOf(createListOfLines(lines))
+}
+
 /*
 Creates a Command object from the given parameters AND resolves the address range with the given state.
 */
@@ -32,12 +39,12 @@ func createCommandAndResolveAddressRange(state *State, ra AddressRange, cmdIdent
 /*
 Checks the buffer contents against the expected string, returns non-nil if they didn't match.
 */
-func checkBufferContents(buffer *list.List, expected string) error {
+func checkBufferContents(buffer Buffer, expected string) error {
 	var err error
 	var buff bytes.Buffer               // implements io.Writer
 	var writer = bufio.NewWriter(&buff) // -> bufio
 
-	if _, err = WriteWriter(writer, buffer.Front(), 1, buffer.Len()); err != nil {
+	if _, err = WriteWriter(writer, buffer, 1, buffer.Len()); err != nil {
 		return fmt.Errorf("error: %w", err)
 	}
 	if buff.String() != expected {
@@ -48,7 +55,7 @@ func checkBufferContents(buffer *list.List, expected string) error {
 
 func resetState(buffer []string) *State {
 	state := NewState()
-	state.Buffer = createListOfLines(buffer)
+	state.Buffer = createBuffer(buffer)
 	return state
 }
 
@@ -64,8 +71,12 @@ func assertString(t *testing.T, errorText string, val, expected string) {
 	}
 }
 
-func assertBufferContents(t *testing.T, buffer *list.List, expected string) {
+func assertBufferContents(t *testing.T, buffer Buffer, expected string) {
 	if err := checkBufferContents(buffer, expected); err != nil {
 		t.Fatalf("error: %s", err)
 	}
 }
+
+func assertListContents(t *testing.T, lines *list.List, expected string) {
+	assertBufferContents(t, newBufferOf(lines), expected)
+}